@@ -0,0 +1,157 @@
+// Package oneshot implements the single-purpose send and receive modes:
+// a tiny server that exposes exactly one item (or one upload form) behind an
+// unguessable URL and shuts itself down once the transfer is done.
+package oneshot
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/beam/server"
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/qr"
+)
+
+// maxPINAttempts is the number of wrong PINs tolerated before the session
+// is closed, which keeps short PINs from being brute forced
+const maxPINAttempts = 5
+
+var (
+	ErrTimeout         = errors.New("timed out")
+	ErrInterrupted     = errors.New("interrupted")
+	ErrTooManyAttempts = errors.New("too many wrong PIN attempts")
+)
+
+// newToken returns a random URL-safe token with 192 bits of entropy
+func newToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func tokenMatches(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// pinGate checks PINs and counts failures
+type pinGate struct {
+	pin      string
+	failures int
+}
+
+// check reports whether the supplied pin is correct and whether the session
+// should be aborted because of too many failures. Callers must serialize.
+func (g *pinGate) check(supplied string) (ok bool, locked bool) {
+	if g.pin == "" {
+		return true, false
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(supplied)), []byte(g.pin)) == 1 {
+		return true, false
+	}
+	g.failures++
+	return false, g.failures >= maxPINAttempts
+}
+
+// session is the plumbing shared by send and receive: a listener, an HTTP
+// server and a channel that is closed when the work is done
+type session struct {
+	url      string
+	listener net.Listener
+	srv      *http.Server
+	finished chan error
+}
+
+func newSession(port int, urlPath string, handler http.Handler) (*session, error) {
+	if port == 0 {
+		p, err := config.FindAvailablePort()
+		if err != nil {
+			return nil, err
+		}
+		port = p
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+
+	return &session{
+		url:      fmt.Sprintf("http://%s:%d%s", server.GetLocalIP(), port, urlPath),
+		listener: ln,
+		srv:      &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second},
+		finished: make(chan error, 1),
+	}, nil
+}
+
+// finish ends the session with the given result; only the first call counts
+func (s *session) finish(err error) {
+	select {
+	case s.finished <- err:
+	default:
+	}
+}
+
+// run serves until the session finishes, the timeout expires or the user
+// presses Ctrl+C, then shuts the server down gracefully
+func (s *session) run(noQR bool, timeout time.Duration) error {
+	if !noQR {
+		qr.ShowQrCode(s.url)
+	}
+	logger.Info("Open %s on the other device", s.url)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.srv.Serve(s.listener)
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	var result error
+	select {
+	case result = <-s.finished:
+	case <-expired:
+		result = ErrTimeout
+	case <-interrupt:
+		result = ErrInterrupted
+	case err := <-serveErr:
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.srv.Shutdown(ctx); err != nil {
+		logger.Warn("Failed to shut down cleanly: %v", err)
+	}
+	return result
+}
+
+// clientIP strips the port from a request's remote address
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
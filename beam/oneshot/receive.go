@@ -0,0 +1,392 @@
+package oneshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/beam/server/handlers"
+	"github.com/tachRoutine/beamdrop-go/pkg/clamd"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"github.com/tachRoutine/beamdrop-go/pkg/styles"
+)
+
+// ReceiveOptions configures a one-shot receive
+type ReceiveOptions struct {
+	Dir        string
+	Port       int
+	PIN        string
+	MaxUploads int           // files after which the server exits, 0 means unlimited
+	MaxBytes   int64         // maximum size of a single upload request, 0 means unlimited
+	Timeout    time.Duration // 0 means no timeout
+	NoQR       bool
+	// Clamd scans every upload while it's received when set. Infected
+	// uploads and those it can't scan are refused; there's no quarantine.
+	Clamd *clamd.Client
+}
+
+// Received records one file that was stored
+type Received struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Bytes      int64     `json:"bytes"`
+	RemoteAddr string    `json:"remoteAddr"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// ReceiveReceipt summarizes a finished receive session
+type ReceiveReceipt struct {
+	Dir   string     `json:"dir"`
+	URL   string     `json:"url"`
+	Files []Received `json:"files"`
+	Ended string     `json:"ended"`
+	// Reason is why the session ended, nil when the upload limit was reached
+	Reason error `json:"-"`
+}
+
+type receiver struct {
+	opts  ReceiveOptions
+	token string
+	fs    *sandbox.FS // opts.Dir
+
+	mu       sync.Mutex
+	gate     pinGate
+	files    []Received
+	accepted int // upload slots claimed, including uploads in progress
+	stopping bool
+	session  *session
+}
+
+// Receive serves an upload-only page and stores uploaded files in
+// opts.Dir until the upload limit or the timeout is reached
+func Receive(opts ReceiveOptions) (ReceiveReceipt, error) {
+	abs, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return ReceiveReceipt{}, err
+	}
+	if info, err := os.Stat(abs); err != nil {
+		return ReceiveReceipt{}, err
+	} else if !info.IsDir() {
+		return ReceiveReceipt{}, fmt.Errorf("%s is not a directory", abs)
+	}
+	token, err := newToken()
+	if err != nil {
+		return ReceiveReceipt{}, err
+	}
+
+	fs, err := sandbox.New(abs, sandbox.DefaultSymlinkPolicy)
+	if err != nil {
+		return ReceiveReceipt{}, err
+	}
+	defer fs.Close()
+
+	rc := &receiver{opts: opts, token: token, fs: fs, gate: pinGate{pin: opts.PIN}}
+	rc.opts.Dir = abs
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /r/{token}", rc.page)
+	mux.HandleFunc("POST /r/{token}", rc.upload)
+
+	rc.session, err = newSession(opts.Port, "/r/"+token, mux)
+	if err != nil {
+		return ReceiveReceipt{}, err
+	}
+
+	logger.Info("Receiving files into %s", abs)
+	reason := rc.session.run(opts.NoQR, opts.Timeout)
+
+	ended := "upload limit reached"
+	if reason != nil {
+		ended = reason.Error()
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return ReceiveReceipt{
+		Dir:    abs,
+		URL:    rc.session.url,
+		Files:  append([]Received(nil), rc.files...),
+		Ended:  ended,
+		Reason: reason,
+	}, nil
+}
+
+var receivePage = template.Must(template.New("receive").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Send files - beamdrop</title>
+<style>body{font-family:system-ui,sans-serif;max-width:28rem;margin:3rem auto;padding:0 1rem;text-align:center}
+button{padding:.8rem 1.6rem;border-radius:.5rem;border:0;background:#7c3aed;color:#fff;font-size:1.1rem}
+input{font-size:1.1rem;padding:.6rem;margin:.4rem 0}progress{width:100%;height:1.2rem}.error{color:#dc2626}</style></head>
+<body><h1>Send files</h1>
+{{if .Message}}<p class="{{if .Error}}error{{end}}">{{.Message}}</p>{{end}}
+{{if .Open}}<form id="f" method="post" enctype="multipart/form-data" action="{{.Action}}">
+{{if .NeedPIN}}<p><input name="pin" inputmode="numeric" autocomplete="off" placeholder="PIN"></p>{{end}}
+<p><input type="file" name="file" required {{if .Multiple}}multiple{{end}}></p>
+<p><button type="submit">Upload</button></p><progress id="p" max="100" value="0" hidden></progress></form>
+<script>
+document.getElementById("f").addEventListener("submit", function (e) {
+  e.preventDefault();
+  var xhr = new XMLHttpRequest(), bar = document.getElementById("p");
+  bar.hidden = false;
+  xhr.upload.onprogress = function (ev) { if (ev.lengthComputable) bar.value = ev.loaded / ev.total * 100; };
+  xhr.onload = function () { document.open(); document.write(xhr.responseText); document.close(); };
+  xhr.open("POST", this.action);
+  xhr.send(new FormData(this));
+});
+</script>{{end}}
+</body></html>`))
+
+func (rc *receiver) render(w http.ResponseWriter, status int, message string, isError bool) {
+	rc.mu.Lock()
+	open := !rc.stopping
+	rc.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	receivePage.Execute(w, map[string]any{
+		"Message":  message,
+		"Error":    isError,
+		"Open":     open,
+		"Multiple": rc.opts.MaxUploads != 1,
+		"NeedPIN":  rc.opts.PIN != "",
+		"Action":   "/r/" + rc.token,
+	})
+}
+
+func (rc *receiver) page(w http.ResponseWriter, r *http.Request) {
+	if !tokenMatches(r.PathValue("token"), rc.token) {
+		http.NotFound(w, r)
+		return
+	}
+	rc.render(w, http.StatusOK, "", false)
+}
+
+func (rc *receiver) upload(w http.ResponseWriter, r *http.Request) {
+	if !tokenMatches(r.PathValue("token"), rc.token) {
+		http.NotFound(w, r)
+		return
+	}
+	if rc.opts.MaxBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, rc.opts.MaxBytes)
+	}
+
+	// Progress for the whole request body; browsers send a Content-Length
+	bar := styles.NewProgress("Receiving from "+clientIP(r), r.ContentLength)
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(r.Body, bar), r.Body}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		rc.render(w, http.StatusBadRequest, "Invalid upload", true)
+		return
+	}
+
+	var stored []Received
+	pinChecked := rc.opts.PIN == ""
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			bar.Done()
+			rc.render(w, http.StatusBadRequest, "Upload failed: "+err.Error(), true)
+			return
+		}
+
+		switch part.FormName() {
+		case "pin":
+			value, _ := io.ReadAll(io.LimitReader(part, 64))
+			rc.mu.Lock()
+			ok, locked := rc.gate.check(string(value))
+			rc.mu.Unlock()
+			if locked {
+				bar.Done()
+				rc.render(w, http.StatusForbidden, "Too many wrong PIN attempts", true)
+				rc.session.finish(ErrTooManyAttempts)
+				return
+			}
+			if !ok {
+				bar.Done()
+				logger.Warn("Wrong PIN from %s", clientIP(r))
+				rc.render(w, http.StatusForbidden, "Wrong PIN, try again.", true)
+				return
+			}
+			pinChecked = true
+
+		case "file":
+			if !pinChecked {
+				bar.Done()
+				rc.render(w, http.StatusForbidden, "PIN required", true)
+				return
+			}
+			// Parts beyond the upload limit are skipped and drained
+			if part.FileName() == "" || !rc.reserve() {
+				break
+			}
+			rec, err := rc.store(r.Context(), part, part.FileName(), clientIP(r))
+			var virus *virusError
+			if errors.As(err, &virus) || errors.Is(err, errScanFailed) {
+				rc.release()
+				bar.Done()
+				logger.Warn("Refused %s from %s: %v", part.FileName(), clientIP(r), err)
+				status := http.StatusServiceUnavailable
+				if virus != nil {
+					status = http.StatusUnprocessableEntity
+				}
+				rc.render(w, status, "Refused "+part.FileName()+": "+err.Error(), true)
+				return
+			}
+			if err != nil {
+				rc.release()
+				bar.Done()
+				logger.Error("Failed to store upload %s: %v", part.FileName(), err)
+				rc.render(w, http.StatusInternalServerError, "Failed to save "+part.FileName(), true)
+				return
+			}
+			stored = append(stored, rec)
+		}
+		part.Close()
+	}
+	bar.Done()
+
+	rc.mu.Lock()
+	rc.files = append(rc.files, stored...)
+	done := rc.stopping
+	rc.mu.Unlock()
+
+	for _, f := range stored {
+		logger.Info("Received %s (%s) from %s", f.Name, handlers.FormatFileSize(f.Bytes), f.RemoteAddr)
+	}
+	rc.render(w, http.StatusOK, fmt.Sprintf("Received %d file(s). Thank you!", len(stored)), false)
+	if done {
+		rc.session.finish(nil)
+	}
+}
+
+// reserve claims one upload slot, returning false once the limit is reached
+func (rc *receiver) reserve() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.stopping {
+		return false
+	}
+	rc.accepted++
+	rc.stopping = rc.opts.MaxUploads > 0 && rc.accepted >= rc.opts.MaxUploads
+	return true
+}
+
+// release gives back a slot claimed by a failed upload
+func (rc *receiver) release() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.accepted--
+	rc.stopping = rc.opts.MaxUploads > 0 && rc.accepted >= rc.opts.MaxUploads
+}
+
+// virusError refuses an upload clamd found a virus in
+type virusError struct{ signature string }
+
+func (e *virusError) Error() string { return "virus found: " + e.signature }
+
+// errScanFailed refuses an upload clamd couldn't scan
+var errScanFailed = errors.New("virus scan failed")
+
+// store writes one uploaded part into the target directory without
+// overwriting anything that is already there. The part is written to a
+// temporary file first, so an interrupted upload leaves nothing behind
+// under its name, nor does one refused by the virus scan.
+func (rc *receiver) store(ctx context.Context, part io.Reader, name string, from string) (Received, error) {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		return Received{}, errors.New("invalid file name")
+	}
+
+	out, err := rc.fs.CreateAtomic(name, sandbox.FileMode)
+	if err != nil {
+		return Received{}, err
+	}
+	var n int64
+	if rc.opts.Clamd != nil {
+		n, err = scanCopy(ctx, rc.opts.Clamd, out, part)
+	} else {
+		n, err = io.Copy(out, part)
+	}
+	if err == nil {
+		name, err = commitUnique(out, name)
+	}
+	if err != nil {
+		out.Abort()
+		return Received{}, err
+	}
+
+	return Received{
+		Name:       name,
+		Path:       filepath.Join(rc.opts.Dir, name),
+		Bytes:      n,
+		RemoteAddr: from,
+		ReceivedAt: time.Now(),
+	}, nil
+}
+
+// scanCopy copies src to dst while streaming it to clamd, so the upload is
+// read only once. It fails with a *virusError or errScanFailed unless clamd
+// found the content clean.
+func scanCopy(ctx context.Context, c *clamd.Client, dst io.Writer, src io.Reader) (int64, error) {
+	pr, pw := io.Pipe()
+	var res clamd.Result
+	var scanErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		res, scanErr = c.Scan(ctx, pr)
+		// A scan that ends early mustn't leave the copy blocked on the pipe
+		pr.CloseWithError(errScanFailed)
+	}()
+
+	n, err := io.Copy(io.MultiWriter(dst, pw), src)
+	pw.CloseWithError(err)
+	<-done
+	switch {
+	case err != nil && !errors.Is(err, errScanFailed):
+		// The upload broke off, or the file couldn't be written
+		return n, err
+	case scanErr != nil:
+		logger.Error("Failed to scan upload: %v", scanErr)
+		return n, fmt.Errorf("%w: %v", errScanFailed, scanErr)
+	case res.Infected:
+		return n, &virusError{signature: res.Signature}
+	case err != nil:
+		return n, fmt.Errorf("%w: clamd stopped reading", errScanFailed)
+	}
+	return n, nil
+}
+
+// commitUnique moves a received file to name, or "name (1).ext",
+// "name (2).ext", ... if the name is taken, and returns the name it got
+func commitUnique(out *sandbox.AtomicFile, name string) (string, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 0; i < 1000; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		}
+		err := out.CommitNew(candidate)
+		if !errors.Is(err, os.ErrExist) {
+			return candidate, err
+		}
+	}
+	return "", fmt.Errorf("no free name for %s", name)
+}
@@ -0,0 +1,127 @@
+package oneshot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/clamd"
+	"github.com/tachRoutine/beamdrop-go/pkg/clamd/clamdtest"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+)
+
+func newReceiver(t *testing.T) *receiver {
+	t.Helper()
+	dir := t.TempDir()
+	fs, err := sandbox.New(dir, sandbox.DefaultSymlinkPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fs.Close() })
+	return &receiver{opts: ReceiveOptions{Dir: dir}, fs: fs}
+}
+
+// names lists the entries of dir
+func names(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestStoreKeepsExistingFiles(t *testing.T) {
+	rc := newReceiver(t)
+	for i, want := range []string{"notes.txt", "notes (1).txt", "notes (2).txt"} {
+		rec, err := rc.store(context.Background(), strings.NewReader("version "+want), "notes.txt", "127.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Name != want || rec.Path != filepath.Join(rc.opts.Dir, want) || rec.Bytes != int64(len("version "+want)) {
+			t.Errorf("upload %d: stored as %+v, want %s", i, rec, want)
+		}
+	}
+	content, _ := os.ReadFile(filepath.Join(rc.opts.Dir, "notes.txt"))
+	if string(content) != "version notes.txt" {
+		t.Errorf("the first file was replaced with %q", content)
+	}
+}
+
+// brokenReader fails after handing out some content, like a client that
+// disconnects mid-upload
+type brokenReader struct{ sent bool }
+
+func (r *brokenReader) Read(p []byte) (int, error) {
+	if r.sent {
+		return 0, io.ErrUnexpectedEOF
+	}
+	r.sent = true
+	return copy(p, "the first half of the"), nil
+}
+
+func TestStoreInterruptedLeavesNothing(t *testing.T) {
+	rc := newReceiver(t)
+	if _, err := rc.store(context.Background(), &brokenReader{}, "report.pdf", "127.0.0.1"); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v, want the read error", err)
+	}
+	if left := names(t, rc.opts.Dir); len(left) != 0 {
+		t.Errorf("an interrupted upload left %v behind", left)
+	}
+}
+
+func TestStoreScans(t *testing.T) {
+	f := &clamdtest.Fake{}
+	if err := f.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	c, err := clamd.New(f.Addr(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := newReceiver(t)
+	rc.opts.Clamd = c
+
+	var virus *virusError
+	if _, err := rc.store(context.Background(), strings.NewReader(clamdtest.EICAR), "eicar.com", "127.0.0.1"); !errors.As(err, &virus) {
+		t.Fatalf("got %v, want a virus error", err)
+	}
+	if _, err := rc.store(context.Background(), strings.NewReader("hello"), "notes.txt", "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, rc.opts.Dir); len(got) != 1 || got[0] != "notes.txt" {
+		t.Errorf("directory holds %v, want only notes.txt", got)
+	}
+
+	// Nor is a file over clamd's limit, which stops reading it midway
+	big := &clamdtest.Fake{MaxLength: 1024}
+	if err := big.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer big.Close()
+	if rc.opts.Clamd, err = clamd.New(big.Addr(), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.store(context.Background(), strings.NewReader(strings.Repeat("x", 1<<20)), "big.bin", "127.0.0.1"); !errors.Is(err, errScanFailed) {
+		t.Fatalf("got %v, want the scan to fail", err)
+	}
+
+	// Without clamd nothing is stored
+	rc.opts.Clamd = c
+	f.Close()
+	if _, err := rc.store(context.Background(), strings.NewReader("hello"), "later.txt", "127.0.0.1"); !errors.Is(err, errScanFailed) {
+		t.Fatalf("got %v, want the scan to fail", err)
+	}
+	if got := names(t, rc.opts.Dir); len(got) != 1 {
+		t.Errorf("a file clamd couldn't scan was stored: %v", got)
+	}
+}
@@ -0,0 +1,317 @@
+package oneshot
+
+import (
+	"archive/zip"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/beam/server/handlers"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+)
+
+// SendOptions configures a one-shot send
+type SendOptions struct {
+	Path         string
+	Port         int
+	PIN          string
+	MaxDownloads int           // downloads after which the server exits, 0 means unlimited
+	Timeout      time.Duration // 0 means no timeout
+	NoQR         bool
+}
+
+// Download records one download attempt for the receipt
+type Download struct {
+	RemoteAddr string    `json:"remoteAddr"`
+	UserAgent  string    `json:"userAgent"`
+	StartedAt  time.Time `json:"startedAt"`
+	Bytes      int64     `json:"bytes"`
+	Completed  bool      `json:"completed"`
+}
+
+// SendReceipt summarizes a finished send session
+type SendReceipt struct {
+	Item      string     `json:"item"`
+	URL       string     `json:"url"`
+	Downloads []Download `json:"downloads"`
+	Ended     string     `json:"ended"`
+	// Reason is why the session ended, nil when the download limit was reached
+	Reason error `json:"-"`
+}
+
+// Completed returns the number of downloads that transferred everything
+func (r SendReceipt) Completed() int {
+	n := 0
+	for _, d := range r.Downloads {
+		if d.Completed {
+			n++
+		}
+	}
+	return n
+}
+
+type sender struct {
+	opts  SendOptions
+	token string
+	name  string
+	isDir bool
+	size  int64
+
+	mu        sync.Mutex
+	gate      pinGate
+	downloads []Download
+	completed int
+	reserved  int // download slots claimed, including downloads in progress
+	session   *session
+}
+
+// Send serves a single file or directory (as a zip archive) until the
+// download limit or the timeout is reached and returns a receipt
+func Send(opts SendOptions) (SendReceipt, error) {
+	abs, err := filepath.Abs(opts.Path)
+	if err != nil {
+		return SendReceipt{}, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return SendReceipt{}, err
+	}
+	token, err := newToken()
+	if err != nil {
+		return SendReceipt{}, err
+	}
+
+	s := &sender{
+		opts:  opts,
+		token: token,
+		name:  info.Name(),
+		isDir: info.IsDir(),
+		size:  info.Size(),
+		gate:  pinGate{pin: opts.PIN},
+	}
+	s.opts.Path = abs
+	if s.isDir {
+		s.name += ".zip"
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /s/{token}", s.page)
+	mux.HandleFunc("GET /s/{token}/download", s.download)
+
+	s.session, err = newSession(opts.Port, "/s/"+token, mux)
+	if err != nil {
+		return SendReceipt{}, err
+	}
+
+	logger.Info("Sending %s", abs)
+	if opts.PIN != "" {
+		logger.Info("A PIN is required to download")
+	}
+	reason := s.session.run(opts.NoQR, opts.Timeout)
+
+	ended := "download limit reached"
+	if reason != nil {
+		ended = reason.Error()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SendReceipt{
+		Item:      abs,
+		URL:       s.session.url,
+		Downloads: append([]Download(nil), s.downloads...),
+		Ended:     ended,
+		Reason:    reason,
+	}, nil
+}
+
+var sendPage = template.Must(template.New("send").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}} - beamdrop</title>
+<style>body{font-family:system-ui,sans-serif;max-width:28rem;margin:3rem auto;padding:0 1rem;text-align:center}
+a.button,button{display:inline-block;padding:.8rem 1.6rem;border-radius:.5rem;border:0;background:#7c3aed;color:#fff;font-size:1.1rem;text-decoration:none}
+input{font-size:1.1rem;padding:.6rem;width:8rem;text-align:center}.error{color:#dc2626}</style></head>
+<body><h1>{{.Name}}</h1><p>{{.Size}}</p>
+{{if .NeedPIN}}<form method="get" action="{{.Action}}">
+{{if .WrongPIN}}<p class="error">Wrong PIN, try again.</p>{{end}}
+<p><input name="pin" inputmode="numeric" autocomplete="off" placeholder="PIN" autofocus></p>
+<p><button type="submit">Download</button></p></form>
+{{else}}<p><a class="button" href="{{.Action}}">Download</a></p>{{end}}
+</body></html>`))
+
+func (s *sender) validToken(w http.ResponseWriter, r *http.Request) bool {
+	if !tokenMatches(r.PathValue("token"), s.token) {
+		http.NotFound(w, r)
+		return false
+	}
+	return true
+}
+
+func (s *sender) page(w http.ResponseWriter, r *http.Request) {
+	if !s.validToken(w, r) {
+		return
+	}
+	size := "folder (zip archive)"
+	if !s.isDir {
+		size = handlers.FormatFileSize(s.size)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	sendPage.Execute(w, map[string]any{
+		"Name":     s.name,
+		"Size":     size,
+		"NeedPIN":  s.opts.PIN != "",
+		"WrongPIN": r.URL.Query().Has("wrong"),
+		"Action":   "/s/" + s.token + "/download",
+	})
+}
+
+func (s *sender) download(w http.ResponseWriter, r *http.Request) {
+	if !s.validToken(w, r) {
+		return
+	}
+
+	s.mu.Lock()
+	ok, locked := s.gate.check(r.URL.Query().Get("pin"))
+	s.mu.Unlock()
+
+	if locked {
+		logger.Warn("Too many wrong PIN attempts, last from %s", clientIP(r))
+		http.Error(w, "Too many wrong PIN attempts", http.StatusForbidden)
+		s.session.finish(ErrTooManyAttempts)
+		return
+	}
+	if !ok {
+		logger.Warn("Wrong PIN from %s", clientIP(r))
+		http.Redirect(w, r, "/s/"+s.token+"?wrong=1", http.StatusSeeOther)
+		return
+	}
+	if !s.reserve() {
+		http.Error(w, "This link has expired", http.StatusGone)
+		return
+	}
+
+	d := Download{RemoteAddr: clientIP(r), UserAgent: r.UserAgent(), StartedAt: time.Now()}
+	logger.Info("Download started by %s", d.RemoteAddr)
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", s.name))
+	var err error
+	if s.isDir {
+		w.Header().Set("Content-Type", "application/zip")
+		d.Bytes, err = writeZip(w, s.opts.Path)
+		d.Completed = err == nil
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(s.size, 10))
+		d.Bytes, err = copyFile(w, s.opts.Path)
+		d.Completed = err == nil && d.Bytes == s.size
+	}
+	if err != nil {
+		logger.Warn("Download by %s interrupted after %s: %v", d.RemoteAddr, handlers.FormatFileSize(d.Bytes), err)
+	} else {
+		logger.Info("Download completed by %s (%s)", d.RemoteAddr, handlers.FormatFileSize(d.Bytes))
+	}
+
+	s.mu.Lock()
+	s.downloads = append(s.downloads, d)
+	if d.Completed {
+		s.completed++
+	} else {
+		// Someone else may try again
+		s.reserved--
+	}
+	reached := s.opts.MaxDownloads > 0 && s.completed >= s.opts.MaxDownloads
+	s.mu.Unlock()
+
+	if reached {
+		s.session.finish(nil)
+	}
+}
+
+// reserve claims one download slot, returning false once the limit is
+// reached. Downloads in progress hold theirs, so concurrent ones can't go
+// past the limit.
+func (s *sender) reserve() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opts.MaxDownloads > 0 && s.reserved >= s.opts.MaxDownloads {
+		return false
+	}
+	s.reserved++
+	return true
+}
+
+func copyFile(w io.Writer, path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(w, f)
+}
+
+// countingWriter counts bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// writeZip streams root as a zip archive whose entries are prefixed with
+// the directory name
+func writeZip(w io.Writer, root string) (int64, error) {
+	cw := &countingWriter{w: w}
+	zw := zip.NewWriter(cw)
+	base := filepath.Base(root)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join(base, rel))
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			_, err := zw.CreateHeader(&zip.FileHeader{Name: name + "/", Modified: info.ModTime()})
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		header.Method = zip.Deflate
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = copyFile(entry, path)
+		return err
+	})
+	if err != nil {
+		return cw.n, err
+	}
+	err = zw.Close()
+	return cw.n, err
+}
@@ -0,0 +1,109 @@
+package oneshot
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// serveSend serves a file of size bytes for up to max downloads
+func serveSend(t *testing.T, size, max int) (*sender, string) {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(p, bytes.Repeat([]byte("x"), size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &sender{
+		opts:    SendOptions{Path: p, MaxDownloads: max},
+		token:   "token",
+		name:    "file.bin",
+		size:    int64(size),
+		session: &session{finished: make(chan error, 1)},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /s/{token}/download", s.download)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return s, srv.URL + "/s/token/download"
+}
+
+func TestConcurrentDownloadsKeepTheLimit(t *testing.T) {
+	// Large enough that the first download is still going while the second
+	// one asks
+	const size = 32 << 20
+	s, url := serveSend(t, size, 1)
+
+	first, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Body.Close()
+	if first.StatusCode != http.StatusOK {
+		t.Fatalf("first download: %s", first.Status)
+	}
+
+	second, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Body.Close()
+	if second.StatusCode != http.StatusGone {
+		t.Errorf("second download while the first is going: %s, want 410", second.Status)
+	}
+
+	if n, err := io.Copy(io.Discard, first.Body); err != nil || n != size {
+		t.Fatalf("first download got %d bytes, %v", n, err)
+	}
+	select {
+	case err := <-s.session.finished:
+		if err != nil {
+			t.Errorf("session finished with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the session didn't finish after the last download")
+	}
+}
+
+func TestInterruptedDownloadGivesBackItsSlot(t *testing.T) {
+	const size = 32 << 20
+	s, url := serveSend(t, size, 1)
+
+	first, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Body.Read(make([]byte, 1024))
+	first.Body.Close()
+
+	// The server notices the client left once a write fails
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		s.mu.Lock()
+		reserved := s.reserved
+		s.mu.Unlock()
+		if reserved == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the interrupted download kept its slot")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	again, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Body.Close()
+	if again.StatusCode != http.StatusOK {
+		t.Fatalf("download after an interrupted one: %s", again.Status)
+	}
+	if n, _ := io.Copy(io.Discard, again.Body); n != size {
+		t.Errorf("got %d bytes, want %d", n, size)
+	}
+}
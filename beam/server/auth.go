@@ -0,0 +1,36 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/tachRoutine/beamdrop-go/beam/server/handlers"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+)
+
+// PasswordHeader is the header API clients use to send the server password
+const PasswordHeader = "X-Password"
+
+// authorized reports whether the request carries the configured password,
+// either in the X-Password header or as the password of HTTP basic auth
+func (s *Server) authorized(r *http.Request) bool {
+	if s.cfg.Password == "" || s.public[r.URL.Path] {
+		return true
+	}
+
+	supplied := r.Header.Get(PasswordHeader)
+	if supplied == "" {
+		_, supplied, _ = r.BasicAuth()
+	}
+	return subtle.ConstantTimeCompare([]byte(supplied), []byte(s.cfg.Password)) == 1
+}
+
+func (s *Server) requireAuth(w http.ResponseWriter, r *http.Request) bool {
+	if s.authorized(r) {
+		return true
+	}
+	logger.Warn("Unauthorized request to %s from %s", r.URL.Path, r.RemoteAddr)
+	w.Header().Set("WWW-Authenticate", `Basic realm="beamdrop"`)
+	handlers.SendError(w, http.StatusUnauthorized, handlers.CodeUnauthorized, "Unauthorized")
+	return false
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/fileops"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+)
+
+// Machine-readable error codes sent in the "code" field of an ErrorResponse
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeInvalidPath      = "invalid_path"
+	CodePathDenied       = "path_denied"
+	CodeReadOnly         = "read_only"
+	CodeUploadOnly       = "upload_only"
+	CodeNotFound         = "not_found"
+	CodeNotADirectory    = "not_a_directory"
+	CodeIsADirectory     = "is_a_directory"
+	CodeAlreadyExists    = "already_exists"
+	CodeJobFinished      = "job_finished"
+	CodeRevisionMismatch = "revision_mismatch"
+	CodeNotText          = "not_text"
+	CodeTooLarge         = "too_large"
+	CodeContentPolicy    = "content_policy"
+	CodeVirusFound       = "virus_found"
+	CodeLocked           = "locked"
+	CodeNotLockOwner     = "not_lock_owner"
+	CodeNotCommentAuthor = "not_comment_author"
+	CodeAdminRequired    = "admin_required"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeUnauthorized     = "unauthorized"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "unavailable"
+)
+
+// ErrorResponse is the envelope for every API error
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// SendJSON writes v as a JSON response with the given status
+func SendJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// SendError writes an ErrorResponse with the given status and code
+func SendError(w http.ResponseWriter, status int, code, message string) {
+	SendJSON(w, status, ErrorResponse{Error: message, Code: code})
+}
+
+// sendPathError reports a failed file operation, telling sandbox violations
+// and missing files apart from I/O errors
+func sendPathError(w http.ResponseWriter, err error, action string) {
+	status, code, msg := pathError(err, action)
+	SendError(w, status, code, msg)
+}
+
+// pathError maps the error of a file operation onto a status, code and
+// message, logging the unexpected ones
+func pathError(err error, action string) (int, string, string) {
+	switch {
+	case errors.Is(err, sandbox.ErrSymlink):
+		return http.StatusForbidden, CodePathDenied, "Symbolic links are not allowed"
+	case errors.Is(err, sandbox.ErrReadOnly):
+		return http.StatusForbidden, CodeReadOnly, "This location is read-only"
+	case errors.Is(err, sandbox.ErrUploadOnly):
+		return http.StatusForbidden, CodeUploadOnly, "This location only accepts uploads"
+	case errors.Is(err, sandbox.ErrTopLevel):
+		return http.StatusForbidden, CodeReadOnly, "The top level only holds the shared roots"
+	case sandbox.IsDenied(err):
+		return http.StatusForbidden, CodePathDenied, "Path is outside the shared directory"
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound, CodeNotFound, "File not found"
+	case errors.Is(err, fileops.ErrConflict):
+		return http.StatusConflict, CodeAlreadyExists, "A file and a directory can't replace each other without the overwrite policy"
+	}
+	logger.Error("Failed to %s: %v", action, err)
+	return http.StatusInternalServerError, CodeInternal, "Failed to " + action
+}
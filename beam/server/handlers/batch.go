@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/fileops"
+	"github.com/tachRoutine/beamdrop-go/pkg/jobs"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"github.com/tachRoutine/beamdrop-go/pkg/webhooks"
+)
+
+// Operations a batch can hold
+const (
+	BatchMove   = "move"
+	BatchCopy   = "copy"
+	BatchRename = "rename"
+	BatchDelete = "delete"
+	BatchStar   = "star"
+	BatchUnstar = "unstar"
+)
+
+// What a batch does after an operation fails
+const (
+	BatchStopOnError = "stop-on-error" // the rest is skipped
+	BatchBestEffort  = "best-effort"   // the rest runs anyway
+)
+
+// Statuses of the operations in a BatchResponse
+const (
+	BatchDone    = "done"
+	BatchFailed  = "failed"
+	BatchSkipped = "skipped" // not run, after an earlier failure or a cancel
+	BatchInvalid = "invalid" // rejected before anything ran
+)
+
+const (
+	// MaxBatchSize is the most operations one batch can hold
+	MaxBatchSize = 10000
+	// batchInlineLimit is the largest batch run within the request; larger
+	// ones run as a job
+	batchInlineLimit = 100
+	// jobKindBatch is the kind of the jobs running large batches
+	jobKindBatch = "batch"
+)
+
+var batchOps = []string{BatchMove, BatchCopy, BatchRename, BatchDelete, BatchStar, BatchUnstar}
+
+// batchParams are the settings of a batch job
+type batchParams struct {
+	BatchRequest
+	// Locks stand for the lock tokens the client sent, see lockDigest
+	Locks []string `json:"locks,omitempty"`
+}
+
+// batchItem is a validated operation with its paths resolved
+type batchItem struct {
+	BatchOperation
+	src     *sandbox.Root
+	srcName string
+	dst     *sandbox.Root
+	dstName string
+	policy  fileops.Policy
+}
+
+// Batch runs a list of operations on many paths. Every operation is
+// validated before any runs; large batches run as a job.
+func (h *FileOperationsHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Invalid batch request: %v", err)
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = BatchStopOnError
+	}
+	switch {
+	case req.Mode != BatchStopOnError && req.Mode != BatchBestEffort:
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "mode must be "+BatchStopOnError+" or "+BatchBestEffort)
+		return
+	case len(req.Operations) == 0:
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "No operations in batch")
+		return
+	case len(req.Operations) > MaxBatchSize:
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("A batch holds at most %d operations", MaxBatchSize))
+		return
+	}
+
+	// Locks are checked now, and again when a job starts
+	tokens := lockTokens(r)
+	locks, err := othersLocks(tokens)
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to check locks")
+		return
+	}
+	items, resp := h.prepareBatch(req.Operations, locks)
+	if items == nil {
+		status := http.StatusBadRequest
+		switch resp.Code {
+		case CodeLocked:
+			status = http.StatusLocked
+		case CodeContentPolicy:
+			status = http.StatusUnsupportedMediaType
+		}
+		SendJSON(w, status, resp)
+		return
+	}
+
+	if req.Background || len(items) > batchInlineLimit {
+		job, err := h.jobs.Submit(jobKindBatch, "", "", batchParams{BatchRequest: req, Locks: lockDigests(tokens)})
+		if err != nil {
+			logger.Error("Failed to queue batch: %v", err)
+			SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to queue batch")
+			return
+		}
+		logger.Info("Queued batch job %s with %d operations", job.ID, len(items))
+		SendJSON(w, http.StatusAccepted, JobResponse{Message: "Queued in the background", Job: job})
+		return
+	}
+
+	resp = h.runBatch(r.Context(), items, req.Mode, nil)
+	SendJSON(w, http.StatusOK, resp)
+}
+
+// prepareBatch validates every operation, refusing those that change a path
+// under one of locks. If any is invalid it returns nil and a response saying
+// which.
+func (h *FileOperationsHandler) prepareBatch(ops []BatchOperation, locks []db.Lock) ([]batchItem, BatchResponse) {
+	items := make([]batchItem, len(ops))
+	resp := BatchResponse{Results: make([]BatchResult, len(ops))}
+	invalid := 0
+	for i, op := range ops {
+		resp.Results[i] = BatchResult{Index: i, Op: op.Op, Path: op.Path, Status: BatchSkipped}
+		item, code, msg := h.prepareBatchItem(op, locks)
+		if code != "" {
+			resp.Results[i].Status = BatchInvalid
+			resp.Results[i].Code = code
+			resp.Results[i].Error = msg
+			if invalid == 0 {
+				resp.Code = code
+				resp.Error = fmt.Sprintf("Operation %d: %s", i, msg)
+			}
+			invalid++
+			continue
+		}
+		items[i] = item
+	}
+	if invalid > 0 {
+		resp.Message = fmt.Sprintf("%d of %d operations are invalid, none were run", invalid, len(ops))
+		resp.Skipped = len(ops) - invalid
+		return nil, resp
+	}
+	return items, resp
+}
+
+// prepareBatchItem resolves the paths of one operation and checks it's
+// allowed, returning an error code and message if not
+func (h *FileOperationsHandler) prepareBatchItem(op BatchOperation, locks []db.Lock) (batchItem, string, string) {
+	item := batchItem{BatchOperation: op}
+	if !slices.Contains(batchOps, op.Op) {
+		return item, CodeInvalidRequest, "op must be one of " + strings.Join(batchOps, ", ")
+	}
+
+	access := sandbox.Write
+	if op.Op == BatchCopy || op.Op == BatchStar || op.Op == BatchUnstar {
+		access = sandbox.Read
+	}
+	var err error
+	item.src, item.srcName, err = h.roots.Locate(op.Path, access)
+	if err != nil {
+		_, code, msg := pathError(err, op.Op)
+		return item, code, msg
+	}
+	if item.src == nil {
+		return item, CodeInvalidPath, "Refusing to " + op.Op + " the top level"
+	}
+
+	switch op.Op {
+	case BatchMove, BatchCopy:
+		if item.policy, err = fileops.ParsePolicy(op.Policy); err != nil {
+			return item, CodeInvalidRequest, err.Error()
+		}
+		if op.Op == BatchMove && item.srcName == "." {
+			return item, CodeInvalidPath, "Refusing to move a shared root"
+		}
+		item.dst, item.dstName, err = h.roots.Locate(op.TargetPath, sandbox.Write)
+		if err != nil {
+			_, code, msg := pathError(err, op.Op)
+			return item, code, msg
+		}
+		check := fileops.Op{Src: item.src.FS, SrcName: item.srcName, Dst: item.dst.FS, DstName: item.dstName}
+		if err := check.Check(); err != nil {
+			return item, CodeInvalidPath, "Can't " + op.Op + " a directory into itself"
+		}
+	case BatchRename:
+		if op.NewName == "" || op.NewName == "." || op.NewName == ".." || strings.ContainsAny(op.NewName, "/\\") {
+			return item, CodeInvalidPath, "Invalid new name"
+		}
+		if item.srcName == "." {
+			return item, CodeInvalidPath, "Refusing to rename a shared root"
+		}
+	case BatchDelete:
+		if item.srcName == "." {
+			return item, CodeInvalidPath, "Refusing to delete a shared root"
+		}
+	}
+
+	var changed []string
+	switch op.Op {
+	case BatchCopy:
+		changed = []string{item.dst.Join(item.dstName)}
+	case BatchMove:
+		changed = []string{item.src.Join(item.srcName), item.dst.Join(item.dstName)}
+	case BatchRename:
+		changed = []string{item.src.Join(item.srcName), item.src.Join(path.Join(path.Dir(item.srcName), op.NewName))}
+	case BatchDelete:
+		changed = []string{item.src.Join(item.srcName)}
+	}
+	if lock := coveringLock(locks, changed...); lock != nil {
+		return item, CodeLocked, lockMessage(*lock)
+	}
+
+	var violations []PolicyViolation
+	switch op.Op {
+	case BatchMove, BatchCopy:
+		violations, err = treeViolations(h.policies.For(item.dst.Name), item.src, item.srcName, item.dst, item.dstName)
+	case BatchRename:
+		violations, err = treeViolations(h.policies.For(item.src.Name), item.src, item.srcName, item.src, path.Join(path.Dir(item.srcName), op.NewName))
+	}
+	// A missing source fails when the operation runs
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		_, code, msg := pathError(err, op.Op)
+		return item, code, msg
+	}
+	if len(violations) > 0 {
+		return item, CodeContentPolicy, policyMessage(violations)
+	}
+	return item, "", ""
+}
+
+// runBatch runs validated operations in order. progress, if set, is called
+// after each one.
+func (h *FileOperationsHandler) runBatch(ctx context.Context, items []batchItem, mode string, progress func(fileops.Progress)) BatchResponse {
+	resp := BatchResponse{Results: make([]BatchResult, len(items))}
+	stopped := false
+	for i, it := range items {
+		res := BatchResult{Index: i, Op: it.Op, Path: it.Path, Status: BatchSkipped}
+		if !stopped && ctx.Err() == nil {
+			if err := h.runBatchItem(ctx, it); err != nil {
+				res.Status = BatchFailed
+				res.Code, res.Error = batchError(err, it.Op)
+				stopped = mode == BatchStopOnError
+			} else {
+				res.Status = BatchDone
+			}
+		}
+
+		switch res.Status {
+		case BatchDone:
+			resp.Done++
+		case BatchFailed:
+			resp.Failed++
+		default:
+			resp.Skipped++
+		}
+		resp.Results[i] = res
+		if progress != nil {
+			progress(fileops.Progress{Files: int64(resp.Done), Skipped: int64(resp.Failed + resp.Skipped), TotalFiles: int64(len(items)), Current: it.Path})
+		}
+	}
+
+	resp.Message = fmt.Sprintf("%d of %d operations done", resp.Done, len(items))
+	if resp.Failed > 0 {
+		resp.Message += fmt.Sprintf(", %d failed", resp.Failed)
+	}
+	logger.Info("Batch finished: %d done, %d failed, %d skipped", resp.Done, resp.Failed, resp.Skipped)
+	return resp
+}
+
+func (h *FileOperationsHandler) runBatchItem(ctx context.Context, it batchItem) error {
+	apiPath := it.src.Join(it.srcName)
+	switch it.Op {
+	case BatchMove, BatchCopy:
+		op := &fileops.Op{Src: it.src.FS, SrcName: it.srcName, Dst: it.dst.FS, DstName: it.dstName, Policy: it.policy}
+		run, kind := op.Copy, jobKindCopy
+		if it.Op == BatchMove {
+			op.OnMoved = movedMetadata(it.src, it.dst)
+			run, kind = op.Move, jobKindMove
+		}
+		if err := run(ctx); err != nil {
+			return err
+		}
+		h.hooks.Emit(transferEvent(kind, apiPath, it.dst.Join(it.dstName), ""))
+		return nil
+
+	case BatchRename:
+		if _, err := it.src.Lstat(it.srcName); err != nil {
+			return err
+		}
+		newName := path.Join(path.Dir(it.srcName), it.NewName)
+		if _, err := it.src.Lstat(newName); !errors.Is(err, fs.ErrNotExist) {
+			if err != nil {
+				return err
+			}
+			return fs.ErrExist
+		}
+		if err := it.src.Rename(it.srcName, newName); err != nil {
+			return err
+		}
+		if err := db.MovePaths(apiPath, it.src.Join(newName)); err != nil {
+			return err
+		}
+		h.hooks.Emit(webhooks.Event{Type: webhooks.Rename, Path: it.src.Join(newName), From: apiPath})
+		return nil
+
+	case BatchDelete:
+		if _, err := it.src.Lstat(it.srcName); err != nil {
+			return err
+		}
+		if err := it.src.RemoveAll(it.srcName); err != nil {
+			return err
+		}
+		if err := db.ForgetPaths(apiPath); err != nil {
+			return err
+		}
+		h.hooks.Emit(webhooks.Event{Type: webhooks.Delete, Path: apiPath})
+		return nil
+
+	case BatchStar:
+		if _, err := it.src.Lstat(it.srcName); err != nil {
+			return err
+		}
+		if err := db.StarFile(apiPath); err != nil {
+			return err
+		}
+		trackPaths(h.roots, apiPath)
+		return nil
+
+	case BatchUnstar:
+		return db.UnstarFile(apiPath)
+	}
+	return nil
+}
+
+// batchError gives the code and message of a failed operation
+func batchError(err error, op string) (string, string) {
+	switch {
+	case errors.Is(err, fileops.ErrConflict):
+		_, code, msg := pathError(err, op)
+		return code, msg
+	case errors.Is(err, fs.ErrExist):
+		return CodeAlreadyExists, "Target name already exists"
+	case errors.Is(err, context.Canceled):
+		return CodeInternal, "Cancelled"
+	}
+	_, code, msg := pathError(err, op)
+	return code, msg
+}
+
+// runBatchJob does the work of a batch job
+func (h *FileOperationsHandler) runBatchJob(ctx context.Context, job jobs.Job, progress func(fileops.Progress)) (any, error) {
+	var req batchParams
+	if err := json.Unmarshal(job.Params, &req); err != nil {
+		return nil, err
+	}
+	// Checked again, the configuration and the locks may have changed since
+	// the job was queued
+	locks, err := othersLocksByDigest(req.Locks)
+	if err != nil {
+		return nil, err
+	}
+	items, resp := h.prepareBatch(req.Operations, locks)
+	if items == nil {
+		return resp, errors.New(resp.Error)
+	}
+	resp = h.runBatch(ctx, items, req.Mode, progress)
+	if resp.Failed > 0 {
+		return resp, fmt.Errorf("%d of %d operations failed", resp.Failed, len(items))
+	}
+	return resp, ctx.Err()
+}
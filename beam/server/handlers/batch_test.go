@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/jobs"
+	"github.com/tachRoutine/beamdrop-go/pkg/webhooks"
+)
+
+// lock takes a lock on p with token, released with the test
+func lock(t *testing.T, p, token string) {
+	t.Helper()
+	l := &db.Lock{ID: newLockID(), Path: p, Owner: "test", Token: token, ExpiresAt: time.Now().Add(time.Minute)}
+	if held, err := db.AcquireLock(l); err != nil || held != nil {
+		t.Fatalf("lock %s: held by %v, %v", p, held, err)
+	}
+	t.Cleanup(func() { db.DeleteLock(l.ID) })
+}
+
+// queue posts body to handler with the lock token and returns the job it
+// queued
+func queue(t *testing.T, m *jobs.Manager, handler http.HandlerFunc, body any, token string) jobs.Job {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	r.Header.Set(LockTokenHeader, token)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("answered %d, want a queued job: %s", w.Code, w.Body)
+	}
+	var resp JobResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	job, err := m.Get(resp.Job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(job.Params), token) {
+		t.Errorf("the job params show the lock token: %s", job.Params)
+	}
+	return job
+}
+
+func TestBatchJobChecksLocks(t *testing.T) {
+	roots := singleRoot(t, map[string]string{"batch-mine.txt": "a", "batch-theirs.txt": "b"})
+	m := jobs.NewManager(1)
+	h := NewFileOperationsHandler(roots, m, nil, acceptAll, webhooks.NewDispatcher())
+	m.Register(jobKindBatch, h.runBatchJob, false)
+	del := func(p string) BatchRequest {
+		return BatchRequest{Operations: []BatchOperation{{Op: BatchDelete, Path: p}}, Background: true}
+	}
+
+	mine, theirs := newToken(), newToken()
+
+	// The client's own lock doesn't stop it
+	lock(t, "batch-mine.txt", mine)
+	job := queue(t, m, h.Batch, del("batch-mine.txt"), mine)
+	if _, err := h.runBatchJob(context.Background(), job, nil); err != nil {
+		t.Errorf("batch under the client's own lock failed: %v", err)
+	}
+	if _, err := roots.All()[0].Lstat("batch-mine.txt"); err == nil {
+		t.Error("batch-mine.txt wasn't deleted")
+	}
+
+	// Someone else's lock taken after the job was queued does
+	job = queue(t, m, h.Batch, del("batch-theirs.txt"), mine)
+	lock(t, "batch-theirs.txt", theirs)
+	res, err := h.runBatchJob(context.Background(), job, nil)
+	if err == nil || res.(BatchResponse).Code != CodeLocked {
+		t.Errorf("batch under another client's lock: got %v, %+v", err, res)
+	}
+	if _, err := roots.All()[0].Lstat("batch-theirs.txt"); err != nil {
+		t.Errorf("the locked file was deleted: %v", err)
+	}
+}
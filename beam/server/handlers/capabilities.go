@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+)
+
+// CapabilitiesResponse tells clients what the server allows so they can
+// hide what won't work. Roots may restrict further, see the roots endpoint.
+type CapabilitiesResponse struct {
+	Version string `json:"version"`
+	Mode    string `json:"mode"`
+	// Read covers listing, searching, downloading and stars
+	Read   bool `json:"read"`
+	Upload bool `json:"upload"`
+	// Write covers editing, moving, copying, renaming, creating directories
+	// and deleting
+	Write bool `json:"write"`
+	// DropFolders is how drop-box uploads are grouped, timestamp or session
+	DropFolders string `json:"dropFolders,omitempty"`
+	// Virtual is set when the top level lists named roots
+	Virtual bool `json:"virtual"`
+}
+
+// CapabilitiesHandler reports the server mode and what it permits
+func CapabilitiesHandler(roots *sandbox.Roots, dropFolders string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mode := roots.Mode()
+		resp := CapabilitiesResponse{
+			Version: config.VERSION,
+			Mode:    string(mode),
+			Read:    mode.Allow(sandbox.Read) == nil,
+			Upload:  mode.Allow(sandbox.Upload) == nil,
+			Write:   mode.Allow(sandbox.Write) == nil,
+			Virtual: roots.Virtual(),
+		}
+		if mode == sandbox.ModeDropBox {
+			resp.DropFolders = dropFolders
+		}
+		SendJSON(w, http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"gorm.io/gorm"
+)
+
+// CollectionsHandler manages collections, named virtual folders holding
+// paths from anywhere in the share
+type CollectionsHandler struct {
+	roots *sandbox.Roots
+}
+
+func NewCollectionsHandler(roots *sandbox.Roots) *CollectionsHandler {
+	return &CollectionsHandler{roots: roots}
+}
+
+// List returns every collection with how many paths it holds
+func (h *CollectionsHandler) List(w http.ResponseWriter, r *http.Request) {
+	collections, sizes, err := db.GetCollections()
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to list collections")
+		return
+	}
+	resp := CollectionsResponse{Collections: make([]CollectionInfo, 0, len(collections))}
+	for _, c := range collections {
+		resp.Collections = append(resp.Collections, CollectionInfo{Collection: c, Items: sizes[c.ID]})
+	}
+	SendJSON(w, http.StatusOK, resp)
+}
+
+// Create adds an empty collection
+func (h *CollectionsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.Name == nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Collection name is required")
+		return
+	}
+	var c db.Collection
+	if !applyCollection(w, &c, req) {
+		return
+	}
+	if err := db.SaveCollection(&c); err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to create collection")
+		return
+	}
+	logger.Info("Collection created: %s", c.Name)
+	SendJSON(w, http.StatusCreated, CollectionResponse{Message: "Collection created", Collection: CollectionInfo{Collection: c}})
+}
+
+// Get lists the entries of a collection
+func (h *CollectionsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	c, ok := pathCollection(w, r)
+	if !ok {
+		return
+	}
+	paths, err := db.GetCollectionItems(c.ID)
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to get collection")
+		return
+	}
+
+	resp := CollectionContentResponse{
+		Collection: CollectionInfo{Collection: c, Items: int64(len(paths))},
+		Entries:    []File{},
+		Missing:    []string{},
+	}
+	for _, p := range paths {
+		root, name, err := h.roots.Locate(p, sandbox.Read)
+		if err != nil || root == nil {
+			resp.Missing = append(resp.Missing, p)
+			continue
+		}
+		info, err := root.Lstat(name)
+		if err != nil {
+			resp.Missing = append(resp.Missing, p)
+			continue
+		}
+		f := newFile(root.FS, name, p, info)
+		f.IsStarred = db.IsStarred(p)
+		resp.Entries = append(resp.Entries, f)
+	}
+	showLocks(resp.Entries)
+	showTags(resp.Entries)
+	showComments(resp.Entries)
+	SendJSON(w, http.StatusOK, resp)
+}
+
+// Update renames a collection or changes its description
+func (h *CollectionsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	c, ok := pathCollection(w, r)
+	if !ok {
+		return
+	}
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if !applyCollection(w, &c, req) {
+		return
+	}
+	if err := db.SaveCollection(&c); err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to update collection")
+		return
+	}
+	SendJSON(w, http.StatusOK, CollectionResponse{Message: "Collection updated", Collection: CollectionInfo{Collection: c}})
+}
+
+// Delete removes a collection. The files it held stay where they are.
+func (h *CollectionsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	c, ok := pathCollection(w, r)
+	if !ok {
+		return
+	}
+	if err := db.DeleteCollection(c.ID); err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to delete collection")
+		return
+	}
+	logger.Info("Collection deleted: %s", c.Name)
+	SendJSON(w, http.StatusOK, CollectionResponse{Message: "Collection deleted", Collection: CollectionInfo{Collection: c}})
+}
+
+// Items adds paths to a collection and removes them from it. Added paths
+// must exist; removed ones needn't any more.
+func (h *CollectionsHandler) Items(w http.ResponseWriter, r *http.Request) {
+	c, ok := pathCollection(w, r)
+	if !ok {
+		return
+	}
+	var req CollectionItemsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	switch n := len(req.Add) + len(req.Remove); {
+	case n == 0:
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "No paths to add or remove")
+		return
+	case n > MaxBatchSize:
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("At most %d paths can be changed at once", MaxBatchSize))
+		return
+	}
+
+	add, ok := metadataPaths(w, h.roots, req.Add, true, "add to collection")
+	if !ok {
+		return
+	}
+	remove, ok := metadataPaths(w, h.roots, req.Remove, false, "remove from collection")
+	if !ok {
+		return
+	}
+
+	added, removed, err := db.UpdateCollectionItems(c.ID, add, remove)
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to update collection")
+		return
+	}
+	trackPaths(h.roots, add...)
+	SendJSON(w, http.StatusOK, CollectionItemsResponse{
+		Message: fmt.Sprintf("%d added, %d removed", added, removed),
+		Added:   added,
+		Removed: removed,
+	})
+}
+
+// pathCollection loads the collection named by the id path segment
+func pathCollection(w http.ResponseWriter, r *http.Request) (db.Collection, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 0)
+	if err != nil {
+		SendError(w, http.StatusNotFound, CodeNotFound, "Collection not found")
+		return db.Collection{}, false
+	}
+	c, err := db.GetCollection(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		SendError(w, http.StatusNotFound, CodeNotFound, "Collection not found")
+		return c, false
+	}
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to get collection")
+		return c, false
+	}
+	return c, true
+}
+
+// applyCollection validates the fields set in req and copies them onto c
+func applyCollection(w http.ResponseWriter, c *db.Collection, req CollectionRequest) bool {
+	if req.Name != nil {
+		name, ok := validName(w, *req.Name, "Collection")
+		if !ok {
+			return false
+		}
+		other, err := db.GetCollectionByName(name)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to check collection name")
+			return false
+		}
+		if err == nil && other.ID != c.ID {
+			SendError(w, http.StatusConflict, CodeAlreadyExists, "A collection named "+other.Name+" already exists")
+			return false
+		}
+		c.Name = name
+	}
+	if req.Description != nil {
+		c.Description = strings.TrimSpace(*req.Description)
+	}
+	return true
+}
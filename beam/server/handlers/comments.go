@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"gorm.io/gorm"
+)
+
+const (
+	// CommentTokenHeader carries the token of a comment, to edit or delete it
+	CommentTokenHeader = "X-Comment-Token"
+
+	// MaxCommentLength is the longest comment body in bytes
+	MaxCommentLength = 10000
+	// maxAuthor is the longest author name
+	maxAuthor = 64
+)
+
+// Comment events pushed over the stats WebSocket
+const (
+	CommentCreated = "created"
+	CommentUpdated = "updated"
+	CommentDeleted = "deleted"
+)
+
+// CommentsHandler keeps threads of comments on files and directories
+type CommentsHandler struct {
+	roots         *sandbox.Roots
+	adminPassword string
+}
+
+func NewCommentsHandler(roots *sandbox.Roots, adminPassword string) *CommentsHandler {
+	return &CommentsHandler{roots: roots, adminPassword: adminPassword}
+}
+
+// List returns the comments on a path as threads, oldest first
+func (h *CommentsHandler) List(w http.ResponseWriter, r *http.Request) {
+	paths, ok := metadataPaths(w, h.roots, []string{queryPath(r)}, false, "read comments of")
+	if !ok {
+		return
+	}
+	comments, err := db.GetComments(paths[0])
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to get comments")
+		return
+	}
+	n := 0
+	for _, c := range comments {
+		if !c.Deleted {
+			n++
+		}
+	}
+	SendJSON(w, http.StatusOK, CommentsResponse{Path: paths[0], Count: n, Threads: threads(comments)})
+}
+
+// Create adds a comment on a path, or a reply to a comment on it
+func (h *CommentsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	body, ok := commentBody(w, req.Body)
+	if !ok {
+		return
+	}
+	author := strings.TrimSpace(req.Author)
+	if author == "" {
+		author = requestOwner(r)
+	}
+	if len(author) > maxAuthor {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("author is longer than %d bytes", maxAuthor))
+		return
+	}
+	paths, ok := metadataPaths(w, h.roots, []string{req.Path}, true, "comment on")
+	if !ok {
+		return
+	}
+
+	c := db.Comment{
+		Path:      paths[0],
+		ParentID:  req.ParentID,
+		Author:    author,
+		Body:      body,
+		Token:     newToken(),
+		CreatedAt: time.Now(),
+	}
+	if req.ParentID != nil {
+		parent, err := db.GetComment(*req.ParentID)
+		if err != nil || parent.Path != c.Path || parent.Deleted {
+			SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Parent comment not found on this path")
+			return
+		}
+	}
+	if err := db.AddComment(&c); err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to add comment")
+		return
+	}
+	trackPaths(h.roots, c.Path)
+	publishComment(CommentCreated, c)
+	logger.Info("%s commented on %s", c.Author, c.Path)
+	SendJSON(w, http.StatusCreated, CommentResponse{Message: "Comment added", Comment: c, Token: c.Token})
+}
+
+// Update replaces the body of a comment the client wrote
+func (h *CommentsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var req CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	body, ok := commentBody(w, req.Body)
+	if !ok {
+		return
+	}
+	c, ok := h.ownComment(w, r, false)
+	if !ok {
+		return
+	}
+	c, err := db.EditComment(c.ID, body)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		SendError(w, http.StatusNotFound, CodeNotFound, "Comment not found")
+		return
+	}
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to edit comment")
+		return
+	}
+	publishComment(CommentUpdated, c)
+	SendJSON(w, http.StatusOK, CommentResponse{Message: "Comment edited", Comment: c})
+}
+
+// Delete removes a comment the client wrote, or any comment with the admin
+// password
+func (h *CommentsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.ownComment(w, r, true)
+	if !ok {
+		return
+	}
+	c, err := db.DeleteComment(c.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		SendError(w, http.StatusNotFound, CodeNotFound, "Comment not found")
+		return
+	}
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to delete comment")
+		return
+	}
+	c.Deleted = true
+	publishComment(CommentDeleted, c)
+	SendJSON(w, http.StatusOK, CommentResponse{Message: "Comment deleted", Comment: c})
+}
+
+// ownComment loads the comment named in the path and checks the client
+// wrote it, or has the admin password if admin is set
+func (h *CommentsHandler) ownComment(w http.ResponseWriter, r *http.Request, admin bool) (db.Comment, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 0)
+	if err != nil {
+		SendError(w, http.StatusNotFound, CodeNotFound, "Comment not found")
+		return db.Comment{}, false
+	}
+	c, err := db.GetComment(uint(id))
+	if err == nil && c.Deleted {
+		err = gorm.ErrRecordNotFound
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		SendError(w, http.StatusNotFound, CodeNotFound, "Comment not found")
+		return c, false
+	}
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to get comment")
+		return c, false
+	}
+	token := r.Header.Get(CommentTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(c.Token)) == 1 || (admin && isAdmin(r, h.adminPassword)) {
+		return c, true
+	}
+	SendError(w, http.StatusForbidden, CodeNotCommentAuthor, "Only "+c.Author+" can change this comment")
+	return c, false
+}
+
+func commentBody(w http.ResponseWriter, body string) (string, bool) {
+	body = strings.TrimSpace(body)
+	switch {
+	case body == "":
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Comment is empty")
+	case len(body) > MaxCommentLength:
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Comment is longer than %d bytes", MaxCommentLength))
+	default:
+		return body, true
+	}
+	return "", false
+}
+
+// threads nests replies under the comments they answer
+func threads(comments []db.Comment) []CommentThread {
+	replies := map[uint][]db.Comment{}
+	var top []db.Comment
+	for _, c := range comments {
+		if c.ParentID == nil {
+			top = append(top, c)
+		} else {
+			replies[*c.ParentID] = append(replies[*c.ParentID], c)
+		}
+	}
+	var nest func([]db.Comment) []CommentThread
+	nest = func(cs []db.Comment) []CommentThread {
+		out := make([]CommentThread, 0, len(cs))
+		for _, c := range cs {
+			out = append(out, CommentThread{Comment: c, Replies: nest(replies[c.ID])})
+		}
+		return out
+	}
+	return nest(top)
+}
+
+// showComments sets the Comments count of each file
+func showComments(files []File) {
+	if len(files) == 0 {
+		return
+	}
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+	}
+	counts, err := db.CountComments(paths)
+	if err != nil {
+		return
+	}
+	for i := range files {
+		files[i].Comments = counts[files[i].Path]
+	}
+}
+
+// commentFeed hands comment events to the WebSocket connections
+var commentFeed = struct {
+	sync.Mutex
+	subs map[chan CommentEvent]struct{}
+}{subs: map[chan CommentEvent]struct{}{}}
+
+// SubscribeComments returns a channel receiving every comment event, and a
+// function to stop. Events a slow receiver has no room for are dropped.
+func SubscribeComments() (<-chan CommentEvent, func()) {
+	ch := make(chan CommentEvent, 64)
+	commentFeed.Lock()
+	commentFeed.subs[ch] = struct{}{}
+	commentFeed.Unlock()
+	return ch, func() {
+		commentFeed.Lock()
+		delete(commentFeed.subs, ch)
+		commentFeed.Unlock()
+	}
+}
+
+func publishComment(event string, c db.Comment) {
+	ev := CommentEvent{Event: event, Comment: c}
+	commentFeed.Lock()
+	defer commentFeed.Unlock()
+	for ch := range commentFeed.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"github.com/tachRoutine/beamdrop-go/pkg/textfile"
+	"github.com/tachRoutine/beamdrop-go/pkg/webhooks"
+)
+
+// MaxReadSize is the most text a read returns. Larger files are read a line
+// range at a time.
+const MaxReadSize = 10 << 20
+
+// sniffSize is how much of a large file decides its encoding
+const sniffSize = 8 << 10
+
+// Read returns the content of a text file with its encoding, line endings
+// and revision, or a range of its lines
+func (h *FileOperationsHandler) Read(w http.ResponseWriter, r *http.Request) {
+	reqPath := queryPath(r)
+	from, to, err := lineRange(r)
+	if err != nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	root, name, ok := locate(w, h.roots, reqPath, sandbox.Read, "read file")
+	if !ok {
+		return
+	}
+	if root == nil {
+		SendError(w, http.StatusBadRequest, CodeIsADirectory, "Path is a directory")
+		return
+	}
+	f, err := root.Open(name)
+	if err != nil {
+		sendPathError(w, err, "read file")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		sendPathError(w, err, "read file")
+		return
+	}
+	if info.IsDir() {
+		SendError(w, http.StatusBadRequest, CodeIsADirectory, "Path is a directory")
+		return
+	}
+
+	resp := ReadResponse{Path: reqPath, Size: info.Size(), ModTime: info.ModTime()}
+	var text string
+	if info.Size() <= MaxReadSize {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			sendPathError(w, err, "read file")
+			return
+		}
+		enc, err := textfile.Detect(data)
+		if err == nil {
+			text, err = textfile.Decode(data, enc)
+		}
+		if enc == textfile.UTF8 && err != nil {
+			// Not UTF-8 after all, cut short at the end
+			enc = textfile.Latin1
+			text, err = textfile.Decode(data, enc)
+		}
+		if err != nil {
+			SendError(w, http.StatusUnsupportedMediaType, CodeNotText, "Not a text file")
+			return
+		}
+		resp.Encoding = enc
+		resp.Revision = textfile.Revision(data)
+		lines := splitLines(text)
+		resp.Lines = len(lines)
+		if from > 0 {
+			text = strings.Join(lines[min(from-1, len(lines)):min(lineEnd(to, len(lines)), len(lines))], "")
+		}
+	} else {
+		// Too large to hold: stream through the file, keeping the range
+		if from == 0 {
+			SendError(w, http.StatusRequestEntityTooLarge, CodeTooLarge, "File is too large, read a range of lines")
+			return
+		}
+		head := make([]byte, sniffSize)
+		n, err := io.ReadFull(f, head)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			sendPathError(w, err, "read file")
+			return
+		}
+		enc, err := textfile.Detect(head[:n])
+		if err != nil {
+			SendError(w, http.StatusUnsupportedMediaType, CodeNotText, "Not a text file")
+			return
+		}
+		if enc == textfile.UTF16LE || enc == textfile.UTF16BE {
+			SendError(w, http.StatusRequestEntityTooLarge, CodeTooLarge, "UTF-16 files are only read whole, this one is too large")
+			return
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			sendPathError(w, err, "read file")
+			return
+		}
+		lines, err := textfile.ReadLines(f, from, to, MaxReadSize)
+		if errors.Is(err, textfile.ErrTooLarge) {
+			SendError(w, http.StatusRequestEntityTooLarge, CodeTooLarge, "Line range is too large, read fewer lines")
+			return
+		}
+		if err != nil {
+			sendPathError(w, err, "read file")
+			return
+		}
+		if text, err = textfile.Decode(lines.Data, enc); err != nil {
+			SendError(w, http.StatusUnsupportedMediaType, CodeNotText, "Not a text file")
+			return
+		}
+		resp.Encoding = enc
+		resp.Revision = lines.Revision
+		resp.Lines = lines.Total
+	}
+
+	if from > 0 {
+		resp.From = from
+		resp.To = max(min(lineEnd(to, resp.Lines), resp.Lines), from-1)
+		resp.Partial = from > 1 || resp.To < resp.Lines
+	}
+	resp.Content = text
+	resp.LineEnding = textfile.LineEnding(text)
+
+	w.Header().Set("ETag", etag(resp.Revision))
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && matchRevision(ifNoneMatch, resp.Revision) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	SendJSON(w, http.StatusOK, resp)
+}
+
+// Write creates or replaces a text file. With an If-Match header the file is
+// only replaced while its revision is still the one the client read.
+func (h *FileOperationsHandler) Write(w http.ResponseWriter, r *http.Request) {
+	var req WriteRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Invalid write request: %v", err)
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if req.FilePath == "" {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "File path is required")
+		return
+	}
+	var enc textfile.Encoding
+	if req.Encoding != "" {
+		var err error
+		if enc, err = textfile.ParseEncoding(req.Encoding); err != nil {
+			SendError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+	}
+
+	root, targetPath, ok := locate(w, h.roots, req.FilePath, sandbox.Write, "write file")
+	if !ok {
+		return
+	}
+	if root == nil || targetPath == "." {
+		SendError(w, http.StatusBadRequest, CodeIsADirectory, "Path is a directory")
+		return
+	}
+	if !checkLocks(w, r, root.Join(targetPath)) {
+		return
+	}
+
+	// The revision check and the write must not interleave with another write
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	current, err := root.ReadFile(targetPath)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		sendPathError(w, err, "write file")
+		return
+	}
+	revision := ""
+	if exists {
+		revision = textfile.Revision(current)
+		if enc == "" {
+			// Keep the encoding of the file being replaced
+			enc, _ = textfile.Detect(current)
+		}
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !(exists && matchRevision(ifMatch, revision)) {
+		logger.Warn("Refusing stale write to %s", req.FilePath)
+		msg := "File no longer exists"
+		if exists {
+			msg = "File was changed since it was read"
+			w.Header().Set("ETag", etag(revision))
+		}
+		SendJSON(w, http.StatusPreconditionFailed, RevisionConflictResponse{
+			Error:    msg,
+			Code:     CodeRevisionMismatch,
+			Revision: revision,
+		})
+		return
+	}
+
+	if enc == "" {
+		enc = textfile.UTF8
+	}
+	data, err := textfile.Encode(req.Content, enc)
+	if err != nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	// Encodings like latin-1 carry any bytes, so what's written is held to
+	// the policy like an upload
+	if v := h.policies.For(root.Name).Check(targetPath, int64(len(data)), data); v != nil {
+		logger.Warn("Write to %s refused by the content policy: %s", req.FilePath, v.Reason)
+		sendPolicyError(w, []PolicyViolation{{Name: root.Join(targetPath), Type: v.Type, Reason: v.Reason}})
+		return
+	}
+
+	// Like an upload, new content is scanned before it's stored
+	var verdict db.ScanResult
+	if h.scanner != nil {
+		var refused *scanRefusal
+		open := func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }
+		verdict, refused = h.scanner.check(r.Context(), open, root.Join(targetPath), requestOwner(r))
+		if refused != nil {
+			logger.Warn("Write to %s refused: %s", req.FilePath, refused.message)
+			refused.send(w)
+			return
+		}
+	}
+
+	// Create parent directories if they don't exist
+	parentDir := path.Dir(targetPath)
+	if err := root.MkdirAll(parentDir, sandbox.DirMode); err != nil {
+		logger.Error("Failed to create parent directory %s: %v", parentDir, err)
+		sendPathError(w, err, "create parent directory")
+		return
+	}
+
+	// Write file content, replacing the old content atomically
+	if err := root.WriteFile(targetPath, data, sandbox.FileMode); err != nil {
+		logger.Error("Failed to write file %s: %v", targetPath, err)
+		sendPathError(w, err, "write file")
+		return
+	}
+
+	if h.scanner != nil {
+		h.scanner.record(verdict, root.Join(targetPath))
+	}
+	revision = textfile.Revision(data)
+	logger.Info("File written successfully: %s", req.FilePath)
+	h.hooks.Emit(webhooks.Event{Type: webhooks.Write, Path: root.Join(targetPath), Size: int64(len(data)), Client: requestOwner(r)})
+	w.Header().Set("ETag", etag(revision))
+	SendJSON(w, http.StatusOK, WriteResponse{
+		Message:  "File written successfully",
+		FilePath: req.FilePath,
+		Revision: revision,
+		Encoding: enc,
+	})
+}
+
+// lineRange parses the from and to query parameters; from is 0 when the
+// whole file is asked for and to is 0 for up to the last line
+func lineRange(r *http.Request) (from, to int, err error) {
+	q := r.URL.Query()
+	if s := q.Get("from"); s != "" {
+		if from, err = strconv.Atoi(s); err != nil || from < 1 {
+			return 0, 0, errors.New("from must be a line number, starting at 1")
+		}
+	}
+	if s := q.Get("to"); s != "" {
+		if to, err = strconv.Atoi(s); err != nil || to < 1 {
+			return 0, 0, errors.New("to must be a line number, starting at 1")
+		}
+		if from == 0 {
+			from = 1
+		}
+		if to < from {
+			return 0, 0, errors.New("to must not be before from")
+		}
+	}
+	return from, to, nil
+}
+
+// lineEnd is the last line of a range, to or else the last line of the file
+func lineEnd(to, total int) int {
+	if to == 0 {
+		return total
+	}
+	return to
+}
+
+// splitLines splits text after each '\n', keeping the line endings
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// etag quotes a revision for the ETag header
+func etag(revision string) string {
+	return `"` + revision + `"`
+}
+
+// matchRevision reports whether an If-Match or If-None-Match header names
+// the revision
+func matchRevision(header, revision string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		tag = strings.TrimPrefix(tag, "W/")
+		if strings.Trim(tag, `"`) == revision {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/jobs"
+	"github.com/tachRoutine/beamdrop-go/pkg/webhooks"
+)
+
+func TestReadLargeRange(t *testing.T) {
+	line := strings.Repeat("x", 99) + "\n"
+	large := strings.Repeat(line, MaxReadSize/len(line)+100)
+	roots := singleRoot(t, map[string]string{"large.txt": large})
+	h := NewFileOperationsHandler(roots, jobs.NewManager(1), nil, acceptAll, webhooks.NewDispatcher())
+
+	read := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.Read(w, httptest.NewRequest(http.MethodGet, "/files/content?path=large.txt&"+query, nil))
+		return w
+	}
+	for _, query := range []string{"from=1", "from=2", "from=1&to=200000"} {
+		expectError(t, read(query), http.StatusRequestEntityTooLarge, CodeTooLarge)
+	}
+	if w := read("from=5&to=10"); w.Code != http.StatusOK {
+		t.Errorf("a small range of a large file: got %d %s", w.Code, w.Body)
+	}
+}
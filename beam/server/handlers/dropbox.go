@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// Drop folder strategies for uploads in drop-box mode
+const (
+	// DropPerUpload puts every upload request in a new timestamped folder
+	DropPerUpload = "timestamp"
+	// DropPerSession puts all uploads of a browser session in one folder
+	DropPerSession = "session"
+)
+
+// dropCookie remembers the folder of a drop-box session
+const dropCookie = "beamdrop_drop"
+
+// dropName matches the folder names newDropName generates, so a cookie
+// can't point an upload anywhere else
+var dropName = regexp.MustCompile(`^\d{8}-\d{6}-[0-9a-f]{8}$`)
+
+// dropFolder returns the folder a drop-box upload goes into, starting a
+// session if the strategy asks for one
+func (h *FileHandler) dropFolder(w http.ResponseWriter, r *http.Request) string {
+	if h.dropFolders != DropPerSession {
+		return newDropName()
+	}
+	if c, err := r.Cookie(dropCookie); err == nil && dropName.MatchString(c.Value) {
+		return c.Value
+	}
+	name := newDropName()
+	http.SetCookie(w, &http.Cookie{
+		Name:     dropCookie,
+		Value:    name,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return name
+}
+
+// newDropName is a folder name that sorts by time and doesn't collide
+// with uploads made in the same second
+func newDropName() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
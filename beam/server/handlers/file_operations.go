@@ -1,352 +1,477 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"io"
+	"errors"
+	"io/fs"
 	"net/http"
-	"os"
 	"path"
-	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/tachRoutine/beamdrop-go/pkg/contentpolicy"
 	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/fileops"
+	"github.com/tachRoutine/beamdrop-go/pkg/jobs"
 	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/pipeline"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"github.com/tachRoutine/beamdrop-go/pkg/webhooks"
 )
 
 type FileOperationsHandler struct {
-	sharedDir string
+	roots    *sandbox.Roots
+	jobs     *jobs.Manager
+	scanner  *Scanner // nil unless clamd is configured
+	policies *contentpolicy.Set
+	hooks    *webhooks.Dispatcher
+	writeMu  sync.Mutex // serializes content writes, see Write
 }
 
-func NewFileOperationsHandler(sharedDir string) *FileOperationsHandler {
-	return &FileOperationsHandler{sharedDir: sharedDir}
+func NewFileOperationsHandler(roots *sandbox.Roots, jobs *jobs.Manager, scanner *Scanner, policies *contentpolicy.Set, hooks *webhooks.Dispatcher) *FileOperationsHandler {
+	return &FileOperationsHandler{roots: roots, jobs: jobs, scanner: scanner, policies: policies, hooks: hooks}
 }
 
+// Move moves a file or directory, also between shared roots and across
+// mount points
 func (h *FileOperationsHandler) Move(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	h.transfer(w, r, jobKindMove)
+}
 
-	var req struct {
-		SourcePath string `json:"sourcePath"`
-		TargetPath string `json:"targetPath"`
-	}
+// Copy copies a file or directory tree
+func (h *FileOperationsHandler) Copy(w http.ResponseWriter, r *http.Request) {
+	h.transfer(w, r, jobKindCopy)
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		logger.Error("Invalid move request: %v", err)
-		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
-		return
+// Kinds of the jobs queued by transfer
+const (
+	jobKindMove = "move"
+	jobKindCopy = "copy"
+)
+
+// transferParams are the settings of a move or copy job
+type transferParams struct {
+	Policy fileops.Policy `json:"policy"`
+	// Locks stand for the lock tokens the client sent, see lockDigest
+	Locks []string `json:"locks,omitempty"`
+}
+
+// RegisterJobs lets the job manager run moves, copies, batches, metadata
+// reconciles and the processing of uploads. Those interrupted by a restart
+// are resumed, except a batch, whose operations can't all be repeated.
+func RegisterJobs(m *jobs.Manager, roots *sandbox.Roots, pipe *pipeline.Pipeline, policies *contentpolicy.Set, hooks *webhooks.Dispatcher) {
+	for _, kind := range []string{jobKindMove, jobKindCopy} {
+		m.Register(kind, func(ctx context.Context, job jobs.Job, progress func(fileops.Progress)) (any, error) {
+			return nil, runTransfer(ctx, roots, policies, hooks, job, progress)
+		}, true)
+	}
+	// Batches write no new content, so they need no scanner
+	h := NewFileOperationsHandler(roots, m, nil, policies, hooks)
+	m.Register(jobKindBatch, h.runBatchJob, false)
+	m.Register(jobKindReconcile, func(ctx context.Context, job jobs.Job, progress func(fileops.Progress)) (any, error) {
+		return ReconcileMetadata(ctx, roots, progress)
+	}, true)
+	m.Register(jobKindProcess, func(ctx context.Context, job jobs.Job, progress func(fileops.Progress)) (any, error) {
+		return runProcessing(ctx, roots, pipe, job, progress)
+	}, true)
+}
+
+// runTransfer does the work of a move or copy job
+func runTransfer(ctx context.Context, roots *sandbox.Roots, policies *contentpolicy.Set, hooks *webhooks.Dispatcher, job jobs.Job, progress func(fileops.Progress)) error {
+	var params transferParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return err
+	}
+	// What's at the target after an interruption is the job's own partial
+	// result, which must not be removed again
+	if job.Resumed() && params.Policy == fileops.Overwrite {
+		params.Policy = fileops.Merge
 	}
 
-	sourcePath, err := ResolvePath(h.sharedDir, req.SourcePath)
+	// Checked again, the configuration may have changed since the job was queued
+	access := sandbox.Read
+	if job.Kind == jobKindMove {
+		access = sandbox.Write
+	}
+	src, srcName, err := roots.Locate(job.Source, access)
 	if err != nil {
-		sendJSONError(w, "Invalid source path", http.StatusBadRequest)
-		return
+		return err
 	}
-
-	targetPath, err := ResolvePath(h.sharedDir, req.TargetPath)
+	dst, dstName, err := roots.Locate(job.Target, sandbox.Write)
 	if err != nil {
-		sendJSONError(w, "Invalid target path", http.StatusBadRequest)
-		return
+		return err
 	}
-
-	if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
-		sendJSONError(w, "Source file not found", http.StatusNotFound)
-		return
+	if src == nil {
+		return sandbox.ErrTopLevel
 	}
-
-	if err := os.Rename(sourcePath, targetPath); err != nil {
-		logger.Error("Failed to move file from %s to %s: %v", sourcePath, targetPath, err)
-		sendJSONError(w, "Failed to move file", http.StatusInternalServerError)
-		return
+	locks, err := othersLocksByDigest(params.Locks)
+	if err != nil {
+		return err
+	}
+	if lock := coveringLock(locks, transferLocked(job.Kind, src.Join(srcName), dst.Join(dstName))...); lock != nil {
+		return errors.New(lockMessage(*lock))
+	}
+	violations, err := treeViolations(policies.For(dst.Name), src, srcName, dst, dstName)
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return errors.New(policyMessage(violations))
 	}
 
-	logger.Info("File moved from %s to %s", req.SourcePath, req.TargetPath)
-	sendJSONSuccess(w, map[string]string{
-		"message": "File moved successfully",
-		"from":    req.SourcePath,
-		"to":      req.TargetPath,
-	})
+	op := &fileops.Op{Src: src.FS, SrcName: srcName, Dst: dst.FS, DstName: dstName, Policy: params.Policy}
+	if job.Kind == jobKindMove {
+		op.OnMoved = movedMetadata(src, dst)
+	}
+	if err := op.Count(); err != nil {
+		logger.Warn("Failed to count %s: %v", job.Source, err)
+	}
+	op.OnProgress = progress
+	run := op.Copy
+	if job.Kind == jobKindMove {
+		run = op.Move
+	}
+	if err := run(ctx); err != nil {
+		return err
+	}
+	hooks.Emit(transferEvent(job.Kind, src.Join(srcName), dst.Join(dstName), ""))
+	return nil
 }
 
-func (h *FileOperationsHandler) Copy(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// transferLocked returns the paths a move or copy changes, which mustn't be
+// locked by anyone else
+func transferLocked(kind, from, to string) []string {
+	if kind == jobKindMove {
+		return []string{to, from}
 	}
+	return []string{to}
+}
 
-	var req struct {
-		SourcePath string `json:"sourcePath"`
-		TargetPath string `json:"targetPath"`
+// transferEvent is the webhook event of a finished move or copy
+func transferEvent(kind, from, to, client string) webhooks.Event {
+	e := webhooks.Event{Type: webhooks.Copy, Path: to, From: from, Client: client}
+	if kind == jobKindMove {
+		e.Type = webhooks.Move
 	}
+	return e
+}
+
+// transfer runs a move or copy. Directories that have to be copied, and
+// anything asked to, run as a job and get a 202 with the job to watch.
+func (h *FileOperationsHandler) transfer(w http.ResponseWriter, r *http.Request, kind string) {
+	var req MoveRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		logger.Error("Invalid copy request: %v", err)
-		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		logger.Error("Invalid %s request: %v", kind, err)
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
 		return
 	}
-
-	sourcePath, err := ResolvePath(h.sharedDir, req.SourcePath)
+	policy, err := fileops.ParsePolicy(req.Policy)
 	if err != nil {
-		sendJSONError(w, "Invalid source path", http.StatusBadRequest)
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 		return
 	}
 
-	targetPath, err := ResolvePath(h.sharedDir, req.TargetPath)
+	access, action := sandbox.Read, "copy file"
+	if kind == jobKindMove {
+		access, action = sandbox.Write, "move file"
+	}
+	src, srcName, ok := locate(w, h.roots, req.SourcePath, access, action)
+	if !ok {
+		return
+	}
+	dst, dstName, ok := locate(w, h.roots, req.TargetPath, sandbox.Write, action)
+	if !ok {
+		return
+	}
+	if src == nil || (kind == jobKindMove && srcName == ".") {
+		SendError(w, http.StatusBadRequest, CodeInvalidPath, "Refusing to "+kind+" a shared root")
+		return
+	}
+	info, err := src.Lstat(srcName)
 	if err != nil {
-		sendJSONError(w, "Invalid target path", http.StatusBadRequest)
+		sendPathError(w, err, action)
 		return
 	}
 
-	sourceFile, err := os.Open(sourcePath)
+	op := &fileops.Op{Src: src.FS, SrcName: srcName, Dst: dst.FS, DstName: dstName, Policy: policy}
+	if err := op.Check(); err != nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidPath, "Can't "+kind+" a directory into itself")
+		return
+	}
+	// Locks and the content policy are checked now, and again when a job
+	// starts
+	if !checkLocks(w, r, transferLocked(kind, src.Join(srcName), dst.Join(dstName))...) {
+		return
+	}
+	violations, err := treeViolations(h.policies.For(dst.Name), src, srcName, dst, dstName)
 	if err != nil {
-		logger.Error("Failed to open source file %s: %v", sourcePath, err)
-		sendJSONError(w, "Source file not found", http.StatusNotFound)
+		sendPathError(w, err, action)
 		return
 	}
-	defer sourceFile.Close()
+	if len(violations) > 0 {
+		sendPolicyError(w, violations)
+		return
+	}
+	run := op.Copy
+	if kind == jobKindMove {
+		run = op.Move
+		op.OnMoved = movedMetadata(src, dst)
+	}
 
-	targetFile, err := os.Create(targetPath)
-	if err != nil {
-		logger.Error("Failed to create target file %s: %v", targetPath, err)
-		sendJSONError(w, "Failed to create target file", http.StatusInternalServerError)
+	// A move within a root is a rename, however large the tree
+	if req.Background || (info.IsDir() && (kind == jobKindCopy || src != dst)) {
+		job, err := h.jobs.Submit(kind, req.SourcePath, req.TargetPath, transferParams{Policy: policy, Locks: lockDigests(lockTokens(r))})
+		if err != nil {
+			logger.Error("Failed to queue %s of %s: %v", kind, req.SourcePath, err)
+			SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to queue "+kind)
+			return
+		}
+		logger.Info("Queued %s job %s from %s to %s", kind, job.ID, req.SourcePath, req.TargetPath)
+		SendJSON(w, http.StatusAccepted, JobResponse{Message: "Queued in the background", Job: job})
 		return
 	}
-	defer targetFile.Close()
 
-	if _, err := io.Copy(targetFile, sourceFile); err != nil {
-		logger.Error("Failed to copy file from %s to %s: %v", sourcePath, targetPath, err)
-		sendJSONError(w, "Failed to copy file", http.StatusInternalServerError)
+	if err := run(r.Context()); err != nil {
+		logger.Error("Failed to %s %s to %s: %v", kind, req.SourcePath, req.TargetPath, err)
+		sendPathError(w, err, action)
 		return
 	}
 
-	logger.Info("File copied from %s to %s", req.SourcePath, req.TargetPath)
-	sendJSONSuccess(w, map[string]string{
-		"message": "File copied successfully",
-		"from":    req.SourcePath,
-		"to":      req.TargetPath,
+	progress := op.Progress()
+	logger.Info("%s from %s to %s: %d file(s), %d skipped", kind, req.SourcePath, req.TargetPath, progress.Files, progress.Skipped)
+	h.hooks.Emit(transferEvent(kind, src.Join(srcName), dst.Join(dstName), requestOwner(r)))
+	msg := "File copied successfully"
+	if kind == jobKindMove {
+		msg = "File moved successfully"
+	}
+	SendJSON(w, http.StatusOK, TransferResponse{
+		Message: msg,
+		From:    req.SourcePath,
+		To:      req.TargetPath,
+		Files:   progress.Files,
+		Skipped: progress.Skipped,
 	})
 }
 
 func (h *FileOperationsHandler) Mkdir(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var req struct {
-		DirPath string `json:"dirPath"`
-	}
+	var req MkdirRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		logger.Error("Invalid mkdir request: %v", err)
-		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
 		return
 	}
 
-	targetPath, err := ResolvePath(h.sharedDir, req.DirPath)
-	if err != nil {
-		sendJSONError(w, "Invalid directory path", http.StatusBadRequest)
+	root, name, ok := locate(w, h.roots, req.DirPath, sandbox.Write, "create directory")
+	if !ok {
 		return
 	}
 
-	if _, err := os.Stat(targetPath); !os.IsNotExist(err) {
-		sendJSONError(w, "Directory already exists", http.StatusConflict)
+	if _, err := root.Lstat(name); !errors.Is(err, fs.ErrNotExist) {
+		if err != nil {
+			sendPathError(w, err, "create directory")
+			return
+		}
+		SendError(w, http.StatusConflict, CodeAlreadyExists, "Directory already exists")
 		return
 	}
 
-	if err := os.MkdirAll(targetPath, 0755); err != nil {
-		logger.Error("Failed to create directory %s: %v", targetPath, err)
-		sendJSONError(w, "Failed to create directory", http.StatusInternalServerError)
+	if err := root.MkdirAll(name, sandbox.DirMode); err != nil {
+		logger.Error("Failed to create directory %s: %v", req.DirPath, err)
+		sendPathError(w, err, "create directory")
 		return
 	}
 
 	logger.Info("Directory created: %s", req.DirPath)
-	sendJSONSuccess(w, map[string]string{
-		"message": "Directory created successfully",
-		"path":    req.DirPath,
+	h.hooks.Emit(webhooks.Event{Type: webhooks.Mkdir, Path: root.Join(name), Client: requestOwner(r)})
+	SendJSON(w, http.StatusOK, PathResponse{
+		Message: "Directory created successfully",
+		Path:    req.DirPath,
 	})
 }
 
 func (h *FileOperationsHandler) Rename(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var req struct {
-		OldPath string `json:"oldPath"`
-		NewName string `json:"newName"`
-	}
+	var req RenameRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		logger.Error("Invalid rename request: %v", err)
-		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
 		return
 	}
 
-	oldPath, err := ResolvePath(h.sharedDir, req.OldPath)
-	if err != nil {
-		sendJSONError(w, "Invalid old path", http.StatusBadRequest)
+	// A new name can't move the entry to another directory
+	if req.NewName == "" || req.NewName == "." || req.NewName == ".." || strings.ContainsAny(req.NewName, "/\\") {
+		SendError(w, http.StatusBadRequest, CodeInvalidPath, "Invalid new name")
 		return
 	}
 
-	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
-		sendJSONError(w, "File or directory not found", http.StatusNotFound)
+	root, oldName, ok := locate(w, h.roots, req.OldPath, sandbox.Write, "rename")
+	if !ok {
 		return
 	}
-
-	// Get the parent directory and create new path
-	parentDir := path.Dir(req.OldPath)
-	var newPath string
-	if parentDir == "." || parentDir == "" {
-		newPath = req.NewName
-	} else {
-		newPath = path.Join(parentDir, req.NewName)
-	}
-
-	newFullPath, err := ResolvePath(h.sharedDir, newPath)
-	if err != nil {
-		sendJSONError(w, "Invalid new name", http.StatusBadRequest)
+	if oldName == "." {
+		SendError(w, http.StatusBadRequest, CodeInvalidPath, "Refusing to rename the shared directory")
 		return
 	}
-
-	if _, err := os.Stat(newFullPath); !os.IsNotExist(err) {
-		sendJSONError(w, "Target name already exists", http.StatusConflict)
+	if _, err := root.Lstat(oldName); err != nil {
+		sendPathError(w, err, "rename")
 		return
 	}
 
-	if err := os.Rename(oldPath, newFullPath); err != nil {
-		logger.Error("Failed to rename %s to %s: %v", oldPath, newFullPath, err)
-		sendJSONError(w, "Failed to rename", http.StatusInternalServerError)
+	// Get the parent directory and create new path
+	newName := path.Join(path.Dir(oldName), req.NewName)
+	newPath := root.Join(newName)
+	if !checkLocks(w, r, root.Join(oldName), newPath) {
 		return
 	}
 
-	logger.Info("Renamed %s to %s", req.OldPath, newPath)
-	sendJSONSuccess(w, map[string]string{
-		"message": "Renamed successfully",
-		"oldPath": req.OldPath,
-		"newPath": newPath,
-	})
-}
-
-func (h *FileOperationsHandler) Write(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if _, err := root.Lstat(newName); !errors.Is(err, fs.ErrNotExist) {
+		if err != nil {
+			sendPathError(w, err, "rename")
+			return
+		}
+		SendError(w, http.StatusConflict, CodeAlreadyExists, "Target name already exists")
 		return
 	}
-
-	var req struct {
-		FilePath string `json:"filePath"`
-		Content  string `json:"content"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		logger.Error("Invalid write request: %v", err)
-		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+	// A new name mustn't turn a file into one the policy refuses, like a
+	// photo.jpg holding a program renamed to setup.exe
+	violations, err := treeViolations(h.policies.For(root.Name), root, oldName, root, newName)
+	if err != nil {
+		sendPathError(w, err, "rename")
 		return
 	}
-
-	if req.FilePath == "" {
-		sendJSONError(w, "File path is required", http.StatusBadRequest)
+	if len(violations) > 0 {
+		sendPolicyError(w, violations)
 		return
 	}
 
-	targetPath, err := ResolvePath(h.sharedDir, req.FilePath)
-	if err != nil {
-		sendJSONError(w, "Invalid file path", http.StatusBadRequest)
+	if err := root.Rename(oldName, newName); err != nil {
+		logger.Error("Failed to rename %s to %s: %v", req.OldPath, newPath, err)
+		sendPathError(w, err, "rename")
 		return
 	}
-
-	// Create parent directories if they don't exist
-	parentDir := path.Dir(targetPath)
-	if err := os.MkdirAll(parentDir, 0755); err != nil {
-		logger.Error("Failed to create parent directory %s: %v", parentDir, err)
-		sendJSONError(w, "Failed to create parent directory", http.StatusInternalServerError)
-		return
+	resp := RenameResponse{
+		Message: "Renamed successfully",
+		OldPath: req.OldPath,
+		NewPath: newPath,
 	}
-
-	// Write file content
-	if err := os.WriteFile(targetPath, []byte(req.Content), 0644); err != nil {
-		logger.Error("Failed to write file %s: %v", targetPath, err)
-		sendJSONError(w, "Failed to write file", http.StatusInternalServerError)
-		return
+	// The rename stands; only the metadata is left at the old path
+	if err := db.MovePaths(root.Join(oldName), newPath); err != nil {
+		resp.Warning = "Failed to move metadata to the new name"
 	}
 
-	logger.Info("File written successfully: %s", req.FilePath)
-	sendJSONSuccess(w, map[string]string{
-		"message":  "File written successfully",
-		"filePath": req.FilePath,
-	})
+	logger.Info("Renamed %s to %s", req.OldPath, newPath)
+	h.hooks.Emit(webhooks.Event{Type: webhooks.Rename, Path: newPath, From: root.Join(oldName), Client: requestOwner(r)})
+	SendJSON(w, http.StatusOK, resp)
 }
 
 func (h *FileOperationsHandler) Search(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	query := r.URL.Query().Get("q")
-	if query == "" {
-		sendJSONError(w, "Search query is required", http.StatusBadRequest)
+	tags := searchTags(r)
+	if query == "" && len(tags) == 0 {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Search query or tag is required")
 		return
 	}
 
 	searchPath := r.URL.Query().Get("path")
-	if searchPath == "" {
-		searchPath = ""
+	root, dir, ok := locate(w, h.roots, searchPath, sandbox.Read, "search")
+	if !ok {
+		return
 	}
 
-	targetPath, err := ResolvePath(h.sharedDir, searchPath)
-	if err != nil {
-		sendJSONError(w, "Invalid search path", http.StatusBadRequest)
+	// The top level searches every visible root that can be read
+	searched := []*sandbox.Root{root}
+	if root == nil {
+		searched = nil
+		for _, r := range h.roots.Visible() {
+			if r.Allow(sandbox.Read) == nil {
+				searched = append(searched, r)
+			}
+		}
+	} else if _, err := root.Stat(dir); err != nil {
+		sendPathError(w, err, "search")
 		return
 	}
 
-	var results []File
-	err = searchFiles(targetPath, query, searchPath, &results)
+	results := []File{}
+	var err error
+	if len(tags) > 0 {
+		ids, ok := tagIDs(w, tags)
+		if !ok {
+			return
+		}
+		err = h.searchTagged(searched, dir, query, ids, &results)
+	} else {
+		for _, r := range searched {
+			if err = searchFiles(r, dir, query, &results); err != nil {
+				break
+			}
+		}
+	}
 	if err != nil {
 		logger.Error("Search failed: %v", err)
-		sendJSONError(w, "Search failed", http.StatusInternalServerError)
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Search failed")
 		return
 	}
+	showLocks(results)
+	showTags(results)
+	showComments(results)
 
 	logger.Info("Search completed for query '%s' in path '%s', found %d results", query, searchPath, len(results))
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{
-		"query":   query,
-		"path":    searchPath,
-		"results": results,
-		"count":   len(results),
+	SendJSON(w, http.StatusOK, SearchResponse{
+		Query:   query,
+		Tags:    tags,
+		Path:    searchPath,
+		Results: results,
+		Count:   len(results),
 	})
 }
 
+// Star toggles the star of a file
 func (h *FileOperationsHandler) Star(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	if resp, ok := h.toggleStar(w, r); ok {
+		SendJSON(w, http.StatusOK, resp)
 	}
+}
 
-	var req struct {
-		FilePath string `json:"filePath"`
+// LegacyStar backs the deprecated /star route, which sends starred as a
+// string
+func (h *FileOperationsHandler) LegacyStar(w http.ResponseWriter, r *http.Request) {
+	if resp, ok := h.toggleStar(w, r); ok {
+		SendJSON(w, http.StatusOK, LegacyStarResponse{Message: resp.Message, FilePath: resp.FilePath, Starred: strconv.FormatBool(resp.Starred)})
 	}
+}
+
+// toggleStar stars the file of the request, or unstars it if it's already
+// starred. It reports whether it succeeded, having sent the error if not.
+func (h *FileOperationsHandler) toggleStar(w http.ResponseWriter, r *http.Request) (StarResponse, bool) {
+	var req StarRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		logger.Error("Invalid star request: %v", err)
-		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
-		return
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return StarResponse{}, false
 	}
 
-	target, err := ResolvePath(h.sharedDir, req.FilePath)
-	if err != nil {
-		sendJSONError(w, "Invalid file path", http.StatusBadRequest)
-		return
+	root, name, ok := locate(w, h.roots, req.FilePath, sandbox.Read, "star file")
+	if !ok {
+		return StarResponse{}, false
+	}
+	if root != nil {
+		if _, err := root.Lstat(name); err != nil {
+			sendPathError(w, err, "star file")
+			return StarResponse{}, false
+		}
 	}
 
-	if _, err := os.Stat(target); os.IsNotExist(err) {
-		sendJSONError(w, "File not found", http.StatusNotFound)
-		return
+	// Stars are kept under the canonical path, which follows moves
+	if root != nil {
+		req.FilePath = root.Join(name)
 	}
 
 	// Toggle star status: if already starred, unstars it; otherwise stars it
@@ -354,99 +479,103 @@ func (h *FileOperationsHandler) Star(w http.ResponseWriter, r *http.Request) {
 	if isStarred {
 		if err := db.UnstarFile(req.FilePath); err != nil {
 			logger.Error("Failed to unstar file %s: %v", req.FilePath, err)
-			sendJSONError(w, "Failed to unstar file", http.StatusInternalServerError)
-			return
+			SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to unstar file")
+			return StarResponse{}, false
 		}
 		logger.Info("File unstarred: %s", req.FilePath)
-		sendJSONSuccess(w, map[string]string{"message": "File unstarred", "filePath": req.FilePath, "starred": "false"})
-	} else {
-		if err := db.StarFile(req.FilePath); err != nil {
-			logger.Error("Failed to star file %s: %v", req.FilePath, err)
-			sendJSONError(w, "Failed to star file", http.StatusInternalServerError)
-			return
-		}
-		logger.Info("File starred: %s", req.FilePath)
-		sendJSONSuccess(w, map[string]string{"message": "File starred", "filePath": req.FilePath, "starred": "true"})
+		return StarResponse{Message: "File unstarred", FilePath: req.FilePath, Starred: false}, true
+	}
+	if err := db.StarFile(req.FilePath); err != nil {
+		logger.Error("Failed to star file %s: %v", req.FilePath, err)
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to star file")
+		return StarResponse{}, false
 	}
+	trackPaths(h.roots, req.FilePath)
+	logger.Info("File starred: %s", req.FilePath)
+	return StarResponse{Message: "File starred", FilePath: req.FilePath, Starred: true}, true
 }
 
 func (h *FileOperationsHandler) Starred(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		sendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	starredFiles, err := db.GetStarredFiles()
 	if err != nil {
 		logger.Error("Failed to retrieve starred files: %v", err)
-		sendJSONError(w, "Failed to retrieve starred files", http.StatusInternalServerError)
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to retrieve starred files")
 		return
 	}
 
-	// Convert to a more frontend-friendly format
-	result := make([]map[string]string, len(starredFiles))
-	for i, sf := range starredFiles {
-		result[i] = map[string]string{
-			"filePath":  sf.FilePath,
-			"createdAt": sf.CreatedAt.Format(time.RFC3339),
+	// Convert to a more frontend-friendly format, leaving out files that
+	// can't be read in the current mode
+	result := make([]StarredFile, 0, len(starredFiles))
+	for _, sf := range starredFiles {
+		if _, _, err := h.roots.Locate(sf.FilePath, sandbox.Read); err != nil {
+			continue
 		}
+		result = append(result, StarredFile{
+			FilePath:  sf.FilePath,
+			CreatedAt: sf.CreatedAt.Format(time.RFC3339),
+		})
 	}
 
 	logger.Debug("Retrieved %d starred files", len(starredFiles))
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{
-		"starred": result,
-	})
+	SendJSON(w, http.StatusOK, StarredResponse{Starred: result})
 }
 
-// Helper functions
-func sendJSONSuccess(w http.ResponseWriter, data map[string]string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(data)
-}
-
-// searchFiles recursively searches for files matching the query in the given directory
-func searchFiles(rootPath, query, relativePath string, results *[]File) error {
-	return filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+// searchFiles recursively searches for files matching the query below the
+// directory dir of a root
+func searchFiles(root *sandbox.Root, dir, query string, results *[]File) error {
+	query = strings.ToLower(query)
+	return fs.WalkDir(root.FS.FS(), dir, func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
-			logger.Warn("Error accessing path %s: %v", path, err)
+			logger.Warn("Error accessing path %s: %v", p, err)
 			return nil // Continue searching other files
 		}
 
-		// Get relative path from the search root
-		relPath, err := filepath.Rel(rootPath, path)
-		if err != nil {
-			return nil
-		}
-
-		// Construct the path relative to the shared directory
-		var fullRelPath string
-		if relativePath == "" {
-			fullRelPath = relPath
-		} else {
-			fullRelPath = filepath.Join(relativePath, relPath)
-		}
-
 		// Skip the root directory itself
-		if relPath == "." {
+		if p == dir {
 			return nil
 		}
 
 		// Check if filename contains the search query (case-insensitive)
-		if strings.Contains(strings.ToLower(info.Name()), strings.ToLower(query)) {
-			filePath := strings.ReplaceAll(fullRelPath, "\\", "/") // Normalize path separators
-			file := File{
-				Name:      info.Name(),
-				IsDir:     info.IsDir(),
-				Size:      FormatFileSize(info.Size()),
-				ModTime:   FormatModTime(info.ModTime().Format(time.RFC3339)),
-				Path:      filePath,
-				IsStarred: db.IsStarred(filePath),
+		if !sandbox.IsTemp(d.Name()) && strings.Contains(strings.ToLower(d.Name()), query) {
+			info, err := d.Info()
+			if err != nil {
+				return nil
 			}
+			file := newFile(root.FS, p, root.Join(p), info)
+			file.IsStarred = db.IsStarred(file.Path)
 			*results = append(*results, file)
 		}
 
 		return nil
 	})
 }
+
+// searchTagged finds the paths below dir in the searched roots that carry
+// every one of the tags and whose name contains query
+func (h *FileOperationsHandler) searchTagged(searched []*sandbox.Root, dir, query string, tagIDs []uint, results *[]File) error {
+	paths, err := db.GetTaggedPaths(tagIDs)
+	if err != nil {
+		return err
+	}
+	query = strings.ToLower(query)
+	for _, p := range paths {
+		root, name, err := h.roots.Locate(p, sandbox.Read)
+		if err != nil || !slices.Contains(searched, root) {
+			continue
+		}
+		if name == dir || (dir != "." && !strings.HasPrefix(name, dir+"/")) {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(path.Base(name)), query) {
+			continue
+		}
+		info, err := root.Lstat(name)
+		if err != nil {
+			continue // Tagged but since removed
+		}
+		file := newFile(root.FS, name, p, info)
+		file.IsStarred = db.IsStarred(p)
+		*results = append(*results, file)
+	}
+	return nil
+}
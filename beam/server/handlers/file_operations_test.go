@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/fileops"
+	"github.com/tachRoutine/beamdrop-go/pkg/jobs"
+	"github.com/tachRoutine/beamdrop-go/pkg/pipeline"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"github.com/tachRoutine/beamdrop-go/pkg/webhooks"
+)
+
+// singleRoot shares a temporary directory holding the files, by path
+func singleRoot(t *testing.T, files map[string]string) *sandbox.Roots {
+	t.Helper()
+	fs, err := sandbox.New(t.TempDir(), sandbox.SymlinksDeny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := fs.MkdirAll(path.Dir(name), sandbox.DirMode); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.WriteFile(name, []byte(content), sandbox.FileMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	roots := sandbox.Single(fs)
+	t.Cleanup(func() { roots.Close() })
+	return roots
+}
+
+// post runs handler on a POST of the JSON body
+func post(handler http.HandlerFunc, body any) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data)))
+	return w
+}
+
+func rename(t *testing.T, h *FileOperationsHandler, oldPath, newName string) RenameResponse {
+	t.Helper()
+	w := post(h.Rename, RenameRequest{OldPath: oldPath, NewName: newName})
+	if w.Code != http.StatusOK {
+		t.Fatalf("rename answered %d: %s", w.Code, w.Body)
+	}
+	var resp RenameResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestRenameMovesMetadata(t *testing.T) {
+	roots := singleRoot(t, map[string]string{"rename-a.txt": "a", "rename-c.txt": "c"})
+	h := NewFileOperationsHandler(roots, jobs.NewManager(1), nil, acceptAll, webhooks.NewDispatcher())
+
+	db.StarFile("rename-a.txt")
+	resp := rename(t, h, "rename-a.txt", "rename-b.txt")
+	if resp.Warning != "" || !db.IsStarred("rename-b.txt") || db.IsStarred("rename-a.txt") {
+		t.Errorf("the star didn't follow the rename (warning %q)", resp.Warning)
+	}
+
+	// A failed update is reported, not passed over
+	db.StarFile("rename-c.txt")
+	if err := db.GetDB().Migrator().DropTable(&db.Comment{}); err != nil {
+		t.Fatal(err)
+	}
+	defer db.AutoMigrate()
+	resp = rename(t, h, "rename-c.txt", "rename-d.txt")
+	if resp.Warning == "" {
+		t.Error("no warning after the metadata failed to move")
+	}
+	if _, err := roots.All()[0].Lstat("rename-d.txt"); err != nil {
+		t.Errorf("the file wasn't renamed: %v", err)
+	}
+}
+
+func TestTransferJobChecksLocks(t *testing.T) {
+	roots := singleRoot(t, map[string]string{"xfer-mine.txt": "a", "xfer-theirs.txt": "b"})
+	m := jobs.NewManager(1)
+	hooks := webhooks.NewDispatcher()
+	RegisterJobs(m, roots, pipeline.New(nil, nil), acceptAll, hooks)
+	h := NewFileOperationsHandler(roots, m, nil, acceptAll, hooks)
+	mine, theirs := newToken(), newToken()
+
+	// The client's own lock doesn't stop it
+	lock(t, "xfer-mine.txt", mine)
+	job := queue(t, m, h.Move, MoveRequest{SourcePath: "xfer-mine.txt", TargetPath: "xfer-moved.txt", Background: true}, mine)
+	if err := runTransfer(context.Background(), roots, acceptAll, hooks, job, func(fileops.Progress) {}); err != nil {
+		t.Errorf("move under the client's own lock failed: %v", err)
+	}
+
+	// Someone else's lock on the source or the target taken after the job
+	// was queued does
+	for _, locked := range []string{"xfer-theirs.txt", "xfer-target.txt"} {
+		t.Run(locked, func(t *testing.T) {
+			job := queue(t, m, h.Move, MoveRequest{SourcePath: "xfer-theirs.txt", TargetPath: "xfer-target.txt", Background: true}, mine)
+			lock(t, locked, theirs)
+			err := runTransfer(context.Background(), roots, acceptAll, hooks, job, func(fileops.Progress) {})
+			if err == nil || !strings.HasPrefix(err.Error(), "Locked by") {
+				t.Errorf("move under another client's lock: got %v", err)
+			}
+			if _, err := roots.All()[0].Lstat("xfer-theirs.txt"); err != nil {
+				t.Errorf("the file was moved: %v", err)
+			}
+		})
+	}
+}
+
+func TestMoveFileOntoDirectory(t *testing.T) {
+	roots := singleRoot(t, map[string]string{"onto-a.txt": "a", "onto-docs/important.txt": "keep"})
+	h := NewFileOperationsHandler(roots, jobs.NewManager(1), nil, acceptAll, webhooks.NewDispatcher())
+
+	w := post(h.Move, MoveRequest{SourcePath: "onto-a.txt", TargetPath: "onto-docs"})
+	expectError(t, w, http.StatusConflict, CodeAlreadyExists)
+	if _, err := roots.All()[0].Lstat("onto-docs/important.txt"); err != nil {
+		t.Errorf("the directory lost its content: %v", err)
+	}
+}
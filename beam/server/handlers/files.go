@@ -1,125 +1,223 @@
 package handlers
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
 	"net/http"
-	"os"
 	"path"
-	"time"
+	"slices"
+	"strings"
 
+	"github.com/tachRoutine/beamdrop-go/pkg/contentpolicy"
 	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/jobs"
 	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/pipeline"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"github.com/tachRoutine/beamdrop-go/pkg/webhooks"
 )
 
 type FileHandler struct {
-	sharedDir string
+	roots       *sandbox.Roots
+	dropFolders string // DropPerUpload or DropPerSession
+	jobs        *jobs.Manager
+	pipeline    *pipeline.Pipeline // run on uploaded files
+	scanner     *Scanner           // nil when uploads aren't scanned
+	policies    *contentpolicy.Set // what each root accepts
+	hooks       *webhooks.Dispatcher
 }
 
-func NewFileHandler(sharedDir string) *FileHandler {
-	return &FileHandler{sharedDir: sharedDir}
+func NewFileHandler(roots *sandbox.Roots, dropFolders string, jobs *jobs.Manager, pipe *pipeline.Pipeline, scanner *Scanner, policies *contentpolicy.Set, hooks *webhooks.Dispatcher) *FileHandler {
+	return &FileHandler{roots: roots, dropFolders: dropFolders, jobs: jobs, pipeline: pipe, scanner: scanner, policies: policies, hooks: hooks}
 }
 
+// ListFiles returns a page of a directory listing
 func (h *FileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
-	logger.Debug("Listing files from directory: %s", h.sharedDir)
-	w.Header().Set("Content-Type", "application/json")
-
-	reqPath := r.URL.Query().Get("path")
-	target, err := ResolvePath(h.sharedDir, reqPath)
-	if err != nil {
-		http.Error(w, `{"error":"invalid path"}`, http.StatusBadRequest)
+	listing, ok := h.list(w, r)
+	if !ok {
 		return
 	}
+	SendJSON(w, http.StatusOK, listing)
+}
 
-	if IsFile(target) {
-		http.ServeFile(w, r, target)
+// ListOrServe backs the legacy /files route, which returns the content of
+// the path when it's a file and a bare array of entries otherwise
+func (h *FileHandler) ListOrServe(w http.ResponseWriter, r *http.Request) {
+	reqPath := r.URL.Query().Get("path")
+	if root, name, err := h.roots.Locate(reqPath, sandbox.Read); err == nil && root != nil {
+		if info, err := root.Stat(name); err == nil && !info.IsDir() {
+			h.serve(w, r, reqPath)
+			return
+		}
+	}
+	listing, ok := h.list(w, r)
+	if !ok {
 		return
 	}
+	SendJSON(w, http.StatusOK, listing.Entries)
+}
 
-	files, err := os.ReadDir(target)
+// list reads, filters, sorts and pages the directory named by the request,
+// writing an error response if that fails
+func (h *FileHandler) list(w http.ResponseWriter, r *http.Request) (*Listing, bool) {
+	opts, err := parseListOptions(r.URL.Query())
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"%v"}`, err), http.StatusInternalServerError)
-		return
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return nil, false
+	}
+
+	reqPath := r.URL.Query().Get("path")
+	root, dir, ok := locate(w, h.roots, reqPath, sandbox.Read, "read directory")
+	if !ok {
+		return nil, false
 	}
 
 	var fileList []File
-	for _, f := range files {
-		info, err := f.Info()
+	if root == nil {
+		fileList = topLevel(h.roots)
+	} else {
+		logger.Debug("Listing files from directory: %s", root.Dir())
+		entries, err := root.ReadDir(dir)
 		if err != nil {
+			if info, serr := root.Stat(dir); serr == nil && !info.IsDir() {
+				SendError(w, http.StatusBadRequest, CodeNotADirectory, "Path is not a directory")
+				return nil, false
+			}
+			sendPathError(w, err, "read directory")
+			return nil, false
+		}
+
+		fileList = make([]File, 0, len(entries))
+		for _, e := range entries {
+			// Files still being written aren't there yet
+			if sandbox.IsTemp(e.Name()) {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			name := path.Join(dir, e.Name())
+			fileList = append(fileList, newFile(root.FS, name, root.Join(name), info))
+		}
+	}
+	if !opts.Hidden {
+		fileList = slices.DeleteFunc(fileList, func(f File) bool { return f.Hidden })
+	}
+	sortFiles(fileList, opts)
+
+	page, next, err := paginate(fileList, opts)
+	if err != nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return nil, false
+	}
+
+	// Only the returned page pays for the star lookups and child counts
+	for i := range page {
+		page[i].IsStarred = db.IsStarred(page[i].Path)
+		if !page[i].IsDir {
 			continue
 		}
-		filePath := path.Join(reqPath, info.Name())
-		fileList = append(fileList, File{
-			Name:      info.Name(),
-			IsDir:     info.IsDir(),
-			Size:      FormatFileSize(info.Size()),
-			ModTime:   FormatModTime(info.ModTime().Format(time.RFC3339)),
-			Path:      filePath,
-			IsStarred: db.IsStarred(filePath),
-		})
-	}
-
-	json.NewEncoder(w).Encode(fileList)
+		if root, name, err := h.roots.Locate(page[i].Path, sandbox.Read); err == nil && root != nil {
+			n := countEntries(root.FS, name)
+			page[i].Children = &n
+		}
+	}
+	showLocks(page)
+	showTags(page)
+	showComments(page)
+	showScans(page)
+
+	return &Listing{
+		Path:       reqPath,
+		Entries:    page,
+		Total:      len(fileList),
+		NextCursor: next,
+	}, true
 }
 
 func (h *FileHandler) Download(w http.ResponseWriter, r *http.Request) {
-	filename := r.URL.Query().Get("file")
-	filePath := h.sharedDir + "/" + filename
-
+	filename := queryPath(r)
 	logger.Info("Download request for file: %s", filename)
-	f, err := os.Open(filePath)
+	if h.serve(w, r, filename) {
+		db.IncrementDownloads()
+		logger.Info("Download completed for file: %s", filename)
+	}
+}
+
+// serve sends the content of a file, reporting whether it got that far
+func (h *FileHandler) serve(w http.ResponseWriter, r *http.Request, reqPath string) bool {
+	root, name, ok := locate(w, h.roots, reqPath, sandbox.Read, "open file")
+	if !ok {
+		return false
+	}
+	if root == nil {
+		SendError(w, http.StatusBadRequest, CodeIsADirectory, "Path is a directory")
+		return false
+	}
+
+	f, err := root.Open(name)
 	if err != nil {
-		logger.Error("Failed to open file %s: %v", filePath, err)
-		http.Error(w, "File not found", 404)
-		return
+		logger.Error("Failed to open file %s: %v", name, err)
+		sendPathError(w, err, "open file")
+		return false
 	}
 	defer f.Close()
 
-	logger.Info("Serving download for file: %s", filename)
-	io.Copy(w, f)
-	db.IncrementDownloads()
-	logger.Info("Download completed for file: %s", filename)
+	info, err := f.Stat()
+	if err != nil {
+		sendPathError(w, err, "open file")
+		return false
+	}
+	if info.IsDir() {
+		SendError(w, http.StatusBadRequest, CodeIsADirectory, "Path is a directory")
+		return false
+	}
+
+	// ServeContent handles Range requests so clients can resume downloads
+	logger.Info("Serving download for file: %s", name)
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	// A resumed or streamed download asks for the rest in ranges
+	if rng := r.Header.Get("Range"); rng == "" || strings.HasPrefix(rng, "bytes=0-") {
+		h.hooks.Emit(webhooks.Event{Type: webhooks.Download, Path: root.Join(name), Size: info.Size(), Client: requestOwner(r)})
+	}
+	return true
 }
 
-func (h *FileHandler) Upload(w http.ResponseWriter, r *http.Request) {
-	logger.Info("Upload request received")
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		logger.Error("Invalid upload request: %v", err)
-		sendJSONError(w, "Invalid upload", http.StatusBadRequest)
+// Delete removes a file or a directory with everything in it
+func (h *FileHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	reqPath := queryPath(r)
+	root, name, ok := locate(w, h.roots, reqPath, sandbox.Write, "delete file")
+	if !ok {
+		return
+	}
+	if name == "." {
+		SendError(w, http.StatusBadRequest, CodeInvalidPath, "Refusing to delete the shared directory")
 		return
 	}
-	defer file.Close()
-
-	filePath := h.sharedDir + "/" + header.Filename
-	logger.Info("Uploading file: %s (size: %s)", header.Filename, FormatFileSize(header.Size))
 
-	out, err := os.Create(filePath)
-	if err != nil {
-		logger.Error("Failed to create file %s: %v", filePath, err)
-		sendJSONError(w, "Failed to save file", http.StatusInternalServerError)
+	if _, err := root.Lstat(name); err != nil {
+		sendPathError(w, err, "delete file")
+		return
+	}
+	if !checkLocks(w, r, root.Join(name)) {
 		return
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, file)
-	if err != nil {
-		logger.Error("Failed to write file %s: %v", filePath, err)
-		sendJSONError(w, "Failed to write file", http.StatusInternalServerError)
+	if err := root.RemoveAll(name); err != nil {
+		sendPathError(w, err, "delete file")
 		return
 	}
+	db.ForgetPaths(root.Join(name))
+	h.hooks.Emit(webhooks.Event{Type: webhooks.Delete, Path: root.Join(name), Client: requestOwner(r)})
 
-	logger.Info("File uploaded successfully: %s", header.Filename)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	db.IncrementUploads()
-	json.NewEncoder(w).Encode(map[string]string{"message": "Uploaded", "file": header.Filename})
+	logger.Info("Deleted %s", reqPath)
+	SendJSON(w, http.StatusOK, PathResponse{Message: "Deleted successfully", Path: reqPath})
 }
 
-// Helper function
-func sendJSONError(w http.ResponseWriter, message string, statusCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
+// queryPath returns the "path" query parameter, falling back to the "file"
+// parameter used by the legacy routes
+func queryPath(r *http.Request) string {
+	if p := r.URL.Query().Get("path"); p != "" {
+		return p
+	}
+	return r.URL.Query().Get("file")
 }
@@ -1,43 +1,29 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
 	"os"
 
 	"github.com/tachRoutine/beamdrop-go/pkg/db"
 	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
 )
 
 // HealthHandler handles the /health endpoint for liveness checks
 // This is a simple check that the server is running and responding
 func HealthHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		w.Header().Set("Allow", "GET")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "healthy",
-		"service": "beamdrop",
+	SendJSON(w, http.StatusOK, HealthResponse{
+		Status:  "healthy",
+		Service: "beamdrop",
 	})
 }
 
 // ReadinessHandler handles the /ready endpoint for readiness checks
 // This checks if the service is ready to accept traffic by verifying:
 // - Database connection is working
-// - Shared directory is accessible
-func ReadinessHandler(sharedDir string) http.HandlerFunc {
+// - Every shared root is accessible
+func ReadinessHandler(roots *sandbox.Roots) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "GET" {
-			w.Header().Set("Allow", "GET")
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
 		checks := make(map[string]string)
 		allHealthy := true
 
@@ -61,47 +47,47 @@ func ReadinessHandler(sharedDir string) http.HandlerFunc {
 			}
 		}
 
-		// Check shared directory accessibility
-		if sharedDir == "" {
-			checks["shared_directory"] = "not configured"
-			allHealthy = false
-		} else {
-			info, err := os.Stat(sharedDir)
-			if err != nil {
-				checks["shared_directory"] = "error: " + err.Error()
-				allHealthy = false
-			} else if !info.IsDir() {
-				checks["shared_directory"] = "error: not a directory"
-				allHealthy = false
-			} else {
-				// Check if directory is readable
-				_, err := os.ReadDir(sharedDir)
-				if err != nil {
-					checks["shared_directory"] = "error: not readable - " + err.Error()
-					allHealthy = false
-				} else {
-					checks["shared_directory"] = "ok"
-				}
+		// Check that every shared root is accessible
+		if roots.Virtual() {
+			for _, root := range roots.All() {
+				key := "root:" + root.Name
+				checks[key] = checkDir(root.Dir())
+				allHealthy = allHealthy && checks[key] == "ok"
 			}
+		} else {
+			checks["shared_directory"] = checkDir(roots.All()[0].Dir())
+			allHealthy = allHealthy && checks["shared_directory"] == "ok"
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-
 		if allHealthy {
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]any{
-				"status":  "ready",
-				"service": "beamdrop",
-				"checks":  checks,
+			SendJSON(w, http.StatusOK, ReadinessResponse{
+				Status:  "ready",
+				Service: "beamdrop",
+				Checks:  checks,
 			})
 		} else {
-			w.WriteHeader(http.StatusServiceUnavailable)
 			logger.Warn("Readiness check failed: %v", checks)
-			json.NewEncoder(w).Encode(map[string]any{
-				"status":  "not ready",
-				"service": "beamdrop",
-				"checks":  checks,
+			SendJSON(w, http.StatusServiceUnavailable, ReadinessResponse{
+				Status:  "not ready",
+				Service: "beamdrop",
+				Checks:  checks,
 			})
 		}
 	}
 }
+
+// checkDir reports "ok" if dir is a readable directory, or what's wrong with it
+func checkDir(dir string) string {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	if !info.IsDir() {
+		return "error: not a directory"
+	}
+	// Check if directory is readable
+	if _, err := os.ReadDir(dir); err != nil {
+		return "error: not readable - " + err.Error()
+	}
+	return "ok"
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/jobs"
+)
+
+// JobsHandler lets clients watch and cancel background jobs
+type JobsHandler struct {
+	jobs *jobs.Manager
+}
+
+func NewJobsHandler(jobs *jobs.Manager) *JobsHandler {
+	return &JobsHandler{jobs: jobs}
+}
+
+// List returns every job, newest first
+func (h *JobsHandler) List(w http.ResponseWriter, r *http.Request) {
+	list, err := h.jobs.List()
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to list jobs")
+		return
+	}
+	SendJSON(w, http.StatusOK, JobsResponse{Jobs: list})
+}
+
+// Get returns the job named in the path
+func (h *JobsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Get(r.PathValue("id"))
+	if errors.Is(err, jobs.ErrNotFound) {
+		SendError(w, http.StatusNotFound, CodeNotFound, "Job not found")
+		return
+	}
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to get job")
+		return
+	}
+	SendJSON(w, http.StatusOK, JobResponse{Message: "Job " + string(job.State), Job: job})
+}
+
+// Cancel stops the job named in the path. Work done so far stays.
+func (h *JobsHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Cancel(r.PathValue("id"))
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		SendError(w, http.StatusNotFound, CodeNotFound, "Job not found")
+		return
+	case errors.Is(err, jobs.ErrFinished):
+		SendError(w, http.StatusConflict, CodeJobFinished, "Job already finished")
+		return
+	case err != nil:
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to cancel job")
+		return
+	}
+	SendJSON(w, http.StatusOK, JobResponse{Message: "Job cancelled", Job: job})
+}
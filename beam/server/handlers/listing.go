@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+)
+
+// MaxListLimit is the largest page size a listing can be asked for
+const MaxListLimit = 5000
+
+// Listing is one page of a directory listing
+type Listing struct {
+	Path    string `json:"path"`
+	Entries []File `json:"entries"`
+	// Total is the number of entries across all pages after filtering
+	Total int `json:"total"`
+	// NextCursor fetches the following page, empty on the last one
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// ListOptions controls sorting, filtering and paging of a listing
+type ListOptions struct {
+	Sort   string // "name" (natural order), "size", "mtime" or "type"
+	Desc   bool
+	Hidden bool // include dotfiles
+	Limit  int  // 0 returns everything
+	Cursor string
+}
+
+var sortKeys = []string{"name", "size", "mtime", "type"}
+
+// parseListOptions reads the sort, order, hidden, limit and cursor query
+// parameters
+func parseListOptions(q url.Values) (ListOptions, error) {
+	opts := ListOptions{Sort: "name", Hidden: true, Cursor: q.Get("cursor")}
+
+	if s := q.Get("sort"); s != "" {
+		if !slices.Contains(sortKeys, s) {
+			return opts, fmt.Errorf("sort must be one of %s", strings.Join(sortKeys, ", "))
+		}
+		opts.Sort = s
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, errors.New("order must be asc or desc")
+	}
+	if h := q.Get("hidden"); h != "" {
+		show, err := strconv.ParseBool(h)
+		if err != nil {
+			return opts, errors.New("hidden must be true or false")
+		}
+		opts.Hidden = show
+	}
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 || n > MaxListLimit {
+			return opts, fmt.Errorf("limit must be between 0 and %d", MaxListLimit)
+		}
+		opts.Limit = n
+	}
+	return opts, nil
+}
+
+// newFile describes the entry name inside fsys, reachable as apiPath through
+// the API. info comes from Lstat so symlinks are reported as such.
+func newFile(fsys *sandbox.FS, name, apiPath string, info os.FileInfo) File {
+	f := File{
+		Name:        info.Name(),
+		IsDir:       info.IsDir(),
+		Path:        apiPath,
+		Type:        fileType(info.Mode()),
+		Bytes:       info.Size(),
+		Modified:    info.ModTime().UTC(),
+		Mode:        info.Mode().String(),
+		Permissions: fmt.Sprintf("%04o", info.Mode().Perm()),
+		Hidden:      strings.HasPrefix(info.Name(), "."),
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		f.LinkTarget, _ = fsys.Readlink(name)
+		// Describe what the link points at so it can be opened like its target,
+		// as long as the symlink policy lets it be followed
+		if target, err := fsys.Stat(name); err == nil {
+			f.IsDir = target.IsDir()
+			f.Bytes = target.Size()
+		}
+	}
+	if !f.IsDir {
+		f.MimeType = mimeType(f.Name)
+	}
+
+	f.Size = FormatFileSize(f.Bytes)
+	f.ModTime = FormatModTime(info.ModTime().Format(time.RFC3339))
+	return f
+}
+
+func fileType(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode.IsDir():
+		return "dir"
+	case mode.IsRegular():
+		return "file"
+	}
+	return "other"
+}
+
+// mimeType guesses the content type from the file extension
+func mimeType(name string) string {
+	t := mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))
+	if t == "" {
+		return "application/octet-stream"
+	}
+	if media, _, err := mime.ParseMediaType(t); err == nil {
+		return media
+	}
+	return t
+}
+
+// countEntries returns the number of entries in a directory, or 0 if it
+// can't be read
+func countEntries(fsys *sandbox.FS, dir string) int {
+	d, err := fsys.Open(dir)
+	if err != nil {
+		return 0
+	}
+	defer d.Close()
+	names, _ := d.Readdirnames(-1)
+	return len(names)
+}
+
+// compareFiles orders a before b by the given key, ties broken by name
+func compareFiles(a, b File, key string) int {
+	var c int
+	switch key {
+	case "size":
+		c = cmp.Compare(a.Bytes, b.Bytes)
+	case "mtime":
+		c = a.Modified.Compare(b.Modified)
+	case "type":
+		// Directories first, then files grouped by extension
+		c = cmpBool(b.IsDir, a.IsDir)
+		if c == 0 {
+			c = strings.Compare(strings.ToLower(filepath.Ext(a.Name)), strings.ToLower(filepath.Ext(b.Name)))
+		}
+	}
+	if c == 0 {
+		c = naturalCompare(a.Name, b.Name)
+	}
+	if c == 0 {
+		c = strings.Compare(a.Name, b.Name)
+	}
+	return c
+}
+
+func sortFiles(files []File, opts ListOptions) {
+	slices.SortFunc(files, func(a, b File) int {
+		c := compareFiles(a, b, opts.Sort)
+		if opts.Desc {
+			return -c
+		}
+		return c
+	})
+}
+
+// listCursor is the position after the last entry of a page. It holds the
+// sort key rather than an index so pages stay consistent while the
+// directory changes.
+type listCursor struct {
+	Sort     string    `json:"s"`
+	Desc     bool      `json:"d"`
+	Name     string    `json:"n"`
+	IsDir    bool      `json:"dir"`
+	Bytes    int64     `json:"b"`
+	Modified time.Time `json:"m"`
+}
+
+func encodeCursor(f File, opts ListOptions) string {
+	data, _ := json.Marshal(listCursor{
+		Sort:     opts.Sort,
+		Desc:     opts.Desc,
+		Name:     f.Name,
+		IsDir:    f.IsDir,
+		Bytes:    f.Bytes,
+		Modified: f.Modified,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string, opts ListOptions) (File, error) {
+	var c listCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil {
+		return File{}, errors.New("invalid cursor")
+	}
+	if c.Sort != opts.Sort || c.Desc != opts.Desc {
+		return File{}, errors.New("cursor was issued for a different sort order")
+	}
+	return File{Name: c.Name, IsDir: c.IsDir, Bytes: c.Bytes, Modified: c.Modified}, nil
+}
+
+// paginate returns the page of sorted files selected by opts and the cursor
+// of the next page
+func paginate(files []File, opts ListOptions) ([]File, string, error) {
+	start := 0
+	if opts.Cursor != "" {
+		after, err := decodeCursor(opts.Cursor, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		start = len(files)
+		for i, f := range files {
+			c := compareFiles(f, after, opts.Sort)
+			if opts.Desc {
+				c = -c
+			}
+			if c > 0 {
+				start = i
+				break
+			}
+		}
+	}
+
+	page := files[start:]
+	if opts.Limit == 0 || len(page) <= opts.Limit {
+		return page, "", nil
+	}
+	page = page[:opts.Limit]
+	return page, encodeCursor(page[len(page)-1], opts), nil
+}
+
+// naturalCompare compares names case-insensitively with runs of digits
+// compared by value, so "file2" sorts before "file10"
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		ra, sa := utf8.DecodeRuneInString(a)
+		rb, sb := utf8.DecodeRuneInString(b)
+
+		if isDigit(ra) && isDigit(rb) {
+			da, db := leadingDigits(a), leadingDigits(b)
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if c := cmp.Compare(len(na), len(nb)); c != 0 {
+				return c
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+
+		if la, lb := unicode.ToLower(ra), unicode.ToLower(rb); la != lb {
+			return cmp.Compare(la, lb)
+		}
+		a, b = a[sa:], b[sb:]
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && isDigit(rune(s[i])) {
+		i++
+	}
+	return s[:i]
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func cmpBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case !a:
+		return -1
+	}
+	return 1
+}
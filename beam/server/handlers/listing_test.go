@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/jobs"
+	"github.com/tachRoutine/beamdrop-go/pkg/pipeline"
+	"github.com/tachRoutine/beamdrop-go/pkg/webhooks"
+)
+
+// listed returns files with the names, sorted by opts. Sizes shrink along
+// the names, so size order isn't name order.
+func listed(opts ListOptions, names ...string) []File {
+	files := make([]File, len(names))
+	for i, name := range names {
+		files[i] = File{Name: name, Bytes: int64(len(names) - i), Modified: time.Unix(int64(i), 0)}
+	}
+	sortFiles(files, opts)
+	return files
+}
+
+func fileNames(files []File) []string {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.Name
+	}
+	return names
+}
+
+func TestNaturalCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"file2", "file10", -1},
+		{"file10", "file2", 1},
+		{"File2", "file10", -1},
+		{"img9.png", "img10.png", -1},
+		{"a007", "a7", 0},
+		{"a", "a1", -1},
+		{"report", "Report", 0},
+		{"x99y", "x100a", -1},
+		{"v1.9", "v1.10", -1},
+	}
+	for _, tt := range tests {
+		if got := naturalCompare(tt.a, tt.b); got != tt.want {
+			t.Errorf("naturalCompare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	got := fileNames(listed(ListOptions{Sort: "name"}, "file10", "file1", "File3", "file2", "file20"))
+	if want := []string{"file1", "file2", "File3", "file10", "file20"}; !slices.Equal(got, want) {
+		t.Errorf("sorted %v, want %v", got, want)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	names := []string{"file1", "file2", "file3", "file4", "file5", "file6", "file7"}
+	for _, opts := range []ListOptions{
+		{Sort: "name", Limit: 3},
+		{Sort: "name", Desc: true, Limit: 2},
+		{Sort: "size", Limit: 3},
+		{Sort: "mtime", Desc: true, Limit: 1},
+	} {
+		// Every entry turns up once across the pages
+		files := listed(opts, names...)
+		var all []string
+		for pages := 0; ; pages++ {
+			if pages > len(files) {
+				t.Fatalf("%+v: the pages don't end", opts)
+			}
+			page, next, err := paginate(files, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) > opts.Limit {
+				t.Errorf("%+v: a page of %d", opts, len(page))
+			}
+			all = append(all, fileNames(page)...)
+			if next == "" {
+				break
+			}
+			opts.Cursor = next
+		}
+		if want := fileNames(files); !slices.Equal(all, want) {
+			t.Errorf("%+v: pages hold %v, want %v", opts, all, want)
+		}
+	}
+}
+
+func TestPaginateWhileChanging(t *testing.T) {
+	opts := ListOptions{Sort: "name", Limit: 3}
+	page, next, err := paginate(listed(opts, "file1", "file2", "file3", "file4", "file5", "file6", "file7"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fileNames(page); !slices.Equal(got, []string{"file1", "file2", "file3"}) {
+		t.Fatalf("first page %v", got)
+	}
+
+	// Files added before the cursor don't shift the next page, those after
+	// it show up in it, and the entry the cursor names may be gone
+	opts.Cursor = next
+	changed := listed(opts, "file0", "file1", "file2", "file2a", "file3a", "file4", "file5", "file6", "file7")
+	page, _, err = paginate(changed, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fileNames(page); !slices.Equal(got, []string{"file3a", "file4", "file5"}) {
+		t.Errorf("second page %v, want file3a, file4, file5", got)
+	}
+
+	// A cursor past the last entry gives an empty last page
+	page, next, err = paginate(listed(opts, "file1", "file2"), opts)
+	if err != nil || len(page) != 0 || next != "" {
+		t.Errorf("past the end: got %v, %q, %v", fileNames(page), next, err)
+	}
+}
+
+func TestPaginateBadCursor(t *testing.T) {
+	opts := ListOptions{Sort: "name", Limit: 1}
+	files := listed(opts, "a", "b", "c")
+	_, next, err := paginate(files, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, other := range []ListOptions{
+		{Sort: "size", Limit: 1, Cursor: next},
+		{Sort: "name", Desc: true, Limit: 1, Cursor: next},
+	} {
+		if _, _, err := paginate(files, other); err == nil || !strings.Contains(err.Error(), "different sort order") {
+			t.Errorf("cursor of another sort order %+v: got %v", other, err)
+		}
+	}
+	for _, cursor := range []string{"not a cursor!", base64.RawURLEncoding.EncodeToString([]byte("[1,2]"))} {
+		opts.Cursor = cursor
+		if _, _, err := paginate(files, opts); err == nil || err.Error() != "invalid cursor" {
+			t.Errorf("cursor %q: got %v", cursor, err)
+		}
+	}
+
+	h := NewFileHandler(singleRoot(t, map[string]string{"a.txt": "a"}), "", jobs.NewManager(1), pipeline.New(nil, nil),
+		nil, acceptAll, webhooks.NewDispatcher())
+	w := httptest.NewRecorder()
+	h.ListFiles(w, httptest.NewRequest(http.MethodGet, "/files?sort=size&cursor="+next, nil))
+	expectError(t, w, http.StatusBadRequest, CodeInvalidRequest)
+}
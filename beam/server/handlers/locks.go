@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"gorm.io/gorm"
+)
+
+const (
+	// LockTokenHeader carries the tokens of the locks a client holds,
+	// comma-separated
+	LockTokenHeader = "X-Lock-Token"
+	// AdminPasswordHeader carries the admin password that breaks locks
+	AdminPasswordHeader = "X-Admin-Password"
+
+	// DefaultLockTTL is how long a lock lasts without a heartbeat
+	DefaultLockTTL = 5 * time.Minute
+	// MaxLockTTL is the longest a lock can last without a heartbeat
+	MaxLockTTL = 24 * time.Hour
+)
+
+// LocksHandler takes, renews and releases advisory file locks
+type LocksHandler struct {
+	roots         *sandbox.Roots
+	adminPassword string
+}
+
+func NewLocksHandler(roots *sandbox.Roots, adminPassword string) *LocksHandler {
+	return &LocksHandler{roots: roots, adminPassword: adminPassword}
+}
+
+// List returns the locks in force, those overlapping path if it's given
+func (h *LocksHandler) List(w http.ResponseWriter, r *http.Request) {
+	locks, err := db.GetLocks()
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to list locks")
+		return
+	}
+	if reqPath := queryPath(r); reqPath != "" {
+		root, name, ok := locate(w, h.roots, reqPath, sandbox.Read, "list locks")
+		if !ok {
+			return
+		}
+		if root != nil {
+			apiPath := root.Join(name)
+			locks = slices.DeleteFunc(locks, func(l db.Lock) bool { return !l.Covers(apiPath) })
+		}
+	}
+	if locks == nil {
+		locks = []db.Lock{}
+	}
+	SendJSON(w, http.StatusOK, LocksResponse{Locks: locks})
+}
+
+// Lock takes a lock on a file or directory. A client that sends the token
+// of a lock it holds gets the new lock under the same token, and renews the
+// lock if it's on the same path.
+func (h *LocksHandler) Lock(w http.ResponseWriter, r *http.Request) {
+	var req LockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	ttl, ok := lockTTL(w, req.TTL)
+	if !ok {
+		return
+	}
+	root, name, ok := locate(w, h.roots, req.Path, sandbox.Write, "lock file")
+	if !ok {
+		return
+	}
+	if root == nil || name == "." {
+		SendError(w, http.StatusBadRequest, CodeInvalidPath, "Refusing to lock a shared root")
+		return
+	}
+	if _, err := root.Lstat(name); err != nil {
+		sendPathError(w, err, "lock file")
+		return
+	}
+
+	now := time.Now()
+	lock := db.Lock{
+		ID:        newLockID(),
+		Path:      root.Join(name),
+		Owner:     req.Owner,
+		Reason:    req.Reason,
+		Token:     newToken(),
+		CreatedAt: now,
+		RenewedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if lock.Owner == "" {
+		lock.Owner = requestOwner(r)
+	}
+	if held, err := db.GetLocks(); err == nil {
+		tokens := lockTokens(r)
+		for _, l := range held {
+			if slices.Contains(tokens, l.Token) {
+				lock.Token = l.Token
+				break
+			}
+		}
+	}
+
+	other, err := db.AcquireLock(&lock)
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to lock file")
+		return
+	}
+	if other != nil {
+		sendLocked(w, *other)
+		return
+	}
+	logger.Info("%s locked %s until %s", lock.Owner, lock.Path, lock.ExpiresAt.Format(time.RFC3339))
+	SendJSON(w, http.StatusCreated, LockResponse{Message: "Locked", Lock: lock, Token: lock.Token})
+}
+
+// Renew moves the expiry of a lock the client holds, as a heartbeat
+func (h *LocksHandler) Renew(w http.ResponseWriter, r *http.Request) {
+	var req RenewLockRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+			return
+		}
+	}
+	ttl, ok := lockTTL(w, req.TTL)
+	if !ok {
+		return
+	}
+	lock, ok := h.heldLock(w, r, false)
+	if !ok {
+		return
+	}
+	lock, err := db.RenewLock(lock.ID, time.Now().Add(ttl))
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to renew lock")
+		return
+	}
+	SendJSON(w, http.StatusOK, LockResponse{Message: "Lock renewed", Lock: lock})
+}
+
+// Unlock releases a lock the client holds. With the admin password it
+// breaks a lock held by anyone.
+func (h *LocksHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	lock, ok := h.heldLock(w, r, true)
+	if !ok {
+		return
+	}
+	err := db.DeleteLock(lock.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		SendError(w, http.StatusNotFound, CodeNotFound, "Lock not found")
+		return
+	}
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to release lock")
+		return
+	}
+
+	msg := "Unlocked"
+	if !slices.Contains(lockTokens(r), lock.Token) {
+		msg = "Lock broken"
+		logger.Warn("Admin broke the lock of %s on %s from %s", lock.Owner, lock.Path, r.RemoteAddr)
+	} else {
+		logger.Info("%s unlocked %s", lock.Owner, lock.Path)
+	}
+	SendJSON(w, http.StatusOK, LockResponse{Message: msg, Lock: lock})
+}
+
+// heldLock loads the lock named in the path and checks the client holds it,
+// or has the admin password if admin is set
+func (h *LocksHandler) heldLock(w http.ResponseWriter, r *http.Request, admin bool) (db.Lock, bool) {
+	lock, err := db.GetLock(r.PathValue("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		SendError(w, http.StatusNotFound, CodeNotFound, "Lock not found")
+		return lock, false
+	}
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to get lock")
+		return lock, false
+	}
+	if slices.Contains(lockTokens(r), lock.Token) || (admin && isAdmin(r, h.adminPassword)) {
+		return lock, true
+	}
+	SendError(w, http.StatusForbidden, CodeNotLockOwner, "Lock is held by "+lock.Owner)
+	return lock, false
+}
+
+// isAdmin reports whether the request carries the admin password, which
+// must be set
+func isAdmin(r *http.Request, password string) bool {
+	supplied := r.Header.Get(AdminPasswordHeader)
+	return password != "" && subtle.ConstantTimeCompare([]byte(supplied), []byte(password)) == 1
+}
+
+// requireAdmin refuses the request with 403 unless it carries the admin
+// password. what names the feature in the error, e.g. "webhooks".
+func requireAdmin(w http.ResponseWriter, r *http.Request, password, what string) bool {
+	switch {
+	case password == "":
+		SendError(w, http.StatusForbidden, CodeAdminRequired, "Managing "+what+" needs the server to have an admin password")
+	case !isAdmin(r, password):
+		SendError(w, http.StatusForbidden, CodeAdminRequired, "Managing "+what+" needs the admin password")
+	default:
+		return true
+	}
+	return false
+}
+
+// checkLocks refuses a change to the paths with 423 while someone else
+// holds a lock overlapping any of them. Paths are as the API names them,
+// see sandbox.Root.Join.
+func checkLocks(w http.ResponseWriter, r *http.Request, paths ...string) bool {
+	lock, err := lockedBy(lockTokens(r), paths...)
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to check locks")
+		return false
+	}
+	if lock != nil {
+		sendLocked(w, *lock)
+		return false
+	}
+	return true
+}
+
+// lockedBy returns a lock overlapping any of the paths whose token isn't
+// among tokens
+func lockedBy(tokens []string, paths ...string) (*db.Lock, error) {
+	locks, err := othersLocks(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return coveringLock(locks, paths...), nil
+}
+
+// othersLocks returns the locks in force whose token isn't among tokens
+func othersLocks(tokens []string) ([]db.Lock, error) {
+	locks, err := db.GetLocks()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(locks, func(l db.Lock) bool { return slices.Contains(tokens, l.Token) }), nil
+}
+
+// lockDigest stands in for a lock token in the params of a job, which every
+// client can read. Only whoever holds the token can present the lock.
+func lockDigest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func lockDigests(tokens []string) []string {
+	digests := make([]string, len(tokens))
+	for i, t := range tokens {
+		digests[i] = lockDigest(t)
+	}
+	return digests
+}
+
+// othersLocksByDigest returns the locks in force whose token's digest isn't
+// among digests
+func othersLocksByDigest(digests []string) ([]db.Lock, error) {
+	locks, err := db.GetLocks()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(locks, func(l db.Lock) bool { return slices.Contains(digests, lockDigest(l.Token)) }), nil
+}
+
+// coveringLock returns the first of locks overlapping any of the paths
+func coveringLock(locks []db.Lock, paths ...string) *db.Lock {
+	for _, l := range locks {
+		for _, p := range paths {
+			if l.Covers(p) {
+				return &l
+			}
+		}
+	}
+	return nil
+}
+
+// showLocks sets the Lock of each file held under a lock
+func showLocks(files []File) {
+	locks, err := db.GetLocks()
+	if err != nil || len(locks) == 0 {
+		return
+	}
+	for i := range files {
+		for _, l := range locks {
+			if l.Path == files[i].Path || strings.HasPrefix(files[i].Path, l.Path+"/") {
+				files[i].Lock = &l
+				break
+			}
+		}
+	}
+}
+
+// lockMessage describes who holds a lock
+func lockMessage(lock db.Lock) string {
+	msg := "Locked by " + lock.Owner
+	if lock.Reason != "" {
+		msg += ": " + lock.Reason
+	}
+	return msg
+}
+
+func sendLocked(w http.ResponseWriter, lock db.Lock) {
+	SendJSON(w, http.StatusLocked, LockedResponse{Error: lockMessage(lock), Code: CodeLocked, Lock: lock})
+}
+
+func lockTokens(r *http.Request) []string {
+	var tokens []string
+	for _, v := range r.Header.Values(LockTokenHeader) {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return tokens
+}
+
+// lockTTL turns a lifetime in seconds into a duration, DefaultLockTTL for 0
+func lockTTL(w http.ResponseWriter, seconds int) (time.Duration, bool) {
+	if seconds == 0 {
+		return DefaultLockTTL, true
+	}
+	ttl := time.Duration(seconds) * time.Second
+	if seconds < 0 || ttl > MaxLockTTL {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "ttl must be between 1 and "+strconv.Itoa(int(MaxLockTTL/time.Second))+" seconds")
+		return 0, false
+	}
+	return ttl, true
+}
+
+// requestOwner names the client of a request that didn't name itself: the
+// basic auth user or the remote host
+func requestOwner(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		return user
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func newLockID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+)
+
+// TestMain gives the tests a database of their own in a temporary data
+// directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "beamdrop-handlers-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	config.SetDataDir(dir)
+	logger.SetOutput(io.Discard)
+	if err := db.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	db.AutoMigrate()
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
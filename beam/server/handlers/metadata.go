@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/fileid"
+	"github.com/tachRoutine/beamdrop-go/pkg/fileops"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+)
+
+// ReconcileInterval is how often the server checks metadata against the
+// files on its own
+const ReconcileInterval = time.Hour
+
+// jobKindReconcile is the kind of the jobs reconciling metadata on request
+const jobKindReconcile = "reconcile"
+
+// reconcileMu keeps the periodic and requested runs apart
+var reconcileMu sync.Mutex
+
+// Reconcile queues a check of the metadata against the files
+func (h *FileOperationsHandler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Submit(jobKindReconcile, "", "", nil)
+	if err != nil {
+		logger.Error("Failed to queue reconcile: %v", err)
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to queue reconcile")
+		return
+	}
+	SendJSON(w, http.StatusAccepted, JobResponse{Message: "Queued in the background", Job: job})
+}
+
+// movedMetadata returns the OnMoved of a move from src to dst, taking the
+// metadata of each moved entry along
+func movedMetadata(src, dst *sandbox.Root) func(from, to string) {
+	return func(from, to string) {
+		db.MovePaths(src.Join(from), dst.Join(to))
+	}
+}
+
+// trackPaths records the identity of paths that gained metadata, so it can
+// follow them if they're moved outside beamdrop
+func trackPaths(roots *sandbox.Roots, paths ...string) {
+	for _, p := range paths {
+		root, name, err := roots.Locate(p, sandbox.Read)
+		if err != nil || root == nil {
+			continue
+		}
+		info, err := root.Lstat(name)
+		if err != nil {
+			continue
+		}
+		id := identity(p, info)
+		if known, err := db.GetIdentity(p); err == nil && sameFile(known, id) {
+			continue
+		}
+		db.SaveIdentity(&id)
+	}
+}
+
+func identity(p string, info fs.FileInfo) db.FileIdentity {
+	dev, ino, _ := fileid.Inode(info)
+	return db.FileIdentity{
+		Path:      p,
+		Dir:       info.IsDir(),
+		Device:    dev,
+		Inode:     ino,
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		CheckedAt: time.Now(),
+	}
+}
+
+// sameFile reports whether two identities were taken of the same, unchanged
+// file
+func sameFile(a, b db.FileIdentity) bool {
+	return a.Dir == b.Dir && a.Device == b.Device && a.Inode == b.Inode && a.Size == b.Size && a.ModTime.Equal(b.ModTime)
+}
+
+// ReconcileMetadata checks the paths metadata is about against the files.
+// The metadata of a file moved or renamed outside beamdrop follows it,
+// found by inode or else by content; that of a file that's gone is
+// removed. Paths that can't be read at the moment are left alone.
+func ReconcileMetadata(ctx context.Context, roots *sandbox.Roots, progress func(fileops.Progress)) (*ReconcileReport, error) {
+	reconcileMu.Lock()
+	defer reconcileMu.Unlock()
+
+	paths, err := db.GetTrackedPaths()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := db.GetIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconcileReport{Moved: []PathMove{}, Removed: []string{}}
+	tracked := make(map[string]bool, len(paths))
+	var missing []string
+	for i, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if progress != nil {
+			progress(fileops.Progress{Files: int64(i), TotalFiles: int64(len(paths)), Current: p})
+		}
+		root, name, err := roots.Locate(p, sandbox.Read)
+		if err != nil || root == nil {
+			continue
+		}
+		info, err := root.Lstat(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Only a root that's there tells whether its files are
+			if _, err := root.Lstat("."); err == nil {
+				missing = append(missing, p)
+			}
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		report.Checked++
+
+		// Paths recorded before they were made canonical
+		if canonical := root.Join(name); canonical != p {
+			db.MovePaths(p, canonical)
+			p = canonical
+		}
+		tracked[p] = true
+		id := identity(p, info)
+		if known, ok := ids[p]; ok && sameFile(known, id) && (known.Hash != "" || info.IsDir()) {
+			continue
+		}
+		if id.Hash, err = fileid.Hash(root.FS, name, info); err != nil {
+			logger.Warn("Failed to hash %s: %v", p, err)
+		}
+		db.SaveIdentity(&id)
+	}
+
+	var stale []string
+	for p := range ids {
+		if !tracked[p] && !slices.Contains(missing, p) {
+			stale = append(stale, p)
+		}
+	}
+	db.DeleteIdentities(stale)
+
+	if len(missing) == 0 {
+		return report, nil
+	}
+	idx, err := indexRoots(ctx, roots, tracked)
+	if err != nil {
+		return report, err
+	}
+	// Parents come first, so a directory moved whole takes everything in it
+	var moved []string
+	for _, p := range missing {
+		if slices.ContainsFunc(moved, func(m string) bool { return isBelow(p, m) }) {
+			continue
+		}
+		to := idx.find(ids[p])
+		if to == "" {
+			continue
+		}
+		if err := db.MovePaths(p, to); err != nil {
+			return report, err
+		}
+		logger.Info("Metadata of %s follows it to %s", p, to)
+		report.Moved = append(report.Moved, PathMove{From: p, To: to})
+		moved = append(moved, p)
+	}
+	for _, p := range missing {
+		if slices.Contains(moved, p) {
+			continue
+		}
+		// What went missing from a moved directory was taken along; it's
+		// gone unless it's at the new place
+		if i := slices.IndexFunc(report.Moved, func(m PathMove) bool { return isBelow(p, m.From) }); i >= 0 {
+			p = report.Moved[i].To + strings.TrimPrefix(p, report.Moved[i].From)
+			if !gone(roots, p) {
+				continue
+			}
+		}
+		if err := db.ForgetPaths(p); err != nil {
+			return report, err
+		}
+		logger.Info("Removed the metadata of %s, which no longer exists", p)
+		report.Removed = append(report.Removed, p)
+	}
+	return report, nil
+}
+
+// gone reports whether nothing is at p, in a root that can be read
+func gone(roots *sandbox.Roots, p string) bool {
+	root, name, err := roots.Locate(p, sandbox.Read)
+	if err != nil || root == nil {
+		return false
+	}
+	_, err = root.Lstat(name)
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// isBelow reports whether p is inside the directory dir
+func isBelow(p, dir string) bool {
+	return strings.HasPrefix(p, dir+"/")
+}
+
+type devIno struct {
+	dev, ino uint64
+}
+
+// candidate is an untracked file a missing one may have become
+type candidate struct {
+	root *sandbox.Root
+	name string
+	info fs.FileInfo
+	hash string
+}
+
+// rootIndex finds the untracked files of the roots by inode and size
+type rootIndex struct {
+	inodes map[devIno]*candidate
+	sizes  map[int64][]*candidate
+	used   map[string]bool
+}
+
+func indexRoots(ctx context.Context, roots *sandbox.Roots, tracked map[string]bool) (*rootIndex, error) {
+	idx := &rootIndex{inodes: map[devIno]*candidate{}, sizes: map[int64][]*candidate{}, used: map[string]bool{}}
+	for _, root := range roots.All() {
+		if root.Allow(sandbox.Read) != nil {
+			continue
+		}
+		err := fs.WalkDir(root.FS.FS(), ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil || name == "." || sandbox.IsTemp(d.Name()) {
+				return nil
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			p := root.Join(name)
+			if tracked[p] {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			c := &candidate{root: root, name: name, info: info}
+			if dev, ino, ok := fileid.Inode(info); ok {
+				idx.inodes[devIno{dev, ino}] = c
+			}
+			if info.Mode().IsRegular() {
+				idx.sizes[info.Size()] = append(idx.sizes[info.Size()], c)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+// find returns the path of the file that had the identity, "" if there's
+// none
+func (idx *rootIndex) find(id db.FileIdentity) string {
+	if id.Path == "" {
+		return ""
+	}
+	if c, ok := idx.inodes[devIno{id.Device, id.Inode}]; ok && id.Inode != 0 && c.info.IsDir() == id.Dir {
+		if p := c.root.Join(c.name); !idx.used[p] {
+			idx.used[p] = true
+			return p
+		}
+	}
+	if id.Hash == "" || id.Dir {
+		return ""
+	}
+	for _, c := range idx.sizes[id.Size] {
+		p := c.root.Join(c.name)
+		if idx.used[p] {
+			continue
+		}
+		if c.hash == "" {
+			h, err := fileid.Hash(c.root.FS, c.name, c.info)
+			if err != nil {
+				continue
+			}
+			c.hash = h
+		}
+		if c.hash == id.Hash {
+			idx.used[p] = true
+			return p
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/contentpolicy"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"github.com/tachRoutine/beamdrop-go/pkg/sniff"
+)
+
+// sendPolicyError refuses a request that would store files the content
+// policy doesn't accept
+func sendPolicyError(w http.ResponseWriter, violations []PolicyViolation) {
+	SendJSON(w, http.StatusUnsupportedMediaType, PolicyErrorResponse{
+		ErrorResponse: ErrorResponse{Error: policyMessage(violations), Code: CodeContentPolicy},
+		Violations:    violations,
+	})
+}
+
+// policyMessage sums up violations in one line
+func policyMessage(violations []PolicyViolation) string {
+	if len(violations) > 1 {
+		return fmt.Sprintf("%d files are not allowed here", len(violations))
+	}
+	return violations[0].Name + ": " + violations[0].Reason
+}
+
+// treeViolations returns the files below srcName in src that policy refuses
+// under the names a move, copy or rename to dstName in dst gives them.
+// Within a root everything below the entry keeps its name and was under the
+// same policy already, so only the entry itself is checked there.
+func treeViolations(policy *contentpolicy.Policy, src *sandbox.Root, srcName string, dst *sandbox.Root, dstName string) ([]PolicyViolation, error) {
+	if policy == nil {
+		return nil, nil
+	}
+	var violations []PolicyViolation
+	head := make([]byte, sniff.Size)
+	err := fs.WalkDir(src.FS.FS(), srcName, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && src == dst {
+			return fs.SkipDir
+		}
+		// Links are copied as links, and other special files not at all
+		if !d.Type().IsRegular() || sandbox.IsTemp(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f, err := src.Open(p)
+		if err != nil {
+			return err
+		}
+		n, _ := io.ReadFull(f, head)
+		f.Close()
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, srcName), "/")
+		if srcName == "." {
+			rel = p
+		}
+		target := path.Join(dstName, rel)
+		if v := policy.Check(target, info.Size(), head[:n]); v != nil {
+			logger.Warn("%s refused by the content policy: %s", dst.Join(target), v.Reason)
+			violations = append(violations, PolicyViolation{Name: dst.Join(target), Type: v.Type, Reason: v.Reason})
+		}
+		return nil
+	})
+	return violations, err
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/contentpolicy"
+	"github.com/tachRoutine/beamdrop-go/pkg/jobs"
+	"github.com/tachRoutine/beamdrop-go/pkg/pipeline"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"github.com/tachRoutine/beamdrop-go/pkg/sniff"
+	"github.com/tachRoutine/beamdrop-go/pkg/webhooks"
+)
+
+// program is the start of a Windows executable
+var program = "MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff\x00\x00" + strings.Repeat("\x00", 48)
+
+// noPrograms refuses executables and content that doesn't match its name
+var noPrograms = config.UploadPolicy{DenyExtensions: []string{".exe"}, MatchExtension: true}
+
+// expectPolicyError checks the response refuses the file named name, whose
+// content sniffed as typ
+func expectPolicyError(t *testing.T, w *httptest.ResponseRecorder, name, typ string) {
+	t.Helper()
+	var resp PolicyErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error response: %v", err)
+	}
+	if w.Code != http.StatusUnsupportedMediaType || resp.Code != CodeContentPolicy {
+		t.Fatalf("got %d %q (%s), want 415 %q", w.Code, resp.Code, resp.Error, CodeContentPolicy)
+	}
+	if len(resp.Violations) != 1 || resp.Violations[0].Name != name || resp.Violations[0].Type != typ {
+		t.Errorf("violations %+v, want %s of type %s", resp.Violations, name, typ)
+	}
+}
+
+func TestUploadPolicy(t *testing.T) {
+	roots := singleRoot(t, nil)
+	h := NewFileHandler(roots, "", jobs.NewManager(1), pipeline.New(nil, nil), nil,
+		contentpolicy.NewSet(noPrograms, nil), webhooks.NewDispatcher())
+
+	w := postUpload(h, nil, map[string]string{"photo.jpg": program, "notes.txt": "hello"})
+	expectPolicyError(t, w, "photo.jpg", sniff.Windows)
+	// Nothing of the upload is stored
+	if entries, _ := roots.All()[0].ReadDir("."); len(entries) != 0 {
+		t.Errorf("a refused upload stored %d files", len(entries))
+	}
+}
+
+func TestRenamePolicy(t *testing.T) {
+	roots := singleRoot(t, map[string]string{"photo.jpg": program, "holiday.jpg": "\xff\xd8\xff\xe0\x00\x10JFIF\x00"})
+	h := NewFileOperationsHandler(roots, jobs.NewManager(1), nil, contentpolicy.NewSet(noPrograms, nil), webhooks.NewDispatcher())
+
+	// The program that came in before the policy can't be renamed into one
+	// it refuses
+	w := post(h.Rename, RenameRequest{OldPath: "photo.jpg", NewName: "evil.exe"})
+	expectPolicyError(t, w, "evil.exe", sniff.Windows)
+	if _, err := roots.All()[0].Lstat("photo.jpg"); err != nil {
+		t.Errorf("the file was renamed anyway: %v", err)
+	}
+
+	rename(t, h, "holiday.jpg", "beach.jpg")
+}
+
+func TestWritePolicy(t *testing.T) {
+	roots := singleRoot(t, nil)
+	h := NewFileOperationsHandler(roots, jobs.NewManager(1), nil, contentpolicy.NewSet(noPrograms, nil), webhooks.NewDispatcher())
+
+	// latin-1 stores every code point below 256 as that byte, so a text
+	// write can produce any binary content
+	var latin1 strings.Builder
+	for _, b := range []byte(program) {
+		latin1.WriteRune(rune(b))
+	}
+	w := post(h.Write, WriteRequest{FilePath: "notes.txt", Content: latin1.String(), Encoding: "latin-1"})
+	expectPolicyError(t, w, "notes.txt", sniff.Windows)
+	if _, err := roots.All()[0].Lstat("notes.txt"); err == nil {
+		t.Error("the refused content was written")
+	}
+
+	if w := post(h.Write, WriteRequest{FilePath: "notes.txt", Content: "hello"}); w.Code != http.StatusOK {
+		t.Errorf("writing text: got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestTransferPolicy(t *testing.T) {
+	inbox, err := sandbox.New(t.TempDir(), sandbox.SymlinksDeny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	photos, err := sandbox.New(t.TempDir(), sandbox.SymlinksDeny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := sandbox.Named([]*sandbox.Root{{Name: "inbox", FS: inbox}, {Name: "photos", FS: photos}})
+	defer roots.Close()
+	inbox.MkdirAll("album", sandbox.DirMode)
+	inbox.WriteFile("album/cover.jpg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), sandbox.FileMode)
+	inbox.WriteFile("album/setup.jpg", []byte(program), sandbox.FileMode)
+
+	imagesOnly := config.UploadPolicy{AllowTypes: []string{"image/*"}}
+	policies := contentpolicy.NewSet(config.UploadPolicy{}, []config.Root{{Name: "photos", UploadPolicy: &imagesOnly}})
+	h := NewFileOperationsHandler(roots, jobs.NewManager(1), nil, policies, webhooks.NewDispatcher())
+
+	// Every file of a tree is checked before any is copied
+	w := post(h.Copy, MoveRequest{SourcePath: "inbox/album", TargetPath: "photos/album"})
+	expectPolicyError(t, w, "photos/album/setup.jpg", sniff.Windows)
+	w = post(h.Move, MoveRequest{SourcePath: "inbox/album/setup.jpg", TargetPath: "photos/setup.jpg"})
+	expectPolicyError(t, w, "photos/setup.jpg", sniff.Windows)
+	if entries, _ := photos.ReadDir("."); len(entries) != 0 {
+		t.Errorf("a refused transfer left %d entries", len(entries))
+	}
+
+	// The source root has no policy
+	if w := post(h.Move, MoveRequest{SourcePath: "inbox/album/setup.jpg", TargetPath: "inbox/setup.jpg"}); w.Code != http.StatusOK {
+		t.Errorf("move within the inbox: got %d %s", w.Code, w.Body)
+	}
+	if w := post(h.Copy, MoveRequest{SourcePath: "inbox/album/cover.jpg", TargetPath: "photos/cover.jpg"}); w.Code != http.StatusOK {
+		t.Errorf("copying a photo: got %d %s", w.Code, w.Body)
+	}
+
+	// Nor do batches get around it
+	w = post(h.Batch, BatchRequest{Operations: []BatchOperation{{Op: BatchCopy, Path: "inbox/setup.jpg", TargetPath: "photos/setup.jpg"}}})
+	var resp BatchResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusUnsupportedMediaType || resp.Code != CodeContentPolicy {
+		t.Errorf("batch copy of a program: got %d %+v", w.Code, resp)
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/fileops"
+	"github.com/tachRoutine/beamdrop-go/pkg/jobs"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/pipeline"
+	"github.com/tachRoutine/beamdrop-go/pkg/quarantine"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"gorm.io/gorm"
+)
+
+// jobKindProcess is the kind of the jobs running the processing pipeline
+// on uploaded files
+const jobKindProcess = "process"
+
+// processParams are the settings of a process job
+type processParams struct {
+	// Paths are the uploaded files, as the API names them
+	Paths  []string `json:"paths"`
+	Client string   `json:"client,omitempty"`
+}
+
+// submitProcessing queues the pipeline on uploaded files. It returns nil
+// when no processors are configured or the job can't be queued, which
+// doesn't fail the upload.
+func submitProcessing(m *jobs.Manager, pipe *pipeline.Pipeline, paths []string, client string) *jobs.Job {
+	if !pipe.Enabled() || len(paths) == 0 {
+		return nil
+	}
+	job, err := m.Submit(jobKindProcess, "", "", processParams{Paths: paths, Client: client})
+	if err != nil {
+		logger.Error("Failed to queue processing of %d uploaded files: %v", len(paths), err)
+		return nil
+	}
+	return &job
+}
+
+// runProcessing does the work of a process job. A file gone since the
+// upload is skipped; one interrupted by a restart is processed again.
+func runProcessing(ctx context.Context, roots *sandbox.Roots, pipe *pipeline.Pipeline, job jobs.Job, progress func(fileops.Progress)) (*ProcessingReport, error) {
+	var params processParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return nil, err
+	}
+
+	report := &ProcessingReport{}
+	for i, p := range params.Paths {
+		progress(fileops.Progress{Files: int64(i), TotalFiles: int64(len(params.Paths)), Current: p})
+		root, name, err := roots.Locate(p, sandbox.Upload)
+		if err != nil || root == nil {
+			report.Missing++
+			continue
+		}
+		results, err := pipe.Run(ctx, &pipeline.File{Root: root, Name: name, Path: p, Client: params.Client})
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		if err != nil {
+			logger.Warn("Failed to process %s: %v", p, err)
+			report.Missing++
+			continue
+		}
+		report.Processed++
+		for _, res := range results {
+			if res.Status == db.ProcessingFailed {
+				report.Failed++
+			}
+			switch res.Action {
+			case pipeline.ActionDeleted:
+				report.Deleted = append(report.Deleted, p)
+			case pipeline.ActionQuarantined:
+				report.Quarantined = append(report.Quarantined, p)
+			}
+		}
+	}
+	progress(fileops.Progress{Files: int64(len(params.Paths)), TotalFiles: int64(len(params.Paths))})
+	return report, nil
+}
+
+// ProcessingHandler serves what the pipeline found out about files, and
+// the files it quarantined
+type ProcessingHandler struct {
+	roots         *sandbox.Roots
+	quarantine    *quarantine.Store
+	adminPassword string
+}
+
+func NewProcessingHandler(roots *sandbox.Roots, q *quarantine.Store, adminPassword string) *ProcessingHandler {
+	return &ProcessingHandler{roots: roots, quarantine: q, adminPassword: adminPassword}
+}
+
+// Results returns the results of the processors that last ran on a file
+func (h *ProcessingHandler) Results(w http.ResponseWriter, r *http.Request) {
+	root, name, ok := locate(w, h.roots, r.URL.Query().Get("path"), sandbox.Read, "read processing results")
+	if !ok {
+		return
+	}
+	if root == nil {
+		SendError(w, http.StatusBadRequest, CodeIsADirectory, "Path is a directory")
+		return
+	}
+	if _, err := root.Lstat(name); err != nil {
+		sendPathError(w, err, "read processing results")
+		return
+	}
+	p := root.Join(name)
+	results, err := db.GetProcessingResults(p)
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to get processing results")
+		return
+	}
+	if results == nil {
+		results = []db.ProcessingResult{}
+	}
+	SendJSON(w, http.StatusOK, ProcessingResponse{Path: p, Results: results})
+}
+
+// Thumbnail serves the thumbnail a processor made of a file
+func (h *ProcessingHandler) Thumbnail(w http.ResponseWriter, r *http.Request) {
+	root, name, ok := locate(w, h.roots, r.URL.Query().Get("path"), sandbox.Read, "read thumbnail")
+	if !ok {
+		return
+	}
+	if root == nil {
+		SendError(w, http.StatusBadRequest, CodeIsADirectory, "Path is a directory")
+		return
+	}
+	if _, err := root.Lstat(name); err != nil {
+		sendPathError(w, err, "read thumbnail")
+		return
+	}
+	res, err := db.GetProcessingData(root.Join(name), "")
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		SendError(w, http.StatusNotFound, CodeNotFound, "No thumbnail for this file")
+		return
+	}
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to get thumbnail")
+		return
+	}
+	contentType := res.Output["thumbnail"]
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write(res.Data)
+}
+
+// Quarantined returns the files taken out of the share, newest first
+func (h *ProcessingHandler) Quarantined(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.adminPassword, "the quarantine") {
+		return
+	}
+	files, err := db.GetQuarantined()
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to list quarantined files")
+		return
+	}
+	SendJSON(w, http.StatusOK, QuarantineResponse{Files: files})
+}
+
+// DeleteQuarantined removes a quarantined file for good
+func (h *ProcessingHandler) DeleteQuarantined(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.adminPassword, "the quarantine") {
+		return
+	}
+	file, err := db.GetQuarantinedFile(r.PathValue("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		SendError(w, http.StatusNotFound, CodeNotFound, "Quarantined file not found")
+		return
+	}
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to get quarantined file")
+		return
+	}
+	if err := h.quarantine.Delete(file.ID); err != nil {
+		logger.Error("Failed to delete quarantined file %s: %v", file.ID, err)
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to delete quarantined file")
+		return
+	}
+	logger.Info("Deleted quarantined file %s (was %s)", file.ID, file.Path)
+	SendJSON(w, http.StatusOK, QuarantinedFileResponse{Message: "Quarantined file deleted", File: file})
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+)
+
+// namedRoots shares a temporary directory as the root "share", so the top
+// level is virtual
+func namedRoots(t *testing.T) *sandbox.Roots {
+	t.Helper()
+	fs, err := sandbox.New(t.TempDir(), sandbox.SymlinksDeny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := sandbox.Named([]*sandbox.Root{{Name: "share", FS: fs}})
+	t.Cleanup(func() { roots.Close() })
+	return roots
+}
+
+// call runs handler on a GET of path with the query p and returns the
+// recorded response
+func call(handler http.HandlerFunc, path, p string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, path+"?path="+url.QueryEscape(p), nil))
+	return w
+}
+
+// expectError checks the response is an error with the status and code
+func expectError(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	var resp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error response: %v", err)
+	}
+	if w.Code != status || resp.Code != code {
+		t.Errorf("got %d %q (%s), want %d %q", w.Code, resp.Code, resp.Error, status, code)
+	}
+}
+
+func TestProcessingTopLevel(t *testing.T) {
+	h := NewProcessingHandler(namedRoots(t), nil, "")
+	for _, p := range []string{"", "/", "."} {
+		t.Run("results "+p, func(t *testing.T) {
+			expectError(t, call(h.Results, "/files/processing", p), http.StatusBadRequest, CodeIsADirectory)
+		})
+		t.Run("thumbnail "+p, func(t *testing.T) {
+			expectError(t, call(h.Thumbnail, "/files/thumbnail", p), http.StatusBadRequest, CodeIsADirectory)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"github.com/tachRoutine/beamdrop-go/pkg/system"
+)
+
+// RootInfo describes a shared root and the storage it lives on
+type RootInfo struct {
+	Name       string           `json:"name"`
+	ReadOnly   bool             `json:"readOnly"`
+	UploadOnly bool             `json:"uploadOnly"`
+	Disk       system.DiskStats `json:"disk"`
+}
+
+// RootsResponse is returned by the roots endpoint
+type RootsResponse struct {
+	// Virtual is set when the top level lists named roots rather than the
+	// content of a single shared directory
+	Virtual bool       `json:"virtual"`
+	Roots   []RootInfo `json:"roots"`
+}
+
+// RootsHandler lists the visible shared roots with their options and disk
+// usage
+func RootsHandler(roots *sandbox.Roots) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := RootsResponse{Virtual: roots.Virtual(), Roots: []RootInfo{}}
+		for _, root := range roots.Visible() {
+			resp.Roots = append(resp.Roots, RootInfo{
+				Name:       root.Name,
+				ReadOnly:   root.ReadOnly,
+				UploadOnly: root.UploadOnly,
+				Disk:       system.GetDiskStats(root.Dir()),
+			})
+		}
+		SendJSON(w, http.StatusOK, resp)
+	}
+}
+
+// locate finds the root of a request path and checks it allows the access,
+// writing an error response if it doesn't
+func locate(w http.ResponseWriter, roots *sandbox.Roots, p string, a sandbox.Access, action string) (*sandbox.Root, string, bool) {
+	root, name, err := roots.Locate(p, a)
+	if err != nil {
+		sendPathError(w, err, action)
+		return nil, "", false
+	}
+	return root, name, true
+}
+
+// topLevel lists the visible named roots as the entries of the virtual top
+// level directory
+func topLevel(roots *sandbox.Roots) []File {
+	files := []File{}
+	for _, root := range roots.Visible() {
+		info, err := root.Stat(".")
+		if err != nil {
+			continue
+		}
+		f := newFile(root.FS, ".", root.Name, info)
+		f.Name = root.Name
+		f.Hidden = false
+		files = append(files, f)
+	}
+	return files
+}
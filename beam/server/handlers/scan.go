@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/clamd"
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/quarantine"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"gorm.io/gorm"
+)
+
+// ScanInfected is the scan status of an upload refused for carrying a
+// virus. It's never recorded, the file isn't stored.
+const ScanInfected = "infected"
+
+// Scanner checks new content for viruses with clamd before it's stored:
+// uploads and text writes. Moves, copies and renames aren't scanned, they
+// only place content that is already stored. Infected content goes to
+// quarantine instead.
+type Scanner struct {
+	clamd      *clamd.Client
+	quarantine *quarantine.Store
+	// accept stores uploads clamd couldn't scan instead of refusing them
+	accept bool
+}
+
+// NewScanner returns a scanner using c, or nil if c is nil
+func NewScanner(c *clamd.Client, q *quarantine.Store, onError string) *Scanner {
+	if c == nil {
+		return nil
+	}
+	return &Scanner{clamd: c, quarantine: q, accept: onError == config.ScanErrorAccept}
+}
+
+// Ping checks clamd answers
+func (s *Scanner) Ping(ctx context.Context) error {
+	return s.clamd.Ping(ctx)
+}
+
+// String returns the address of clamd
+func (s *Scanner) String() string {
+	return s.clamd.String()
+}
+
+// scanRefusal is why content must not be stored, and how to answer for it
+type scanRefusal struct {
+	status  int
+	code    string
+	message string
+}
+
+func (r *scanRefusal) send(w http.ResponseWriter) {
+	SendError(w, r.status, r.code, r.message)
+}
+
+// check scans content about to be stored at p, quarantining it if it's
+// infected. open is called for each read of the content. It returns the
+// verdict, and why the content must not be stored, if it mustn't.
+func (s *Scanner) check(ctx context.Context, open func() (io.ReadCloser, error), p, client string) (db.ScanResult, *scanRefusal) {
+	verdict := db.ScanResult{Path: p, Status: db.ScanClean, Scanner: s.clamd.String(), ScannedAt: time.Now()}
+	src, err := open()
+	if err != nil {
+		return verdict, &scanRefusal{http.StatusInternalServerError, CodeInternal, "Failed to read file"}
+	}
+	res, err := s.clamd.Scan(ctx, src)
+	src.Close()
+
+	if err != nil {
+		logger.Error("Failed to scan %s: %v", p, err)
+		verdict.Status, verdict.Error = db.ScanError, err.Error()
+		switch {
+		case s.accept:
+			return verdict, nil
+		case errors.Is(err, clamd.ErrSizeLimit):
+			return verdict, &scanRefusal{http.StatusRequestEntityTooLarge, CodeTooLarge, "File is too large to scan for viruses"}
+		}
+		return verdict, &scanRefusal{http.StatusServiceUnavailable, CodeUnavailable, "Virus scanner unavailable"}
+	}
+	if !res.Infected {
+		return verdict, nil
+	}
+
+	verdict.Status, verdict.Error = ScanInfected, res.Signature
+	if src, err = open(); err == nil {
+		_, err = s.quarantine.Add(src, db.QuarantinedFile{Path: p, Source: "clamd", Reason: res.Signature, Client: client})
+		src.Close()
+	}
+	if err != nil {
+		// Refused all the same, only the copy for inspection is lost
+		logger.Error("Failed to quarantine infected file %s: %v", p, err)
+	}
+	return verdict, &scanRefusal{http.StatusUnprocessableEntity, CodeVirusFound, "Virus found: " + res.Signature}
+}
+
+// record keeps the verdict on a file that was stored
+func (s *Scanner) record(verdict db.ScanResult, p string) {
+	verdict.Path = p
+	db.SaveScanResult(verdict)
+}
+
+// ScanHandler reports the antivirus verdict on files
+type ScanHandler struct {
+	roots   *sandbox.Roots
+	scanner *Scanner
+}
+
+func NewScanHandler(roots *sandbox.Roots, scanner *Scanner) *ScanHandler {
+	return &ScanHandler{roots: roots, scanner: scanner}
+}
+
+// Status returns the verdict on a file when it was uploaded
+func (h *ScanHandler) Status(w http.ResponseWriter, r *http.Request) {
+	root, name, ok := locate(w, h.roots, r.URL.Query().Get("path"), sandbox.Read, "read scan status")
+	if !ok {
+		return
+	}
+	if root == nil {
+		SendError(w, http.StatusBadRequest, CodeIsADirectory, "Path is a directory")
+		return
+	}
+	if _, err := root.Lstat(name); err != nil {
+		sendPathError(w, err, "read scan status")
+		return
+	}
+	p := root.Join(name)
+	resp := ScanResponse{Path: p, Status: db.ScanUnscanned, Scanning: h.scanner != nil}
+	verdict, err := db.GetScanResult(p)
+	switch {
+	case err == nil:
+		resp.Status, resp.Error, resp.Scanner, resp.ScannedAt = verdict.Status, verdict.Error, verdict.Scanner, &verdict.ScannedAt
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to get scan status")
+		return
+	}
+	SendJSON(w, http.StatusOK, resp)
+}
+
+// showScans fills in the scan status of listed files that have one
+func showScans(files []File) {
+	if len(files) == 0 {
+		return
+	}
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+	}
+	statuses, err := db.GetScanStatuses(paths)
+	if err != nil {
+		return
+	}
+	for i := range files {
+		files[i].Scan = statuses[files[i].Path]
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/clamd"
+	"github.com/tachRoutine/beamdrop-go/pkg/clamd/clamdtest"
+	"github.com/tachRoutine/beamdrop-go/pkg/contentpolicy"
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/jobs"
+	"github.com/tachRoutine/beamdrop-go/pkg/pipeline"
+	"github.com/tachRoutine/beamdrop-go/pkg/quarantine"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"github.com/tachRoutine/beamdrop-go/pkg/webhooks"
+)
+
+// fakeClamd starts a clamdtest.Fake for the test and returns a client of it
+func fakeClamd(t *testing.T) *clamd.Client {
+	t.Helper()
+	f := &clamdtest.Fake{}
+	if err := f.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	c, err := clamd.New(f.Addr(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestUploadInfected(t *testing.T) {
+	c := fakeClamd(t)
+	q, err := quarantine.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	fs, err := sandbox.New(dir, sandbox.SymlinksDeny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := sandbox.Single(fs)
+	defer roots.Close()
+	h := NewFileHandler(roots, "", jobs.NewManager(1), pipeline.New(nil, q),
+		NewScanner(c, q, config.ScanErrorReject), contentpolicy.NewSet(config.UploadPolicy{}, nil), webhooks.NewDispatcher())
+
+	resp := upload(t, h, map[string]string{"clean.txt": "hello", "eicar.com": clamdtest.EICAR})
+	if resp.Uploaded != 1 || resp.Failed != 1 {
+		t.Fatalf("got %d uploaded and %d failed, want 1 and 1: %+v", resp.Uploaded, resp.Failed, resp.Files)
+	}
+	for _, res := range resp.Files {
+		switch res.Name {
+		case "clean.txt":
+			if res.Status != UploadCreated || res.Scan != db.ScanClean {
+				t.Errorf("clean file: got status %q scan %q", res.Status, res.Scan)
+			}
+		case "eicar.com":
+			if res.Status != UploadFailed || res.Scan != ScanInfected || res.Error != "Virus found: Eicar-Test-Signature" {
+				t.Errorf("infected file: got status %q scan %q error %q", res.Status, res.Scan, res.Error)
+			}
+		}
+	}
+
+	// Nothing of the infected file is visible, temporary files included
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "clean.txt" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("shared directory holds %v, want only clean.txt", names)
+	}
+	if _, err := db.GetScanResult("eicar.com"); err == nil {
+		t.Error("a scan result was recorded for the refused file")
+	}
+
+	// It's in quarantine instead
+	records, err := db.GetQuarantined()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found *db.QuarantinedFile
+	for i := range records {
+		if records[i].Path == "eicar.com" {
+			found = &records[i]
+		}
+	}
+	if found == nil {
+		t.Fatal("the infected file wasn't recorded in quarantine")
+	}
+	if found.Source != "clamd" || found.Reason != "Eicar-Test-Signature" {
+		t.Errorf("quarantine record: got source %q reason %q", found.Source, found.Reason)
+	}
+	content, err := os.ReadFile(filepath.Join(q.Dir(), found.ID))
+	if err != nil || string(content) != clamdtest.EICAR {
+		t.Errorf("quarantined content: got %q, %v", content, err)
+	}
+}
+
+func TestWriteInfected(t *testing.T) {
+	q, err := quarantine.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := singleRoot(t, nil)
+	h := NewFileOperationsHandler(roots, jobs.NewManager(1), NewScanner(fakeClamd(t), q, config.ScanErrorReject),
+		acceptAll, webhooks.NewDispatcher())
+
+	w := post(h.Write, WriteRequest{FilePath: "written/eicar.txt", Content: clamdtest.EICAR})
+	expectError(t, w, http.StatusUnprocessableEntity, CodeVirusFound)
+	if _, err := roots.All()[0].Lstat("written/eicar.txt"); err == nil {
+		t.Error("the infected content was written")
+	}
+	records, err := db.GetQuarantined()
+	if err != nil {
+		t.Fatal(err)
+	}
+	quarantined := false
+	for _, rec := range records {
+		quarantined = quarantined || rec.Path == "written/eicar.txt"
+	}
+	if !quarantined {
+		t.Error("the infected content wasn't quarantined")
+	}
+
+	if w := post(h.Write, WriteRequest{FilePath: "written/notes.txt", Content: "hello"}); w.Code != http.StatusOK {
+		t.Fatalf("writing clean text: got %d %s", w.Code, w.Body)
+	}
+	if verdict, err := db.GetScanResult("written/notes.txt"); err != nil || verdict.Status != db.ScanClean {
+		t.Errorf("verdict on the written file: %+v, %v", verdict, err)
+	}
+}
+
+func TestScanStatusTopLevel(t *testing.T) {
+	h := NewScanHandler(namedRoots(t), nil)
+	for _, p := range []string{"", "/", "."} {
+		expectError(t, call(h.Status, "/files/scan", p), http.StatusBadRequest, CodeIsADirectory)
+	}
+}
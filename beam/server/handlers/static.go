@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"encoding/json"
 	"io"
 	"mime"
 	"net/http"
@@ -22,9 +21,7 @@ func StaticHandler(w http.ResponseWriter, r *http.Request) {
 	file, err := static.FrontendFiles.Open("frontend/dist" + urlPath)
 	if err != nil {
 		logger.Warn("Static file not found: %s", urlPath)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Not found"})
+		SendError(w, http.StatusNotFound, CodeNotFound, "Not found")
 		return
 	}
 	defer file.Close()
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"github.com/tachRoutine/beamdrop-go/pkg/db"
@@ -12,12 +11,9 @@ func StatsHandler(w http.ResponseWriter, r *http.Request) {
 	stats, err := db.GetStats()
 	if err != nil {
 		logger.Error("Failed to get server stats: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to get server stats"})
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to get server stats")
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(stats)
+	SendJSON(w, http.StatusOK, stats)
 }
 
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"gorm.io/gorm"
+)
+
+// maxTagName is the longest tag or collection name
+const maxTagName = 64
+
+var tagColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// TagsHandler manages tags and their assignment to paths
+type TagsHandler struct {
+	roots *sandbox.Roots
+}
+
+func NewTagsHandler(roots *sandbox.Roots) *TagsHandler {
+	return &TagsHandler{roots: roots}
+}
+
+// List returns every tag with how many paths carry it
+func (h *TagsHandler) List(w http.ResponseWriter, r *http.Request) {
+	tags, usage, err := db.GetTags()
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to list tags")
+		return
+	}
+	resp := TagsResponse{Tags: make([]TagInfo, 0, len(tags))}
+	for _, t := range tags {
+		resp.Tags = append(resp.Tags, TagInfo{Tag: t, Files: usage[t.ID]})
+	}
+	SendJSON(w, http.StatusOK, resp)
+}
+
+// Create adds a tag
+func (h *TagsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.Name == nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Tag name is required")
+		return
+	}
+	var tag db.Tag
+	if !applyTag(w, &tag, req) {
+		return
+	}
+	if err := db.SaveTag(&tag); err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to create tag")
+		return
+	}
+	logger.Info("Tag created: %s", tag.Name)
+	SendJSON(w, http.StatusCreated, TagResponse{Message: "Tag created", Tag: TagInfo{Tag: tag}})
+}
+
+// Update changes the name, color or description of a tag
+func (h *TagsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	tag, ok := pathTag(w, r)
+	if !ok {
+		return
+	}
+	var req TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if !applyTag(w, &tag, req) {
+		return
+	}
+	if err := db.SaveTag(&tag); err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to update tag")
+		return
+	}
+	SendJSON(w, http.StatusOK, TagResponse{Message: "Tag updated", Tag: TagInfo{Tag: tag}})
+}
+
+// Delete removes a tag from everything that carries it
+func (h *TagsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	tag, ok := pathTag(w, r)
+	if !ok {
+		return
+	}
+	if err := db.DeleteTag(tag.ID); err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to delete tag")
+		return
+	}
+	logger.Info("Tag deleted: %s", tag.Name)
+	SendJSON(w, http.StatusOK, TagResponse{Message: "Tag deleted", Tag: TagInfo{Tag: tag}})
+}
+
+// Assign adds and removes tags on many paths at once. Every path and tag is
+// checked before anything changes.
+func (h *TagsHandler) Assign(w http.ResponseWriter, r *http.Request) {
+	var req TagAssignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	switch {
+	case len(req.Paths) == 0:
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "No paths given")
+		return
+	case len(req.Paths) > MaxBatchSize:
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("At most %d paths can be tagged at once", MaxBatchSize))
+		return
+	case len(req.Add) == 0 && len(req.Remove) == 0:
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "No tags to add or remove")
+		return
+	}
+
+	add, ok := tagIDs(w, req.Add)
+	if !ok {
+		return
+	}
+	remove, ok := tagIDs(w, req.Remove)
+	if !ok {
+		return
+	}
+	paths, ok := metadataPaths(w, h.roots, req.Paths, len(add) > 0, "tag file")
+	if !ok {
+		return
+	}
+
+	added, removed, err := db.TagFiles(paths, add, remove)
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to tag files")
+		return
+	}
+	if len(add) > 0 {
+		trackPaths(h.roots, paths...)
+	}
+	logger.Info("Tagged %d path(s): %d tag(s) added, %d removed", len(paths), added, removed)
+	SendJSON(w, http.StatusOK, TagAssignResponse{
+		Message: fmt.Sprintf("%d tag(s) added, %d removed", added, removed),
+		Paths:   len(paths),
+		Added:   added,
+		Removed: removed,
+	})
+}
+
+// pathTag loads the tag named by the id path segment
+func pathTag(w http.ResponseWriter, r *http.Request) (db.Tag, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 0)
+	if err != nil {
+		SendError(w, http.StatusNotFound, CodeNotFound, "Tag not found")
+		return db.Tag{}, false
+	}
+	tag, err := db.GetTag(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		SendError(w, http.StatusNotFound, CodeNotFound, "Tag not found")
+		return tag, false
+	}
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to get tag")
+		return tag, false
+	}
+	return tag, true
+}
+
+// applyTag validates the fields set in req and copies them onto tag
+func applyTag(w http.ResponseWriter, tag *db.Tag, req TagRequest) bool {
+	if req.Name != nil {
+		name, ok := validName(w, *req.Name, "Tag")
+		if !ok {
+			return false
+		}
+		if strings.Contains(name, ",") {
+			// Commas separate the tags of a search
+			SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Tag name can't contain a comma")
+			return false
+		}
+		others, err := db.GetTagsByName([]string{name})
+		if err != nil {
+			SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to check tag name")
+			return false
+		}
+		if len(others) > 0 && others[0].ID != tag.ID {
+			SendError(w, http.StatusConflict, CodeAlreadyExists, "A tag named "+others[0].Name+" already exists")
+			return false
+		}
+		tag.Name = name
+	}
+	if req.Color != nil {
+		if *req.Color != "" && !tagColor.MatchString(*req.Color) {
+			SendError(w, http.StatusBadRequest, CodeInvalidRequest, "color must be like #3a7 or #33aa77")
+			return false
+		}
+		tag.Color = strings.ToLower(*req.Color)
+	}
+	if req.Description != nil {
+		tag.Description = strings.TrimSpace(*req.Description)
+	}
+	return true
+}
+
+// validName checks the name of a tag or collection
+func validName(w http.ResponseWriter, name, kind string) (string, bool) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, kind+" name is required")
+	case len(name) > maxTagName:
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("%s name is longer than %d bytes", kind, maxTagName))
+	default:
+		return name, true
+	}
+	return "", false
+}
+
+// tagIDs resolves tag names without repeats, refusing unknown ones
+func tagIDs(w http.ResponseWriter, names []string) ([]uint, bool) {
+	tags, err := db.GetTagsByName(names)
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to get tags")
+		return nil, false
+	}
+	var ids []uint
+	for _, n := range names {
+		i := slices.IndexFunc(tags, func(t db.Tag) bool { return strings.EqualFold(t.Name, strings.TrimSpace(n)) })
+		if i < 0 {
+			SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Unknown tag "+n)
+			return nil, false
+		}
+		if !slices.Contains(ids, tags[i].ID) {
+			ids = append(ids, tags[i].ID)
+		}
+	}
+	return ids, true
+}
+
+// metadataPaths turns the paths tags or collections refer to into the form
+// the database keeps. If exist is set the paths must exist.
+func metadataPaths(w http.ResponseWriter, roots *sandbox.Roots, paths []string, exist bool, action string) ([]string, bool) {
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		root, name, err := roots.Locate(p, sandbox.Read)
+		if err == nil && root == nil {
+			SendError(w, http.StatusBadRequest, CodeInvalidPath, "Refusing to "+action+" the top level")
+			return nil, false
+		}
+		if err == nil && exist {
+			_, err = root.Lstat(name)
+		}
+		if err != nil {
+			status, code, msg := pathError(err, action)
+			SendError(w, status, code, p+": "+msg)
+			return nil, false
+		}
+		if apiPath := root.Join(name); !slices.Contains(out, apiPath) {
+			out = append(out, apiPath)
+		}
+	}
+	return out, true
+}
+
+// showTags sets the Tags of each file
+func showTags(files []File) {
+	if len(files) == 0 {
+		return
+	}
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+	}
+	tags, err := db.GetFileTags(paths)
+	if err != nil {
+		return
+	}
+	for i := range files {
+		files[i].Tags = tags[files[i].Path]
+	}
+}
+
+// searchTags returns the tag names of a search, from repeated or
+// comma-separated tag parameters
+func searchTags(r *http.Request) []string {
+	var names []string
+	for _, v := range r.URL.Query()["tag"] {
+		for _, n := range strings.Split(v, ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				names = append(names, n)
+			}
+		}
+	}
+	return names
+}
@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
 	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/jobs"
+	"github.com/tachRoutine/beamdrop-go/pkg/textfile"
 )
 
 // File represents a file or directory in the file system
@@ -16,41 +18,269 @@ type File struct {
 	ModTime   string `json:"modTime"`
 	Path      string `json:"path"`
 	IsStarred bool   `json:"isStarred"`
+
+	// Raw metadata for scripts; Size and ModTime above are for display
+	Type        string    `json:"type"` // "file", "dir", "symlink" or "other"
+	Bytes       int64     `json:"bytes"`
+	Modified    time.Time `json:"modified"` // UTC
+	MimeType    string    `json:"mimeType,omitempty"`
+	Mode        string    `json:"mode"`        // e.g. "-rw-r--r--"
+	Permissions string    `json:"permissions"` // octal, e.g. "0644"
+	Hidden      bool      `json:"hidden"`
+	LinkTarget  string    `json:"linkTarget,omitempty"`
+	Children    *int      `json:"children,omitempty"` // entries of a directory, listings only
+
+	// Lock is the lock on the entry or a directory above it, if any
+	Lock *db.Lock `json:"lock,omitempty"`
+	// Tags are the names of the tags on the entry
+	Tags []string `json:"tags,omitempty"`
+	// Comments counts the comments on the entry
+	Comments int `json:"comments,omitempty"`
+	// Scan is the antivirus verdict from when the file was uploaded, clean
+	// or error; empty if it wasn't scanned
+	Scan string `json:"scan,omitempty"`
 }
 
-// ResolvePath safely resolves a relative path within the shared directory
-func ResolvePath(sharedDir, reqPath string) (string, error) {
-	if reqPath == "" {
-		return sharedDir, nil
-	}
+// MoveRequest is the body of a move or copy
+type MoveRequest struct {
+	SourcePath string `json:"sourcePath"`
+	TargetPath string `json:"targetPath"`
+	// Policy for existing targets: merge (default), overwrite or skip
+	Policy string `json:"policy,omitempty"`
+	// Background runs the operation as a job even for a single file
+	Background bool `json:"background,omitempty"`
+}
 
-	clean := filepath.Clean(reqPath)
-	target := filepath.Join(sharedDir, clean)
+// RenameRequest is the body of a rename
+type RenameRequest struct {
+	OldPath string `json:"oldPath"`
+	NewName string `json:"newName"`
+}
 
-	absShared, err := filepath.Abs(sharedDir)
-	if err != nil {
-		return "", err
-	}
+// MkdirRequest is the body of a mkdir
+type MkdirRequest struct {
+	DirPath string `json:"dirPath"`
+}
 
-	absTarget, err := filepath.Abs(target)
-	if err != nil {
-		return "", err
-	}
+// WriteRequest is the body of a write
+type WriteRequest struct {
+	FilePath string `json:"filePath"`
+	Content  string `json:"content"`
+	// Encoding to store the content in: utf-8, utf-8-bom, utf-16le, utf-16be
+	// or latin-1. Defaults to the encoding of the file being replaced.
+	Encoding string `json:"encoding,omitempty"`
+}
 
-	if !strings.HasPrefix(absTarget, absShared) {
-		return "", fmt.Errorf("path traversal attempt")
-	}
+// StarRequest is the body of a star toggle
+type StarRequest struct {
+	FilePath string `json:"filePath"`
+}
 
-	return absTarget, nil
+// UploadResult reports what happened to one file of an upload
+type UploadResult struct {
+	// Name is the relative path the file was sent with
+	Name string `json:"name"`
+	// Path is where the file was stored, or would have been for skipped files
+	Path   string `json:"path,omitempty"`
+	Status string `json:"status"` // created, overwritten, renamed, skipped or failed
+	Bytes  int64  `json:"bytes"`
+	Error  string `json:"error,omitempty"`
+	// Scan is the antivirus verdict, clean, infected or error, when uploads
+	// are scanned
+	Scan string `json:"scan,omitempty"`
 }
 
-// IsFile checks if the given path is a file
-func IsFile(path string) bool {
-	info, err := os.Stat(path)
-	if err != nil {
-		return false
-	}
-	return !info.IsDir()
+// PolicyViolation is a file the content policy refuses
+type PolicyViolation struct {
+	Name string `json:"name"`
+	// Type is what the content sniffed as
+	Type   string `json:"type,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// PolicyErrorResponse refuses an upload, write, rename, move or copy that
+// would put a file the content policy doesn't accept in a root; nothing of
+// it is done
+type PolicyErrorResponse struct {
+	ErrorResponse
+	Violations []PolicyViolation `json:"violations"`
+}
+
+// UploadResponse is returned after an upload with a result per file
+type UploadResponse struct {
+	Message string `json:"message"`
+	// File is the name of the first file stored, kept for older clients
+	File     string         `json:"file"`
+	Files    []UploadResult `json:"files"`
+	Uploaded int            `json:"uploaded"`
+	Skipped  int            `json:"skipped"`
+	Failed   int            `json:"failed"`
+	// Processing is the job running the processing pipeline on the stored
+	// files, if processors are configured
+	Processing *jobs.Job `json:"processing,omitempty"`
+}
+
+// TransferResponse is returned by move and copy
+type TransferResponse struct {
+	Message string `json:"message"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Files   int64  `json:"files"`
+	Skipped int64  `json:"skipped"`
+}
+
+// BatchOperation is one operation of a batch. Path is the source of a move
+// or copy and the entry every other operation acts on.
+type BatchOperation struct {
+	Op         string `json:"op"` // move, copy, rename, delete, star or unstar
+	Path       string `json:"path"`
+	TargetPath string `json:"targetPath,omitempty"` // move and copy
+	NewName    string `json:"newName,omitempty"`    // rename
+	Policy     string `json:"policy,omitempty"`     // move and copy
+}
+
+// BatchRequest is the body of a batch
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+	// Mode is stop-on-error (default) or best-effort
+	Mode string `json:"mode,omitempty"`
+	// Background runs the batch as a job even when it's small
+	Background bool `json:"background,omitempty"`
+}
+
+// BatchResult is the outcome of one operation of a batch
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Path   string `json:"path"`
+	Status string `json:"status"` // done, failed, skipped or invalid
+	Error  string `json:"error,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+// BatchResponse is returned by a batch, and stored as the result of a batch
+// job. When validation fails it's sent with 400 and Error and Code set, like
+// an ErrorResponse.
+type BatchResponse struct {
+	Message string        `json:"message"`
+	Error   string        `json:"error,omitempty"`
+	Code    string        `json:"code,omitempty"`
+	Done    int           `json:"done"`
+	Failed  int           `json:"failed"`
+	Skipped int           `json:"skipped"`
+	Results []BatchResult `json:"results"`
+}
+
+// JobResponse is returned for an operation that continues in the background
+type JobResponse struct {
+	Message string   `json:"message"`
+	Job     jobs.Job `json:"job"`
+}
+
+// JobsResponse lists the background jobs
+type JobsResponse struct {
+	Jobs []jobs.Job `json:"jobs"`
+}
+
+// PathResponse is returned by operations on a single path
+type PathResponse struct {
+	Message string `json:"message"`
+	Path    string `json:"path"`
+}
+
+// RenameResponse is returned by rename
+type RenameResponse struct {
+	Message string `json:"message"`
+	OldPath string `json:"oldPath"`
+	NewPath string `json:"newPath"`
+	// Warning says what went wrong after the entry was renamed, like its
+	// stars and tags staying behind
+	Warning string `json:"warning,omitempty"`
+}
+
+// WriteResponse is returned by write
+type WriteResponse struct {
+	Message  string            `json:"message"`
+	FilePath string            `json:"filePath"`
+	Revision string            `json:"revision"`
+	Encoding textfile.Encoding `json:"encoding"`
+}
+
+// ReadResponse is returned by read
+type ReadResponse struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	// Encoding the file is stored in; content is always sent as UTF-8
+	Encoding textfile.Encoding `json:"encoding"`
+	// LineEnding is lf, crlf, cr, mixed or none, for the content returned
+	LineEnding string `json:"lineEnding"`
+	// Revision of the whole file, also sent as the ETag header
+	Revision string    `json:"revision"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modTime"`
+	// Lines counts the lines of the whole file
+	Lines int `json:"lines"`
+	// From and To are the lines returned by a range read
+	From    int  `json:"from,omitempty"`
+	To      int  `json:"to,omitempty"`
+	Partial bool `json:"partial,omitempty"`
+}
+
+// RevisionConflictResponse is returned with 412 by a write whose If-Match
+// header names an outdated revision
+type RevisionConflictResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+	// Revision is the current one, empty if the file no longer exists
+	Revision string `json:"revision"`
+}
+
+// SearchResponse is returned by search
+type SearchResponse struct {
+	Query   string   `json:"query"`
+	Tags    []string `json:"tags,omitempty"`
+	Path    string   `json:"path"`
+	Results []File   `json:"results"`
+	Count   int      `json:"count"`
+}
+
+// StarResponse is returned by a star toggle
+type StarResponse struct {
+	Message  string `json:"message"`
+	FilePath string `json:"filePath"`
+	Starred  bool   `json:"starred"`
+}
+
+// LegacyStarResponse is what the deprecated /star route returns, with
+// starred as "true" or "false"
+type LegacyStarResponse struct {
+	Message  string `json:"message"`
+	FilePath string `json:"filePath"`
+	Starred  string `json:"starred"`
+}
+
+// StarredFile is an entry of the starred files list
+type StarredFile struct {
+	FilePath  string `json:"filePath"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// StarredResponse is returned by the starred files list
+type StarredResponse struct {
+	Starred []StarredFile `json:"starred"`
+}
+
+// HealthResponse is returned by the liveness check
+type HealthResponse struct {
+	Status  string `json:"status"`
+	Service string `json:"service"`
+}
+
+// ReadinessResponse is returned by the readiness check
+type ReadinessResponse struct {
+	Status  string            `json:"status"`
+	Service string            `json:"service"`
+	Checks  map[string]string `json:"checks"`
 }
 
 // FormatFileSize formats file size in human-readable format
@@ -76,3 +306,265 @@ func FormatModTime(modTime string) string {
 	return t.Format("2006-01-02 15:04:05")
 }
 
+// LockRequest is the body of a lock
+type LockRequest struct {
+	Path string `json:"path"`
+	// Owner names who holds the lock; the client's address by default
+	Owner  string `json:"owner,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// TTL is how many seconds the lock lasts without a renewal
+	TTL int `json:"ttl,omitempty"`
+}
+
+// RenewLockRequest is the optional body of a lock renewal
+type RenewLockRequest struct {
+	TTL int `json:"ttl,omitempty"`
+}
+
+// LockResponse is returned by lock, renew and unlock
+type LockResponse struct {
+	Message string  `json:"message"`
+	Lock    db.Lock `json:"lock"`
+	// Token is only sent to the client taking the lock. Send it in the
+	// X-Lock-Token header to change the locked files, renew or unlock.
+	Token string `json:"token,omitempty"`
+}
+
+// LocksResponse is returned by the lock listing
+type LocksResponse struct {
+	Locks []db.Lock `json:"locks"`
+}
+
+// LockedResponse is returned with 423 for a change to a path someone else
+// holds a lock on
+type LockedResponse struct {
+	Error string  `json:"error"`
+	Code  string  `json:"code"`
+	Lock  db.Lock `json:"lock"`
+}
+
+// TagInfo is a tag with how many paths carry it
+type TagInfo struct {
+	db.Tag
+	Files int64 `json:"files"`
+}
+
+// TagRequest is the body of a tag creation or update. Fields left out are
+// kept as they are.
+type TagRequest struct {
+	Name *string `json:"name,omitempty"`
+	// Color is like "#3a7" or "#33aa77", or empty for none
+	Color       *string `json:"color,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+// TagResponse is returned by tag creation, update and deletion
+type TagResponse struct {
+	Message string  `json:"message"`
+	Tag     TagInfo `json:"tag"`
+}
+
+// TagsResponse is returned by the tag listing
+type TagsResponse struct {
+	Tags []TagInfo `json:"tags"`
+}
+
+// TagAssignRequest is the body of a bulk tag change. Tags are named and
+// must exist.
+type TagAssignRequest struct {
+	Paths  []string `json:"paths"`
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+}
+
+// TagAssignResponse is returned by a bulk tag change
+type TagAssignResponse struct {
+	Message string `json:"message"`
+	Paths   int    `json:"paths"`
+	Added   int64  `json:"added"`
+	Removed int64  `json:"removed"`
+}
+
+// CollectionInfo is a collection with how many paths it holds
+type CollectionInfo struct {
+	db.Collection
+	Items int64 `json:"items"`
+}
+
+// CollectionRequest is the body of a collection creation or update. Fields
+// left out are kept as they are.
+type CollectionRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+// CollectionResponse is returned by collection creation, update and
+// deletion
+type CollectionResponse struct {
+	Message    string         `json:"message"`
+	Collection CollectionInfo `json:"collection"`
+}
+
+// CollectionsResponse is returned by the collection listing
+type CollectionsResponse struct {
+	Collections []CollectionInfo `json:"collections"`
+}
+
+// CollectionContentResponse lists what a collection holds
+type CollectionContentResponse struct {
+	Collection CollectionInfo `json:"collection"`
+	Entries    []File         `json:"entries"`
+	// Missing are the paths in the collection that no longer exist
+	Missing []string `json:"missing"`
+}
+
+// CollectionItemsRequest is the body of a collection item change
+type CollectionItemsRequest struct {
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+}
+
+// CollectionItemsResponse is returned by a collection item change
+type CollectionItemsResponse struct {
+	Message string `json:"message"`
+	Added   int64  `json:"added"`
+	Removed int64  `json:"removed"`
+}
+
+// PathMove is metadata that followed a file from one path to another
+type PathMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ReconcileReport is the result of a reconcile job: how many tracked paths
+// were still there, whose metadata followed a move and whose was removed
+type ReconcileReport struct {
+	Checked int        `json:"checked"`
+	Moved   []PathMove `json:"moved"`
+	Removed []string   `json:"removed"`
+}
+
+// CommentRequest is the body of a new comment or an edit, which only
+// changes Body
+type CommentRequest struct {
+	Path string `json:"path"`
+	Body string `json:"body"`
+	// ParentID makes the comment a reply
+	ParentID *uint `json:"parentId,omitempty"`
+	// Author names who wrote it; the client's address by default
+	Author string `json:"author,omitempty"`
+}
+
+// CommentResponse is returned by comment creation, edits and deletion
+type CommentResponse struct {
+	Message string     `json:"message"`
+	Comment db.Comment `json:"comment"`
+	// Token is only sent to the client adding the comment. Send it in the
+	// X-Comment-Token header to edit or delete the comment.
+	Token string `json:"token,omitempty"`
+}
+
+// CommentThread is a comment with the replies to it
+type CommentThread struct {
+	db.Comment
+	Replies []CommentThread `json:"replies,omitempty"`
+}
+
+// CommentsResponse is returned by the comment listing
+type CommentsResponse struct {
+	Path    string          `json:"path"`
+	Count   int             `json:"count"`
+	Threads []CommentThread `json:"threads"`
+}
+
+// CommentEvent is pushed over the stats WebSocket when a comment is added,
+// edited or deleted
+type CommentEvent struct {
+	Event   string     `json:"event"` // created, updated or deleted
+	Comment db.Comment `json:"comment"`
+}
+
+// WebhookRequest is the body of a webhook creation or update. Fields left
+// out are kept as they are.
+type WebhookRequest struct {
+	URL *string `json:"url,omitempty"`
+	// Secret signs the payloads; an empty one is generated and returned
+	Secret *string `json:"secret,omitempty"`
+	// Events are the event types to send, every one if empty
+	Events *[]string `json:"events,omitempty"`
+	// Paths are patterns like "builds" or "*/reports/*.pdf". A pattern
+	// matching a directory covers everything in it. Every path if empty.
+	Paths  *[]string `json:"paths,omitempty"`
+	Active *bool     `json:"active,omitempty"`
+}
+
+// WebhookResponse is returned by webhook creation, update and deletion
+type WebhookResponse struct {
+	Message string     `json:"message"`
+	Webhook db.Webhook `json:"webhook"`
+	// Secret is only sent when the server generated it
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhooksResponse is returned by the webhook listing
+type WebhooksResponse struct {
+	Webhooks []db.Webhook `json:"webhooks"`
+}
+
+// WebhookDelivery is a delivery with the payload it sends
+type WebhookDelivery struct {
+	db.WebhookDelivery
+	Payload json.RawMessage `json:"payload"`
+}
+
+// WebhookDeliveryResponse is returned when a ping is queued
+type WebhookDeliveryResponse struct {
+	Message  string          `json:"message"`
+	Delivery WebhookDelivery `json:"delivery"`
+}
+
+// WebhookDeliveriesResponse is the delivery log of a webhook, newest first
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+// ProcessingReport is the result of a process job. Missing counts the files
+// gone or unreadable before they could be processed.
+type ProcessingReport struct {
+	Processed   int      `json:"processed"`
+	Missing     int      `json:"missing"`
+	Failed      int      `json:"failed"`
+	Deleted     []string `json:"deleted,omitempty"`
+	Quarantined []string `json:"quarantined,omitempty"`
+}
+
+// ProcessingResponse holds the results of the processors that last ran on a
+// file, in the order they ran
+type ProcessingResponse struct {
+	Path    string                `json:"path"`
+	Results []db.ProcessingResult `json:"results"`
+}
+
+// QuarantineResponse lists the quarantined files, newest first
+type QuarantineResponse struct {
+	Files []db.QuarantinedFile `json:"files"`
+}
+
+// QuarantinedFileResponse is returned when a quarantined file is deleted
+type QuarantinedFileResponse struct {
+	Message string             `json:"message"`
+	File    db.QuarantinedFile `json:"file"`
+}
+
+// ScanResponse is the antivirus verdict on a file from when it was
+// uploaded. Status is clean, error (stored although clamd couldn't scan
+// it) or unscanned. Scanning tells whether uploads are scanned now.
+type ScanResponse struct {
+	Path      string     `json:"path"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	Scanner   string     `json:"scanner,omitempty"`
+	ScannedAt *time.Time `json:"scannedAt,omitempty"`
+	Scanning  bool       `json:"scanning"`
+}
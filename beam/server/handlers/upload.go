@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/contentpolicy"
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"github.com/tachRoutine/beamdrop-go/pkg/sniff"
+	"github.com/tachRoutine/beamdrop-go/pkg/webhooks"
+)
+
+// Conflict policies for uploaded files whose name is already taken
+const (
+	ConflictOverwrite = "overwrite"
+	ConflictRename    = "rename" // store as "name (1).ext"
+	ConflictSkip      = "skip"
+	ConflictFail      = "fail" // reject the whole upload with 409
+)
+
+// DefaultConflict applies when an upload doesn't name a policy
+const DefaultConflict = ConflictRename
+
+var conflictPolicies = []string{ConflictOverwrite, ConflictRename, ConflictSkip, ConflictFail}
+
+// Statuses of the files in an UploadResponse
+const (
+	UploadCreated     = "created"
+	UploadOverwritten = "overwritten"
+	UploadRenamed     = "renamed"
+	UploadSkipped     = "skipped"
+	UploadFailed      = "failed"
+)
+
+// maxUploadMemory is how much of an upload is buffered in memory before the
+// rest spills to temporary files
+const maxUploadMemory = 32 << 20
+
+// maxRenames bounds the search for a free "name (n).ext"
+const maxRenames = 10000
+
+// uploadedFile is one file of an upload request
+type uploadedFile struct {
+	header *multipart.FileHeader
+	name   string // relative path below the target directory
+}
+
+// Upload stores the files of a multipart form in the directory named by the
+// path field. Files come in "files" or "file" fields; folder uploads keep
+// their layout through relativePath fields or slashes in the file names.
+func (h *FileHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Upload request received")
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		logger.Error("Invalid upload request: %v", err)
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid upload")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	policy := r.FormValue("conflict")
+	if policy == "" {
+		policy = DefaultConflict
+	}
+	if !slices.Contains(conflictPolicies, policy) {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "conflict must be one of "+strings.Join(conflictPolicies, ", "))
+		return
+	}
+
+	files := uploadedFiles(r.MultipartForm)
+	if len(files) == 0 {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "No files in upload")
+		return
+	}
+
+	// Optional target directory relative to the shared directory
+	targetDir := r.FormValue("path")
+	root, dir, ok := locate(w, h.roots, targetDir, sandbox.Upload, "open upload directory")
+	if !ok {
+		return
+	}
+	info, err := root.Stat(dir)
+	if err != nil {
+		sendPathError(w, err, "open upload directory")
+		return
+	}
+	if !info.IsDir() {
+		SendError(w, http.StatusBadRequest, CodeNotADirectory, "Upload path is not a directory")
+		return
+	}
+	// Someone who can only drop files can't see what's there, so they get
+	// no say in it: overwriting would replace files they can't list, and
+	// skip or fail would tell which names exist
+	if root.UploadOnly || h.roots.Mode() == sandbox.ModeDropBox {
+		policy = ConflictRename
+	}
+
+	// Refuse the whole upload before anything is written if a file breaks
+	// the root's content policy
+	if violations := checkPolicy(h.policies.For(root.Name), files); len(violations) > 0 {
+		sendPolicyError(w, violations)
+		return
+	}
+
+	// A drop box keeps each upload apart from what others sent
+	if h.roots.Mode() == sandbox.ModeDropBox {
+		dir = path.Join(dir, h.dropFolder(w, r))
+		if err := root.MkdirAll(dir, sandbox.DirMode); err != nil {
+			sendPathError(w, err, "create drop folder")
+			return
+		}
+	}
+
+	// Check every name first so a conflict doesn't leave half an upload
+	if policy == ConflictFail {
+		for _, f := range files {
+			if f.name == "" {
+				continue
+			}
+			if _, err := root.Lstat(path.Join(dir, f.name)); err == nil {
+				SendError(w, http.StatusConflict, CodeAlreadyExists, f.name+" already exists")
+				return
+			}
+		}
+	}
+
+	resp := UploadResponse{Files: make([]UploadResult, 0, len(files))}
+	tokens := lockTokens(r)
+	var stored []string
+	for _, f := range files {
+		res := h.storeUpload(r, root, dir, f, policy, tokens)
+		switch res.Status {
+		case UploadSkipped:
+			resp.Skipped++
+		case UploadFailed:
+			resp.Failed++
+		default:
+			resp.Uploaded++
+			db.IncrementUploads()
+			stored = append(stored, res.Path)
+			h.hooks.Emit(webhooks.Event{Type: webhooks.Upload, Path: res.Path, Size: res.Bytes, Client: requestOwner(r)})
+			if resp.File == "" {
+				resp.File = path.Base(res.Path)
+			}
+		}
+		resp.Files = append(resp.Files, res)
+	}
+
+	resp.Processing = submitProcessing(h.jobs, h.pipeline, stored, requestOwner(r))
+
+	resp.Message = "Uploaded"
+	if resp.Failed > 0 {
+		resp.Message = fmt.Sprintf("%d of %d files failed to upload", resp.Failed, len(files))
+	}
+	logger.Info("Upload finished: %d stored, %d skipped, %d failed", resp.Uploaded, resp.Skipped, resp.Failed)
+	SendJSON(w, http.StatusOK, resp)
+}
+
+// uploadedFiles collects the files of the form in order, "files" fields
+// before "file" fields. The i-th relativePath value, if any, names the i-th
+// file. An invalid name is left empty and reported when storing.
+func uploadedFiles(form *multipart.Form) []uploadedFile {
+	headers := append(slices.Clone(form.File["files"]), form.File["file"]...)
+	relPaths := form.Value["relativePath"]
+
+	files := make([]uploadedFile, 0, len(headers))
+	for i, fh := range headers {
+		name := path.Base(strings.ReplaceAll(fh.Filename, "\\", "/"))
+		if i < len(relPaths) && relPaths[i] != "" {
+			name = relPaths[i]
+		} else if raw := rawFilename(fh); strings.Contains(raw, "/") {
+			// Browsers send webkitRelativePath as the file name when asked to
+			name = raw
+		}
+
+		// Names of temporary files are reserved, they'd be swept away
+		clean, err := sandbox.Clean(name)
+		if err != nil || clean == "." || sandbox.IsTemp(path.Base(clean)) {
+			clean = ""
+		}
+		files = append(files, uploadedFile{header: fh, name: clean})
+	}
+	return files
+}
+
+// rawFilename returns the file name as sent. multipart only keeps its last
+// element.
+func rawFilename(fh *multipart.FileHeader) string {
+	_, params, err := mime.ParseMediaType(fh.Header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+	return params["filename"]
+}
+
+// checkPolicy returns the files of an upload the policy refuses, judging
+// their type by their first bytes rather than their name
+func checkPolicy(policy *contentpolicy.Policy, files []uploadedFile) []PolicyViolation {
+	if policy == nil {
+		return nil
+	}
+	var violations []PolicyViolation
+	head := make([]byte, sniff.Size)
+	for _, f := range files {
+		if f.name == "" {
+			continue // refused when storing
+		}
+		n := 0
+		src, err := f.header.Open()
+		if err == nil {
+			n, _ = io.ReadFull(src, head)
+			src.Close()
+		}
+		if v := policy.Check(f.name, f.header.Size, head[:n]); v != nil {
+			logger.Warn("Upload of %s refused by the content policy: %s", f.name, v.Reason)
+			violations = append(violations, PolicyViolation{Name: f.name, Type: v.Type, Reason: v.Reason})
+		}
+	}
+	return violations
+}
+
+// storeUpload writes one uploaded file below dir, applying the conflict
+// policy if its name is taken, unless someone without one of tokens holds a
+// lock on it. The content goes to a temporary file first so an interrupted
+// upload never leaves a truncated file behind. When uploads are scanned,
+// only content clamd passed gets that far.
+func (h *FileHandler) storeUpload(r *http.Request, root *sandbox.Root, dir string, f uploadedFile, policy string, tokens []string) UploadResult {
+	res := UploadResult{Name: f.name}
+	if f.name == "" {
+		res.Name = f.header.Filename
+		return uploadFailed(res, "Invalid file name")
+	}
+
+	target := path.Join(dir, f.name)
+	res.Path = root.Join(target)
+	// A locked file is only touched when overwriting it, a locked directory
+	// by anything stored below it
+	lock, err := lockedBy(tokens, res.Path)
+	if err != nil {
+		return uploadFailed(res, "Failed to check locks")
+	}
+	if lock != nil && (lock.Path != res.Path || policy == ConflictOverwrite) {
+		return uploadFailed(res, lockMessage(*lock))
+	}
+	if err := root.MkdirAll(path.Dir(target), sandbox.DirMode); err != nil {
+		logger.Error("Failed to create directory for %s: %v", target, err)
+		return uploadFailed(res, "Failed to create parent directory")
+	}
+
+	// Don't bother receiving a file that would be skipped anyway
+	if policy == ConflictSkip {
+		if _, err := root.Lstat(target); err == nil {
+			res.Status = UploadSkipped
+			return res
+		}
+	}
+
+	var verdict db.ScanResult
+	if h.scanner != nil {
+		var refused *scanRefusal
+		open := func() (io.ReadCloser, error) { return f.header.Open() }
+		verdict, refused = h.scanner.check(r.Context(), open, res.Path, requestOwner(r))
+		res.Scan = verdict.Status
+		if refused != nil {
+			return uploadFailed(res, refused.message)
+		}
+	}
+
+	out, err := root.CreateAtomic(target, sandbox.FileMode)
+	if err != nil {
+		logger.Error("Failed to create file %s: %v", target, err)
+		return uploadFailed(res, "Failed to create file")
+	}
+	src, err := f.header.Open()
+	if err == nil {
+		res.Bytes, err = io.Copy(out, src)
+		src.Close()
+	}
+	if err != nil {
+		out.Abort()
+		logger.Error("Failed to write file %s: %v", target, err)
+		return uploadFailed(res, "Failed to write file")
+	}
+
+	target, res.Status, err = commitUpload(root, out, target, policy)
+	if err != nil {
+		out.Abort()
+		if errors.Is(err, fs.ErrExist) {
+			return uploadFailed(res, "File already exists")
+		}
+		logger.Error("Failed to save file %s: %v", target, err)
+		return uploadFailed(res, "Failed to save file")
+	}
+	if res.Status == UploadSkipped {
+		out.Abort()
+		return res
+	}
+
+	res.Path = root.Join(target)
+	if h.scanner != nil {
+		h.scanner.record(verdict, res.Path)
+	}
+	logger.Info("File uploaded successfully: %s (%s)", res.Path, FormatFileSize(res.Bytes))
+	return res
+}
+
+// commitUpload moves a received file into place, returning the name it got
+// and its status. Names are claimed without replacing anything, so
+// concurrent uploads can't take the same one.
+func commitUpload(root *sandbox.Root, out *sandbox.AtomicFile, target, policy string) (string, string, error) {
+	err := out.CommitNew(target)
+	if !errors.Is(err, fs.ErrExist) {
+		return target, UploadCreated, err
+	}
+
+	switch policy {
+	case ConflictSkip:
+		return target, UploadSkipped, nil
+	case ConflictOverwrite:
+		if info, err := root.Lstat(target); err == nil && info.IsDir() {
+			return target, UploadFailed, fs.ErrExist
+		}
+		return target, UploadOverwritten, out.Commit()
+	case ConflictRename:
+		for n := 1; n <= maxRenames; n++ {
+			name := numberedName(target, n)
+			err := out.CommitNew(name)
+			if !errors.Is(err, fs.ErrExist) {
+				return name, UploadRenamed, err
+			}
+		}
+	}
+	return target, UploadFailed, fs.ErrExist
+}
+
+// numberedName turns "dir/name.ext" into "dir/name (n).ext"
+func numberedName(p string, n int) string {
+	dir, base := path.Split(p)
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	if stem == "" {
+		// Dotfiles like ".env" have no extension to keep
+		stem, ext = base, ""
+	}
+	return dir + stem + " (" + strconv.Itoa(n) + ")" + ext
+}
+
+func uploadFailed(res UploadResult, msg string) UploadResult {
+	res.Status = UploadFailed
+	res.Error = msg
+	return res
+}
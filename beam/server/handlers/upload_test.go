@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/contentpolicy"
+	"github.com/tachRoutine/beamdrop-go/pkg/jobs"
+	"github.com/tachRoutine/beamdrop-go/pkg/pipeline"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"github.com/tachRoutine/beamdrop-go/pkg/webhooks"
+)
+
+// postUpload posts the form fields and the files, by name, as a multipart
+// upload
+func postUpload(h *FileHandler, fields, files map[string]string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		mw.WriteField(name, value)
+	}
+	for name, content := range files {
+		fw, _ := mw.CreateFormFile("files", name)
+		fw.Write([]byte(content))
+	}
+	mw.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h.Upload(w, r)
+	return w
+}
+
+// upload posts the files, by name, as a multipart upload to the top of the
+// shared directory
+func upload(t *testing.T, h *FileHandler, files map[string]string) UploadResponse {
+	t.Helper()
+	return uploadResponse(t, postUpload(h, nil, files))
+}
+
+func uploadResponse(t *testing.T, w *httptest.ResponseRecorder) UploadResponse {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload answered %d: %s", w.Code, w.Body)
+	}
+	var resp UploadResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// acceptAll has no content policy
+var acceptAll = contentpolicy.NewSet(config.UploadPolicy{}, nil)
+
+func newUploadHandler(roots *sandbox.Roots, dropFolders string) *FileHandler {
+	return NewFileHandler(roots, dropFolders, jobs.NewManager(1), pipeline.New(nil, nil), nil, acceptAll, webhooks.NewDispatcher())
+}
+
+func TestUploadOnlyRenames(t *testing.T) {
+	fs, err := sandbox.New(t.TempDir(), sandbox.SymlinksDeny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := sandbox.Named([]*sandbox.Root{{Name: "inbox", FS: fs, UploadOnly: true}})
+	defer roots.Close()
+	if err := fs.WriteFile("report.txt", []byte("theirs"), sandbox.FileMode); err != nil {
+		t.Fatal(err)
+	}
+	h := newUploadHandler(roots, "")
+
+	// Whatever the guest asks for, the existing file stays and the new one
+	// is stored next to it
+	for _, policy := range []string{ConflictOverwrite, ConflictSkip, ConflictFail} {
+		t.Run(policy, func(t *testing.T) {
+			w := postUpload(h, map[string]string{"path": "inbox", "conflict": policy}, map[string]string{"report.txt": "mine"})
+			resp := uploadResponse(t, w)
+			if resp.Uploaded != 1 || resp.Files[0].Status != UploadRenamed {
+				t.Errorf("got %+v, want the file renamed", resp.Files)
+			}
+		})
+	}
+	if content, _ := fs.ReadFile("report.txt"); string(content) != "theirs" {
+		t.Errorf("the existing file now holds %q", content)
+	}
+}
+
+func TestDropBoxRenames(t *testing.T) {
+	roots := singleRoot(t, nil)
+	roots.SetMode(sandbox.ModeDropBox)
+	h := newUploadHandler(roots, DropPerSession)
+	session := &http.Cookie{Name: dropCookie, Value: "20260102-030405-0123abcd"}
+
+	uploadResponse(t, postUpload(h, nil, map[string]string{"notes.txt": "first"}, session))
+	resp := uploadResponse(t, postUpload(h, map[string]string{"conflict": ConflictOverwrite}, map[string]string{"notes.txt": "second"}, session))
+	if resp.Files[0].Status != UploadRenamed {
+		t.Errorf("got %+v, want the file renamed", resp.Files)
+	}
+	content, _ := roots.All()[0].ReadFile(session.Value + "/notes.txt")
+	if string(content) != "first" {
+		t.Errorf("the first upload now holds %q", content)
+	}
+}
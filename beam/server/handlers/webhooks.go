@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/webhooks"
+	"gorm.io/gorm"
+)
+
+// WebhooksHandler manages the webhooks file events are sent to. It takes
+// the admin password, as webhooks make the server call out to any URL.
+type WebhooksHandler struct {
+	hooks         *webhooks.Dispatcher
+	adminPassword string
+}
+
+func NewWebhooksHandler(hooks *webhooks.Dispatcher, adminPassword string) *WebhooksHandler {
+	return &WebhooksHandler{hooks: hooks, adminPassword: adminPassword}
+}
+
+// List returns every webhook
+func (h *WebhooksHandler) List(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.adminPassword, "webhooks") {
+		return
+	}
+	hooks, err := db.GetWebhooks()
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to list webhooks")
+		return
+	}
+	SendJSON(w, http.StatusOK, WebhooksResponse{Webhooks: hooks})
+}
+
+// Create adds a webhook, active unless asked otherwise
+func (h *WebhooksHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.adminPassword, "webhooks") {
+		return
+	}
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.URL == nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Webhook URL is required")
+		return
+	}
+	if req.Secret == nil {
+		req.Secret = new(string)
+	}
+	hook := db.Webhook{Active: true, Events: []string{}, Paths: []string{}}
+	secret, ok := applyWebhook(w, &hook, req)
+	if !ok {
+		return
+	}
+	if err := db.SaveWebhook(&hook); err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to create webhook")
+		return
+	}
+	logger.Info("Webhook created: %s", hook.URL)
+	SendJSON(w, http.StatusCreated, WebhookResponse{Message: "Webhook created", Webhook: hook, Secret: secret})
+}
+
+// Get returns a webhook
+func (h *WebhooksHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.adminPassword, "webhooks") {
+		return
+	}
+	hook, ok := pathWebhook(w, r)
+	if !ok {
+		return
+	}
+	msg := "Webhook active"
+	if !hook.Active {
+		msg = "Webhook disabled"
+	}
+	SendJSON(w, http.StatusOK, WebhookResponse{Message: msg, Webhook: hook})
+}
+
+// Update changes a webhook's URL, secret, filters or whether it's active
+func (h *WebhooksHandler) Update(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.adminPassword, "webhooks") {
+		return
+	}
+	hook, ok := pathWebhook(w, r)
+	if !ok {
+		return
+	}
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	secret, ok := applyWebhook(w, &hook, req)
+	if !ok {
+		return
+	}
+	if err := db.SaveWebhook(&hook); err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to update webhook")
+		return
+	}
+	SendJSON(w, http.StatusOK, WebhookResponse{Message: "Webhook updated", Webhook: hook, Secret: secret})
+}
+
+// Delete removes a webhook and its delivery log
+func (h *WebhooksHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.adminPassword, "webhooks") {
+		return
+	}
+	hook, ok := pathWebhook(w, r)
+	if !ok {
+		return
+	}
+	if err := db.DeleteWebhook(hook.ID); err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to delete webhook")
+		return
+	}
+	logger.Info("Webhook deleted: %s", hook.URL)
+	SendJSON(w, http.StatusOK, WebhookResponse{Message: "Webhook deleted", Webhook: hook})
+}
+
+// Deliveries returns the delivery log of a webhook, newest first,
+// optionally only the deliveries in the state query parameter
+func (h *WebhooksHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.adminPassword, "webhooks") {
+		return
+	}
+	hook, ok := pathWebhook(w, r)
+	if !ok {
+		return
+	}
+	state := r.URL.Query().Get("state")
+	states := []string{db.DeliveryPending, db.DeliveryDelivered, db.DeliveryFailed}
+	if state != "" && !slices.Contains(states, state) {
+		SendError(w, http.StatusBadRequest, CodeInvalidRequest, "state must be one of "+strings.Join(states, ", "))
+		return
+	}
+	deliveries, err := db.GetDeliveries(hook.ID, state, webhooks.KeepDeliveries)
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to get deliveries")
+		return
+	}
+	resp := WebhookDeliveriesResponse{Deliveries: make([]WebhookDelivery, 0, len(deliveries))}
+	for _, d := range deliveries {
+		resp.Deliveries = append(resp.Deliveries, WebhookDelivery{WebhookDelivery: d, Payload: json.RawMessage(d.Payload)})
+	}
+	SendJSON(w, http.StatusOK, resp)
+}
+
+// Ping queues a ping event for a webhook, to check it's set up right
+func (h *WebhooksHandler) Ping(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.adminPassword, "webhooks") {
+		return
+	}
+	hook, ok := pathWebhook(w, r)
+	if !ok {
+		return
+	}
+	d, err := h.hooks.Ping(hook)
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to queue ping")
+		return
+	}
+	SendJSON(w, http.StatusAccepted, WebhookDeliveryResponse{
+		Message:  "Ping queued",
+		Delivery: WebhookDelivery{WebhookDelivery: d, Payload: json.RawMessage(d.Payload)},
+	})
+}
+
+// pathWebhook loads the webhook named by the id path segment
+func pathWebhook(w http.ResponseWriter, r *http.Request) (db.Webhook, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 0)
+	if err != nil {
+		SendError(w, http.StatusNotFound, CodeNotFound, "Webhook not found")
+		return db.Webhook{}, false
+	}
+	hook, err := db.GetWebhook(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		SendError(w, http.StatusNotFound, CodeNotFound, "Webhook not found")
+		return hook, false
+	}
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, CodeInternal, "Failed to get webhook")
+		return hook, false
+	}
+	return hook, true
+}
+
+// applyWebhook validates the fields set in req and copies them onto hook.
+// It returns the secret if it generated one.
+func applyWebhook(w http.ResponseWriter, hook *db.Webhook, req WebhookRequest) (string, bool) {
+	if req.URL != nil {
+		u, err := url.Parse(strings.TrimSpace(*req.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Webhook URL must be an http:// or https:// URL")
+			return "", false
+		}
+		hook.URL = u.String()
+	}
+	if req.Events != nil {
+		for _, e := range *req.Events {
+			if !slices.Contains(webhooks.Events, e) {
+				SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Unknown event "+e+"; events are "+strings.Join(webhooks.Events, ", "))
+				return "", false
+			}
+		}
+		hook.Events = slices.Compact(slices.Sorted(slices.Values(*req.Events)))
+	}
+	if req.Paths != nil {
+		paths := make([]string, 0, len(*req.Paths))
+		for _, p := range *req.Paths {
+			p = strings.Trim(p, "/")
+			if !webhooks.ValidPattern(p) {
+				SendError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid path pattern "+strconv.Quote(p))
+				return "", false
+			}
+			paths = append(paths, p)
+		}
+		hook.Paths = paths
+	}
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+
+	var generated string
+	if req.Secret != nil {
+		hook.Secret = *req.Secret
+		if hook.Secret == "" {
+			generated = newToken()
+			hook.Secret = generated
+		}
+	}
+	return generated, true
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/beam/server/handlers"
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+)
+
+func (s *Server) serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.openAPI)
+}
+
+// openAPIDocument generates the OpenAPI 3 description of the route table
+func (s *Server) openAPIDocument() []byte {
+	schemas := schemaSet{defs: map[string]any{}}
+	errorSchema := schemas.of(reflect.TypeOf(handlers.ErrorResponse{}))
+
+	paths := map[string]map[string]any{}
+	for _, rt := range s.api {
+		op := map[string]any{
+			"operationId": rt.id,
+			"summary":     rt.summary,
+			"tags":        []string{rt.tag},
+		}
+		if rt.public {
+			op["security"] = []any{}
+		}
+
+		var params []any
+		for _, p := range rt.params {
+			in := "query"
+			switch {
+			case p.path:
+				in = "path"
+			case p.header:
+				in = "header"
+			}
+			params = append(params, map[string]any{
+				"name":        p.name,
+				"in":          in,
+				"description": p.description,
+				"required":    p.required,
+				"schema":      map[string]any{"type": "string"},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+
+		if rt.body != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": schemas.of(reflect.TypeOf(rt.body))},
+				},
+			}
+		} else if rt.form != nil {
+			props := map[string]any{}
+			var required []string
+			for _, f := range rt.form {
+				prop := map[string]any{"type": "string", "description": f.description}
+				if f.binary {
+					prop["format"] = "binary"
+				}
+				props[f.name] = prop
+				if f.required {
+					required = append(required, f.name)
+				}
+			}
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"multipart/form-data": map[string]any{"schema": objectSchema(props, required)},
+				},
+			}
+		}
+
+		status := rt.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]any{"description": http.StatusText(status)}
+		switch {
+		case rt.response != nil:
+			success["content"] = map[string]any{
+				"application/json": map[string]any{"schema": schemas.of(reflect.TypeOf(rt.response))},
+			}
+		case rt.raw != "":
+			success["content"] = map[string]any{
+				rt.raw: map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+			}
+		}
+		responses := map[string]any{strconv.Itoa(status): success}
+		if rt.accepted != nil {
+			responses[strconv.Itoa(http.StatusAccepted)] = map[string]any{
+				"description": http.StatusText(http.StatusAccepted),
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": schemas.of(reflect.TypeOf(rt.accepted))},
+				},
+			}
+		}
+
+		errs := rt.errors
+		if !rt.public {
+			errs = append([]int{http.StatusUnauthorized}, errs...)
+		}
+		for _, code := range errs {
+			responses[strconv.Itoa(code)] = map[string]any{
+				"description": http.StatusText(code),
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": errorSchema},
+				},
+			}
+		}
+		op["responses"] = responses
+
+		if paths[rt.path] == nil {
+			paths[rt.path] = map[string]any{}
+		}
+		paths[rt.path][strings.ToLower(rt.method)] = op
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "beamdrop API",
+			"version":     config.VERSION,
+			"description": "Errors are returned as {\"error\": message, \"code\": code}. The unversioned routes of earlier releases remain as deprecated aliases.",
+		},
+		"servers": []any{map[string]any{"url": APIPrefix}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas.defs,
+			"securitySchemes": map[string]any{
+				"password": map[string]any{"type": "apiKey", "in": "header", "name": PasswordHeader},
+				"basic":    map[string]any{"type": "http", "scheme": "basic"},
+			},
+		},
+		"security": []any{
+			map[string]any{"password": []string{}},
+			map[string]any{"basic": []string{}},
+		},
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		logger.Error("Failed to generate OpenAPI document: %v", err)
+	}
+	return data
+}
+
+// schemaSet builds JSON schemas from Go types, collecting named structs
+// under components/schemas
+type schemaSet struct {
+	defs map[string]any
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (s schemaSet) of(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.of(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]any{"type": "string", "format": "date-time"}
+		}
+		ref := map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := s.defs[t.Name()]; ok {
+			return ref
+		}
+		s.defs[t.Name()] = nil // placeholder for recursive types
+
+		props := map[string]any{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = s.of(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		s.defs[t.Name()] = objectSchema(props, required)
+		return ref
+	}
+	return map[string]any{}
+}
+
+func objectSchema(props map[string]any, required []string) map[string]any {
+	schema := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
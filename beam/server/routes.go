@@ -1,35 +1,701 @@
 package server
 
 import (
+	"net/http"
+	"strconv"
+	"strings"
+
 	"github.com/tachRoutine/beamdrop-go/beam/server/handlers"
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
 )
 
+// APIPrefix is the path every versioned API route lives under
+const APIPrefix = "/api/v1"
+
+// route describes one API endpoint. The same table registers the handlers
+// and generates the OpenAPI document.
+type route struct {
+	method  string
+	path    string // relative to APIPrefix
+	id      string // OpenAPI operationId
+	tag     string
+	summary string
+	public  bool // reachable without the password
+
+	params   []param
+	form     []param // multipart/form-data fields
+	body     any     // JSON request body, nil for none
+	response any     // JSON success response, nil for raw content
+	accepted any     // JSON response sent with 202 when the work continues as a job
+	raw      string  // content type of a non-JSON success response
+	status   int     // success status, defaults to 200
+	errors   []int
+
+	handler http.HandlerFunc
+
+	// legacy is the unversioned alias of the route, served by legacyHandler
+	// if set and by handler otherwise, and answering legacyMethod if set and
+	// method otherwise. Aliases are deprecated unless stable.
+	legacy        string
+	legacyHandler http.HandlerFunc
+	legacyMethod  string
+	stable        bool
+}
+
+// param is a query parameter, path parameter, header or form field
+type param struct {
+	name        string
+	description string
+	required    bool
+	binary      bool // file content in a multipart form
+	path        bool // a {name} segment of the route path
+	header      bool // a request header
+}
+
+func (s *Server) routes() []route {
+	fileHandler := handlers.NewFileHandler(s.roots, s.cfg.DropFolders, s.jobs, s.pipeline, s.scanner, s.policies, s.hooks)
+	fileOpsHandler := handlers.NewFileOperationsHandler(s.roots, s.jobs, s.scanner, s.policies, s.hooks)
+	jobsHandler := handlers.NewJobsHandler(s.jobs)
+	locksHandler := handlers.NewLocksHandler(s.roots, s.cfg.AdminPassword)
+	tagsHandler := handlers.NewTagsHandler(s.roots)
+	collectionsHandler := handlers.NewCollectionsHandler(s.roots)
+	commentsHandler := handlers.NewCommentsHandler(s.roots, s.cfg.AdminPassword)
+	webhooksHandler := handlers.NewWebhooksHandler(s.hooks, s.cfg.AdminPassword)
+	processingHandler := handlers.NewProcessingHandler(s.roots, s.quarantine, s.cfg.AdminPassword)
+	scanHandler := handlers.NewScanHandler(s.roots, s.scanner)
+	pathParam := param{name: "path", description: "Path relative to the shared directory"}
+	pathRequired := pathParam
+	pathRequired.required = true
+	jobID := param{name: "id", description: "Job ID", required: true, path: true}
+	lockID := param{name: "id", description: "Lock ID", required: true, path: true}
+	tagID := param{name: "id", description: "Tag ID", required: true, path: true}
+	collectionID := param{name: "id", description: "Collection ID", required: true, path: true}
+	commentID := param{name: "id", description: "Comment ID", required: true, path: true}
+	webhookID := param{name: "id", description: "Webhook ID", required: true, path: true}
+	quarantineID := param{name: "id", description: "Quarantined file ID", required: true, path: true}
+	adminPassword := param{name: handlers.AdminPasswordHeader, description: "Admin password", required: true, header: true}
+	commentToken := param{name: handlers.CommentTokenHeader, description: "Token returned when the comment was added", header: true}
+	lockToken := param{name: handlers.LockTokenHeader, description: "Tokens of the locks the client holds, to change what they lock", header: true}
+
+	return []route{
+		// Health and readiness endpoints (for deployment contexts)
+		{
+			method: "GET", path: "/health", id: "health", tag: "system", public: true,
+			summary:  "Liveness check",
+			response: handlers.HealthResponse{},
+			handler:  handlers.HealthHandler,
+			legacy:   "/health", stable: true,
+		},
+		{
+			method: "GET", path: "/ready", id: "ready", tag: "system", public: true,
+			summary:  "Readiness check of the database and every shared root",
+			response: handlers.ReadinessResponse{},
+			errors:   []int{http.StatusServiceUnavailable},
+			handler:  handlers.ReadinessHandler(s.roots),
+			legacy:   "/ready", stable: true,
+		},
+		{
+			method: "GET", path: "/openapi.json", id: "openapi", tag: "system", public: true,
+			summary: "This OpenAPI document",
+			raw:     "application/json",
+			handler: s.serveOpenAPI,
+		},
+
+		{
+			method: "GET", path: "/capabilities", id: "capabilities", tag: "system",
+			summary:  "Server mode and the operations it allows",
+			response: handlers.CapabilitiesResponse{},
+			handler:  handlers.CapabilitiesHandler(s.roots, s.cfg.DropFolders),
+		},
+
+		// Stats
+		{
+			method: "GET", path: "/stats", id: "getStats", tag: "stats",
+			summary:  "Transfer counters",
+			response: db.ServerStats{},
+			errors:   []int{http.StatusInternalServerError},
+			handler:  handlers.StatsHandler,
+			legacy:   "/stats",
+		},
+		{
+			method: "GET", path: "/ws/stats", id: "watchStats", tag: "stats",
+			summary: "WebSocket streaming ExtendedStats every minute, and every second while background jobs progress or comments change",
+			status:  http.StatusSwitchingProtocols,
+			handler: StatsSocketHandler(s.roots, s.jobs), //TODO: will come up with  better structure for the websockts
+			legacy:  "/ws/stats",
+		},
+
+		// Roots
+		{
+			method: "GET", path: "/roots", id: "listRoots", tag: "files",
+			summary:  "List the shared roots with their options and disk usage",
+			response: handlers.RootsResponse{},
+			handler:  handlers.RootsHandler(s.roots),
+		},
+
+		// File operations
+		{
+			method: "GET", path: "/files", id: "listFiles", tag: "files",
+			summary: "List a directory",
+			params: []param{
+				pathParam,
+				{name: "sort", description: "name (natural order, default), size, mtime or type"},
+				{name: "order", description: "asc (default) or desc"},
+				{name: "hidden", description: "Include dotfiles, true by default"},
+				{name: "limit", description: "Page size, at most " + strconv.Itoa(handlers.MaxListLimit) + "; all entries when 0 or unset"},
+				{name: "cursor", description: "nextCursor of the previous page"},
+			},
+			response: handlers.Listing{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  fileHandler.ListFiles,
+			legacy:   "/files", legacyHandler: fileHandler.ListOrServe,
+		},
+		{
+			method: "DELETE", path: "/files", id: "deleteFile", tag: "files",
+			summary:  "Delete a file or directory",
+			params:   []param{pathRequired, lockToken},
+			response: handlers.PathResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusLocked, http.StatusInternalServerError},
+			handler:  fileHandler.Delete,
+			legacy:   "/delete",
+		},
+		{
+			method: "GET", path: "/files/download", id: "downloadFile", tag: "files",
+			summary: "Download a file, supports Range requests",
+			params:  []param{pathRequired},
+			raw:     "application/octet-stream",
+			errors:  []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+			handler: fileHandler.Download,
+			legacy:  "/download",
+		},
+		{
+			method: "POST", path: "/files/upload", id: "uploadFile", tag: "files",
+			summary: "Upload files or a folder",
+			params:  []param{lockToken},
+			form: []param{
+				{name: "files", description: "File content, repeat for several files", binary: true},
+				{name: "file", description: "File content, same as files", binary: true},
+				{name: "path", description: "Target directory relative to the shared directory"},
+				{name: "conflict", description: "What to do when a name is taken: rename (default, stores \"name (1).ext\"), overwrite, skip or fail"},
+				{name: "relativePath", description: "Path of the n-th file below the target directory for folder uploads; a file name containing slashes works too"},
+			},
+			response: handlers.UploadResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+			handler:  fileHandler.Upload,
+			legacy:   "/upload",
+		},
+		{
+			method: "GET", path: "/files/content", id: "readFile", tag: "files",
+			summary: "Read a text file, or a range of its lines, with its encoding, line endings and revision",
+			params: []param{
+				pathRequired,
+				{name: "from", description: "First line to return, starting at 1"},
+				{name: "to", description: "Last line to return; the last line of the file when unset"},
+				{name: "If-None-Match", description: "Revision the client has, answered with 304 while it's current", header: true},
+			},
+			response: handlers.ReadResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+			handler:  fileOpsHandler.Read,
+			legacy:   "/read",
+		},
+		{
+			method: "PUT", path: "/files/content", id: "writeFile", tag: "files",
+			summary: "Create or replace a text file, keeping its encoding",
+			params: []param{
+				lockToken,
+				{name: "If-Match", description: "Revision the content was read at; the write fails with 412 and the current revision once the file changed", header: true},
+			},
+			body:     handlers.WriteRequest{},
+			response: handlers.WriteResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusPreconditionFailed, http.StatusRequestEntityTooLarge, http.StatusLocked, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity, http.StatusInternalServerError, http.StatusServiceUnavailable},
+			handler:  fileOpsHandler.Write,
+			legacy:   "/write", legacyMethod: "POST",
+		},
+		{
+			method: "POST", path: "/files/move", id: "moveFile", tag: "files",
+			summary:  "Move a file or directory, also between shared roots; runs as a job when a directory has to be copied",
+			params:   []param{lockToken},
+			body:     handlers.MoveRequest{},
+			response: handlers.TransferResponse{},
+			accepted: handlers.JobResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusLocked, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+			handler:  fileOpsHandler.Move,
+			legacy:   "/move",
+		},
+		{
+			method: "POST", path: "/files/copy", id: "copyFile", tag: "files",
+			summary:  "Copy a file, or a directory tree as a job",
+			params:   []param{lockToken},
+			body:     handlers.MoveRequest{},
+			response: handlers.TransferResponse{},
+			accepted: handlers.JobResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusLocked, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+			handler:  fileOpsHandler.Copy,
+			legacy:   "/copy",
+		},
+		{
+			method: "POST", path: "/files/rename", id: "renameFile", tag: "files",
+			summary:  "Rename a file or directory in place",
+			params:   []param{lockToken},
+			body:     handlers.RenameRequest{},
+			response: handlers.RenameResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusLocked, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+			handler:  fileOpsHandler.Rename,
+			legacy:   "/rename",
+		},
+		{
+			method: "POST", path: "/directories", id: "createDirectory", tag: "files",
+			summary:  "Create a directory including missing parents",
+			body:     handlers.MkdirRequest{},
+			response: handlers.PathResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict, http.StatusInternalServerError},
+			handler:  fileOpsHandler.Mkdir,
+			legacy:   "/mkdir",
+		},
+		{
+			method: "POST", path: "/batch", id: "batch", tag: "files",
+			summary:  "Move, copy, rename, delete, star or unstar many paths at once; more than 100 operations run as a job",
+			params:   []param{lockToken},
+			body:     handlers.BatchRequest{},
+			response: handlers.BatchResponse{},
+			accepted: handlers.JobResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusLocked, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+			handler:  fileOpsHandler.Batch,
+		},
+		{
+			method: "GET", path: "/search", id: "searchFiles", tag: "files",
+			summary: "Search files by name and tags",
+			params: []param{
+				{name: "q", description: "Case-insensitive part of the file name; required without tag"},
+				{name: "tag", description: "Only paths carrying all these tags, comma-separated or repeated"},
+				pathParam,
+			},
+			response: handlers.SearchResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusInternalServerError},
+			handler:  fileOpsHandler.Search,
+			legacy:   "/search",
+		},
+
+		// Background jobs
+		{
+			method: "GET", path: "/jobs", id: "listJobs", tag: "jobs",
+			summary:  "List background jobs, newest first",
+			response: handlers.JobsResponse{},
+			errors:   []int{http.StatusInternalServerError},
+			handler:  jobsHandler.List,
+		},
+		{
+			method: "GET", path: "/jobs/{id}", id: "getJob", tag: "jobs",
+			summary:  "State and progress of a job",
+			params:   []param{jobID},
+			response: handlers.JobResponse{},
+			errors:   []int{http.StatusNotFound, http.StatusInternalServerError},
+			handler:  jobsHandler.Get,
+		},
+		{
+			method: "DELETE", path: "/jobs/{id}", id: "cancelJob", tag: "jobs",
+			summary:  "Cancel a job; what it already did stays",
+			params:   []param{jobID},
+			response: handlers.JobResponse{},
+			errors:   []int{http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+			handler:  jobsHandler.Cancel,
+		},
+
+		// Locks
+		{
+			method: "GET", path: "/locks", id: "listLocks", tag: "locks",
+			summary:  "List the locks in force, those overlapping path if given",
+			params:   []param{pathParam},
+			response: handlers.LocksResponse{},
+			errors:   []int{http.StatusForbidden, http.StatusInternalServerError},
+			handler:  locksHandler.List,
+		},
+		{
+			method: "POST", path: "/locks", id: "lock", tag: "locks",
+			summary:  "Lock a file or directory against changes by others; the response holds the lock's token",
+			params:   []param{lockToken},
+			body:     handlers.LockRequest{},
+			response: handlers.LockResponse{},
+			status:   http.StatusCreated,
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusLocked, http.StatusInternalServerError},
+			handler:  locksHandler.Lock,
+		},
+		{
+			method: "POST", path: "/locks/{id}/renew", id: "renewLock", tag: "locks",
+			summary:  "Extend a lock the client holds",
+			params:   []param{lockID, lockToken},
+			body:     handlers.RenewLockRequest{},
+			response: handlers.LockResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  locksHandler.Renew,
+		},
+		{
+			method: "DELETE", path: "/locks/{id}", id: "unlock", tag: "locks",
+			summary: "Release a lock the client holds, or break any lock with the admin password",
+			params: []param{
+				lockID, lockToken,
+				{name: handlers.AdminPasswordHeader, description: "Admin password, to break a lock held by someone else", header: true},
+			},
+			response: handlers.LockResponse{},
+			errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  locksHandler.Unlock,
+		},
+
+		// Tags
+		{
+			method: "GET", path: "/tags", id: "listTags", tag: "tags",
+			summary:  "List tags with how many paths carry each",
+			response: handlers.TagsResponse{},
+			errors:   []int{http.StatusInternalServerError},
+			handler:  tagsHandler.List,
+		},
+		{
+			method: "POST", path: "/tags", id: "createTag", tag: "tags",
+			summary:  "Create a tag",
+			body:     handlers.TagRequest{},
+			response: handlers.TagResponse{},
+			status:   http.StatusCreated,
+			errors:   []int{http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError},
+			handler:  tagsHandler.Create,
+		},
+		{
+			method: "PATCH", path: "/tags/{id}", id: "updateTag", tag: "tags",
+			summary:  "Rename a tag or change its color or description",
+			params:   []param{tagID},
+			body:     handlers.TagRequest{},
+			response: handlers.TagResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+			handler:  tagsHandler.Update,
+		},
+		{
+			method: "DELETE", path: "/tags/{id}", id: "deleteTag", tag: "tags",
+			summary:  "Delete a tag, removing it from every path",
+			params:   []param{tagID},
+			response: handlers.TagResponse{},
+			errors:   []int{http.StatusNotFound, http.StatusInternalServerError},
+			handler:  tagsHandler.Delete,
+		},
+		{
+			method: "POST", path: "/tags/assign", id: "assignTags", tag: "tags",
+			summary:  "Add and remove tags on many files and directories at once",
+			body:     handlers.TagAssignRequest{},
+			response: handlers.TagAssignResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  tagsHandler.Assign,
+		},
+
+		// Collections
+		{
+			method: "GET", path: "/collections", id: "listCollections", tag: "collections",
+			summary:  "List collections with how many paths each holds",
+			response: handlers.CollectionsResponse{},
+			errors:   []int{http.StatusInternalServerError},
+			handler:  collectionsHandler.List,
+		},
+		{
+			method: "POST", path: "/collections", id: "createCollection", tag: "collections",
+			summary:  "Create an empty collection",
+			body:     handlers.CollectionRequest{},
+			response: handlers.CollectionResponse{},
+			status:   http.StatusCreated,
+			errors:   []int{http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError},
+			handler:  collectionsHandler.Create,
+		},
+		{
+			method: "GET", path: "/collections/{id}", id: "getCollection", tag: "collections",
+			summary:  "List the entries of a collection and the paths in it that no longer exist",
+			params:   []param{collectionID},
+			response: handlers.CollectionContentResponse{},
+			errors:   []int{http.StatusNotFound, http.StatusInternalServerError},
+			handler:  collectionsHandler.Get,
+		},
+		{
+			method: "PATCH", path: "/collections/{id}", id: "updateCollection", tag: "collections",
+			summary:  "Rename a collection or change its description",
+			params:   []param{collectionID},
+			body:     handlers.CollectionRequest{},
+			response: handlers.CollectionResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+			handler:  collectionsHandler.Update,
+		},
+		{
+			method: "DELETE", path: "/collections/{id}", id: "deleteCollection", tag: "collections",
+			summary:  "Delete a collection; the files it holds stay",
+			params:   []param{collectionID},
+			response: handlers.CollectionResponse{},
+			errors:   []int{http.StatusNotFound, http.StatusInternalServerError},
+			handler:  collectionsHandler.Delete,
+		},
+		{
+			method: "POST", path: "/collections/{id}/items", id: "updateCollectionItems", tag: "collections",
+			summary:  "Add paths to a collection and remove them from it",
+			params:   []param{collectionID},
+			body:     handlers.CollectionItemsRequest{},
+			response: handlers.CollectionItemsResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  collectionsHandler.Items,
+		},
+
+		// Comments
+		{
+			method: "GET", path: "/comments", id: "listComments", tag: "comments",
+			summary:  "Comment threads on a file or directory, oldest first",
+			params:   []param{pathRequired},
+			response: handlers.CommentsResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusInternalServerError},
+			handler:  commentsHandler.List,
+		},
+		{
+			method: "POST", path: "/comments", id: "addComment", tag: "comments",
+			summary:  "Comment on a file or directory, or reply to a comment; the response holds the comment's token",
+			body:     handlers.CommentRequest{},
+			response: handlers.CommentResponse{},
+			status:   http.StatusCreated,
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  commentsHandler.Create,
+		},
+		{
+			method: "PATCH", path: "/comments/{id}", id: "editComment", tag: "comments",
+			summary:  "Edit a comment the client wrote",
+			params:   []param{commentID, commentToken},
+			body:     handlers.CommentRequest{},
+			response: handlers.CommentResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  commentsHandler.Update,
+		},
+		{
+			method: "DELETE", path: "/comments/{id}", id: "deleteComment", tag: "comments",
+			summary: "Delete a comment the client wrote, or any comment with the admin password",
+			params: []param{
+				commentID, commentToken,
+				{name: handlers.AdminPasswordHeader, description: "Admin password, to delete anyone's comment", header: true},
+			},
+			response: handlers.CommentResponse{},
+			errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  commentsHandler.Delete,
+		},
+
+		// Processing
+		{
+			method: "GET", path: "/files/processing", id: "getProcessingResults", tag: "processing",
+			summary:  "Results of the processors that last ran on a file",
+			params:   []param{pathRequired},
+			response: handlers.ProcessingResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  processingHandler.Results,
+		},
+		{
+			method: "GET", path: "/files/thumbnail", id: "getThumbnail", tag: "processing",
+			summary: "Thumbnail a processor made of an image",
+			params:  []param{pathRequired},
+			raw:     "image/jpeg",
+			errors:  []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler: processingHandler.Thumbnail,
+		},
+		{
+			method: "GET", path: "/files/scan", id: "getScanStatus", tag: "processing",
+			summary:  "Antivirus verdict on a file from when it was uploaded",
+			params:   []param{pathRequired},
+			response: handlers.ScanResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  scanHandler.Status,
+		},
+		{
+			method: "GET", path: "/quarantine", id: "listQuarantined", tag: "processing",
+			summary:  "Infected uploads and files a processor failed on, newest first",
+			params:   []param{adminPassword},
+			response: handlers.QuarantineResponse{},
+			errors:   []int{http.StatusForbidden, http.StatusInternalServerError},
+			handler:  processingHandler.Quarantined,
+		},
+		{
+			method: "DELETE", path: "/quarantine/{id}", id: "deleteQuarantined", tag: "processing",
+			summary:  "Delete a quarantined file for good; its record goes too",
+			params:   []param{quarantineID, adminPassword},
+			response: handlers.QuarantinedFileResponse{},
+			errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  processingHandler.DeleteQuarantined,
+		},
+
+		// Webhooks
+		{
+			method: "GET", path: "/webhooks", id: "listWebhooks", tag: "webhooks",
+			summary:  "Webhooks file events are sent to",
+			params:   []param{adminPassword},
+			response: handlers.WebhooksResponse{},
+			errors:   []int{http.StatusForbidden, http.StatusInternalServerError},
+			handler:  webhooksHandler.List,
+		},
+		{
+			method: "POST", path: "/webhooks", id: "createWebhook", tag: "webhooks",
+			summary:  "Subscribe a URL to file events; the response holds the secret if the server generated it",
+			params:   []param{adminPassword},
+			body:     handlers.WebhookRequest{},
+			response: handlers.WebhookResponse{},
+			status:   http.StatusCreated,
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusInternalServerError},
+			handler:  webhooksHandler.Create,
+		},
+		{
+			method: "GET", path: "/webhooks/{id}", id: "getWebhook", tag: "webhooks",
+			summary:  "A webhook",
+			params:   []param{webhookID, adminPassword},
+			response: handlers.WebhookResponse{},
+			errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  webhooksHandler.Get,
+		},
+		{
+			method: "PATCH", path: "/webhooks/{id}", id: "updateWebhook", tag: "webhooks",
+			summary:  "Change a webhook's URL, secret or filters, or disable it",
+			params:   []param{webhookID, adminPassword},
+			body:     handlers.WebhookRequest{},
+			response: handlers.WebhookResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  webhooksHandler.Update,
+		},
+		{
+			method: "DELETE", path: "/webhooks/{id}", id: "deleteWebhook", tag: "webhooks",
+			summary:  "Delete a webhook and its delivery log",
+			params:   []param{webhookID, adminPassword},
+			response: handlers.WebhookResponse{},
+			errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  webhooksHandler.Delete,
+		},
+		{
+			method: "GET", path: "/webhooks/{id}/deliveries", id: "listWebhookDeliveries", tag: "webhooks",
+			summary: "Delivery log of a webhook, newest first",
+			params: []param{
+				webhookID, adminPassword,
+				{name: "state", description: "Only deliveries that are pending, delivered or failed"},
+			},
+			response: handlers.WebhookDeliveriesResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  webhooksHandler.Deliveries,
+		},
+		{
+			method: "POST", path: "/webhooks/{id}/ping", id: "pingWebhook", tag: "webhooks",
+			summary:  "Send a ping event to a webhook",
+			params:   []param{webhookID, adminPassword},
+			response: handlers.WebhookDeliveryResponse{},
+			status:   http.StatusAccepted,
+			errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  webhooksHandler.Ping,
+		},
+
+		// Metadata
+		{
+			method: "POST", path: "/metadata/reconcile", id: "reconcileMetadata", tag: "metadata",
+			summary:  "Match stars, tags and other metadata against the files, following files moved outside beamdrop and removing it for files that are gone",
+			response: handlers.JobResponse{},
+			status:   http.StatusAccepted,
+			errors:   []int{http.StatusInternalServerError},
+			handler:  fileOpsHandler.Reconcile,
+		},
+
+		// Stars
+		{
+			method: "GET", path: "/stars", id: "listStarred", tag: "stars",
+			summary:  "List starred files",
+			response: handlers.StarredResponse{},
+			errors:   []int{http.StatusInternalServerError},
+			handler:  fileOpsHandler.Starred,
+			legacy:   "/starred",
+		},
+		{
+			method: "POST", path: "/stars", id: "toggleStar", tag: "stars",
+			summary:  "Star a file, or unstar it if it's already starred",
+			body:     handlers.StarRequest{},
+			response: handlers.StarResponse{},
+			errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			handler:  fileOpsHandler.Star,
+			legacy:   "/star", legacyHandler: fileOpsHandler.LegacyStar,
+		},
+	}
+}
+
 func (s *Server) setupRoutes() {
-	// Health and readiness endpoints (for deployment contexts)
-	s.mux.HandleFunc("/health", handlers.HealthHandler)
-	s.mux.HandleFunc("/ready", handlers.ReadinessHandler(s.sharedDir))
+	s.api = s.routes()
+	s.public = make(map[string]bool)
+	for _, rt := range s.api {
+		s.mux.HandleFunc(rt.method+" "+APIPrefix+rt.path, rt.handler)
+		if rt.public {
+			s.public[APIPrefix+rt.path] = true
+		}
+
+		if rt.legacy != "" {
+			method, h := rt.method, rt.handler
+			if rt.legacyMethod != "" {
+				method = rt.legacyMethod
+			}
+			if rt.legacyHandler != nil {
+				h = rt.legacyHandler
+			}
+			h = allowMethod(method, h)
+			if !rt.stable {
+				h = deprecated(APIPrefix+rt.path, h)
+			}
+			s.mux.HandleFunc(rt.legacy, h)
+			if rt.public {
+				s.public[rt.legacy] = true
+			}
+		}
+	}
+	s.openAPI = s.openAPIDocument()
+	s.mux.HandleFunc(APIPrefix+"/", s.apiNotFound)
 
 	// Static files
 	s.mux.HandleFunc("/", handlers.StaticHandler)
+}
+
+// apiNotFound answers API requests no route matched, telling a wrong method
+// apart from an unknown path
+func (s *Server) apiNotFound(w http.ResponseWriter, r *http.Request) {
+	var allowed []string
+	for _, rt := range s.api {
+		if matchPath(APIPrefix+rt.path, r.URL.Path) {
+			allowed = append(allowed, rt.method)
+		}
+	}
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		handlers.SendError(w, http.StatusMethodNotAllowed, handlers.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	handlers.SendError(w, http.StatusNotFound, handlers.CodeNotFound, "Unknown API endpoint")
+}
+
+// matchPath reports whether a request path fits a route path, where a
+// {name} segment matches any one segment
+func matchPath(pattern, p string) bool {
+	want, got := strings.Split(pattern, "/"), strings.Split(p, "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i, seg := range want {
+		if seg != got[i] && !(strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") && got[i] != "") {
+			return false
+		}
+	}
+	return true
+}
+
+// allowMethod rejects requests to a legacy route made with another method
+func allowMethod(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method && !(method == "GET" && r.Method == "HEAD") {
+			w.Header().Set("Allow", method)
+			handlers.SendError(w, http.StatusMethodNotAllowed, handlers.CodeMethodNotAllowed, "Method not allowed")
+			return
+		}
+		next(w, r)
+	}
+}
 
-	// Stats
-	s.mux.HandleFunc("/stats", handlers.StatsHandler)
-	s.mux.HandleFunc("/ws/stats", StatsSocketHandler(s.sharedDir)) //TODO: will come up with  better structure for the websockts
-
-	// File handlers
-	fileHandler := handlers.NewFileHandler(s.sharedDir)
-	fileOpsHandler := handlers.NewFileOperationsHandler(s.sharedDir)
-
-	// File operations
-	s.mux.HandleFunc("/files", fileHandler.ListFiles)
-	s.mux.HandleFunc("/download", fileHandler.Download)
-	s.mux.HandleFunc("/upload", fileHandler.Upload)
-	s.mux.HandleFunc("/move", fileOpsHandler.Move)
-	s.mux.HandleFunc("/copy", fileOpsHandler.Copy)
-	s.mux.HandleFunc("/mkdir", fileOpsHandler.Mkdir)
-	s.mux.HandleFunc("/rename", fileOpsHandler.Rename)
-	s.mux.HandleFunc("/write", fileOpsHandler.Write)
-	s.mux.HandleFunc("/search", fileOpsHandler.Search)
-	s.mux.HandleFunc("/star", fileOpsHandler.Star)
-	s.mux.HandleFunc("/starred", fileOpsHandler.Starred)
+// deprecated marks responses of a legacy route and points at its successor
+func deprecated(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		next(w, r)
+	}
 }
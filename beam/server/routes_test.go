@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+)
+
+// TestMain gives the tests a database of their own in a temporary data
+// directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "beamdrop-server-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	config.SetDataDir(dir)
+	logger.SetOutput(io.Discard)
+	if err := db.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	db.AutoMigrate()
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newServer serves a temporary directory holding the files, by name
+func newServer(t *testing.T, files map[string]string) *Server {
+	t.Helper()
+	cfg := config.Default()
+	cfg.SharedDir = t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(cfg.SharedDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.roots.Close() })
+	return s
+}
+
+// baselineRoutes are the routes, and their methods, of the API before it
+// was versioned
+var baselineRoutes = map[string]string{
+	"/health":   "GET",
+	"/ready":    "GET",
+	"/stats":    "GET",
+	"/ws/stats": "GET",
+	"/files":    "GET",
+	"/download": "GET",
+	"/upload":   "POST",
+	"/move":     "POST",
+	"/copy":     "POST",
+	"/mkdir":    "POST",
+	"/rename":   "POST",
+	"/write":    "POST",
+	"/search":   "GET",
+	"/star":     "POST",
+	"/starred":  "GET",
+}
+
+func TestLegacyMethods(t *testing.T) {
+	s := newServer(t, nil)
+	aliases := make(map[string]route)
+	for _, rt := range s.api {
+		if rt.legacy != "" {
+			aliases[rt.legacy] = rt
+		}
+	}
+
+	for p, method := range baselineRoutes {
+		_, ok := aliases[p]
+		if !ok {
+			t.Errorf("%s is gone", p)
+			continue
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, p, strings.NewReader("{}")))
+		if w.Code == http.StatusMethodNotAllowed {
+			t.Errorf("%s %s answered 405", method, p)
+		}
+	}
+
+	// Aliases added since answer the method of their route
+	for p, rt := range aliases {
+		if _, ok := baselineRoutes[p]; ok {
+			continue
+		}
+		if rt.stable {
+			t.Errorf("%s never existed unversioned, yet is marked stable", p)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(rt.method, p, strings.NewReader("{}")))
+		if w.Code == http.StatusMethodNotAllowed {
+			t.Errorf("%s %s answered 405", rt.method, p)
+		}
+	}
+}
+
+func TestLegacyStar(t *testing.T) {
+	s := newServer(t, map[string]string{"star-legacy.txt": "a", "star-v1.txt": "b"})
+	star := func(p, file string) map[string]any {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("POST", p, strings.NewReader(`{"filePath":"`+file+`"}`)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST %s answered %d: %s", p, w.Code, w.Body)
+		}
+		var resp map[string]any
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if got := star("/star", "star-legacy.txt")["starred"]; got != "true" {
+		t.Errorf("/star sent starred %#v, want \"true\"", got)
+	}
+	if got := star("/star", "star-legacy.txt")["starred"]; got != "false" {
+		t.Errorf("/star sent starred %#v, want \"false\"", got)
+	}
+	if got := star(APIPrefix+"/stars", "star-v1.txt")["starred"]; got != true {
+		t.Errorf("%s/stars sent starred %#v, want true", APIPrefix, got)
+	}
+}
@@ -1,57 +1,226 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
+	"path/filepath"
+	"time"
 
+	"github.com/tachRoutine/beamdrop-go/beam/server/handlers"
 	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/clamd"
+	"github.com/tachRoutine/beamdrop-go/pkg/contentpolicy"
 	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/discovery"
+	"github.com/tachRoutine/beamdrop-go/pkg/jobs"
 	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/pipeline"
 	"github.com/tachRoutine/beamdrop-go/pkg/qr"
+	"github.com/tachRoutine/beamdrop-go/pkg/quarantine"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"github.com/tachRoutine/beamdrop-go/pkg/webhooks"
 )
 
 type Server struct {
 	sharedDir string
-	flags     config.Flags
+	cfg       config.Config
 	mux       *http.ServeMux
+	roots     *sandbox.Roots
+	jobs      *jobs.Manager
+	hooks     *webhooks.Dispatcher
+	// pipeline runs on uploaded files, moving failed ones into quarantine
+	pipeline   *pipeline.Pipeline
+	quarantine *quarantine.Store
+	scanner    *handlers.Scanner // nil unless clamd is configured
+	policies   *contentpolicy.Set
+
+	api     []route
+	public  map[string]bool // paths reachable without the password
+	openAPI []byte
 }
 
-func New(sharedDir string, flags config.Flags) *Server {
+func New(cfg config.Config) (*Server, error) {
+	policy, err := sandbox.ParseSymlinkPolicy(cfg.Symlinks)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := sandbox.ParseMode(cfg.Mode)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := openRoots(cfg, policy)
+	if err != nil {
+		return nil, err
+	}
+	roots.SetMode(mode)
+	q, err := quarantine.Open(filepath.Join(config.ConfigDir, "quarantine"))
+	if err != nil {
+		roots.Close()
+		return nil, fmt.Errorf("failed to open quarantine: %w", err)
+	}
+	var av *clamd.Client
+	if cfg.Antivirus.Clamd != "" {
+		if av, err = clamd.New(cfg.Antivirus.Clamd, cfg.Antivirus.Timeout); err != nil {
+			roots.Close()
+			return nil, err
+		}
+	}
+
 	s := &Server{
-		sharedDir: sharedDir,
-		flags:     flags,
-		mux:       http.NewServeMux(),
+		sharedDir:  cfg.SharedDir,
+		cfg:        cfg,
+		mux:        http.NewServeMux(),
+		roots:      roots,
+		jobs:       jobs.NewManager(cfg.JobWorkers),
+		hooks:      webhooks.NewDispatcher(),
+		pipeline:   pipeline.New(cfg.Processors, q),
+		quarantine: q,
+		scanner:    handlers.NewScanner(av, q, cfg.Antivirus.OnError),
+		policies:   contentpolicy.NewSet(cfg.UploadPolicy, cfg.Roots),
 	}
+	handlers.RegisterJobs(s.jobs, s.roots, s.pipeline, s.policies, s.hooks)
 	s.setupRoutes()
-	return s
+	return s, nil
+}
+
+// openRoots opens the configured named roots, or the shared directory when
+// there are none
+func openRoots(cfg config.Config, policy sandbox.SymlinkPolicy) (*sandbox.Roots, error) {
+	if len(cfg.Roots) == 0 {
+		fs, err := sandbox.New(cfg.SharedDir, policy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open shared directory: %w", err)
+		}
+		return sandbox.Single(fs), nil
+	}
+
+	var roots []*sandbox.Root
+	for _, rc := range cfg.Roots {
+		fs, err := sandbox.New(rc.Path, policy)
+		if err != nil {
+			sandbox.Named(roots).Close()
+			return nil, fmt.Errorf("failed to open root %s: %w", rc.Name, err)
+		}
+		roots = append(roots, &sandbox.Root{
+			Name:       rc.Name,
+			FS:         fs,
+			ReadOnly:   rc.ReadOnly,
+			UploadOnly: rc.UploadOnly,
+			Hidden:     rc.Hidden,
+		})
+	}
+	return sandbox.Named(roots), nil
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// TODO: Will add other common middleware here
 	db.IncrementRequests()
+	if !s.requireAuth(w, r) {
+		return
+	}
 	s.mux.ServeHTTP(w, r)
 }
 
 func (s *Server) Start() error {
+	if err := db.Init(); err != nil {
+		return err
+	}
 	db.AutoMigrate()
+	if err := s.jobs.Start(); err != nil {
+		return fmt.Errorf("failed to start background jobs: %w", err)
+	}
+	s.hooks.Start()
+	if s.scanner != nil {
+		go s.checkScanner()
+	}
 
-	if s.flags.Password != "" {
+	if s.cfg.Password != "" {
 		logger.Info("Password is enabled")
 	}
 
+	// Runs in the background so a large tree doesn't delay startup
+	go s.sweepTemp(time.Now())
+	go s.reconcileMetadata()
+
 	port := s.getPort()
 	ip := GetLocalIP()
 	url := fmt.Sprintf("http://%s:%d", ip, port)
 
-	if !s.flags.NoQR {
+	if !s.cfg.NoQR {
 		qr.ShowQrCode(url)
 	}
 
-	logger.Info("Server started at %s sharing directory: %s", url, s.sharedDir)
+	if !s.cfg.NoDiscovery {
+		stop, err := discovery.Advertise(discovery.Info{
+			Name:    s.cfg.Name,
+			Version: config.VERSION,
+			Port:    port,
+			IPs:     localIPs(ip),
+			Auth:    s.cfg.Password != "",
+		})
+		if err != nil {
+			logger.Warn("LAN discovery disabled: %v", err)
+		} else {
+			defer stop()
+		}
+	}
+
+	if s.roots.Virtual() {
+		for _, root := range s.roots.All() {
+			logger.Info("Sharing %s as %s", root.Dir(), root.Name)
+		}
+		logger.Info("Server started at %s", url)
+	} else {
+		logger.Info("Server started at %s sharing directory: %s", url, s.sharedDir)
+	}
+	logger.Info("Symbolic link policy: %s", s.roots.All()[0].Policy())
+	if mode := s.roots.Mode(); mode != sandbox.ModeNormal {
+		logger.Info("Server mode: %s", mode)
+	}
 	return http.ListenAndServe(fmt.Sprintf(":%d", port), s)
 }
 
+// reconcileMetadata keeps the metadata of files in step with changes made
+// outside beamdrop, now and then every handlers.ReconcileInterval
+func (s *Server) reconcileMetadata() {
+	for {
+		report, err := handlers.ReconcileMetadata(context.Background(), s.roots, nil)
+		if err != nil {
+			logger.Warn("Failed to reconcile metadata: %v", err)
+		} else if len(report.Moved)+len(report.Removed) > 0 {
+			logger.Info("Reconciled metadata: %d moved, %d removed", len(report.Moved), len(report.Removed))
+		}
+		time.Sleep(handlers.ReconcileInterval)
+	}
+}
+
+// checkScanner warns early when clamd doesn't answer, rather than with the
+// first upload
+func (s *Server) checkScanner() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.scanner.Ping(ctx); err != nil {
+		logger.Warn("Virus scanner %s doesn't answer: %v", s.scanner, err)
+		return
+	}
+	logger.Info("Scanning uploads with clamd at %s", s.scanner)
+}
+
+// sweepTemp removes the temporary files of writes interrupted by a crash
+func (s *Server) sweepTemp(started time.Time) {
+	for _, root := range s.roots.All() {
+		n, err := root.SweepTemp(started)
+		if err != nil {
+			logger.Warn("Failed to sweep temporary files in %s: %v", root.Dir(), err)
+		}
+		if n > 0 {
+			logger.Info("Removed %d unfinished upload(s) from %s", n, root.Dir())
+		}
+	}
+}
+
 func (s *Server) getPort() int {
 	// Find an available port from the default ports list
 	port, err := config.FindAvailablePort()
@@ -60,12 +229,12 @@ func (s *Server) getPort() int {
 	}
 
 	// If its greater than zero then the flag was passed in the cli args
-	if s.flags.Port > 0 {
-		if !config.IsPortAvailable(s.flags.Port) {
-			logger.Error("Port %d is not available, falling back to port %d ", s.flags.Port, port)
+	if s.cfg.Port > 0 {
+		if !config.IsPortAvailable(s.cfg.Port) {
+			logger.Error("Port %d is not available, falling back to port %d ", s.cfg.Port, port)
 			return port
 		}
-		return s.flags.Port
+		return s.cfg.Port
 	}
 	return port
 }
@@ -92,3 +261,12 @@ func GetLocalIP() string {
 	logger.Info("This might be due to no active network connection.")
 	return "localhost"
 }
+
+// localIPs returns the address to advertise, or nil to let the mDNS
+// responder work it out when only localhost is known
+func localIPs(ip string) []net.IP {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		return []net.IP{parsed}
+	}
+	return nil
+}
@@ -5,8 +5,11 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/tachRoutine/beamdrop-go/beam/server/handlers"
 	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/jobs"
 	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
 	"github.com/tachRoutine/beamdrop-go/pkg/system"
 )
 
@@ -23,17 +26,27 @@ type ExtendedStats struct {
 	Uploads   int                `json:"uploads"`
 	StartTime time.Time          `json:"startTime"`
 	System    system.SystemStats `json:"system"`
+	// Roots holds the disk usage of each visible named root
+	Roots map[string]system.DiskStats `json:"roots,omitempty"`
+	// Jobs are the queued and running background jobs
+	Jobs []jobs.Job `json:"jobs"`
+	// Comments are the comment events since the last update
+	Comments []handlers.CommentEvent `json:"comments,omitempty"`
 }
 
+// jobUpdateInterval limits how often job progress is pushed
+const jobUpdateInterval = time.Second
+
 // StatsSocketHandler handles WebSocket connections for real-time stats updates
-// It fetches fresh stats from the database and system on each interval and sends them to the client
-func StatsSocketHandler(sharedDir string) http.HandlerFunc {
+// It fetches fresh stats from the database and system on each interval and sends them to the client,
+// and sooner while background jobs make progress
+func StatsSocketHandler(roots *sandbox.Roots, jm *jobs.Manager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		handleStatsSocket(w, r, sharedDir)
+		handleStatsSocket(w, r, roots, jm)
 	}
 }
 
-func handleStatsSocket(w http.ResponseWriter, r *http.Request, sharedDir string) {
+func handleStatsSocket(w http.ResponseWriter, r *http.Request, roots *sandbox.Roots, jm *jobs.Manager) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		logger.Error("Failed to upgrade to WebSocket: %v", err)
@@ -57,14 +70,22 @@ func handleStatsSocket(w http.ResponseWriter, r *http.Request, sharedDir string)
 		if err != nil {
 			return ExtendedStats{}, err
 		}
-		sysStats := system.GetSystemStats(sharedDir)
-		return ExtendedStats{
+		sysStats := system.GetSystemStats(roots.All()[0].Dir())
+		stats := ExtendedStats{
 			Downloads: dbStats.Downloads,
 			Requests:  dbStats.Requests,
 			Uploads:   dbStats.Uploads,
 			StartTime: dbStats.StartTime,
 			System:    sysStats,
-		}, nil
+			Jobs:      jm.Active(),
+		}
+		if roots.Virtual() {
+			stats.Roots = make(map[string]system.DiskStats)
+			for _, root := range roots.Visible() {
+				stats.Roots[root.Name] = system.GetDiskStats(root.Dir())
+			}
+		}
+		return stats, nil
 	}
 
 	// Sending initial stats immediately
@@ -87,6 +108,18 @@ func handleStatsSocket(w http.ResponseWriter, r *http.Request, sharedDir string)
 	pingTicker := time.NewTicker(30 * time.Second)
 	defer pingTicker.Stop()
 
+	// Job changes are collected and pushed once per jobUpdateInterval
+	jobChanges, unsubscribe := jm.Subscribe()
+	defer unsubscribe()
+	jobTicker := time.NewTicker(jobUpdateInterval)
+	defer jobTicker.Stop()
+	jobsChanged := false
+
+	// So are comment events on paths the client can read
+	commentEvents, unsubscribeComments := handlers.SubscribeComments()
+	defer unsubscribeComments()
+	var comments []handlers.CommentEvent
+
 	// Channel to handle connection close
 	done := make(chan struct{})
 
@@ -117,6 +150,30 @@ func handleStatsSocket(w http.ResponseWriter, r *http.Request, sharedDir string)
 				return
 			}
 
+		case <-jobChanges:
+			jobsChanged = true
+
+		case ev := <-commentEvents:
+			if _, _, err := roots.Locate(ev.Comment.Path, sandbox.Read); err == nil {
+				comments = append(comments, ev)
+			}
+
+		case <-jobTicker.C:
+			if !jobsChanged && len(comments) == 0 {
+				continue
+			}
+			jobsChanged = false
+			stats, err := getExtendedStats()
+			if err != nil {
+				logger.Error("Failed to retrieve stats: %v", err)
+				continue
+			}
+			stats.Comments, comments = comments, nil
+			if err := conn.WriteJSON(stats); err != nil {
+				logger.Debug("WebSocket connection closed during job update: %v", err)
+				return
+			}
+
 		case <-ticker.C:
 			// Fetch fresh stats from database and system on each interval
 			stats, err := getExtendedStats()
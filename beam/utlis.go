@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
 )
 
 func GetLocalIP() string {
@@ -86,23 +87,10 @@ func FormatModTime(modTime string) string {
 	return t.Format("2006-01-02 15:04:05")
 }
 
-// ResolvePath returns the absolute safe path inside sharedDir
+// ResolvePath returns the absolute safe path inside sharedDir, following
+// only symbolic links that stay inside it
 func ResolvePath(sharedDir, raw string) (string, error) {
-	clean := filepath.Clean(raw)
-	target := filepath.Join(sharedDir, clean)
-
-	absShared, err := filepath.Abs(sharedDir)
-	if err != nil {
-		return "", err
-	}
-	absTarget, err := filepath.Abs(target)
-	if err != nil {
-		return "", err
-	}
-	if !strings.HasPrefix(absTarget, absShared) {
-		return "", fmt.Errorf("invalid path")
-	}
-	return absTarget, nil
+	return sandbox.Resolve(sharedDir, raw)
 }
 
 func IsDir(path string) bool {
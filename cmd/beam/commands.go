@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/tachRoutine/beamdrop-go/beam/server/handlers"
+	"github.com/tachRoutine/beamdrop-go/pkg/client"
+	"github.com/tachRoutine/beamdrop-go/pkg/styles"
+)
+
+// command is a beam subcommand
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "serve [options]", "Start the beamdrop server (default)", runServe},
+		{"config", "config print [options]", "Show the effective configuration", runConfig},
+		{"send", "send [options] <path>", "Beam one file or folder and exit after download", runSend},
+		{"receive", "receive [options] [dir]", "Collect files from another device and exit", runReceive},
+		{"discover", "discover [options]", "List beamdrop servers on the local network", runDiscover},
+		{"ls", "ls [options] [path]", "List a remote directory", runLs},
+		{"stat", "stat [options] <path>", "Show details about a remote file", runStat},
+		{"get", "get [options] <remote> [local]", "Download a file or, with -r, a directory", runGet},
+		{"put", "put [options] <local> [remote-dir]", "Upload a file or, with -r, a directory", runPut},
+		{"mv", "mv [options] <source> <target>", "Move a remote file or directory", runMv},
+		{"cp", "cp [options] <source> <target>", "Copy a remote file or directory", runCp},
+		{"mkdir", "mkdir [options] <path>", "Create a remote directory", runMkdir},
+		{"search", "search [options] <query>", "Search remote files by name", runSearch},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// usageError is returned when a command is called with the wrong arguments
+type usageError struct {
+	usage string
+}
+
+func (e usageError) Error() string {
+	return "usage: beam " + e.usage
+}
+
+// parseArgs parses flags that may appear before or after positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func printFiles(files []client.File) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, f := range files {
+		name, kind := f.Name, "file"
+		if f.IsDir {
+			name, kind = styles.DebugStyle.Sprint(f.Name+"/"), "dir"
+		}
+		size := f.Size
+		if f.IsDir {
+			size = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", kind, size, f.ModTime, name)
+	}
+	tw.Flush()
+}
+
+func runLs(args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	cf := registerClientFlags(fs)
+	sortBy := fs.String("sort", "name", "Sort by name, size, mtime or type")
+	desc := fs.Bool("desc", false, "Reverse the sort order")
+	noHidden := fs.Bool("no-hidden", false, "Leave out dotfiles")
+	pos := parseArgs(fs, args)
+	if len(pos) > 1 {
+		return usageError{"ls [options] [path]"}
+	}
+
+	dir := ""
+	if len(pos) == 1 {
+		dir = cleanRemote(pos[0])
+	}
+	c, err := cf.remote()
+	if err != nil {
+		return err
+	}
+	files := []client.File{}
+	opts := &client.ListOptions{Sort: *sortBy, Desc: *desc, HideHidden: *noHidden, Limit: 1000}
+	for {
+		page, err := c.ListPage(context.Background(), dir, opts)
+		if err != nil {
+			return err
+		}
+		files = append(files, page.Entries...)
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	if *cf.json {
+		return printJSON(files)
+	}
+	printFiles(files)
+	return nil
+}
+
+func runStat(args []string) error {
+	fs := flag.NewFlagSet("stat", flag.ExitOnError)
+	cf := registerClientFlags(fs)
+	pos := parseArgs(fs, args)
+	if len(pos) != 1 {
+		return usageError{"stat [options] <path>"}
+	}
+
+	c, err := cf.remote()
+	if err != nil {
+		return err
+	}
+	f, err := c.Stat(context.Background(), pos[0])
+	if err != nil {
+		return err
+	}
+	if *cf.json {
+		return printJSON(f)
+	}
+	kind := "file"
+	if f.IsDir {
+		kind = "directory"
+	}
+	fmt.Printf("Path:     %s\nType:     %s\nSize:     %s\nModified: %s\nStarred:  %t\n",
+		f.Path, kind, f.Size, f.ModTime, f.IsStarred)
+	return nil
+}
+
+// transfer describes one file moved by get or put, used for --json output
+type transfer struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Bytes  int64  `json:"bytes"`
+}
+
+func runGet(args []string) error {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	cf := registerClientFlags(fs)
+	recursive := fs.Bool("r", false, "Download directories recursively")
+	resume := fs.Bool("c", false, "Continue partially downloaded files")
+	pos := parseArgs(fs, args)
+	if len(pos) < 1 || len(pos) > 2 {
+		return usageError{"get [options] <remote> [local]"}
+	}
+
+	c, err := cf.remote()
+	if err != nil {
+		return err
+	}
+	src := cleanRemote(pos[0])
+	info, err := c.Stat(context.Background(), src)
+	if err != nil {
+		return err
+	}
+
+	_, name := splitRemote(src)
+	dst := name
+	if len(pos) == 2 {
+		dst = pos[1]
+		if st, err := os.Stat(dst); err == nil && st.IsDir() {
+			dst = filepath.Join(dst, name)
+		}
+	}
+
+	var done []transfer
+	if info.IsDir {
+		if !*recursive {
+			return fmt.Errorf("%s is a directory, use -r to download it", src)
+		}
+		done, err = getDir(c, src, dst, *resume, !*cf.json)
+	} else {
+		var t transfer
+		t, err = getFile(c, src, dst, *resume, !*cf.json)
+		done = append(done, t)
+	}
+	if err != nil {
+		return err
+	}
+	if *cf.json {
+		return printJSON(done)
+	}
+	return nil
+}
+
+func getDir(c *client.Client, src, dst string, resume, showProgress bool) ([]transfer, error) {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return nil, err
+	}
+	files, err := c.List(context.Background(), src)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []transfer
+	for _, f := range files {
+		remotePath := joinRemote(src, f.Name)
+		localPath := filepath.Join(dst, f.Name)
+		if f.IsDir {
+			sub, err := getDir(c, remotePath, localPath, resume, showProgress)
+			done = append(done, sub...)
+			if err != nil {
+				return done, err
+			}
+			continue
+		}
+		t, err := getFile(c, remotePath, localPath, resume, showProgress)
+		if err != nil {
+			return done, err
+		}
+		done = append(done, t)
+	}
+	return done, nil
+}
+
+func getFile(c *client.Client, src, dst string, resume, showProgress bool) (transfer, error) {
+	var bar *styles.Progress
+	var progress client.ProgressFunc
+	if showProgress {
+		progress = func(done, total int64) {
+			if bar == nil {
+				bar = styles.NewProgress(src, total)
+			}
+			bar.Set(done)
+		}
+	}
+	n, err := c.DownloadFile(context.Background(), src, dst, resume, progress)
+	if bar != nil {
+		bar.Done()
+	}
+	if err != nil {
+		return transfer{}, fmt.Errorf("download %s: %w", src, err)
+	}
+	return transfer{Source: src, Target: dst, Bytes: n}, nil
+}
+
+func runPut(args []string) error {
+	fs := flag.NewFlagSet("put", flag.ExitOnError)
+	cf := registerClientFlags(fs)
+	recursive := fs.Bool("r", false, "Upload directories recursively")
+	conflict := fs.String("conflict", "overwrite", "When a remote name is taken: overwrite, rename, skip or fail")
+	pos := parseArgs(fs, args)
+	if len(pos) < 1 || len(pos) > 2 {
+		return usageError{"put [options] <local> [remote-dir]"}
+	}
+
+	c, err := cf.remote()
+	if err != nil {
+		return err
+	}
+	src := pos[0]
+	dstDir := ""
+	if len(pos) == 2 {
+		dstDir = cleanRemote(pos[1])
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	var done []transfer
+	if info.IsDir() {
+		if !*recursive {
+			return fmt.Errorf("%s is a directory, use -r to upload it", src)
+		}
+		done, err = putDir(c, src, dstDir, putOptions{progress: !*cf.json, conflict: *conflict})
+	} else {
+		var t transfer
+		t, err = putFile(c, src, dstDir, putOptions{progress: !*cf.json, conflict: *conflict})
+		done = append(done, t)
+	}
+	if err != nil {
+		return err
+	}
+	if *cf.json {
+		return printJSON(done)
+	}
+	return nil
+}
+
+// putOptions are the settings shared by every file of a put
+type putOptions struct {
+	progress bool
+	conflict string
+}
+
+func putDir(c *client.Client, src, dstDir string, opts putOptions) ([]transfer, error) {
+	base := joinRemote(dstDir, filepath.Base(filepath.Clean(src)))
+	var done []transfer
+
+	err := filepath.WalkDir(src, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		remotePath := base
+		if rel != "." {
+			remotePath = joinRemote(base, filepath.ToSlash(rel))
+		}
+
+		if d.IsDir() {
+			return mkdirIfMissing(c, remotePath)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		parent, _ := splitRemote(remotePath)
+		t, err := putFile(c, p, parent, opts)
+		if err != nil {
+			return err
+		}
+		done = append(done, t)
+		return nil
+	})
+	return done, err
+}
+
+func putFile(c *client.Client, src, dstDir string, opts putOptions) (transfer, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return transfer{}, err
+	}
+
+	var bar *styles.Progress
+	upload := &client.UploadOptions{Conflict: opts.conflict}
+	if opts.progress {
+		bar = styles.NewProgress(src, info.Size())
+		upload.Progress = func(done, _ int64) { bar.Set(done) }
+	}
+	res, err := c.UploadFile(context.Background(), src, dstDir, upload)
+	if bar != nil {
+		bar.Done()
+	}
+	if err != nil {
+		return transfer{}, fmt.Errorf("upload %s: %w", src, err)
+	}
+
+	t := transfer{Source: src, Target: joinRemote(dstDir, filepath.Base(src)), Bytes: info.Size()}
+	if len(res.Files) == 1 {
+		if res.Files[0].Path != "" {
+			t.Target = res.Files[0].Path
+		}
+		if res.Files[0].Status == client.UploadSkipped {
+			t.Bytes = 0
+		}
+	}
+	return t, nil
+}
+
+func runMv(args []string) error {
+	return runTwoPathOp("mv", args, (*client.Client).Move, "Moved")
+}
+
+func runCp(args []string) error {
+	return runTwoPathOp("cp", args, (*client.Client).Copy, "Copied")
+}
+
+func runTwoPathOp(name string, args []string, op func(*client.Client, context.Context, string, string, *client.TransferOptions) error, verb string) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	cf := registerClientFlags(fs)
+	policy := fs.String("policy", "merge", "When the target exists: merge, overwrite or skip")
+	pos := parseArgs(fs, args)
+	if len(pos) != 2 {
+		return usageError{name + " [options] <source> <target>"}
+	}
+
+	from, to := cleanRemote(pos[0]), cleanRemote(pos[1])
+	c, err := cf.remote()
+	if err != nil {
+		return err
+	}
+	opts := &client.TransferOptions{Policy: *policy}
+	shown := false
+	if !*cf.json {
+		// Directory trees run as a job on the server; show how far it got
+		opts.Progress = func(job client.Job) {
+			p := job.Progress
+			fmt.Fprintf(os.Stderr, "\r%s: %d/%d files, %s", job.Kind, p.Files, p.TotalFiles, handlers.FormatFileSize(p.Bytes))
+			shown = true
+		}
+	}
+	err = op(c, context.Background(), from, to, opts)
+	if shown {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return err
+	}
+	if *cf.json {
+		return printJSON(map[string]string{"from": from, "to": to})
+	}
+	styles.InfoStyle.Printf("%s %s -> %s\n", verb, from, to)
+	return nil
+}
+
+func runMkdir(args []string) error {
+	fs := flag.NewFlagSet("mkdir", flag.ExitOnError)
+	cf := registerClientFlags(fs)
+	pos := parseArgs(fs, args)
+	if len(pos) != 1 {
+		return usageError{"mkdir [options] <path>"}
+	}
+
+	dir := cleanRemote(pos[0])
+	c, err := cf.remote()
+	if err != nil {
+		return err
+	}
+	if err := mkdirIfMissing(c, dir); err != nil {
+		return err
+	}
+	if *cf.json {
+		return printJSON(map[string]string{"path": dir})
+	}
+	styles.InfoStyle.Printf("Created %s\n", dir)
+	return nil
+}
+
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	cf := registerClientFlags(fs)
+	dir := fs.String("path", "", "Remote directory to search in")
+	pos := parseArgs(fs, args)
+	if len(pos) != 1 {
+		return usageError{"search [options] <query>"}
+	}
+
+	c, err := cf.remote()
+	if err != nil {
+		return err
+	}
+	found, err := c.Search(context.Background(), pos[0], cleanRemote(*dir))
+	if err != nil {
+		return err
+	}
+	results := found.Results
+	if *cf.json {
+		if results == nil {
+			results = []client.File{}
+		}
+		return printJSON(results)
+	}
+	for _, f := range results {
+		if f.IsDir {
+			fmt.Println(styles.DebugStyle.Sprint(f.Path + "/"))
+		} else {
+			fmt.Println(f.Path)
+		}
+	}
+	return nil
+}
+
+// mkdirIfMissing creates a remote directory, treating an existing one as success
+func mkdirIfMissing(c *client.Client, dir string) error {
+	err := c.Mkdir(context.Background(), dir)
+	if errors.Is(err, client.ErrConflict) {
+		return nil
+	}
+	return err
+}
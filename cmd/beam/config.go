@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/styles"
+)
+
+// configFlags are the flags shared by every command that needs the
+// effective configuration
+type configFlags struct {
+	fs *flag.FlagSet
+
+	configPath *string
+	dataDir    *string
+	sharedDir  *string
+	port       *int
+	password   *string
+	adminPass  *string
+	noQR       *bool
+	logLevel   *string
+	name       *string
+	noDiscover *bool
+	symlinks   *string
+	mode       *string
+	dropFolder *string
+	jobWorkers *int
+	clamd      *string
+	roots      []config.Root
+
+	// path is the config file that was consulted by load
+	path string
+}
+
+func registerConfigFlags(fs *flag.FlagSet) *configFlags {
+	f := &configFlags{
+		fs:         fs,
+		configPath: fs.String("config", "", "Path to the config file (default <data-dir>/config.yaml)"),
+		dataDir:    fs.String("data-dir", "", "Directory holding the config file and database (default ~/.beamdrop)"),
+		sharedDir:  fs.String("dir", ".", "Directory to share files from"),
+		// NOTE:Here i default it to 0 so when it zero we know that the flag wasnt passed
+		// Since the flag is a non-boolean value
+		port:       fs.Int("port", 0, "Set the port that beamdrop will run on"),
+		password:   fs.String("p", "", "Password authentication"),
+		adminPass:  fs.String("admin-password", "", "Password for breaking locks, deleting comments, managing webhooks and the quarantine"),
+		noQR:       fs.Bool("no-qr", false, "Disable QR code generation"),
+		logLevel:   fs.String("log-level", "info", "Log level (debug, info, warn, error)"),
+		name:       fs.String("name", "", "Instance name advertised on the local network (default \"beamdrop on <host>\")"),
+		noDiscover: fs.Bool("no-discovery", false, "Don't advertise the server via mDNS"),
+		symlinks:   fs.String("symlinks", "within-root", "Symbolic link policy (deny, within-root, allow-all)"),
+		mode:       fs.String("mode", "normal", "Server mode (normal, read-only, drop-box)"),
+		dropFolder: fs.String("drop-folders", "timestamp", "Group drop-box uploads per request (timestamp) or per session"),
+		jobWorkers: fs.Int("job-workers", 2, "How many background jobs run at once"),
+		clamd:      fs.String("clamd", "", "Scan uploads with the clamd at host:port or unix:/path/to/socket"),
+	}
+	fs.Func("root", "Share a named directory as name=path[:ro|:upload-only|:hidden] (repeatable)", func(spec string) error {
+		r, err := config.ParseRoot(spec)
+		f.roots = append(f.roots, r)
+		return err
+	})
+	return f
+}
+
+func (f *configFlags) isSet(name string) bool {
+	set := false
+	f.fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// load resolves the effective configuration. Precedence from lowest to
+// highest is: defaults, config file, BEAMDROP_* environment, flags.
+func (f *configFlags) load() (config.Config, error) {
+	// The data directory decides where the default config file lives, so it
+	// has to be known before the file is read
+	dataDir := config.ConfigDir
+	if v := os.Getenv(config.EnvPrefix + "DATA_DIR"); v != "" {
+		dataDir = v
+	}
+	if f.isSet("data-dir") {
+		dataDir = *f.dataDir
+	}
+	config.SetDataDir(dataDir)
+
+	path, required := config.ConfigPath, false
+	if v := os.Getenv(config.EnvPrefix + "CONFIG"); v != "" {
+		path, required = v, true
+	}
+	if f.isSet("config") {
+		path, required = *f.configPath, true
+	}
+	f.path = path
+
+	cfg, err := config.Load(path, required)
+	if err != nil {
+		return cfg, err
+	}
+
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "data-dir":
+			cfg.DataDir = *f.dataDir
+		case "dir":
+			cfg.SharedDir = *f.sharedDir
+		case "port":
+			cfg.Port = *f.port
+		case "p":
+			cfg.Password = *f.password
+		case "admin-password":
+			cfg.AdminPassword = *f.adminPass
+		case "no-qr":
+			cfg.NoQR = *f.noQR
+		case "log-level":
+			cfg.LogLevel = *f.logLevel
+		case "name":
+			cfg.Name = *f.name
+		case "no-discovery":
+			cfg.NoDiscovery = *f.noDiscover
+		case "symlinks":
+			cfg.Symlinks = *f.symlinks
+		case "mode":
+			cfg.Mode = *f.mode
+		case "drop-folders":
+			cfg.DropFolders = *f.dropFolder
+		case "job-workers":
+			cfg.JobWorkers = *f.jobWorkers
+		case "clamd":
+			cfg.Antivirus.Clamd = *f.clamd
+		case "root":
+			cfg.Roots = f.roots
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	config.SetDataDir(cfg.DataDir)
+	level, _ := logger.ParseLevel(cfg.LogLevel)
+	logger.SetLevel(level)
+	return cfg, nil
+}
+
+// runConfig implements `beam config <subcommand>`
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return usageError{"config print [options]"}
+	}
+
+	fs := flag.NewFlagSet("config print", flag.ExitOnError)
+	flags := registerConfigFlags(fs)
+	fs.Parse(args[1:])
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+
+	out, err := cfg.Redacted().YAML()
+	if err != nil {
+		return fmt.Errorf("failed to render config: %w", err)
+	}
+
+	source := flags.path
+	if _, err := os.Stat(source); err != nil {
+		source += " (not found, using defaults)"
+	}
+	styles.TitleStyle.Println("Effective configuration")
+	fmt.Printf("# config file: %s\n# database: %s\n%s", source, config.DBPath, out)
+	return nil
+}
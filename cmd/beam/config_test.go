@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+)
+
+// loadArgs resolves the configuration for the command line args with a clean
+// environment apart from env, and restores the data directory afterwards
+func loadArgs(t *testing.T, env map[string]string, args ...string) (config.Config, error) {
+	t.Helper()
+	dir := config.ConfigDir
+	t.Cleanup(func() { config.SetDataDir(dir) })
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, config.EnvPrefix) {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+	for name, value := range env {
+		t.Setenv(config.EnvPrefix+name, value)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := registerConfigFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return flags.load()
+}
+
+// dataDir makes a data directory holding a config file with the content
+func dataDir(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, config.ConfigFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	shared := t.TempDir()
+	dir := dataDir(t, "dir: "+shared+"\nport: 8080\nname: from-file\nlogLevel: warn\njobWorkers: 4\n")
+
+	cfg, err := loadArgs(t, map[string]string{"DATA_DIR": dir, "NAME": "from-env", "LOG_LEVEL": "error", "JOB_WORKERS": "3"},
+		"-log-level", "debug", "-job-workers", "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flags win over everything, the environment over the file, the file
+	// over the defaults
+	if cfg.LogLevel != "debug" || cfg.JobWorkers != 5 {
+		t.Errorf("flags lost: logLevel %q, jobWorkers %d", cfg.LogLevel, cfg.JobWorkers)
+	}
+	if cfg.Name != "from-env" {
+		t.Errorf("the environment lost to the file: name %q", cfg.Name)
+	}
+	if cfg.Port != 8080 {
+		t.Errorf("the file lost to the defaults: port %d", cfg.Port)
+	}
+	// Flag defaults don't count as set
+	if cfg.SharedDir != shared {
+		t.Errorf("dir is %q, want %q from the file", cfg.SharedDir, shared)
+	}
+	if cfg.Symlinks != config.Default().Symlinks {
+		t.Errorf("symlinks is %q, want the default", cfg.Symlinks)
+	}
+}
+
+func TestConfigDataDir(t *testing.T) {
+	fromEnv := dataDir(t, "port: 1111\n")
+	fromFlag := dataDir(t, "port: 2222\n")
+
+	// The data directory decides which config file is read, and where the
+	// database goes
+	cfg, err := loadArgs(t, map[string]string{"DATA_DIR": fromEnv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 1111 || cfg.DataDir != fromEnv || config.DBPath != filepath.Join(fromEnv, config.DBName) {
+		t.Errorf("BEAMDROP_DATA_DIR: port %d, data dir %s, database %s", cfg.Port, cfg.DataDir, config.DBPath)
+	}
+
+	cfg, err = loadArgs(t, map[string]string{"DATA_DIR": fromEnv}, "-data-dir", fromFlag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 2222 || cfg.DataDir != fromFlag || config.ConfigPath != filepath.Join(fromFlag, config.ConfigFileName) {
+		t.Errorf("-data-dir: port %d, data dir %s, config %s", cfg.Port, cfg.DataDir, config.ConfigPath)
+	}
+
+	// A dataDir in the file moves the database, unless -data-dir is given
+	elsewhere := t.TempDir()
+	moving := filepath.Join(dataDir(t, "dataDir: "+elsewhere+"\n"), config.ConfigFileName)
+	cfg, err = loadArgs(t, map[string]string{"CONFIG": moving})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DataDir != elsewhere || config.DBPath != filepath.Join(elsewhere, config.DBName) {
+		t.Errorf("dataDir in the file: data dir %s, database %s", cfg.DataDir, config.DBPath)
+	}
+	if cfg, err = loadArgs(t, map[string]string{"CONFIG": moving}, "-data-dir", fromFlag); err != nil || cfg.DataDir != fromFlag {
+		t.Errorf("-data-dir and dataDir in the file: data dir %s, %v", cfg.DataDir, err)
+	}
+
+	// An explicit config file must exist, the default one needn't
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	if _, err := loadArgs(t, nil, "-data-dir", t.TempDir()); err != nil {
+		t.Errorf("without a config file: %v", err)
+	}
+	if _, err := loadArgs(t, nil, "-data-dir", t.TempDir(), "-config", missing); err == nil {
+		t.Error("a missing -config file was accepted")
+	}
+	if _, err := loadArgs(t, map[string]string{"CONFIG": missing}, "-data-dir", t.TempDir()); err == nil {
+		t.Error("a missing BEAMDROP_CONFIG file was accepted")
+	}
+}
+
+func TestConfigInvalid(t *testing.T) {
+	dir := dataDir(t, "logLevel: loud\n")
+	_, err := loadArgs(t, map[string]string{"MODE": "sideways"}, "-data-dir", dir, "-port", "70000")
+	if err == nil {
+		t.Fatal("an invalid configuration was accepted")
+	}
+	for _, want := range []string{"invalid configuration", "port:", "logLevel:", "mode:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %s", err, want)
+		}
+	}
+
+	// Flags are checked the same way, and can fix what the file got wrong
+	if _, err := loadArgs(t, nil, "-data-dir", dir, "-log-level", "info"); err != nil {
+		t.Errorf("a flag overriding an invalid file value: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/discovery"
+	"github.com/tachRoutine/beamdrop-go/pkg/styles"
+)
+
+func runDiscover(args []string) error {
+	fs := flag.NewFlagSet("discover", flag.ExitOnError)
+	timeout := fs.Duration("timeout", discovery.DefaultTimeout, "How long to listen for servers")
+	jsonOut := fs.Bool("json", false, "Print machine-readable JSON output")
+	if pos := parseArgs(fs, args); len(pos) > 0 {
+		return usageError{"discover [options]"}
+	}
+
+	instances, err := discovery.Browse(context.Background(), *timeout)
+	if err != nil {
+		return err
+	}
+	if *jsonOut {
+		if instances == nil {
+			instances = []discovery.Instance{}
+		}
+		return printJSON(instances)
+	}
+	if len(instances) == 0 {
+		styles.WarningStyle.Println("No beamdrop servers found on the local network")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tURL\tVERSION\tAUTH\tTLS")
+	for _, inst := range instances {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", inst.Name, inst.URL(), inst.Version, yesNo(inst.Auth), yesNo(inst.TLS))
+	}
+	tw.Flush()
+	return nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -1,25 +1,104 @@
 package main
 
-import "github.com/tachRoutine/beamdrop-go/pkg/logger"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+)
 
 func Help() string {
+	var cmds strings.Builder
+	for _, c := range commands {
+		fmt.Fprintf(&cmds, "  %-36s %s\n", c.usage, c.summary)
+	}
+
 	return `beamdrop - A simple file sharing tool
 
 NOTE: YOU NEED TO BE IN THE SAME NETWORK AS THE RECEIVER
 
 Usage:
-  beam [options]
+  beam [serve] [options]
+  beam <command> [options] [arguments]
 
-Options:
+Commands:
+` + cmds.String() + `
+Server options:
   -dir string
 		Directory to share files from (default ".")
+  -port int
+		Port to run on (default: first free port from the default list)
+  -p string
+		Password authentication
+  -admin-password string
+		Password for breaking locks, deleting comments, managing webhooks and the quarantine
+  -config string
+		Path to the config file (default <data-dir>/config.yaml)
+  -data-dir string
+		Directory holding the config file and database (default ~/.beamdrop)
+  -log-level string
+		Log level: debug, info, warn or error (default "info")
+  -name string
+		Instance name advertised on the local network (default "beamdrop on <host>")
+  --no-discovery
+		Don't advertise the server as a _beamdrop._tcp mDNS service
+  -root name=path[:ro|:upload-only|:hidden]
+		Share a directory under a name instead of -dir; repeat for more.
+		ro refuses changes, upload-only accepts uploads but hides the
+		content, hidden leaves the root out of the top-level listing
+  -mode string
+		normal, read-only (nothing can be changed) or drop-box (uploads
+		only, nothing can be listed or downloaded) (default "normal")
+  -drop-folders string
+		Put drop-box uploads in a new folder per request (timestamp) or
+		one folder per browser session (session) (default "timestamp")
+  -symlinks string
+		Symbolic links to follow: deny, within-root or allow-all
+		(default "within-root")
+  -job-workers int
+		How many background jobs, such as directory copies, run at once
+		(default 2)
+  -clamd string
+		Scan uploads for viruses with the clamd at host:port or
+		unix:/path/to/socket before storing them
   -h, --help
   -v, --v 
   		version
   --no-qr 
-  		Disable QR code generation`
+  		Disable QR code generation
+
+Client options (ls, stat, get, put, mv, cp, mkdir, search):
+  -server string
+		URL of the beamdrop server, or its advertised name to look it up
+		on the local network (env BEAMDROP_SERVER, default http://localhost:7777)
+  -p string
+		Server password (env BEAMDROP_PASSWORD)
+  -json
+		Print machine-readable JSON output
+  -r
+		Recursive transfer (get and put only)
+  -conflict string
+		put only: overwrite (default), rename, skip or fail when the
+		remote name is taken
+  -policy string
+		mv and cp only: merge (default), overwrite or skip when the
+		target exists
+
+Configuration:
+  Settings are read from the config file, then BEAMDROP_* environment
+  variables, then flags; later sources win. Supported variables:
+  BEAMDROP_CONFIG, BEAMDROP_DATA_DIR, BEAMDROP_DIR, BEAMDROP_PORT,
+  BEAMDROP_PASSWORD, BEAMDROP_ADMIN_PASSWORD, BEAMDROP_NO_QR, BEAMDROP_LOG_LEVEL, BEAMDROP_NAME,
+  BEAMDROP_NO_DISCOVERY, BEAMDROP_SYMLINKS, BEAMDROP_ROOTS (comma-separated),
+  BEAMDROP_MODE, BEAMDROP_DROP_FOLDERS, BEAMDROP_JOB_WORKERS
+
+  Example config.yaml:
+    dir: /srv/share
+    port: 8080
+    noQR: true
+    logLevel: debug`
 }
 
 func PrintHelp() {
-	logger.Info(Help())
+	logger.Info("%s", Help())
 }
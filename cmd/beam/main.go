@@ -1,58 +1,43 @@
 package main
 
 import (
-	"flag"
+	"errors"
+	"os"
+	"strings"
 
-	"github.com/tachRoutine/beamdrop-go/beam/server"
-	"github.com/tachRoutine/beamdrop-go/config"
 	"github.com/tachRoutine/beamdrop-go/pkg/logger"
 	"github.com/tachRoutine/beamdrop-go/pkg/styles"
 )
 
 func main() {
-	sharedDir := flag.String("dir", ".", "Directory to share files from")
-	noQR := flag.Bool("no-qr", false, "Disable QR code generation")
-	help := flag.Bool("h", false, "Show help message")
-	password := flag.String("p", "", "Password authentication")
-	versionFlag := flag.Bool("v", false, "Show version information")
+	args := os.Args[1:]
 
-	// NOTE:Here i default it to 0 so when it zero we know that the flag wasnt passed
-	// Since the flag is a non-boolean value
-	port := flag.Int("port", 0, "Set the port that beamdrop will run on")
-	if *versionFlag {
-		styles.InfoStyle.Println("Beamdrop Version:", config.VERSION)
-		return
-	}
-	flag.Parse()
-
-	flags := config.Flags{
-		SharedDir: *sharedDir,
-		NoQR:      *noQR,
-		Help:      *help,
-		Password:  *password,
-		Port:      *port,
+	// Without a subcommand beam behaves like it always did and starts the server
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	if flag.NArg() > 0 {
-		logger.Debug("Extra arguments provided, showing help")
+	if name == "help" {
 		PrintHelp()
 		return
 	}
-	if *sharedDir == "" {
-		logger.Error("Shared directory is required")
-		return
-	}
-	if *help {
-		// logger.Debug("Help flag provided, showing help")
+
+	cmd, ok := findCommand(name)
+	if !ok {
+		logger.Debug("Unknown command %q, showing help", name)
+		styles.ErrorStyle.Fprintf(os.Stderr, "Unknown command: %s\n\n", name)
 		PrintHelp()
-		return
+		os.Exit(2)
 	}
 
-	logger.Info("Starting beamdrop application")
-	logger.Info("Starting server with shared directory: %s", *sharedDir)
-
-	srv := server.New(*sharedDir, flags)
-	if err := srv.Start(); err != nil {
-		logger.Fatal("Server error: %v", err)
+	if err := cmd.run(args); err != nil {
+		var ue usageError
+		if errors.As(err, &ue) {
+			styles.ErrorStyle.Fprintln(os.Stderr, ue.Error())
+			os.Exit(2)
+		}
+		styles.ErrorStyle.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/beam/oneshot"
+	"github.com/tachRoutine/beamdrop-go/beam/server/handlers"
+	"github.com/tachRoutine/beamdrop-go/pkg/clamd"
+	"github.com/tachRoutine/beamdrop-go/pkg/styles"
+)
+
+func runReceive(args []string) error {
+	fs := flag.NewFlagSet("receive", flag.ExitOnError)
+	port := fs.Int("port", 0, "Port to serve on (default: first free port from the default list)")
+	pin := fs.String("pin", "", "Require this PIN before uploading")
+	uploads := fs.Int("n", 1, "Exit after this many received files (0 for unlimited)")
+	maxSize := fs.Int64("max-size", 0, "Maximum size of one upload in MB (0 for unlimited)")
+	timeout := fs.Duration("timeout", 30*time.Minute, "Exit after this long even if nothing was received (0 to disable)")
+	noQR := fs.Bool("no-qr", false, "Disable QR code generation")
+	jsonOut := fs.Bool("json", false, "Print the list of received files as JSON")
+	clamdAddr := fs.String("clamd", "", "Scan uploads with the clamd at host:port or unix:/path/to/socket, refusing infected ones")
+	pos := parseArgs(fs, args)
+	if len(pos) > 1 {
+		return usageError{"receive [options] [dir]"}
+	}
+
+	dir := "."
+	if len(pos) == 1 {
+		dir = pos[0]
+	}
+
+	var av *clamd.Client
+	if *clamdAddr != "" {
+		var err error
+		if av, err = clamd.New(*clamdAddr, 0); err != nil {
+			return err
+		}
+	}
+
+	receipt, err := oneshot.Receive(oneshot.ReceiveOptions{
+		Dir:        dir,
+		Port:       *port,
+		PIN:        *pin,
+		MaxUploads: *uploads,
+		MaxBytes:   *maxSize * 1024 * 1024,
+		Timeout:    *timeout,
+		NoQR:       *noQR,
+		Clamd:      av,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *jsonOut {
+		return printJSON(receipt)
+	}
+
+	fmt.Println()
+	styles.TitleStyle.Println("Received")
+	fmt.Printf("Into: %s\nEnded: %s\n", receipt.Dir, receipt.Ended)
+	if len(receipt.Files) == 0 {
+		styles.WarningStyle.Println("No files received")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tFROM\tSIZE\tFILE")
+	for _, f := range receipt.Files {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.ReceivedAt.Format("15:04:05"), f.RemoteAddr,
+			handlers.FormatFileSize(f.Bytes), f.Name)
+	}
+	tw.Flush()
+	return nil
+}
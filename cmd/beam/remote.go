@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/client"
+	"github.com/tachRoutine/beamdrop-go/pkg/discovery"
+)
+
+// clientFlags are the flags shared by every command talking to a running server
+type clientFlags struct {
+	server   *string
+	password *string
+	json     *bool
+}
+
+func registerClientFlags(fs *flag.FlagSet) *clientFlags {
+	server := os.Getenv(config.EnvPrefix + "SERVER")
+	if server == "" {
+		server = fmt.Sprintf("http://localhost:%d", config.PORT)
+	}
+	return &clientFlags{
+		server:   fs.String("server", server, "URL or advertised name of the beamdrop server (env BEAMDROP_SERVER)"),
+		password: fs.String("p", os.Getenv(config.EnvPrefix+"PASSWORD"), "Server password (env BEAMDROP_PASSWORD)"),
+		json:     fs.Bool("json", false, "Print machine-readable JSON output"),
+	}
+}
+
+// remote returns a client for the configured server. A server given
+// without a scheme is looked up by name on the local network.
+func (f *clientFlags) remote() (*client.Client, error) {
+	base := *f.server
+	if !strings.Contains(base, "://") {
+		inst, err := discovery.Lookup(context.Background(), base, discovery.DefaultTimeout)
+		if err != nil {
+			return nil, err
+		}
+		base = inst.URL()
+	}
+	return client.New(base,
+		client.WithPassword(*f.password),
+		client.WithUserAgent("beam/"+config.VERSION))
+}
+
+// cleanRemote normalizes a remote path to the "a/b/c" form the API expects
+func cleanRemote(p string) string {
+	return client.CleanPath(p)
+}
+
+func splitRemote(p string) (dir, name string) {
+	i := strings.LastIndex(p, "/")
+	if i < 0 {
+		return "", p
+	}
+	return p[:i], p[i+1:]
+}
+
+func joinRemote(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+	return dir + "/" + name
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/beam/oneshot"
+	"github.com/tachRoutine/beamdrop-go/beam/server/handlers"
+	"github.com/tachRoutine/beamdrop-go/pkg/styles"
+)
+
+func runSend(args []string) error {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	port := fs.Int("port", 0, "Port to serve on (default: first free port from the default list)")
+	pin := fs.String("pin", "", "Require this PIN before downloading")
+	downloads := fs.Int("n", 1, "Exit after this many completed downloads (0 for unlimited)")
+	timeout := fs.Duration("timeout", 30*time.Minute, "Exit after this long even if nobody downloaded (0 to disable)")
+	noQR := fs.Bool("no-qr", false, "Disable QR code generation")
+	jsonOut := fs.Bool("json", false, "Print the receipt as JSON")
+	pos := parseArgs(fs, args)
+	if len(pos) != 1 {
+		return usageError{"send [options] <path>"}
+	}
+
+	receipt, err := oneshot.Send(oneshot.SendOptions{
+		Path:         pos[0],
+		Port:         *port,
+		PIN:          *pin,
+		MaxDownloads: *downloads,
+		Timeout:      *timeout,
+		NoQR:         *noQR,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *jsonOut {
+		return printJSON(receipt)
+	}
+	printReceipt(receipt)
+	if receipt.Reason != nil && receipt.Completed() == 0 {
+		return fmt.Errorf("nothing was downloaded: %w", receipt.Reason)
+	}
+	return nil
+}
+
+func printReceipt(r oneshot.SendReceipt) {
+	fmt.Println()
+	styles.TitleStyle.Println("Receipt")
+	fmt.Printf("Item: %s\n", r.Item)
+	fmt.Printf("Ended: %s\n", r.Ended)
+	if len(r.Downloads) == 0 {
+		styles.WarningStyle.Println("No downloads")
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tFROM\tBYTES\tSTATUS\tCLIENT")
+	for _, d := range r.Downloads {
+		status := styles.InfoStyle.Sprint("complete")
+		if !d.Completed {
+			status = styles.ErrorStyle.Sprint("interrupted")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", d.StartedAt.Format("15:04:05"), d.RemoteAddr,
+			handlers.FormatFileSize(d.Bytes), status, d.UserAgent)
+	}
+	tw.Flush()
+}
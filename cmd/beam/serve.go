@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/tachRoutine/beamdrop-go/beam/server"
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/styles"
+)
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags := registerConfigFlags(fs)
+	help := fs.Bool("h", false, "Show help message")
+	versionFlag := fs.Bool("v", false, "Show version information")
+	fs.Parse(args)
+
+	if *versionFlag {
+		styles.InfoStyle.Println("Beamdrop Version:", config.VERSION)
+		return nil
+	}
+	if fs.NArg() > 0 {
+		logger.Debug("Extra arguments provided, showing help")
+		PrintHelp()
+		return nil
+	}
+	if *help {
+		// logger.Debug("Help flag provided, showing help")
+		PrintHelp()
+		return nil
+	}
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+	if err := config.EnsureDataDir(); err != nil {
+		return err
+	}
+
+	logger.Info("Starting beamdrop application")
+	logger.Info("Starting server with shared directory: %s", cfg.SharedDir)
+
+	srv, err := server.New(cfg)
+	if err != nil {
+		return err
+	}
+	return srv.Start()
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/clamd"
+)
+
+// What happens to an upload clamd couldn't scan
+const (
+	ScanErrorReject = "reject"
+	ScanErrorAccept = "accept"
+)
+
+// Antivirus scans uploads with clamd before they're stored
+type Antivirus struct {
+	// Clamd is the address of the daemon: host:port, tcp://host:port,
+	// unix:/path or a socket path. Scanning is off when empty.
+	Clamd string `yaml:"clamd,omitempty"`
+	// Timeout bounds the scan of one file, clamd.DefaultTimeout if 0
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// OnError is reject (the default) to refuse uploads clamd couldn't scan,
+	// or accept to store them marked as unscanned
+	OnError string `yaml:"onError,omitempty"`
+}
+
+// validateAntivirus checks clamd can be reached the way it's configured
+func validateAntivirus(a Antivirus) []error {
+	var errs []error
+	if a.Clamd != "" {
+		if _, _, err := clamd.ParseAddress(a.Clamd); err != nil {
+			errs = append(errs, fmt.Errorf("antivirus: %w", err))
+		}
+	}
+	if a.Timeout < 0 {
+		errs = append(errs, errors.New("antivirus: timeout can't be negative"))
+	}
+	switch a.OnError {
+	case "", ScanErrorReject, ScanErrorAccept:
+	default:
+		errs = append(errs, fmt.Errorf("antivirus: onError %q must be %s or %s", a.OnError, ScanErrorReject, ScanErrorAccept))
+	}
+	return errs
+}
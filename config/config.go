@@ -2,16 +2,16 @@ package config
 
 import (
 	"fmt"
-	"log"
 	"net"
 	"os"
 	"path/filepath"
 )
 
 const (
-	PORT          = 7777
-	VERSION       = "0.0.1"
-	ConfigDirName = ".beamdrop"
+	PORT           = 7777
+	VERSION        = "0.0.1"
+	ConfigDirName  = ".beamdrop"
+	ConfigFileName = "config.yaml"
 )
 
 var (
@@ -21,26 +21,78 @@ var (
 	DBPath     string
 )
 
+// Config holds the effective beamdrop settings after merging the config
+// file, BEAMDROP_* environment variables and command line flags
 type Config struct {
-	PORT int
+	SharedDir string `yaml:"dir"`
+	Port      int    `yaml:"port"`
+	Password  string `yaml:"password"`
+	NoQR      bool   `yaml:"noQR"`
+	DataDir   string `yaml:"dataDir"`
+	LogLevel  string `yaml:"logLevel"`
+
+	// Name is the instance name advertised on the local network
+	Name        string `yaml:"name"`
+	NoDiscovery bool   `yaml:"noDiscovery"`
+
+	// Symlinks is the symbolic link policy: deny, within-root or allow-all
+	Symlinks string `yaml:"symlinks"`
+
+	// Mode is normal, read-only or drop-box
+	Mode string `yaml:"mode"`
+	// DropFolders groups drop-box uploads by request (timestamp) or by
+	// browser session (session)
+	DropFolders string `yaml:"dropFolders"`
+
+	// Roots shares several named directories instead of SharedDir
+	Roots []Root `yaml:"roots,omitempty"`
+
+	// JobWorkers is how many background jobs run at once
+	JobWorkers int `yaml:"jobWorkers"`
+
+	// AdminPassword lets its holder break file locks held by others, delete
+	// any comment, and manage webhooks and the quarantine
+	AdminPassword string `yaml:"adminPassword"`
+
+	// Processors run in order on every uploaded file
+	Processors []Processor `yaml:"processors,omitempty"`
+	// Antivirus scans uploads before they're stored
+	Antivirus Antivirus `yaml:"antivirus,omitempty"`
+	// UploadPolicy limits what can be uploaded; roots can have their own
+	UploadPolicy UploadPolicy `yaml:"uploadPolicy,omitempty"`
 }
 
-type Flags struct {
-	SharedDir string
-	NoQR      bool
-	Port      int
-	Help      bool
-	Password  string
+// Default returns the configuration used when nothing else is set
+func Default() Config {
+	return Config{
+		SharedDir:   ".",
+		Port:        0,
+		DataDir:     ConfigDir,
+		LogLevel:    "info",
+		Symlinks:    "within-root",
+		Mode:        "normal",
+		DropFolders: "timestamp",
+		JobWorkers:  2,
+	}
 }
 
 func GetDBPath() string {
 	return filepath.Join(ConfigDir, DBName)
 }
 
-func GetConfig() Config {
-	return Config{
-		PORT: PORT,
+// SetDataDir relocates the config/data directory and the paths derived from it
+func SetDataDir(dir string) {
+	ConfigDir = dir
+	ConfigPath = filepath.Join(ConfigDir, ConfigFileName)
+	DBPath = GetDBPath()
+}
+
+// EnsureDataDir creates the data directory if it doesn't exist yet
+func EnsureDataDir() error {
+	if err := os.MkdirAll(ConfigDir, 0755); err != nil {
+		return fmt.Errorf("failed to create data directory %s: %w", ConfigDir, err)
 	}
+	return nil
 }
 
 // FindAvailablePort tries to find an available port from the default ports list
@@ -67,34 +119,8 @@ func IsPortAvailable(port int) bool {
 func init() {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		log.Fatalf("failed to get home directory: %v", err)
-	}
-	ConfigDir = filepath.Join(homeDir, ConfigDirName)
-	ConfigPath = filepath.Join(ConfigDir, "beamdrop.db") //FIXME: will fix this
-	DBPath = GetDBPath()
-
-	createConfigDir()
-
-	if _, err := os.Stat(ConfigPath); os.IsNotExist(err) {
-		createConfigDb()
-	} else {
-		// For now, we just log that we're loading the existing config
-		log.Printf("Loading existing config from: %s", ConfigPath)
-	}
-}
-
-func createConfigDir() {
-	if err := os.MkdirAll(ConfigDir, 0755); err != nil {
-		log.Fatalf("failed to create config directory: %v", err)
-	}
-}
-
-func createConfigDb() {
-	file, err := os.Create(ConfigPath)
-	if err != nil {
-		log.Fatalf("failed to create config file: %v", err)
+		// Fall back to the working directory so the client commands still work
+		homeDir = "."
 	}
-	defer file.Close()
-	// TODO: Load initial settings
-	log.Printf("Created default config file at: %s", ConfigPath)
+	SetDataDir(filepath.Join(homeDir, ConfigDirName))
 }
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is prepended to every environment variable beamdrop reads
+const EnvPrefix = "BEAMDROP_"
+
+// envVar maps a BEAMDROP_* environment variable onto a config field
+type envVar struct {
+	name  string
+	apply func(c *Config, value string) error
+}
+
+var envVars = []envVar{
+	{"DIR", func(c *Config, v string) error { c.SharedDir = v; return nil }},
+	{"PORT", func(c *Config, v string) error { return parseInt(v, &c.Port) }},
+	{"PASSWORD", func(c *Config, v string) error { c.Password = v; return nil }},
+	{"ADMIN_PASSWORD", func(c *Config, v string) error { c.AdminPassword = v; return nil }},
+	{"NO_QR", func(c *Config, v string) error { return parseBool(v, &c.NoQR) }},
+	{"DATA_DIR", func(c *Config, v string) error { c.DataDir = v; return nil }},
+	{"LOG_LEVEL", func(c *Config, v string) error { c.LogLevel = v; return nil }},
+	{"NAME", func(c *Config, v string) error { c.Name = v; return nil }},
+	{"NO_DISCOVERY", func(c *Config, v string) error { return parseBool(v, &c.NoDiscovery) }},
+	{"SYMLINKS", func(c *Config, v string) error { c.Symlinks = v; return nil }},
+	{"MODE", func(c *Config, v string) error { c.Mode = v; return nil }},
+	{"DROP_FOLDERS", func(c *Config, v string) error { c.DropFolders = v; return nil }},
+	{"ROOTS", func(c *Config, v string) (err error) { c.Roots, err = ParseRoots(v); return err }},
+	{"JOB_WORKERS", func(c *Config, v string) error { return parseInt(v, &c.JobWorkers) }},
+	{"CLAMD", func(c *Config, v string) error { c.Antivirus.Clamd = v; return nil }},
+}
+
+// Load builds a configuration from the defaults, the config file at path and
+// the BEAMDROP_* environment variables, in that order of precedence.
+// A missing file is only an error when required is set, i.e. when the user
+// pointed at it explicitly.
+func Load(path string, required bool) (Config, error) {
+	cfg := Default()
+
+	if err := cfg.loadFile(path, required); err != nil {
+		return cfg, err
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return nil
+		}
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	for _, ev := range envVars {
+		value, ok := os.LookupEnv(EnvPrefix + ev.name)
+		if !ok {
+			continue
+		}
+		if err := ev.apply(c, value); err != nil {
+			return fmt.Errorf("invalid %s%s %q: %w", EnvPrefix, ev.name, value, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the configuration and reports every problem it finds
+func (c Config) Validate() error {
+	var errs []error
+
+	if len(c.Roots) > 0 {
+		errs = append(errs, validateRoots(c.Roots)...)
+	} else if c.SharedDir == "" {
+		errs = append(errs, errors.New("dir: shared directory is required"))
+	} else if info, err := os.Stat(c.SharedDir); err != nil {
+		errs = append(errs, fmt.Errorf("dir: %w", err))
+	} else if !info.IsDir() {
+		errs = append(errs, fmt.Errorf("dir: %s is not a directory", c.SharedDir))
+	}
+
+	if c.Port < 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port: %d is out of range (0-65535)", c.Port))
+	}
+
+	if c.DataDir == "" {
+		errs = append(errs, errors.New("dataDir: data directory is required"))
+	}
+
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("logLevel: %q must be one of debug, info, warn, error", c.LogLevel))
+	}
+
+	if _, err := sandbox.ParseSymlinkPolicy(c.Symlinks); err != nil {
+		errs = append(errs, fmt.Errorf("symlinks: %w", err))
+	}
+
+	if _, err := sandbox.ParseMode(c.Mode); err != nil {
+		errs = append(errs, fmt.Errorf("mode: %w", err))
+	}
+	switch c.DropFolders {
+	case "", "timestamp", "session":
+	default:
+		errs = append(errs, fmt.Errorf("dropFolders: %q must be timestamp or session", c.DropFolders))
+	}
+
+	if c.JobWorkers < 1 {
+		errs = append(errs, fmt.Errorf("jobWorkers: %d must be at least 1", c.JobWorkers))
+	}
+
+	errs = append(errs, validateProcessors(c.Processors)...)
+	errs = append(errs, validateAntivirus(c.Antivirus)...)
+	errs = append(errs, validateUploadPolicy("uploadPolicy", c.UploadPolicy)...)
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the config that is safe to print
+func (c Config) Redacted() Config {
+	if c.Password != "" {
+		c.Password = "********"
+	}
+	if c.AdminPassword != "" {
+		c.AdminPassword = "********"
+	}
+	return c
+}
+
+// YAML renders the config in the same format the config file uses
+func (c Config) YAML() (string, error) {
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func parseInt(value string, dst *int) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return errors.New("must be an integer")
+	}
+	*dst = n
+	return nil
+}
+
+func parseBool(value string, dst *bool) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return errors.New("must be true or false")
+	}
+	*dst = b
+	return nil
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedacted(t *testing.T) {
+	c := Default()
+	c.Password = "share-secret"
+	c.AdminPassword = "admin-secret"
+	out, err := c.Redacted().YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"share-secret", "admin-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("redacted config shows %q:\n%s", secret, out)
+		}
+	}
+	if c.Password != "share-secret" || c.AdminPassword != "admin-secret" {
+		t.Error("Redacted changed the original config")
+	}
+}
+
+// clearEnv hides the BEAMDROP_* variables of the environment running the
+// tests for the rest of the test
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, EnvPrefix) {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+}
+
+// writeConfig writes a config file into a temporary directory
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ConfigFileName)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, "port: 8080\nname: from-file\nlogLevel: debug\n")
+	t.Setenv(EnvPrefix+"PORT", "9090")
+	t.Setenv(EnvPrefix+"NO_QR", "true")
+
+	cfg, err := Load(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 9090 || !cfg.NoQR {
+		t.Errorf("the environment didn't win over the file: port %d, noQR %v", cfg.Port, cfg.NoQR)
+	}
+	if cfg.Name != "from-file" || cfg.LogLevel != "debug" {
+		t.Errorf("the file didn't win over the defaults: name %q, logLevel %q", cfg.Name, cfg.LogLevel)
+	}
+	if def := Default(); cfg.Symlinks != def.Symlinks || cfg.JobWorkers != def.JobWorkers {
+		t.Errorf("unset keys lost their defaults: symlinks %q, jobWorkers %d", cfg.Symlinks, cfg.JobWorkers)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	clearEnv(t)
+	missing := filepath.Join(t.TempDir(), ConfigFileName)
+
+	// A missing file is fine unless it was asked for
+	if cfg, err := Load(missing, false); err != nil || cfg.Port != Default().Port {
+		t.Errorf("missing optional file: got %v", err)
+	}
+	if _, err := Load(missing, true); err == nil {
+		t.Error("a missing required file was accepted")
+	}
+	if _, err := Load(writeConfig(t, "prot: 8080\n"), true); err == nil || !strings.Contains(err.Error(), "invalid config file") {
+		t.Errorf("unknown key: got %v", err)
+	}
+	if cfg, err := Load(writeConfig(t, ""), true); err != nil || cfg.LogLevel != Default().LogLevel {
+		t.Errorf("empty file: got %v", err)
+	}
+
+	t.Setenv(EnvPrefix+"PORT", "eighty")
+	if _, err := Load(missing, false); err == nil || !strings.Contains(err.Error(), EnvPrefix+"PORT") {
+		t.Errorf("invalid environment variable: got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("the defaults are invalid: %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		change func(c *Config)
+		want   string
+	}{
+		{func(c *Config) { c.SharedDir = "" }, "dir: shared directory is required"},
+		{func(c *Config) { c.SharedDir = filepath.Join(t.TempDir(), "missing") }, "dir: "},
+		{func(c *Config) { c.SharedDir = file }, "is not a directory"},
+		{func(c *Config) { c.Port = 70000 }, "port: 70000 is out of range"},
+		{func(c *Config) { c.Port = -1 }, "port: -1 is out of range"},
+		{func(c *Config) { c.DataDir = "" }, "dataDir: data directory is required"},
+		{func(c *Config) { c.LogLevel = "verbose" }, "logLevel:"},
+		{func(c *Config) { c.Symlinks = "sometimes" }, "symlinks:"},
+		{func(c *Config) { c.Mode = "write-only" }, "mode:"},
+		{func(c *Config) { c.DropFolders = "daily" }, "dropFolders:"},
+		{func(c *Config) { c.JobWorkers = 0 }, "jobWorkers: 0 must be at least 1"},
+		{func(c *Config) { c.Antivirus.OnError = "ignore" }, "antivirus: onError"},
+		{func(c *Config) { c.Roots = []Root{{Name: "a", Path: file}} }, "roots: a:"},
+	}
+	for _, tt := range tests {
+		c := Default()
+		tt.change(&c)
+		if err := c.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got %v, want an error containing %q", err, tt.want)
+		}
+	}
+
+	// Every problem is reported, not just the first
+	c := Default()
+	c.Port, c.LogLevel, c.JobWorkers = -1, "verbose", 0
+	err := c.Validate()
+	for _, want := range []string{"port:", "logLevel:", "jobWorkers:"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got %v, want it to mention %s", err, want)
+		}
+	}
+}
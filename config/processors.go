@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Processor types
+const (
+	ProcessorHash      = "hash"
+	ProcessorMIME      = "mime"
+	ProcessorThumbnail = "thumbnail"
+	ProcessorCommand   = "command"
+)
+
+// Failure policies of a processor
+const (
+	OnFailureKeep       = "keep"
+	OnFailureDelete     = "delete"
+	OnFailureQuarantine = "quarantine"
+)
+
+// DefaultProcessorTimeout bounds a processor that doesn't set Timeout
+const DefaultProcessorTimeout = time.Minute
+
+var (
+	processorTypes  = []string{ProcessorHash, ProcessorMIME, ProcessorThumbnail, ProcessorCommand}
+	failurePolicies = []string{OnFailureKeep, OnFailureDelete, OnFailureQuarantine}
+)
+
+// Processor is a step of the pipeline run on uploaded files, in the order
+// they're configured
+type Processor struct {
+	// Name identifies the processor's results, e.g. "sha256"
+	Name string `yaml:"name"`
+	// Type is hash, mime, thumbnail or command
+	Type string `yaml:"type"`
+	// Command is the program and arguments a command processor runs
+	Command []string `yaml:"command,omitempty"`
+	// Timeout bounds one run, DefaultProcessorTimeout if 0
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// OnFailure is what happens to the file when the processor fails:
+	// keep (the default), delete or quarantine
+	OnFailure string `yaml:"onFailure,omitempty"`
+	// Match limits the processor to files whose name matches one of these
+	// patterns, e.g. "*.zip"
+	Match []string `yaml:"match,omitempty"`
+}
+
+// validateProcessors checks the pipeline can be built
+func validateProcessors(processors []Processor) []error {
+	var errs []error
+	seen := make(map[string]bool)
+	for i, p := range processors {
+		name := p.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		switch {
+		case p.Name == "" || strings.ContainsFunc(p.Name, badNameChar):
+			errs = append(errs, fmt.Errorf("processors: %s: name must be lowercase letters, digits, - and _", name))
+		case seen[p.Name]:
+			errs = append(errs, fmt.Errorf("processors: duplicate name %q", p.Name))
+		}
+		seen[p.Name] = true
+
+		if !slices.Contains(processorTypes, p.Type) {
+			errs = append(errs, fmt.Errorf("processors: %s: type %q must be one of %s", name, p.Type, strings.Join(processorTypes, ", ")))
+		}
+		if p.Type == ProcessorCommand && len(p.Command) == 0 {
+			errs = append(errs, fmt.Errorf("processors: %s: command is required", name))
+		}
+		if p.OnFailure != "" && !slices.Contains(failurePolicies, p.OnFailure) {
+			errs = append(errs, fmt.Errorf("processors: %s: onFailure %q must be one of %s", name, p.OnFailure, strings.Join(failurePolicies, ", ")))
+		}
+		if p.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("processors: %s: timeout can't be negative", name))
+		}
+		for _, pattern := range p.Match {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, fmt.Errorf("processors: %s: invalid pattern %q", name, pattern))
+			}
+		}
+	}
+	return errs
+}
+
+// badNameChar reports whether r can't be part of a processor name
+func badNameChar(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+}
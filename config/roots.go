@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Root is a directory shared under a name, shown as a top-level entry
+type Root struct {
+	Name       string `yaml:"name"`
+	Path       string `yaml:"path"`
+	ReadOnly   bool   `yaml:"readOnly,omitempty"`
+	UploadOnly bool   `yaml:"uploadOnly,omitempty"`
+	Hidden     bool   `yaml:"hidden,omitempty"`
+	// UploadPolicy replaces the server's upload policy for this root
+	UploadPolicy *UploadPolicy `yaml:"uploadPolicy,omitempty"`
+}
+
+// rootOptions are the flags a root spec can end with
+var rootOptions = map[string]func(r *Root){
+	"ro":          func(r *Root) { r.ReadOnly = true },
+	"upload-only": func(r *Root) { r.UploadOnly = true },
+	"hidden":      func(r *Root) { r.Hidden = true },
+}
+
+// ParseRoot parses a spec of the form name=path[:option...], where the
+// options are ro, upload-only and hidden, e.g. "docs=/srv/docs:ro:hidden"
+func ParseRoot(spec string) (Root, error) {
+	name, dir, ok := strings.Cut(spec, "=")
+	if !ok {
+		return Root{}, fmt.Errorf("root %q must look like name=path[:ro|:upload-only|:hidden]", spec)
+	}
+	r := Root{Name: name}
+
+	// Options are only taken from the end so paths may contain colons
+	for {
+		i := strings.LastIndex(dir, ":")
+		if i < 0 {
+			break
+		}
+		apply, known := rootOptions[dir[i+1:]]
+		if !known {
+			break
+		}
+		apply(&r)
+		dir = dir[:i]
+	}
+	r.Path = dir
+	return r, nil
+}
+
+// ParseRoots parses a comma-separated list of root specs
+func ParseRoots(specs string) ([]Root, error) {
+	var roots []Root
+	for _, spec := range strings.Split(specs, ",") {
+		if spec = strings.TrimSpace(spec); spec == "" {
+			continue
+		}
+		r, err := ParseRoot(spec)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, r)
+	}
+	return roots, nil
+}
+
+// UnmarshalYAML accepts a root either as a mapping or as a spec string
+func (r *Root) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		parsed, err := ParseRoot(n.Value)
+		if err != nil {
+			return err
+		}
+		*r = parsed
+		return nil
+	}
+	type plain Root
+	return n.Decode((*plain)(r))
+}
+
+// validateRoots checks names are usable as top-level entries and every path
+// is a directory
+func validateRoots(roots []Root) []error {
+	var errs []error
+	seen := make(map[string]bool)
+	for _, r := range roots {
+		switch {
+		case r.Name == "" || r.Name == "." || r.Name == ".." || strings.ContainsAny(r.Name, "/\\"):
+			errs = append(errs, fmt.Errorf("roots: invalid name %q", r.Name))
+		case seen[r.Name]:
+			errs = append(errs, fmt.Errorf("roots: duplicate name %q", r.Name))
+		}
+		seen[r.Name] = true
+
+		if r.Path == "" {
+			errs = append(errs, fmt.Errorf("roots: %s: path is required", r.Name))
+		} else if info, err := os.Stat(r.Path); err != nil {
+			errs = append(errs, fmt.Errorf("roots: %s: %w", r.Name, err))
+		} else if !info.IsDir() {
+			errs = append(errs, fmt.Errorf("roots: %s: %s is not a directory", r.Name, r.Path))
+		}
+
+		if r.ReadOnly && r.UploadOnly {
+			errs = append(errs, fmt.Errorf("roots: %s: ro and upload-only can't be combined", r.Name))
+		}
+		if r.UploadPolicy != nil {
+			errs = append(errs, validateUploadPolicy("roots: "+r.Name+": uploadPolicy", *r.UploadPolicy)...)
+		}
+	}
+	return errs
+}
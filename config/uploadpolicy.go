@@ -0,0 +1,105 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// UploadPolicy limits what can be uploaded by name, by the type the content
+// really is and by size. Every list is optional; an empty policy accepts
+// everything.
+type UploadPolicy struct {
+	// AllowExtensions, if set, are the only extensions accepted, e.g. ".jpg"
+	// or ".tar.gz"
+	AllowExtensions []string `yaml:"allowExtensions,omitempty"`
+	// DenyExtensions are refused, e.g. ".exe"
+	DenyExtensions []string `yaml:"denyExtensions,omitempty"`
+	// AllowTypes, if set, are the only MIME types accepted, as sniffed from
+	// the content, e.g. "image/*" or "application/pdf"
+	AllowTypes []string `yaml:"allowTypes,omitempty"`
+	// DenyTypes are refused, e.g. "application/x-msdownload"
+	DenyTypes []string `yaml:"denyTypes,omitempty"`
+	// MaxSize maps MIME types or patterns to the largest file accepted of
+	// that type, e.g. "image/*": 20MB. "*" covers the rest.
+	MaxSize map[string]string `yaml:"maxSize,omitempty"`
+	// MatchExtension refuses files whose content is clearly not what their
+	// extension says, like a program named photo.jpg
+	MatchExtension bool `yaml:"matchExtension,omitempty"`
+}
+
+// IsZero reports whether the policy accepts everything
+func (p UploadPolicy) IsZero() bool {
+	return len(p.AllowExtensions) == 0 && len(p.DenyExtensions) == 0 &&
+		len(p.AllowTypes) == 0 && len(p.DenyTypes) == 0 &&
+		len(p.MaxSize) == 0 && !p.MatchExtension
+}
+
+// ParseSize parses a size like "512", "20MB", "1.5 GiB" or "100k". Units
+// are powers of 1024.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	unit := strings.ToUpper(strings.TrimSpace(s[i:]))
+	unit = strings.TrimSuffix(strings.TrimSuffix(unit, "IB"), "B")
+	exp := 0
+	if unit != "" {
+		exp = strings.Index("KMGT", unit) + 1
+		if len(unit) > 1 || exp == 0 {
+			return 0, fmt.Errorf("invalid size %q: unit must be B, KB, MB, GB or TB", s)
+		}
+	}
+	n *= math.Pow(1024, float64(exp))
+	if n >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return int64(n), nil
+}
+
+// validateUploadPolicy checks the policy of where, "uploadPolicy" or a root
+func validateUploadPolicy(where string, p UploadPolicy) []error {
+	var errs []error
+	for _, list := range [][]string{p.AllowExtensions, p.DenyExtensions} {
+		for _, ext := range list {
+			if !strings.HasPrefix(ext, ".") || len(ext) < 2 || strings.ContainsAny(ext, "/\\*") {
+				errs = append(errs, fmt.Errorf("%s: extension %q must look like .jpg", where, ext))
+			}
+		}
+	}
+	for _, list := range [][]string{p.AllowTypes, p.DenyTypes} {
+		for _, t := range list {
+			if !validTypePattern(t) {
+				errs = append(errs, fmt.Errorf("%s: type %q must look like image/png or image/*", where, t))
+			}
+		}
+	}
+	for t, size := range p.MaxSize {
+		if t != "*" && !validTypePattern(t) {
+			errs = append(errs, fmt.Errorf("%s: maxSize: type %q must look like image/png, image/* or *", where, t))
+		}
+		if n, err := ParseSize(size); err != nil {
+			errs = append(errs, fmt.Errorf("%s: maxSize: %s: %w", where, t, err))
+		} else if n <= 0 {
+			errs = append(errs, errors.New(where+": maxSize: "+t+": must be more than 0"))
+		}
+	}
+	return errs
+}
+
+// validTypePattern reports whether t is a MIME type like image/png or a
+// pattern of a whole family like image/*
+func validTypePattern(t string) bool {
+	major, minor, ok := strings.Cut(t, "/")
+	return ok && major != "" && minor != "" && !strings.Contains(major, "*") &&
+		(minor == "*" || !strings.ContainsAny(minor, "*/"))
+}
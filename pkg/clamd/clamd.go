@@ -0,0 +1,217 @@
+// Package clamd scans content for viruses with the ClamAV daemon, streaming
+// it over the INSTREAM command of its TCP or unix socket protocol
+package clamd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds a scan when the client has no timeout of its own
+const DefaultTimeout = 2 * time.Minute
+
+// chunkSize is how much content goes in one INSTREAM chunk
+const chunkSize = 64 << 10
+
+// ErrSizeLimit is returned for content larger than clamd's StreamMaxLength
+var ErrSizeLimit = errors.New("clamd: content exceeds StreamMaxLength")
+
+// Result is clamd's verdict on some content
+type Result struct {
+	Infected bool
+	// Signature names what was found, e.g. "Eicar-Test-Signature"
+	Signature string
+}
+
+// Client talks to one clamd. Every command uses its own connection.
+type Client struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// New returns a client of the clamd at address, see ParseAddress. A
+// timeout of 0 means DefaultTimeout.
+func New(address string, timeout time.Duration) (*Client, error) {
+	network, addr, err := ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Client{network: network, address: addr, timeout: timeout}, nil
+}
+
+// ParseAddress splits a clamd address into a network and an address for
+// net.Dial. It takes "unix:/run/clamd.sock" or a plain socket path, and
+// "tcp://host:3310" or "host:3310".
+func ParseAddress(s string) (network, address string, err error) {
+	switch {
+	case strings.HasPrefix(s, "unix:"):
+		network, address = "unix", strings.TrimPrefix(strings.TrimPrefix(s, "unix:"), "//")
+	case strings.HasPrefix(s, "tcp://"):
+		network, address = "tcp", strings.TrimPrefix(s, "tcp://")
+	case strings.HasPrefix(s, "/"):
+		network, address = "unix", s
+	default:
+		network, address = "tcp", s
+	}
+	if network == "tcp" {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return "", "", fmt.Errorf("invalid clamd address %q: want host:port or a unix socket path", s)
+		}
+	}
+	if address == "" {
+		return "", "", fmt.Errorf("invalid clamd address %q", s)
+	}
+	return network, address, nil
+}
+
+// String returns the address of the clamd
+func (c *Client) String() string {
+	if c.network == "unix" {
+		return "unix:" + c.address
+	}
+	return c.address
+}
+
+// Ping checks clamd answers
+func (c *Client) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return err
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("clamd: unexpected reply to PING: %q", reply)
+	}
+	return nil
+}
+
+// Scan streams r to clamd and returns its verdict. An error means the
+// content couldn't be scanned, not that it's infected.
+func (c *Client) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	if err := stream(conn, r); err != nil {
+		// clamd answers and hangs up when the stream is too long; its answer
+		// says more than the broken pipe
+		if reply, rerr := readReply(conn); rerr == nil {
+			return parseScan(reply)
+		}
+		return Result{}, err
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return Result{}, err
+	}
+	return parseScan(reply)
+}
+
+// dial connects to clamd. The connection is closed when ctx is done and
+// can't outlive the timeout.
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	d := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := d.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("clamd: %w", err)
+	}
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	return &stoppingConn{Conn: conn, stop: stop}, nil
+}
+
+// stoppingConn stops watching the context once it's closed
+type stoppingConn struct {
+	net.Conn
+	stop func() bool
+}
+
+func (c *stoppingConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
+
+// stream sends r as an INSTREAM command: chunks prefixed with their length
+// as 4 bytes in network order, ended by an empty chunk
+func stream(w io.Writer, r io.Reader) error {
+	bw := bufio.NewWriterSize(w, chunkSize+4)
+	if _, err := bw.WriteString("zINSTREAM\x00"); err != nil {
+		return err
+	}
+	buf := make([]byte, chunkSize)
+	var size [4]byte
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			bw.Write(size[:])
+			if _, werr := bw.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	bw.Write(size[:])
+	return bw.Flush()
+}
+
+// readReply reads one NUL-terminated reply
+func readReply(r io.Reader) (string, error) {
+	reply, err := bufio.NewReader(io.LimitReader(r, 4096)).ReadBytes(0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+	reply = bytes.TrimRight(reply, "\x00\n")
+	if len(reply) == 0 {
+		return "", errors.New("clamd: empty reply")
+	}
+	return string(reply), nil
+}
+
+// parseScan reads the verdict of a reply like "stream: OK" or
+// "stream: Eicar-Test-Signature FOUND"
+func parseScan(reply string) (Result, error) {
+	msg := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case msg == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(msg, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(msg, " FOUND")}, nil
+	case strings.Contains(msg, "size limit exceeded"):
+		return Result{}, ErrSizeLimit
+	case strings.HasSuffix(msg, " ERROR"):
+		return Result{}, fmt.Errorf("clamd: %s", strings.TrimSuffix(msg, " ERROR"))
+	}
+	return Result{}, fmt.Errorf("clamd: unexpected reply %q", reply)
+}
@@ -0,0 +1,139 @@
+package clamd_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/clamd"
+	"github.com/tachRoutine/beamdrop-go/pkg/clamd/clamdtest"
+)
+
+// fake starts a fake clamd on a local TCP port, stopped with the test
+func fake(t *testing.T, f *clamdtest.Fake) *clamd.Client {
+	t.Helper()
+	if err := f.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	c, err := clamd.New(f.Addr(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestScan(t *testing.T) {
+	f := &clamdtest.Fake{Signatures: map[string]string{"evil payload": "Test.Evil"}}
+	c := fake(t, f)
+	tests := []struct {
+		name      string
+		content   string
+		infected  bool
+		signature string
+	}{
+		{"clean", "hello, world", false, ""},
+		{"empty", "", false, ""},
+		{"eicar", clamdtest.EICAR, true, "Eicar-Test-Signature"},
+		{"eicar inside", "header " + clamdtest.EICAR + " trailer", true, "Eicar-Test-Signature"},
+		{"signature", "some evil payload here", true, "Test.Evil"},
+		// Spans several INSTREAM chunks
+		{"large clean", strings.Repeat("a", 200<<10), false, ""},
+		{"large eicar", strings.Repeat("a", 100<<10) + clamdtest.EICAR, true, "Eicar-Test-Signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := c.Scan(context.Background(), strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			if res.Infected != tt.infected || res.Signature != tt.signature {
+				t.Errorf("got %+v, want infected %v signature %q", res, tt.infected, tt.signature)
+			}
+		})
+	}
+	if n := f.Scans(); n != len(tests) {
+		t.Errorf("fake received %d scans, want %d", n, len(tests))
+	}
+}
+
+func TestScanSizeLimit(t *testing.T) {
+	c := fake(t, &clamdtest.Fake{MaxLength: 1024})
+	if _, err := c.Scan(context.Background(), strings.NewReader(strings.Repeat("a", 100<<10))); !errors.Is(err, clamd.ErrSizeLimit) {
+		t.Errorf("got %v, want ErrSizeLimit", err)
+	}
+	if res, err := c.Scan(context.Background(), strings.NewReader("small")); err != nil || res.Infected {
+		t.Errorf("content under the limit: got %+v, %v", res, err)
+	}
+}
+
+func TestScannerDown(t *testing.T) {
+	// A port that was free a moment ago has nobody listening
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	c, err := clamd.New(addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ping(context.Background()); err == nil {
+		t.Error("Ping succeeded with clamd down")
+	}
+	res, err := c.Scan(context.Background(), strings.NewReader(clamdtest.EICAR))
+	if err == nil {
+		t.Errorf("Scan succeeded with clamd down: %+v", res)
+	}
+	if res.Infected {
+		t.Error("a failed scan reported an infection")
+	}
+}
+
+func TestPingUnixSocket(t *testing.T) {
+	f := &clamdtest.Fake{}
+	if err := f.Listen("unix", filepath.Join(t.TempDir(), "clamd.sock")); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	c, err := clamd.New(f.Addr(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if res, err := c.Scan(context.Background(), strings.NewReader(clamdtest.EICAR)); err != nil || !res.Infected {
+		t.Errorf("Scan over a unix socket: got %+v, %v", res, err)
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		in      string
+		network string
+		address string
+		ok      bool
+	}{
+		{"127.0.0.1:3310", "tcp", "127.0.0.1:3310", true},
+		{"tcp://clamav:3310", "tcp", "clamav:3310", true},
+		{"unix:/run/clamd.sock", "unix", "/run/clamd.sock", true},
+		{"unix:///run/clamd.sock", "unix", "/run/clamd.sock", true},
+		{"/run/clamd.sock", "unix", "/run/clamd.sock", true},
+		{"clamav", "", "", false},
+		{"tcp://", "", "", false},
+		{"unix:", "", "", false},
+	}
+	for _, tt := range tests {
+		network, address, err := clamd.ParseAddress(tt.in)
+		if (err == nil) != tt.ok || network != tt.network || address != tt.address {
+			t.Errorf("ParseAddress(%q) = %q, %q, %v", tt.in, network, address, err)
+		}
+	}
+}
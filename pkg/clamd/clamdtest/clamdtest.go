@@ -0,0 +1,178 @@
+// Package clamdtest provides a stand-in for clamd to test virus scanning
+// without ClamAV, like httptest does for HTTP servers
+package clamdtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/clamd"
+)
+
+// EICAR is the standard antivirus test file, which every scanner reports
+// as infected although it's harmless
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// Fake answers PING and INSTREAM like clamd, finding EICAR and the content
+// in Signatures
+type Fake struct {
+	// Signatures maps content to the name of the virus it gives away
+	Signatures map[string]string
+	// MaxLength is clamd's StreamMaxLength, unlimited if 0
+	MaxLength int64
+
+	ln   net.Listener
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	seen int
+}
+
+// Listen starts serving on a "tcp" or "unix" address. Set the fields
+// before.
+func (f *Fake) Listen(network, address string) error {
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	f.ln = ln
+	f.wg.Add(1)
+	go f.serve()
+	return nil
+}
+
+// Addr returns the address to hand clamd.New
+func (f *Fake) Addr() string {
+	if f.ln.Addr().Network() == "unix" {
+		return "unix:" + f.ln.Addr().String()
+	}
+	return f.ln.Addr().String()
+}
+
+// Scans counts the INSTREAM commands received
+func (f *Fake) Scans() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seen
+}
+
+// Close stops serving
+func (f *Fake) Close() error {
+	err := f.ln.Close()
+	f.wg.Wait()
+	return err
+}
+
+func (f *Fake) serve() {
+	defer f.wg.Done()
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			defer conn.Close()
+			f.handle(conn)
+		}()
+	}
+}
+
+// handle answers one command. Commands start with z and end with NUL, or
+// with n and end with a newline; replies end the same way.
+func (f *Fake) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return
+	}
+	end := byte(0)
+	if prefix == 'n' {
+		end = '\n'
+	}
+	cmd, err := r.ReadString(end)
+	if err != nil {
+		return
+	}
+	reply := func(msg string) {
+		conn.Write(append([]byte(msg), end))
+	}
+
+	switch cmd[:len(cmd)-1] {
+	case "PING":
+		reply("PONG")
+	case "INSTREAM":
+		f.mu.Lock()
+		f.seen++
+		f.mu.Unlock()
+		data, err := f.receive(r)
+		switch {
+		case errors.Is(err, clamd.ErrSizeLimit):
+			reply("INSTREAM size limit exceeded. ERROR")
+		case err != nil:
+			reply("Error reading stream. ERROR")
+		default:
+			reply("stream: " + f.verdict(data))
+		}
+	default:
+		reply("UNKNOWN COMMAND")
+	}
+}
+
+// receive reads the chunks of an INSTREAM command. Content over MaxLength
+// is read to the end and dropped, so the client gets to read the answer.
+func (f *Fake) receive(r io.Reader) ([]byte, error) {
+	var data []byte
+	var size [4]byte
+	var total int64
+	for {
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, err
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n == 0 {
+			break
+		}
+		total += int64(n)
+		if f.MaxLength > 0 && total > f.MaxLength {
+			data = nil
+			if _, err := io.CopyN(io.Discard, r, int64(n)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+	if f.MaxLength > 0 && total > f.MaxLength {
+		return nil, clamd.ErrSizeLimit
+	}
+	return data, nil
+}
+
+// verdict is OK or the signature found in data, checked in name order
+func (f *Fake) verdict(data []byte) string {
+	if bytes.Contains(data, []byte(EICAR)) {
+		return "Eicar-Test-Signature FOUND"
+	}
+	needles := make([]string, 0, len(f.Signatures))
+	for needle := range f.Signatures {
+		needles = append(needles, needle)
+	}
+	sort.Slice(needles, func(i, j int) bool { return f.Signatures[needles[i]] < f.Signatures[needles[j]] })
+	for _, needle := range needles {
+		if bytes.Contains(data, []byte(needle)) {
+			return f.Signatures[needle] + " FOUND"
+		}
+	}
+	return "OK"
+}
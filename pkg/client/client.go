@@ -0,0 +1,222 @@
+// Package client is a typed Go client for the beamdrop HTTP API.
+//
+//	c, err := client.New("http://192.168.1.20:7777", client.WithPassword("hunter2"))
+//	files, err := c.List(ctx, "docs")
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PasswordHeader is the header the server reads the password from
+const PasswordHeader = "X-Password"
+
+// APIPrefix is the path of the API version this client speaks
+const APIPrefix = "/api/v1"
+
+// Client talks to a single beamdrop server. It is safe for concurrent use.
+type Client struct {
+	base       *url.URL
+	password   string
+	http       *http.Client
+	userAgent  string
+	maxRetries int
+	backoff    time.Duration
+
+	// locks maps the IDs of the locks the client took to their tokens,
+	// comments those of the comments it added
+	mu       sync.Mutex
+	locks    map[string]string
+	comments map[uint]string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithPassword sets the server password sent with every request
+func WithPassword(password string) Option {
+	return func(c *Client) { c.password = password }
+}
+
+// WithHTTPClient replaces the underlying http.Client
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithRetries sets how often idempotent requests are retried after network
+// errors or 429/502/503/504 responses, and the initial backoff which doubles
+// after every attempt
+func WithRetries(max int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = max
+		c.backoff = backoff
+	}
+}
+
+// WithUserAgent sets the User-Agent header
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.userAgent = ua }
+}
+
+// New creates a client for the server at baseURL, e.g. "http://host:7777"
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("client: base URL must start with http:// or https://")
+	}
+
+	c := &Client{
+		base:       u,
+		http:       http.DefaultClient,
+		userAgent:  "beamdrop-client",
+		maxRetries: 2,
+		backoff:    200 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// BaseURL returns the server URL the client talks to
+func (c *Client) BaseURL() string {
+	return c.base.String()
+}
+
+func (c *Client) endpoint(p string, query url.Values) string {
+	u := *c.base
+	u.Path = strings.TrimRight(u.Path, "/") + APIPrefix + p
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (c *Client) newRequest(ctx context.Context, method, p string, query url.Values, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint(p, query), body)
+	if err != nil {
+		return nil, err
+	}
+	if c.password != "" {
+		req.Header.Set(PasswordHeader, c.password)
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	if tokens := c.lockTokens(); tokens != "" {
+		req.Header.Set(LockTokenHeader, tokens)
+	}
+	return req, nil
+}
+
+// do sends req and converts non-2xx responses into *Error. Idempotent
+// requests whose body can be replayed (GetBody set, or no body) are retried.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	replayable := idempotent(req) && (req.Body == nil || req.GetBody != nil)
+	backoff := c.backoff
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := c.http.Do(req)
+		retry := attempt < c.maxRetries && replayable && shouldRetry(resp, err)
+		if !retry {
+			if err != nil {
+				return nil, err
+			}
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return resp, nil
+			}
+			return nil, errorFromResponse(req, resp)
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// idempotent reports whether sending req twice does no more than sending it
+// once: GET, HEAD, OPTIONS, PUT and DELETE requests, and like in net/http,
+// any request with an Idempotency-Key header. A retried move, copy or comment
+// would run twice.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, ok := req.Header["Idempotency-Key"]
+	return ok
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		var netErr net.Error
+		return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (c *Client) getJSON(ctx context.Context, p string, query url.Values, out any) error {
+	req, err := c.newRequest(ctx, http.MethodGet, p, query, nil)
+	if err != nil {
+		return err
+	}
+	return c.doJSON(req, out)
+}
+
+func (c *Client) sendJSON(ctx context.Context, method, p string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, method, p, nil, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.doJSON(req, out)
+}
+
+func (c *Client) doJSON(req *http.Request, out any) error {
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return &Error{Method: req.Method, Path: req.URL.Path, StatusCode: resp.StatusCode, Message: "invalid JSON response: " + err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		method string
+		header string
+		sent   int32
+	}{
+		{http.MethodGet, "", 3},
+		{http.MethodPut, "", 3},
+		{http.MethodDelete, "", 3},
+		{http.MethodPost, "", 1},
+		{http.MethodPatch, "", 1},
+		{http.MethodPost, "Idempotency-Key", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.header, func(t *testing.T) {
+			var sent atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sent.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer srv.Close()
+			c, err := New(srv.URL, WithRetries(2, time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out struct{}
+			req, err := c.newRequest(context.Background(), tt.method, "/files/move", nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Header.Set(tt.header, "key")
+			}
+			if err := c.doJSON(req, &out); err == nil {
+				t.Fatal("got no error for a 503")
+			}
+			if got := sent.Load(); got != tt.sent {
+				t.Errorf("sent %d times, want %d", got, tt.sent)
+			}
+		})
+	}
+}
+
+func TestMoveNotRetried(t *testing.T) {
+	var sent atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	c, err := New(srv.URL, WithRetries(2, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Move(context.Background(), "a.txt", "b.txt", nil); err == nil {
+		t.Fatal("got no error for a 502")
+	}
+	if got := sent.Load(); got != 1 {
+		t.Errorf("the move was sent %d times", got)
+	}
+}
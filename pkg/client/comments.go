@@ -0,0 +1,121 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// CommentTokenHeader carries the token of a comment, to edit or delete it
+const CommentTokenHeader = "X-Comment-Token"
+
+// Comments returns the comment threads on a file or directory, oldest first
+func (c *Client) Comments(ctx context.Context, p string) ([]CommentThread, error) {
+	var resp struct {
+		Threads []CommentThread `json:"threads"`
+	}
+	err := c.getJSON(ctx, "/comments", url.Values{"path": {CleanPath(p)}}, &resp)
+	return resp.Threads, err
+}
+
+// AddComment comments on a file or directory, or replies to the comment
+// parentID if it isn't 0. The author is the client's address if empty. The
+// client remembers the comment's token, so it can edit or delete it.
+func (c *Client) AddComment(ctx context.Context, p, body, author string, parentID uint) (*Comment, error) {
+	req := struct {
+		Path     string `json:"path"`
+		Body     string `json:"body"`
+		ParentID *uint  `json:"parentId,omitempty"`
+		Author   string `json:"author,omitempty"`
+	}{Path: CleanPath(p), Body: body, Author: author}
+	if parentID != 0 {
+		req.ParentID = &parentID
+	}
+	var resp struct {
+		Comment Comment `json:"comment"`
+		Token   string  `json:"token"`
+	}
+	if err := c.sendJSON(ctx, http.MethodPost, "/comments", req, &resp); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.comments == nil {
+		c.comments = map[uint]string{}
+	}
+	c.comments[resp.Comment.ID] = resp.Token
+	c.mu.Unlock()
+	return &resp.Comment, nil
+}
+
+// EditComment replaces the body of a comment the client added
+func (c *Client) EditComment(ctx context.Context, id uint, body string) (*Comment, error) {
+	var resp struct {
+		Comment Comment `json:"comment"`
+	}
+	req, err := c.commentRequest(ctx, http.MethodPatch, id, struct {
+		Body string `json:"body"`
+	}{body})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.doJSON(req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Comment, nil
+}
+
+// DeleteComment deletes a comment the client added
+func (c *Client) DeleteComment(ctx context.Context, id uint) error {
+	req, err := c.commentRequest(ctx, http.MethodDelete, id, nil)
+	if err != nil {
+		return err
+	}
+	if err := c.doJSON(req, nil); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	delete(c.comments, id)
+	c.mu.Unlock()
+	return nil
+}
+
+// RemoveComment deletes anyone's comment with the server's admin password
+func (c *Client) RemoveComment(ctx context.Context, id uint, adminPassword string) error {
+	req, err := c.commentRequest(ctx, http.MethodDelete, id, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(AdminPasswordHeader, adminPassword)
+	return c.doJSON(req, nil)
+}
+
+// commentRequest builds a request on a comment carrying its token, if the
+// client has it
+func (c *Client) commentRequest(ctx context.Context, method string, id uint, body any) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := c.newRequest(ctx, method, "/comments/"+strconv.FormatUint(uint64(id), 10), nil, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.mu.Lock()
+	token := c.comments[id]
+	c.mu.Unlock()
+	if token != "" {
+		req.Header.Set(CommentTokenHeader, token)
+	}
+	return req, nil
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors matched by errors.Is against an *Error
+var (
+	ErrBadRequest       = errors.New("bad request")
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrForbidden        = errors.New("forbidden")
+	ErrNotFound         = errors.New("not found")
+	ErrMethodNotAllowed = errors.New("method not allowed")
+	ErrConflict         = errors.New("conflict")
+	ErrStale            = errors.New("stale revision")
+	ErrLocked           = errors.New("locked")
+	ErrServer           = errors.New("server error")
+)
+
+// Error is returned for every non-2xx response from the server
+type Error struct {
+	Method     string
+	Path       string
+	StatusCode int
+	// Code is the machine-readable error code if the server sent one
+	Code    string
+	Message string
+	// Revision is the current revision of the file a stale write was refused
+	// for
+	Revision string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("beamdrop: %s %s: %s (HTTP %d)", e.Method, e.Path, e.Message, e.StatusCode)
+}
+
+// Is maps the HTTP status onto the sentinel errors
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrMethodNotAllowed:
+		return e.StatusCode == http.StatusMethodNotAllowed
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrStale:
+		return e.StatusCode == http.StatusPreconditionFailed
+	case ErrLocked:
+		return e.StatusCode == http.StatusLocked
+	case ErrServer:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// errorFromResponse reads the JSON error body ({"error": "...", "code": "..."})
+// or falls back to the plain text body
+func errorFromResponse(req *http.Request, resp *http.Response) *Error {
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	e := &Error{
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(data)),
+	}
+
+	var body struct {
+		Error    string `json:"error"`
+		Code     string `json:"code"`
+		Revision string `json:"revision"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Error != "" {
+		e.Message = body.Error
+		e.Code = body.Code
+		e.Revision = body.Revision
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
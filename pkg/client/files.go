@@ -0,0 +1,486 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// List returns all entries of a directory; "" is the shared root
+func (c *Client) List(ctx context.Context, dir string) ([]File, error) {
+	files := []File{}
+	opts := &ListOptions{Limit: 1000}
+	for {
+		page, err := c.ListPage(ctx, dir, opts)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, page.Entries...)
+		if page.NextCursor == "" {
+			return files, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// ListPage returns one page of a directory listing
+func (c *Client) ListPage(ctx context.Context, dir string, opts *ListOptions) (*Listing, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+	query := url.Values{"path": {dir}}
+	if opts.Sort != "" {
+		query.Set("sort", opts.Sort)
+	}
+	if opts.Desc {
+		query.Set("order", "desc")
+	}
+	if opts.HideHidden {
+		query.Set("hidden", "false")
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		query.Set("cursor", opts.Cursor)
+	}
+
+	var listing Listing
+	if err := c.getJSON(ctx, "/files", query, &listing); err != nil {
+		return nil, err
+	}
+	if listing.Entries == nil {
+		listing.Entries = []File{}
+	}
+	return &listing, nil
+}
+
+// Stat returns a single entry by looking it up in its parent directory
+func (c *Client) Stat(ctx context.Context, p string) (File, error) {
+	p = CleanPath(p)
+	if p == "" {
+		return File{Name: "/", IsDir: true}, nil
+	}
+	files, err := c.List(ctx, parentDir(p))
+	if err != nil {
+		return File{}, err
+	}
+	name := path.Base(p)
+	for _, f := range files {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return File{}, &Error{Method: http.MethodGet, Path: APIPrefix + "/files", StatusCode: http.StatusNotFound, Message: p + ": no such file or directory"}
+}
+
+// UploadOptions tunes an upload
+type UploadOptions struct {
+	// Size of the content if known, used for progress reporting
+	Size     int64
+	Progress ProgressFunc
+	// Conflict is what the server does when the name is taken: overwrite,
+	// rename, skip or fail. Empty leaves it to the server, which renames.
+	Conflict string
+}
+
+// Upload streams r into the remote directory dir under the given name.
+// Uploads are streamed and therefore never retried.
+func (c *Client) Upload(ctx context.Context, dir, name string, r io.Reader, opts *UploadOptions) (*UploadResult, error) {
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	total := opts.Size
+	if total <= 0 {
+		total = -1
+	}
+	if opts.Progress != nil {
+		r = &progressReader{r: r, total: total, fn: opts.Progress}
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		err := mw.WriteField("path", dir)
+		if err == nil && opts.Conflict != "" {
+			err = mw.WriteField("conflict", opts.Conflict)
+		}
+		if err == nil {
+			var part io.Writer
+			part, err = mw.CreateFormFile("file", name)
+			if err == nil {
+				_, err = io.Copy(part, r)
+			}
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/files/upload", nil, pr)
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var result UploadResult
+	if err := c.doJSON(req, &result); err != nil {
+		pr.CloseWithError(err)
+		return nil, err
+	}
+	for _, f := range result.Files {
+		if f.Status == UploadFailed {
+			return &result, fmt.Errorf("upload %s: %s", f.Name, f.Error)
+		}
+	}
+	return &result, nil
+}
+
+// UploadFile uploads a local file into the remote directory dir. opts may be
+// nil; its Size is filled in from the file.
+func (c *Client) UploadFile(ctx context.Context, local, dir string, opts *UploadOptions) (*UploadResult, error) {
+	f, err := os.Open(local)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	o := UploadOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o.Size = info.Size()
+	return c.Upload(ctx, dir, info.Name(), f, &o)
+}
+
+// DownloadOptions tunes a download
+type DownloadOptions struct {
+	// Offset starts the download at this byte using a Range request
+	Offset   int64
+	Progress ProgressFunc
+}
+
+// Download writes the remote file p into w and returns the number of bytes
+// written. With a non-zero Offset only the rest of the file is requested;
+// ErrRangeIgnored is returned if the server sent the whole file instead.
+func (c *Client) Download(ctx context.Context, p string, w io.Writer, opts *DownloadOptions) (int64, error) {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	resp, err := c.openDownload(ctx, p, opts.Offset)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if opts.Offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		return 0, ErrRangeIgnored
+	}
+	return c.copyBody(w, resp, opts.Offset, opts.Progress)
+}
+
+// ErrRangeIgnored is returned when a ranged download got the full file
+var ErrRangeIgnored = errors.New("client: server ignored the range request")
+
+// DownloadFile downloads the remote file p to the local path. If the local
+// file already exists and resume is set, only the missing tail is fetched.
+func (c *Client) DownloadFile(ctx context.Context, p, local string, resume bool, progress ProgressFunc) (int64, error) {
+	var offset int64
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		if info, err := os.Stat(local); err == nil && info.Mode().IsRegular() {
+			offset = info.Size()
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+	}
+
+	resp, err := c.openDownload(ctx, p, offset)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// The local copy is already complete
+		return offset, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		// Server sent the whole file, start over
+		offset = 0
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	out, err := os.OpenFile(local, flags, 0644)
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.copyBody(out, resp, offset, progress)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return offset + n, err
+}
+
+func (c *Client) openDownload(ctx context.Context, p string, offset int64) (*http.Response, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/files/download", url.Values{"path": {CleanPath(p)}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	return c.do(req)
+}
+
+func (c *Client) copyBody(w io.Writer, resp *http.Response, offset int64, progress ProgressFunc) (int64, error) {
+	var r io.Reader = resp.Body
+	if progress != nil {
+		total := int64(-1)
+		if resp.ContentLength >= 0 {
+			total = offset + resp.ContentLength
+		}
+		r = &progressReader{r: r, done: offset, total: total, fn: progress}
+	}
+	return io.Copy(w, r)
+}
+
+// TransferOptions tune a move or copy. The zero value merges into an
+// existing target.
+type TransferOptions struct {
+	Policy string // "merge", "overwrite" or "skip"
+	// Progress is called while the server runs the transfer as a job
+	Progress func(Job)
+}
+
+// Move moves or renames a file or directory to a new path, waiting for the
+// server to finish if it runs the move as a job
+func (c *Client) Move(ctx context.Context, from, to string, opts *TransferOptions) error {
+	return c.transfer(ctx, "/files/move", from, to, opts)
+}
+
+// Copy copies a file or directory tree to a new path, waiting for the
+// server to finish if it runs the copy as a job
+func (c *Client) Copy(ctx context.Context, from, to string, opts *TransferOptions) error {
+	return c.transfer(ctx, "/files/copy", from, to, opts)
+}
+
+func (c *Client) transfer(ctx context.Context, p, from, to string, opts *TransferOptions) error {
+	if opts == nil {
+		opts = &TransferOptions{}
+	}
+	var resp struct {
+		Job *Job `json:"job"`
+	}
+	req := MoveRequest{SourcePath: from, TargetPath: to, Policy: opts.Policy}
+	if err := c.sendJSON(ctx, http.MethodPost, p, req, &resp); err != nil {
+		return err
+	}
+	if resp.Job == nil {
+		return nil
+	}
+	_, err := c.WaitJob(ctx, resp.Job.ID, opts.Progress)
+	return err
+}
+
+// Batch runs many operations at once. Large batches run as a job on the
+// server; Batch waits for it, calling progress if set. Failed operations
+// are reported in the response, not as an error.
+func (c *Client) Batch(ctx context.Context, req BatchRequest, progress func(Job)) (*BatchResponse, error) {
+	var resp struct {
+		BatchResponse
+		Job *Job `json:"job"`
+	}
+	if err := c.sendJSON(ctx, http.MethodPost, "/batch", req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Job == nil {
+		return &resp.BatchResponse, nil
+	}
+
+	job, err := c.WaitJob(ctx, resp.Job.ID, progress)
+	if job == nil || job.Result == nil {
+		return nil, err
+	}
+	var result BatchResponse
+	if jerr := json.Unmarshal(job.Result, &result); jerr != nil {
+		return nil, jerr
+	}
+	// A batch job with failed operations ends as failed; that's in the result
+	if job.State == JobFailed {
+		err = nil
+	}
+	return &result, err
+}
+
+// Rename gives a file or directory a new name within its directory
+func (c *Client) Rename(ctx context.Context, p, newName string) error {
+	return c.sendJSON(ctx, http.MethodPost, "/files/rename", RenameRequest{OldPath: p, NewName: newName}, nil)
+}
+
+// Mkdir creates a directory including missing parents
+func (c *Client) Mkdir(ctx context.Context, dir string) error {
+	return c.sendJSON(ctx, http.MethodPost, "/directories", MkdirRequest{DirPath: dir}, nil)
+}
+
+// Delete removes a file or a directory with everything in it
+func (c *Client) Delete(ctx context.Context, p string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, "/files", url.Values{"path": {CleanPath(p)}}, nil)
+	if err != nil {
+		return err
+	}
+	return c.doJSON(req, nil)
+}
+
+// Write replaces the content of a text file, creating it if needed
+func (c *Client) Write(ctx context.Context, p, content string) error {
+	_, err := c.WriteText(ctx, p, content, nil)
+	return err
+}
+
+// WriteOptions tune WriteText
+type WriteOptions struct {
+	// Revision, if set, is the revision the content was read at. The write
+	// fails with ErrStale, and the current revision in the *Error, once the
+	// file has changed since.
+	Revision string
+	// Encoding to store the content in; the file's current one by default
+	Encoding string
+}
+
+// WriteText replaces the content of a text file, creating it if needed
+func (c *Client) WriteText(ctx context.Context, p, content string, opts *WriteOptions) (*WriteResult, error) {
+	if opts == nil {
+		opts = &WriteOptions{}
+	}
+	body, err := json.Marshal(WriteRequest{FilePath: p, Content: content, Encoding: opts.Encoding})
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodPut, "/files/content", nil, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if opts.Revision != "" {
+		req.Header.Set("If-Match", `"`+opts.Revision+`"`)
+	}
+	var result WriteResult
+	if err := c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Read returns the content of a text file. from and to select a range of
+// lines, starting at 1; 0 leaves either end open, and both 0 read the whole
+// file.
+func (c *Client) Read(ctx context.Context, p string, from, to int) (*TextFile, error) {
+	query := url.Values{"path": {CleanPath(p)}}
+	if from > 0 {
+		query.Set("from", strconv.Itoa(from))
+	}
+	if to > 0 {
+		query.Set("to", strconv.Itoa(to))
+	}
+	var file TextFile
+	if err := c.getJSON(ctx, "/files/content", query, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// Search finds files whose name contains query below dir
+func (c *Client) Search(ctx context.Context, query, dir string) (*SearchResult, error) {
+	return c.SearchTagged(ctx, query, dir)
+}
+
+// SearchTagged searches below dir for paths carrying every one of the tags
+// whose name contains query, which may be empty
+func (c *Client) SearchTagged(ctx context.Context, query, dir string, tags ...string) (*SearchResult, error) {
+	var result SearchResult
+	params := url.Values{"q": {query}, "path": {dir}}
+	if len(tags) > 0 {
+		params["tag"] = tags
+	}
+	if err := c.getJSON(ctx, "/search", params, &result); err != nil {
+		return nil, err
+	}
+	if result.Results == nil {
+		result.Results = []File{}
+	}
+	return &result, nil
+}
+
+// ToggleStar stars or unstars a file and reports the new state
+func (c *Client) ToggleStar(ctx context.Context, p string) (bool, error) {
+	var result struct {
+		Starred bool `json:"starred"`
+	}
+	err := c.sendJSON(ctx, http.MethodPost, "/stars", StarRequest{FilePath: p}, &result)
+	return result.Starred, err
+}
+
+// Starred lists the starred files, most recent first
+func (c *Client) Starred(ctx context.Context) ([]StarredFile, error) {
+	var result struct {
+		Starred []StarredFile `json:"starred"`
+	}
+	err := c.getJSON(ctx, "/stars", nil, &result)
+	return result.Starred, err
+}
+
+// CleanPath normalizes a remote path to the "a/b/c" form the API expects
+func CleanPath(p string) string {
+	p = path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+	return strings.TrimPrefix(p, "/")
+}
+
+func parentDir(p string) string {
+	dir := path.Dir(p)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// progressReader reports bytes read to a ProgressFunc
+type progressReader struct {
+	r     io.Reader
+	done  int64
+	total int64
+	fn    ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.done += int64(n)
+		p.fn(p.done, p.total)
+	}
+	return n, err
+}
+
+// Processing returns the results of the processors that last ran on a file
+func (c *Client) Processing(ctx context.Context, p string) ([]ProcessingResult, error) {
+	var resp struct {
+		Results []ProcessingResult `json:"results"`
+	}
+	err := c.getJSON(ctx, "/files/processing", url.Values{"path": {CleanPath(p)}}, &resp)
+	return resp.Results, err
+}
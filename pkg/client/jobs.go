@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// jobPollInterval is how often WaitJob asks for the state of a job
+const jobPollInterval = 500 * time.Millisecond
+
+// Jobs lists the background jobs, newest first
+func (c *Client) Jobs(ctx context.Context) ([]Job, error) {
+	var resp struct {
+		Jobs []Job `json:"jobs"`
+	}
+	if err := c.getJSON(ctx, "/jobs", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Jobs, nil
+}
+
+// Job returns the state and progress of a job
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	var resp struct {
+		Job Job `json:"job"`
+	}
+	if err := c.getJSON(ctx, "/jobs/"+id, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Job, nil
+}
+
+// CancelJob stops a job. What it already did stays.
+func (c *Client) CancelJob(ctx context.Context, id string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, "/jobs/"+id, nil, nil)
+	if err != nil {
+		return err
+	}
+	return c.doJSON(req, nil)
+}
+
+// WaitJob polls a job until it ends, calling progress, if set, with every
+// update. A job that fails or is cancelled yields an error. If ctx ends
+// first the job is cancelled.
+func (c *Client) WaitJob(ctx context.Context, id string, progress func(Job)) (*Job, error) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := c.Job(ctx, id)
+		if ctx.Err() != nil {
+			c.CancelJob(context.Background(), id)
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(*job)
+		}
+		switch job.State {
+		case JobDone:
+			return job, nil
+		case JobFailed:
+			return job, errors.New("beamdrop: " + job.Kind + " failed: " + job.Error)
+		case JobCancelled:
+			return job, errors.New("beamdrop: " + job.Kind + " was cancelled")
+		}
+
+		select {
+		case <-ctx.Done():
+			c.CancelJob(context.Background(), id)
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReconcileMetadata queues a job matching stars, tags and other metadata
+// against the files, for files moved or removed outside the server. Its
+// result reports what moved and what was removed.
+func (c *Client) ReconcileMetadata(ctx context.Context) (*Job, error) {
+	var resp struct {
+		Job Job `json:"job"`
+	}
+	if err := c.sendJSON(ctx, http.MethodPost, "/metadata/reconcile", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Job, nil
+}
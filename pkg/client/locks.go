@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// LockTokenHeader carries the tokens of the locks a client holds
+const LockTokenHeader = "X-Lock-Token"
+
+// AdminPasswordHeader carries the admin password that breaks locks
+const AdminPasswordHeader = "X-Admin-Password"
+
+// Lock takes a lock on a file or directory so nobody else can change it
+// until it's released or expires. The client remembers the lock's token and
+// sends it with every later request, so it can still change what it locked.
+func (c *Client) Lock(ctx context.Context, req LockRequest) (*Lock, error) {
+	req.Path = CleanPath(req.Path)
+	var resp struct {
+		Lock  Lock   `json:"lock"`
+		Token string `json:"token"`
+	}
+	if err := c.sendJSON(ctx, http.MethodPost, "/locks", req, &resp); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.locks == nil {
+		c.locks = map[string]string{}
+	}
+	c.locks[resp.Lock.ID] = resp.Token
+	c.mu.Unlock()
+	return &resp.Lock, nil
+}
+
+// RenewLock extends a lock the client holds by ttl seconds, or the server's
+// default when 0
+func (c *Client) RenewLock(ctx context.Context, id string, ttl int) (*Lock, error) {
+	var resp struct {
+		Lock Lock `json:"lock"`
+	}
+	body := struct {
+		TTL int `json:"ttl,omitempty"`
+	}{ttl}
+	if err := c.sendJSON(ctx, http.MethodPost, "/locks/"+id+"/renew", body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Lock, nil
+}
+
+// Unlock releases a lock the client holds
+func (c *Client) Unlock(ctx context.Context, id string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, "/locks/"+id, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := c.doJSON(req, nil); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	delete(c.locks, id)
+	c.mu.Unlock()
+	return nil
+}
+
+// BreakLock releases a lock held by anyone, with the server's admin password
+func (c *Client) BreakLock(ctx context.Context, id, adminPassword string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, "/locks/"+id, nil, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(AdminPasswordHeader, adminPassword)
+	return c.doJSON(req, nil)
+}
+
+// Locks lists the locks in force, those overlapping p unless it's ""
+func (c *Client) Locks(ctx context.Context, p string) ([]Lock, error) {
+	var query url.Values
+	if p != "" {
+		query = url.Values{"path": {CleanPath(p)}}
+	}
+	var resp struct {
+		Locks []Lock `json:"locks"`
+	}
+	if err := c.getJSON(ctx, "/locks", query, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Locks, nil
+}
+
+// lockTokens joins the tokens of the locks the client took
+func (c *Client) lockTokens() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var tokens []string
+	for _, t := range c.locks {
+		// Locks taken while holding another share its token
+		if !slices.Contains(tokens, t) {
+			tokens = append(tokens, t)
+		}
+	}
+	return strings.Join(tokens, ",")
+}
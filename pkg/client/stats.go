@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// Stats returns the server counters
+func (c *Client) Stats(ctx context.Context) (*Stats, error) {
+	var stats Stats
+	if err := c.getJSON(ctx, "/stats", nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Capabilities returns the server mode and the operations it allows
+func (c *Client) Capabilities(ctx context.Context) (*Capabilities, error) {
+	var caps Capabilities
+	if err := c.getJSON(ctx, "/capabilities", nil, &caps); err != nil {
+		return nil, err
+	}
+	return &caps, nil
+}
+
+// Roots returns the shared roots with their options and disk usage
+func (c *Client) Roots(ctx context.Context) (*RootList, error) {
+	var roots RootList
+	if err := c.getJSON(ctx, "/roots", nil, &roots); err != nil {
+		return nil, err
+	}
+	return &roots, nil
+}
+
+// Health checks that the server is alive
+func (c *Client) Health(ctx context.Context) error {
+	return c.getJSON(ctx, "/health", nil, nil)
+}
+
+// Ready returns the readiness report. A server that isn't ready yields an
+// *Error with status 503.
+func (c *Client) Ready(ctx context.Context) (*Readiness, error) {
+	var r Readiness
+	if err := c.getJSON(ctx, "/ready", nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// WatchStats subscribes to the stats WebSocket and calls fn for every
+// update until ctx is cancelled, the connection drops or fn returns an error
+func (c *Client) WatchStats(ctx context.Context, fn func(ExtendedStats) error) error {
+	u := *c.base
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	u.Path = strings.TrimRight(u.Path, "/") + APIPrefix + "/ws/stats"
+
+	header := http.Header{}
+	if c.password != "" {
+		header.Set(PasswordHeader, c.password)
+	}
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if resp != nil {
+			return errorFromResponse(&http.Request{Method: http.MethodGet, URL: &u}, resp)
+		}
+		return err
+	}
+	defer conn.Close()
+
+	// Unblock ReadJSON when the context is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		var stats ExtendedStats
+		if err := conn.ReadJSON(&stats); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if err := fn(stats); err != nil {
+			return err
+		}
+	}
+}
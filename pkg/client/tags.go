@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// Tags lists the tags with how many paths carry each
+func (c *Client) Tags(ctx context.Context) ([]Tag, error) {
+	var resp struct {
+		Tags []Tag `json:"tags"`
+	}
+	err := c.getJSON(ctx, "/tags", nil, &resp)
+	return resp.Tags, err
+}
+
+// CreateTag creates a tag. Name is required.
+func (c *Client) CreateTag(ctx context.Context, req TagRequest) (*Tag, error) {
+	return c.sendTag(ctx, http.MethodPost, "/tags", req)
+}
+
+// UpdateTag renames a tag or changes its color or description
+func (c *Client) UpdateTag(ctx context.Context, id uint, req TagRequest) (*Tag, error) {
+	return c.sendTag(ctx, http.MethodPatch, tagPath(id), req)
+}
+
+// DeleteTag deletes a tag, removing it from every path
+func (c *Client) DeleteTag(ctx context.Context, id uint) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, tagPath(id), nil, nil)
+	if err != nil {
+		return err
+	}
+	return c.doJSON(req, nil)
+}
+
+// TagPaths adds the tags named in add to every one of the paths and removes
+// those named in remove
+func (c *Client) TagPaths(ctx context.Context, paths, add, remove []string) (*TagAssignResult, error) {
+	body := struct {
+		Paths  []string `json:"paths"`
+		Add    []string `json:"add,omitempty"`
+		Remove []string `json:"remove,omitempty"`
+	}{cleanPaths(paths), add, remove}
+	var result TagAssignResult
+	if err := c.sendJSON(ctx, http.MethodPost, "/tags/assign", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Collections lists the collections with how many paths each holds
+func (c *Client) Collections(ctx context.Context) ([]Collection, error) {
+	var resp struct {
+		Collections []Collection `json:"collections"`
+	}
+	err := c.getJSON(ctx, "/collections", nil, &resp)
+	return resp.Collections, err
+}
+
+// Collection lists what a collection holds
+func (c *Client) Collection(ctx context.Context, id uint) (*CollectionContent, error) {
+	var content CollectionContent
+	if err := c.getJSON(ctx, collectionPath(id), nil, &content); err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
+
+// CreateCollection creates an empty collection. Name is required.
+func (c *Client) CreateCollection(ctx context.Context, req CollectionRequest) (*Collection, error) {
+	return c.sendCollection(ctx, http.MethodPost, "/collections", req)
+}
+
+// UpdateCollection renames a collection or changes its description
+func (c *Client) UpdateCollection(ctx context.Context, id uint, req CollectionRequest) (*Collection, error) {
+	return c.sendCollection(ctx, http.MethodPatch, collectionPath(id), req)
+}
+
+// DeleteCollection deletes a collection; the files it holds stay
+func (c *Client) DeleteCollection(ctx context.Context, id uint) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, collectionPath(id), nil, nil)
+	if err != nil {
+		return err
+	}
+	return c.doJSON(req, nil)
+}
+
+// UpdateCollectionItems adds paths to a collection and removes them from
+// it, returning how many were added and removed
+func (c *Client) UpdateCollectionItems(ctx context.Context, id uint, add, remove []string) (added, removed int64, err error) {
+	body := struct {
+		Add    []string `json:"add,omitempty"`
+		Remove []string `json:"remove,omitempty"`
+	}{cleanPaths(add), cleanPaths(remove)}
+	var result struct {
+		Added   int64 `json:"added"`
+		Removed int64 `json:"removed"`
+	}
+	err = c.sendJSON(ctx, http.MethodPost, collectionPath(id)+"/items", body, &result)
+	return result.Added, result.Removed, err
+}
+
+func (c *Client) sendTag(ctx context.Context, method, p string, req TagRequest) (*Tag, error) {
+	var resp struct {
+		Tag Tag `json:"tag"`
+	}
+	if err := c.sendJSON(ctx, method, p, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Tag, nil
+}
+
+func (c *Client) sendCollection(ctx context.Context, method, p string, req CollectionRequest) (*Collection, error) {
+	var resp struct {
+		Collection Collection `json:"collection"`
+	}
+	if err := c.sendJSON(ctx, method, p, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Collection, nil
+}
+
+func tagPath(id uint) string {
+	return "/tags/" + strconv.FormatUint(uint64(id), 10)
+}
+
+func collectionPath(id uint) string {
+	return "/collections/" + strconv.FormatUint(uint64(id), 10)
+}
+
+func cleanPaths(paths []string) []string {
+	if paths == nil {
+		return nil
+	}
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		out[i] = CleanPath(p)
+	}
+	return out
+}
@@ -0,0 +1,415 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/system"
+)
+
+// File is an entry of a directory listing or search result
+type File struct {
+	Name      string `json:"name"`
+	Size      string `json:"size"` // human readable, e.g. "1.2 MB"
+	IsDir     bool   `json:"isDir"`
+	ModTime   string `json:"modTime"`
+	Path      string `json:"path"`
+	IsStarred bool   `json:"isStarred"`
+
+	Type        string    `json:"type"` // "file", "dir", "symlink" or "other"
+	Bytes       int64     `json:"bytes"`
+	Modified    time.Time `json:"modified"`
+	MimeType    string    `json:"mimeType,omitempty"`
+	Mode        string    `json:"mode"`
+	Permissions string    `json:"permissions"`
+	Hidden      bool      `json:"hidden"`
+	LinkTarget  string    `json:"linkTarget,omitempty"`
+	Children    *int      `json:"children,omitempty"`
+
+	// Lock is the lock on the entry or a directory above it, if any
+	Lock *Lock `json:"lock,omitempty"`
+	// Tags are the names of the tags on the entry
+	Tags []string `json:"tags,omitempty"`
+	// Comments counts the comments on the entry
+	Comments int `json:"comments,omitempty"`
+	// Scan is the antivirus verdict from the upload, clean or error; empty
+	// if the file wasn't scanned
+	Scan string `json:"scan,omitempty"`
+}
+
+// Listing is one page of a directory listing
+type Listing struct {
+	Path       string `json:"path"`
+	Entries    []File `json:"entries"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// ListOptions sorts, filters and pages a listing. The zero value lists
+// everything in natural name order.
+type ListOptions struct {
+	Sort       string // "name", "size", "mtime" or "type"
+	Desc       bool
+	HideHidden bool
+	Limit      int
+	Cursor     string
+}
+
+// MoveRequest is the body of a move or copy
+type MoveRequest struct {
+	SourcePath string `json:"sourcePath"`
+	TargetPath string `json:"targetPath"`
+	Policy     string `json:"policy,omitempty"`
+	Background bool   `json:"background,omitempty"`
+}
+
+// RenameRequest is the body of a rename
+type RenameRequest struct {
+	OldPath string `json:"oldPath"`
+	NewName string `json:"newName"`
+}
+
+// MkdirRequest is the body of a mkdir
+type MkdirRequest struct {
+	DirPath string `json:"dirPath"`
+}
+
+// WriteRequest is the body of a write
+type WriteRequest struct {
+	FilePath string `json:"filePath"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// WriteResult is returned by WriteText
+type WriteResult struct {
+	FilePath string `json:"filePath"`
+	Revision string `json:"revision"`
+	Encoding string `json:"encoding"`
+}
+
+// TextFile is the content of a text file, or a range of its lines
+type TextFile struct {
+	Path       string    `json:"path"`
+	Content    string    `json:"content"`
+	Encoding   string    `json:"encoding"`
+	LineEnding string    `json:"lineEnding"`
+	Revision   string    `json:"revision"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"modTime"`
+	Lines      int       `json:"lines"`
+	From       int       `json:"from,omitempty"`
+	To         int       `json:"to,omitempty"`
+	Partial    bool      `json:"partial,omitempty"`
+}
+
+// StarRequest is the body of a star toggle
+type StarRequest struct {
+	FilePath string `json:"filePath"`
+}
+
+// SearchResult is returned by Search
+type SearchResult struct {
+	Query   string   `json:"query"`
+	Tags    []string `json:"tags,omitempty"`
+	Path    string   `json:"path"`
+	Results []File   `json:"results"`
+	Count   int      `json:"count"`
+}
+
+// StarredFile is an entry of the starred files list
+type StarredFile struct {
+	FilePath  string `json:"filePath"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// Statuses of an UploadedFile
+const (
+	UploadCreated     = "created"
+	UploadOverwritten = "overwritten"
+	UploadRenamed     = "renamed"
+	UploadSkipped     = "skipped"
+	UploadFailed      = "failed"
+)
+
+// UploadedFile is the outcome for one file of an upload
+type UploadedFile struct {
+	Name   string `json:"name"`
+	Path   string `json:"path,omitempty"`
+	Status string `json:"status"`
+	Bytes  int64  `json:"bytes"`
+	Error  string `json:"error,omitempty"`
+	// Scan is clean, infected or error when the server scans uploads
+	Scan string `json:"scan,omitempty"`
+}
+
+// UploadResult is returned by Upload
+type UploadResult struct {
+	Message  string         `json:"message"`
+	File     string         `json:"file"`
+	Files    []UploadedFile `json:"files"`
+	Uploaded int            `json:"uploaded"`
+	Skipped  int            `json:"skipped"`
+	Failed   int            `json:"failed"`
+	// Processing is the job running the server's processors on the files,
+	// if it has any
+	Processing *Job `json:"processing,omitempty"`
+}
+
+// ProcessingResult is what a server-side processor made of an uploaded file
+type ProcessingResult struct {
+	Processor  string            `json:"processor"`
+	Status     string            `json:"status"` // done, skipped or failed
+	Output     map[string]string `json:"output,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Action     string            `json:"action,omitempty"` // deleted or quarantined after a failure
+	DurationMS int64             `json:"durationMs"`
+	CreatedAt  time.Time         `json:"createdAt"`
+}
+
+// Stats are the server counters returned by /stats
+type Stats struct {
+	ID        uint      `json:"id"`
+	Downloads int       `json:"downloads"`
+	Requests  int       `json:"requests"`
+	Uploads   int       `json:"uploads"`
+	StartTime time.Time `json:"startTime"`
+}
+
+// ExtendedStats are pushed over the stats WebSocket
+type ExtendedStats struct {
+	Downloads int                `json:"downloads"`
+	Requests  int                `json:"requests"`
+	Uploads   int                `json:"uploads"`
+	StartTime time.Time          `json:"startTime"`
+	System    system.SystemStats `json:"system"`
+	// Roots holds the disk usage of each named root
+	Roots map[string]system.DiskStats `json:"roots,omitempty"`
+	// Jobs are the queued and running background jobs
+	Jobs []Job `json:"jobs"`
+	// Comments are the comment events since the last update
+	Comments []CommentEvent `json:"comments,omitempty"`
+}
+
+// Capabilities is the server mode and what it allows
+type Capabilities struct {
+	Version     string `json:"version"`
+	Mode        string `json:"mode"`
+	Read        bool   `json:"read"`
+	Upload      bool   `json:"upload"`
+	Write       bool   `json:"write"`
+	DropFolders string `json:"dropFolders,omitempty"`
+	Virtual     bool   `json:"virtual"`
+}
+
+// Root is a shared root as returned by Roots
+type Root struct {
+	Name       string           `json:"name"`
+	ReadOnly   bool             `json:"readOnly"`
+	UploadOnly bool             `json:"uploadOnly"`
+	Disk       system.DiskStats `json:"disk"`
+}
+
+// RootList is returned by Roots. Virtual is set when the top level lists
+// named roots.
+type RootList struct {
+	Virtual bool   `json:"virtual"`
+	Roots   []Root `json:"roots"`
+}
+
+// Readiness is returned by Ready
+type Readiness struct {
+	Status  string            `json:"status"`
+	Service string            `json:"service"`
+	Checks  map[string]string `json:"checks"`
+}
+
+// ProgressFunc is called while data is transferred with the number of bytes
+// done so far and the total, which is -1 when unknown
+type ProgressFunc func(transferred, total int64)
+
+// Batch operations
+const (
+	BatchMove   = "move"
+	BatchCopy   = "copy"
+	BatchRename = "rename"
+	BatchDelete = "delete"
+	BatchStar   = "star"
+	BatchUnstar = "unstar"
+)
+
+// BatchOperation is one operation of a batch. Path is the source of a move
+// or copy and the entry every other operation acts on.
+type BatchOperation struct {
+	Op         string `json:"op"`
+	Path       string `json:"path"`
+	TargetPath string `json:"targetPath,omitempty"`
+	NewName    string `json:"newName,omitempty"`
+	Policy     string `json:"policy,omitempty"`
+}
+
+// BatchRequest is the body of a batch
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+	// Mode is "stop-on-error" (default) or "best-effort"
+	Mode       string `json:"mode,omitempty"`
+	Background bool   `json:"background,omitempty"`
+}
+
+// BatchResult is the outcome of one operation of a batch
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Path   string `json:"path"`
+	Status string `json:"status"` // done, failed, skipped or invalid
+	Error  string `json:"error,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+// BatchResponse is the outcome of a batch
+type BatchResponse struct {
+	Message string        `json:"message"`
+	Done    int           `json:"done"`
+	Failed  int           `json:"failed"`
+	Skipped int           `json:"skipped"`
+	Results []BatchResult `json:"results"`
+}
+
+// Job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job is a copy or move the server runs in the background
+type Job struct {
+	ID       string      `json:"id"`
+	Kind     string      `json:"kind"`
+	Source   string      `json:"source"`
+	Target   string      `json:"target"`
+	State    string      `json:"state"`
+	Progress JobProgress `json:"progress"`
+	Error    string      `json:"error,omitempty"`
+	// Result is set by kinds that return something, like batches
+	Result   json.RawMessage `json:"result,omitempty"`
+	Attempts int             `json:"attempts"`
+	Created  time.Time       `json:"created"`
+	Started  *time.Time      `json:"started,omitempty"`
+	Finished *time.Time      `json:"finished,omitempty"`
+}
+
+// JobProgress counts what a job did and, once it walked the source, has to do
+type JobProgress struct {
+	Files      int64  `json:"files"`
+	Bytes      int64  `json:"bytes"`
+	Skipped    int64  `json:"skipped"`
+	TotalFiles int64  `json:"totalFiles"`
+	TotalBytes int64  `json:"totalBytes"`
+	Current    string `json:"current,omitempty"`
+}
+
+// Lock is an advisory lock on a file or directory, covering everything
+// below a directory
+type Lock struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Owner     string    `json:"owner"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	RenewedAt time.Time `json:"renewedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// LockRequest is the body of a lock
+type LockRequest struct {
+	Path   string `json:"path"`
+	Owner  string `json:"owner,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	TTL    int    `json:"ttl,omitempty"`
+}
+
+// Tag is a user-defined label files and directories can carry
+type Tag struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Color       string    `json:"color,omitempty"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Files is how many paths carry the tag
+	Files int64 `json:"files"`
+}
+
+// TagRequest creates or changes a tag. Nil fields are left as they are.
+type TagRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Color       *string `json:"color,omitempty"` // "#3a7" or "#33aa77", "" for none
+	Description *string `json:"description,omitempty"`
+}
+
+// TagAssignResult is returned by TagPaths
+type TagAssignResult struct {
+	Paths   int   `json:"paths"`
+	Added   int64 `json:"added"`
+	Removed int64 `json:"removed"`
+}
+
+// Collection is a named virtual folder holding paths from anywhere
+type Collection struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Items is how many paths the collection holds
+	Items int64 `json:"items"`
+}
+
+// CollectionRequest creates or changes a collection. Nil fields are left as
+// they are.
+type CollectionRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+// CollectionContent is what a collection holds. Missing are the paths in it
+// that no longer exist.
+type CollectionContent struct {
+	Collection Collection `json:"collection"`
+	Entries    []File     `json:"entries"`
+	Missing    []string   `json:"missing"`
+}
+
+// Comment is a note on a file or directory, or a reply to another one
+type Comment struct {
+	ID        uint       `json:"id"`
+	Path      string     `json:"path"`
+	ParentID  *uint      `json:"parentId,omitempty"`
+	Author    string     `json:"author"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"createdAt"`
+	EditedAt  *time.Time `json:"editedAt,omitempty"`
+	// Deleted is set on a deleted comment kept for its replies
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// CommentThread is a comment with the replies to it
+type CommentThread struct {
+	Comment
+	Replies []CommentThread `json:"replies,omitempty"`
+}
+
+// Comment events
+const (
+	CommentCreated = "created"
+	CommentUpdated = "updated"
+	CommentDeleted = "deleted"
+)
+
+// CommentEvent is a comment added, edited or deleted, as pushed over the
+// stats WebSocket
+type CommentEvent struct {
+	Event   string  `json:"event"`
+	Comment Comment `json:"comment"`
+}
@@ -0,0 +1,174 @@
+// Package contentpolicy decides whether an upload is accepted by its name,
+// the type its content really is and its size, following the configured
+// upload policies
+package contentpolicy
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/sniff"
+)
+
+// Violation explains why a file is refused
+type Violation struct {
+	Reason string
+	// Type is what the content sniffed as
+	Type string
+}
+
+func (v *Violation) Error() string {
+	return v.Reason
+}
+
+// limit is the largest size of files matching a type pattern
+type limit struct {
+	pattern string
+	size    int64
+	text    string // as configured, e.g. "20MB"
+}
+
+// Policy is a compiled upload policy. A nil Policy accepts everything.
+type Policy struct {
+	allowExt   []string
+	denyExt    []string
+	allowTypes []string
+	denyTypes  []string
+	limits     []limit // most specific pattern first
+	matchExt   bool
+}
+
+// New compiles a policy, which must be valid. It returns nil for a policy
+// that accepts everything.
+func New(c config.UploadPolicy) *Policy {
+	if c.IsZero() {
+		return nil
+	}
+	p := &Policy{
+		allowExt:   lower(c.AllowExtensions),
+		denyExt:    lower(c.DenyExtensions),
+		allowTypes: lower(c.AllowTypes),
+		denyTypes:  lower(c.DenyTypes),
+		matchExt:   c.MatchExtension,
+	}
+	for pattern, text := range c.MaxSize {
+		size, _ := config.ParseSize(text)
+		p.limits = append(p.limits, limit{pattern: strings.ToLower(pattern), size: size, text: text})
+	}
+	sort.Slice(p.limits, func(i, j int) bool {
+		return specificity(p.limits[i].pattern) > specificity(p.limits[j].pattern)
+	})
+	return p
+}
+
+// Check decides on a file named name of size bytes whose content starts
+// with head, at least sniff.Size bytes of it unless it's shorter. It
+// returns nil if the file is accepted.
+func (p *Policy) Check(name string, size int64, head []byte) *Violation {
+	if p == nil {
+		return nil
+	}
+	// Windows drops trailing dots and spaces, "evil.exe." is evil.exe
+	base := strings.ToLower(strings.TrimRight(path.Base(name), ". "))
+	t := sniff.Type(head)
+
+	if ext, ok := matchExt(base, p.denyExt); ok {
+		return &Violation{Reason: "files ending in " + ext + " are not allowed", Type: t}
+	}
+	if len(p.allowExt) > 0 {
+		if _, ok := matchExt(base, p.allowExt); !ok {
+			return &Violation{Reason: "only files ending in " + strings.Join(p.allowExt, ", ") + " are allowed", Type: t}
+		}
+	}
+	if matchType(t, p.denyTypes...) {
+		return &Violation{Reason: "content of type " + t + " is not allowed", Type: t}
+	}
+	if len(p.allowTypes) > 0 {
+		if !matchType(t, p.allowTypes...) {
+			return &Violation{Reason: "content of type " + t + " is not allowed, only " + strings.Join(p.allowTypes, ", "), Type: t}
+		}
+	}
+	if p.matchExt && sniff.Mismatch(base, t) {
+		return &Violation{Reason: fmt.Sprintf("content of type %s doesn't match the %s extension", t, path.Ext(base)), Type: t}
+	}
+	for _, l := range p.limits {
+		if l.pattern != "*" && !matchType(t, l.pattern) {
+			continue
+		}
+		if size > l.size {
+			return &Violation{Reason: fmt.Sprintf("files of type %s can be at most %s", t, l.text), Type: t}
+		}
+		break
+	}
+	return nil
+}
+
+// Set holds the policy of every root
+type Set struct {
+	server *Policy
+	roots  map[string]*Policy
+}
+
+// NewSet compiles the server's upload policy and those of the roots that
+// have their own
+func NewSet(server config.UploadPolicy, roots []config.Root) *Set {
+	s := &Set{server: New(server), roots: make(map[string]*Policy)}
+	for _, r := range roots {
+		if r.UploadPolicy != nil {
+			s.roots[r.Name] = New(*r.UploadPolicy)
+		}
+	}
+	return s
+}
+
+// For returns the policy of the named root
+func (s *Set) For(root string) *Policy {
+	if p, ok := s.roots[root]; ok {
+		return p
+	}
+	return s.server
+}
+
+// matchExt returns the extension of the list name ends in
+func matchExt(name string, exts []string) (string, bool) {
+	for _, ext := range exts {
+		if strings.HasSuffix(name, ext) {
+			return ext, true
+		}
+	}
+	return "", false
+}
+
+// matchType reports whether t matches a pattern of the list, like
+// image/png or image/*
+func matchType(t string, patterns ...string) bool {
+	major, _, _ := strings.Cut(t, "/")
+	for _, pattern := range patterns {
+		if pattern == t || pattern == major+"/*" {
+			return true
+		}
+	}
+	return false
+}
+
+// specificity ranks image/png over image/* over *
+func specificity(pattern string) int {
+	switch {
+	case pattern == "*":
+		return 0
+	case strings.HasSuffix(pattern, "/*"):
+		return 1
+	}
+	return 2
+}
+
+func lower(list []string) []string {
+	out := make([]string, len(list))
+	for i, s := range list {
+		out[i] = strings.ToLower(s)
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package contentpolicy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/sniff"
+)
+
+var (
+	exe  = []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff\x00\x00" + strings.Repeat("\x00", 48))
+	jpeg = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+	png  = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	pdf  = []byte("%PDF-1.7\n")
+	text = []byte("hello, world\n")
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy config.UploadPolicy
+		file   string
+		size   int64
+		head   []byte
+		reason string // part of the reason, "" if accepted
+	}{
+		// The request's core case: a program named like a photo
+		{"exe renamed to jpg", config.UploadPolicy{MatchExtension: true}, "photo.jpg", 64, exe, "doesn't match the .jpg extension"},
+		{"exe renamed to jpg, denied type", config.UploadPolicy{DenyTypes: []string{sniff.Windows}}, "photo.jpg", 64, exe, "content of type " + sniff.Windows},
+		{"exe renamed to jpg, images only", config.UploadPolicy{AllowTypes: []string{"image/*"}}, "photo.jpg", 64, exe, "only image/*"},
+		{"real jpg", config.UploadPolicy{MatchExtension: true, AllowTypes: []string{"image/*"}}, "photo.jpg", 64, jpeg, ""},
+		{"png named jpg", config.UploadPolicy{MatchExtension: true}, "photo.jpg", 64, png, ""},
+		{"real exe", config.UploadPolicy{MatchExtension: true}, "setup.exe", 64, exe, ""},
+
+		{"denied extension", config.UploadPolicy{DenyExtensions: []string{".exe"}}, "setup.EXE", 64, exe, "ending in .exe"},
+		{"trailing dot", config.UploadPolicy{DenyExtensions: []string{".exe"}}, "setup.exe.", 64, exe, "ending in .exe"},
+		{"trailing space", config.UploadPolicy{DenyExtensions: []string{".exe"}}, "setup.exe ", 64, exe, "ending in .exe"},
+		{"allowed extension", config.UploadPolicy{AllowExtensions: []string{".pdf", ".tar.gz"}}, "a.tar.gz", 64, text, ""},
+		{"not an allowed extension", config.UploadPolicy{AllowExtensions: []string{".pdf"}}, "a.txt", 64, text, "only files ending in .pdf"},
+
+		{"size within limit", config.UploadPolicy{MaxSize: map[string]string{"image/*": "1KB"}}, "a.png", 1024, png, ""},
+		{"size over limit", config.UploadPolicy{MaxSize: map[string]string{"image/*": "1KB"}}, "a.png", 1025, png, "at most 1KB"},
+		{"specific limit first", config.UploadPolicy{MaxSize: map[string]string{"*": "1KB", "image/*": "2KB", "image/png": "3KB"}}, "a.png", 3000, png, ""},
+		{"catch-all limit", config.UploadPolicy{MaxSize: map[string]string{"*": "1KB", "image/*": "2KB"}}, "a.pdf", 2000, pdf, "at most 1KB"},
+		{"other types unlimited", config.UploadPolicy{MaxSize: map[string]string{"image/*": "1KB"}}, "a.pdf", 1 << 30, pdf, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New(tt.policy).Check(tt.file, tt.size, tt.head)
+			switch {
+			case tt.reason == "" && v != nil:
+				t.Errorf("refused: %s", v.Reason)
+			case tt.reason != "" && v == nil:
+				t.Errorf("accepted, want %q", tt.reason)
+			case v != nil && !strings.Contains(v.Reason, tt.reason):
+				t.Errorf("reason %q, want it to contain %q", v.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestZeroPolicyAcceptsEverything(t *testing.T) {
+	p := New(config.UploadPolicy{})
+	if p != nil {
+		t.Fatal("an empty policy compiled to a non-nil one")
+	}
+	if v := p.Check("photo.jpg", 1<<40, exe); v != nil {
+		t.Errorf("a nil policy refused a file: %s", v.Reason)
+	}
+}
+
+func TestSet(t *testing.T) {
+	server := config.UploadPolicy{DenyExtensions: []string{".exe"}}
+	own := config.UploadPolicy{AllowTypes: []string{"image/*"}}
+	s := NewSet(server, []config.Root{{Name: "photos", UploadPolicy: &own}, {Name: "docs"}})
+
+	if v := s.For("photos").Check("a.pdf", 64, pdf); v == nil {
+		t.Error("photos accepted a PDF")
+	}
+	if v := s.For("photos").Check("a.exe", 64, jpeg); v != nil {
+		t.Errorf("the server's policy applied to a root with its own: %s", v.Reason)
+	}
+	if v := s.For("docs").Check("a.exe", 64, exe); v == nil {
+		t.Error("a root without a policy of its own didn't get the server's")
+	}
+	if v := s.For("").Check("a.exe", 64, exe); v == nil {
+		t.Error("the single root didn't get the server's policy")
+	}
+}
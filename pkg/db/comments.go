@@ -0,0 +1,144 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// Comment is a note on a file or directory, or a reply to another one
+type Comment struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Path     string `gorm:"column:path;index;not null" json:"path"`
+	ParentID *uint  `gorm:"column:parent_id;index" json:"parentId,omitempty"`
+	Author   string `gorm:"column:author" json:"author"`
+	Body     string `gorm:"column:body" json:"body"`
+	// Token lets whoever wrote the comment edit or delete it
+	Token     string     `gorm:"column:token" json:"-"`
+	CreatedAt time.Time  `gorm:"column:created_at" json:"createdAt"`
+	EditedAt  *time.Time `gorm:"column:edited_at" json:"editedAt,omitempty"`
+	// Deleted is set on a deleted comment kept for its replies
+	Deleted bool `gorm:"column:deleted" json:"deleted,omitempty"`
+}
+
+func (Comment) TableName() string {
+	return "comments"
+}
+
+// GetComments retrieves the comments on a path, oldest first
+func GetComments(p string) ([]Comment, error) {
+	var comments []Comment
+	err := GetDB().Where("path = ?", p).Order("id").Find(&comments).Error
+	if err != nil {
+		logger.Error("failed to get comments on %s: %v", p, err)
+	}
+	return comments, err
+}
+
+// GetComment retrieves a comment by ID
+func GetComment(id uint) (Comment, error) {
+	var c Comment
+	err := GetDB().First(&c, id).Error
+	return c, err
+}
+
+// CountComments counts the comments on each of the paths, leaving out
+// deleted ones
+func CountComments(paths []string) (map[string]int, error) {
+	var rows []struct {
+		Path string
+		N    int
+	}
+	err := GetDB().Model(&Comment{}).
+		Select("path, COUNT(*) AS n").
+		Where("path IN ? AND deleted = ?", paths, false).
+		Group("path").
+		Scan(&rows).Error
+	if err != nil {
+		logger.Error("failed to count comments: %v", err)
+		return nil, err
+	}
+	counts := make(map[string]int, len(rows))
+	for _, r := range rows {
+		counts[r.Path] = r.N
+	}
+	return counts, nil
+}
+
+// AddComment saves a new comment
+func AddComment(c *Comment) error {
+	if err := GetDB().Create(c).Error; err != nil {
+		logger.Error("failed to add comment on %s: %v", c.Path, err)
+		return err
+	}
+	return nil
+}
+
+// EditComment replaces the body of a comment
+func EditComment(id uint, body string) (Comment, error) {
+	now := time.Now()
+	res := GetDB().Model(&Comment{}).Where("id = ? AND deleted = ?", id, false).Updates(map[string]any{"body": body, "edited_at": now})
+	if res.Error != nil {
+		logger.Error("failed to edit comment %d: %v", id, res.Error)
+		return Comment{}, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return Comment{}, gorm.ErrRecordNotFound
+	}
+	return GetComment(id)
+}
+
+// DeleteComment removes a comment. One with replies is kept, emptied and
+// marked deleted, so the thread stays whole, until its last reply goes. The
+// returned comment is what remains, or the removed one.
+func DeleteComment(id uint) (Comment, error) {
+	var c Comment
+	err := GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&c, id).Error; err != nil {
+			return err
+		}
+		n, err := countReplies(tx, id)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			c.Body, c.Deleted = "", true
+			return tx.Model(&Comment{}).Where("id = ?", id).Updates(map[string]any{"body": "", "deleted": true}).Error
+		}
+		if err := tx.Delete(&Comment{}, id).Error; err != nil {
+			return err
+		}
+
+		// Deleted comments left without replies go too
+		for parent := c.ParentID; parent != nil; {
+			var p Comment
+			if err := tx.First(&p, *parent).Error; err != nil {
+				return err
+			}
+			n, err := countReplies(tx, p.ID)
+			if err != nil {
+				return err
+			}
+			if !p.Deleted || n > 0 {
+				break
+			}
+			if err := tx.Delete(&Comment{}, p.ID).Error; err != nil {
+				return err
+			}
+			parent = p.ParentID
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Error("failed to delete comment %d: %v", id, err)
+	}
+	return c, err
+}
+
+func countReplies(tx *gorm.DB, id uint) (int64, error) {
+	var n int64
+	err := tx.Model(&Comment{}).Where("parent_id = ?", id).Count(&n).Error
+	return n, err
+}
@@ -14,19 +14,30 @@ var (
 	once sync.Once
 )
 
-func init() {
-	once.Do(openDB)
+// Init opens the database at config.DBPath. It must be called after the
+// data directory has been resolved, since the path can be relocated.
+func Init() error {
+	var err error
+	once.Do(func() {
+		err = openDB()
+	})
+	if err != nil {
+		return err
+	}
 	CreateStatsTable()
+	return nil
 }
 
-func openDB() {
+func openDB() error {
 	var dbPath string = config.DBPath
-	// logger.Info("Opening database at: %s", dbPath)
+	logger.Debug("Opening database at: %s", dbPath)
 	var err error
 	db, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
 	if err != nil {
 		logger.Error("failed to connect database: %v", err)
+		return err
 	}
+	return nil
 }
 
 func GetDB() *gorm.DB {
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+)
+
+// Job is a background job as stored, so it outlives a restart
+type Job struct {
+	ID     string `gorm:"primaryKey" json:"id"`
+	Kind   string `gorm:"column:kind;not null" json:"kind"`
+	Source string `gorm:"column:source" json:"source"`
+	Target string `gorm:"column:target" json:"target"`
+	// Params holds the JSON encoded settings of the job's kind
+	Params string `gorm:"column:params" json:"params"`
+	// Result holds the JSON encoded outcome, for kinds that have one
+	Result   string `gorm:"column:result" json:"result"`
+	State    string `gorm:"column:state;index;not null" json:"state"`
+	Attempts int    `gorm:"column:attempts;default:0" json:"attempts"`
+	Error    string `gorm:"column:error" json:"error"`
+
+	Files      int64 `gorm:"column:files;default:0" json:"files"`
+	Bytes      int64 `gorm:"column:bytes;default:0" json:"bytes"`
+	Skipped    int64 `gorm:"column:skipped;default:0" json:"skipped"`
+	TotalFiles int64 `gorm:"column:total_files;default:0" json:"totalFiles"`
+	TotalBytes int64 `gorm:"column:total_bytes;default:0" json:"totalBytes"`
+
+	CreatedAt  time.Time  `gorm:"column:created_at;index" json:"createdAt"`
+	StartedAt  *time.Time `gorm:"column:started_at" json:"startedAt"`
+	FinishedAt *time.Time `gorm:"column:finished_at" json:"finishedAt"`
+}
+
+func (Job) TableName() string {
+	return "jobs"
+}
+
+// SaveJob inserts or updates a job
+func SaveJob(job *Job) error {
+	if err := GetDB().Save(job).Error; err != nil {
+		logger.Error("failed to save job %s: %v", job.ID, err)
+		return err
+	}
+	return nil
+}
+
+// GetJob retrieves a job by ID
+func GetJob(id string) (Job, error) {
+	var job Job
+	err := GetDB().Where("id = ?", id).First(&job).Error
+	return job, err
+}
+
+// GetJobs retrieves the jobs in any of the given states, or every job if
+// none are given, newest first
+func GetJobs(states ...string) ([]Job, error) {
+	q := GetDB().Order("created_at DESC")
+	if len(states) > 0 {
+		q = q.Where("state IN ?", states)
+	}
+	var jobs []Job
+	if err := q.Find(&jobs).Error; err != nil {
+		logger.Error("failed to get jobs: %v", err)
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// PruneJobs deletes all but the newest keep jobs in the given states
+func PruneJobs(keep int, states ...string) error {
+	db := GetDB()
+	keepIDs := db.Model(&Job{}).Select("id").Where("state IN ?", states).Order("created_at DESC").Limit(keep)
+	err := db.Where("state IN ? AND id NOT IN (?)", states, keepIDs).Delete(&Job{}).Error
+	if err != nil {
+		logger.Error("failed to prune jobs: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// Lock is an advisory lock on a file or directory. It covers everything
+// below a directory, and lapses at ExpiresAt unless renewed.
+type Lock struct {
+	ID     string `gorm:"primaryKey" json:"id"`
+	Path   string `gorm:"column:path;index;not null" json:"path"`
+	Owner  string `gorm:"column:owner" json:"owner"`
+	Reason string `gorm:"column:reason" json:"reason,omitempty"`
+	// Token proves ownership; only the client that took the lock knows it
+	Token string `gorm:"column:token;not null" json:"-"`
+
+	CreatedAt time.Time `gorm:"column:created_at" json:"createdAt"`
+	RenewedAt time.Time `gorm:"column:renewed_at" json:"renewedAt"`
+	ExpiresAt time.Time `gorm:"column:expires_at;index" json:"expiresAt"`
+}
+
+func (Lock) TableName() string {
+	return "locks"
+}
+
+// Covers reports whether the lock overlaps path: it is on the path, on a
+// directory above it, or on something below it
+func (l Lock) Covers(path string) bool {
+	return l.Path == path || strings.HasPrefix(path, l.Path+"/") || strings.HasPrefix(l.Path, path+"/")
+}
+
+// lockMu keeps the conflict check and insert of AcquireLock together
+var lockMu sync.Mutex
+
+// GetLocks retrieves the locks that haven't expired, oldest first
+func GetLocks() ([]Lock, error) {
+	var locks []Lock
+	err := GetDB().Where("expires_at > ?", time.Now()).Order("created_at").Find(&locks).Error
+	if err != nil {
+		logger.Error("failed to get locks: %v", err)
+		return nil, err
+	}
+	return locks, nil
+}
+
+// GetLock retrieves a lock that hasn't expired by ID
+func GetLock(id string) (Lock, error) {
+	var lock Lock
+	err := GetDB().Where("id = ? AND expires_at > ?", id, time.Now()).First(&lock).Error
+	return lock, err
+}
+
+// AcquireLock stores the lock unless a lock held with another token
+// overlaps it, which is returned instead. A lock with the same token on the
+// same path is replaced, renewing it.
+func AcquireLock(lock *Lock) (*Lock, error) {
+	lockMu.Lock()
+	defer lockMu.Unlock()
+
+	db := GetDB()
+	if err := db.Where("expires_at <= ?", time.Now()).Delete(&Lock{}).Error; err != nil {
+		logger.Error("failed to prune locks: %v", err)
+	}
+	locks, err := GetLocks()
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range locks {
+		if !l.Covers(lock.Path) {
+			continue
+		}
+		if l.Token != lock.Token {
+			return &l, nil
+		}
+		if l.Path == lock.Path {
+			lock.ID, lock.CreatedAt = l.ID, l.CreatedAt
+		}
+	}
+	if err := db.Save(lock).Error; err != nil {
+		logger.Error("failed to save lock on %s: %v", lock.Path, err)
+		return nil, err
+	}
+	return nil, nil
+}
+
+// RenewLock moves the expiry of a lock that hasn't expired yet
+func RenewLock(id string, expires time.Time) (Lock, error) {
+	lockMu.Lock()
+	defer lockMu.Unlock()
+
+	lock, err := GetLock(id)
+	if err != nil {
+		return lock, err
+	}
+	lock.RenewedAt = time.Now()
+	lock.ExpiresAt = expires
+	if err := GetDB().Save(&lock).Error; err != nil {
+		logger.Error("failed to renew lock %s: %v", id, err)
+		return lock, err
+	}
+	return lock, nil
+}
+
+// DeleteLock removes a lock
+func DeleteLock(id string) error {
+	res := GetDB().Where("id = ?", id).Delete(&Lock{})
+	if res.Error != nil {
+		logger.Error("failed to delete lock %s: %v", id, res.Error)
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -4,7 +4,7 @@ import "github.com/tachRoutine/beamdrop-go/pkg/logger"
 
 func AutoMigrate() {
 	logger.Info("Running database migrations")
-	err := db.AutoMigrate(&ServerStats{}, &Config{}, &StarredFile{})
+	err := db.AutoMigrate(&ServerStats{}, &Config{}, &StarredFile{}, &Job{}, &Lock{}, &Tag{}, &FileTag{}, &Collection{}, &CollectionItem{}, &FileIdentity{}, &Comment{}, &Webhook{}, &WebhookDelivery{}, &ProcessingResult{}, &QuarantinedFile{}, &ScanResult{})
 	if err != nil {
 		logger.Error("failed to migrate database: %v", err)
 	}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// pathColumn is a column keying a table by the API path of a file or
+// directory. Tables holding per-file metadata are listed in pathColumns so
+// their rows follow moves and renames and go when the file does.
+type pathColumn struct {
+	table  string
+	column string
+	// content is set for metadata about what's at the path, which a move
+	// replacing the target discards. Locks are about the path itself.
+	content bool
+}
+
+var pathColumns = []pathColumn{
+	{"starred_files", "file_path", true},
+	{"file_tags", "file_path", true},
+	{"collection_items", "file_path", true},
+	{"comments", "path", true},
+	{"processing_results", "path", true},
+	{"scan_results", "path", true},
+	{"file_identities", "path", true},
+	{"locks", "path", false},
+}
+
+// FileIdentity is what's known of a file with metadata, to find it again
+// after it was moved or renamed behind beamdrop's back
+type FileIdentity struct {
+	ID      uint      `gorm:"primaryKey" json:"id"`
+	Path    string    `gorm:"column:path;uniqueIndex;not null" json:"path"`
+	Dir     bool      `gorm:"column:dir" json:"dir"`
+	Device  uint64    `gorm:"column:device" json:"device"`
+	Inode   uint64    `gorm:"column:inode;index" json:"inode"`
+	Size    int64     `gorm:"column:size" json:"size"`
+	ModTime time.Time `gorm:"column:mod_time" json:"modTime"`
+	// Hash is the SHA-256 of the content of a regular file, once known
+	Hash      string    `gorm:"column:hash" json:"hash,omitempty"`
+	CheckedAt time.Time `gorm:"column:checked_at" json:"checkedAt"`
+}
+
+func (FileIdentity) TableName() string {
+	return "file_identities"
+}
+
+// below matches a path column against p and everything under it. LIKE
+// would ignore case, so the prefix is compared; substr counts characters.
+func below(column, p string) (string, []any) {
+	prefix := p + "/"
+	return column + " = ? OR substr(" + column + ", 1, ?) = ?", []any{p, utf8.RuneCountInString(prefix), prefix}
+}
+
+// MovePaths moves the metadata of oldPath and everything under it to
+// newPath, which replaced whatever was there
+func MovePaths(oldPath, newPath string) error {
+	if oldPath == newPath {
+		return nil
+	}
+	err := GetDB().Transaction(func(tx *gorm.DB) error {
+		for _, c := range pathColumns {
+			if c.content {
+				query, args := below(c.column, newPath)
+				if err := tx.Exec("DELETE FROM "+c.table+" WHERE "+query, args...).Error; err != nil {
+					return err
+				}
+			}
+			query, args := below(c.column, oldPath)
+			args = append([]any{newPath, utf8.RuneCountInString(oldPath) + 1}, args...)
+			err := tx.Exec("UPDATE "+c.table+" SET "+c.column+" = ? || substr("+c.column+", ?) WHERE "+query, args...).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("failed to move metadata from %s to %s: %v", oldPath, newPath, err)
+	}
+	return err
+}
+
+// ForgetPaths removes the metadata of p and everything under it
+func ForgetPaths(p string) error {
+	err := GetDB().Transaction(func(tx *gorm.DB) error {
+		for _, c := range pathColumns {
+			query, args := below(c.column, p)
+			if err := tx.Exec("DELETE FROM "+c.table+" WHERE "+query, args...).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("failed to remove metadata of %s: %v", p, err)
+	}
+	return err
+}
+
+// GetTrackedPaths retrieves every path some metadata is about
+func GetTrackedPaths() ([]string, error) {
+	var parts []string
+	for _, c := range pathColumns {
+		// An identity alone isn't worth keeping track of
+		if c.content && c.table != "file_identities" {
+			parts = append(parts, "SELECT "+c.column+" FROM "+c.table)
+		}
+	}
+	var paths []string
+	err := GetDB().Raw(strings.Join(parts, " UNION ") + " ORDER BY 1").Scan(&paths).Error
+	if err != nil {
+		logger.Error("failed to get tracked paths: %v", err)
+	}
+	return paths, err
+}
+
+// GetIdentities retrieves the identities recorded for paths, by path
+func GetIdentities() (map[string]FileIdentity, error) {
+	var rows []FileIdentity
+	if err := GetDB().Find(&rows).Error; err != nil {
+		logger.Error("failed to get file identities: %v", err)
+		return nil, err
+	}
+	ids := make(map[string]FileIdentity, len(rows))
+	for _, r := range rows {
+		ids[r.Path] = r
+	}
+	return ids, nil
+}
+
+// SaveIdentity records the identity of a path, replacing what was known
+func SaveIdentity(id *FileIdentity) error {
+	err := GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"dir", "device", "inode", "size", "mod_time", "hash", "checked_at"}),
+	}).Create(id).Error
+	if err != nil {
+		logger.Error("failed to save identity of %s: %v", id.Path, err)
+	}
+	return err
+}
+
+// DeleteIdentities forgets the identities of paths
+func DeleteIdentities(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	return GetDB().Where("path IN ?", paths).Delete(&FileIdentity{}).Error
+}
+
+// GetIdentity retrieves the identity recorded for a path
+func GetIdentity(p string) (FileIdentity, error) {
+	var id FileIdentity
+	err := GetDB().Where("path = ?", p).First(&id).Error
+	return id, err
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// Statuses of a processing result
+const (
+	ProcessingDone    = "done"
+	ProcessingSkipped = "skipped"
+	ProcessingFailed  = "failed"
+)
+
+// ProcessingResult is what a processor of the upload pipeline made of a
+// file, the last time it ran
+type ProcessingResult struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	Path      string `gorm:"column:path;index;not null" json:"path"`
+	Processor string `gorm:"column:processor;not null" json:"processor"`
+	Status    string `gorm:"column:status;not null" json:"status"`
+	// Output holds what the processor found, e.g. {"sha256": "..."}
+	Output map[string]string `gorm:"column:output;serializer:json" json:"output,omitempty"`
+	// Data is binary output, like a thumbnail
+	Data  []byte `gorm:"column:data" json:"-"`
+	Error string `gorm:"column:error" json:"error,omitempty"`
+	// Action is what the failure policy did to the file: deleted or
+	// quarantined, empty if it was kept
+	Action     string    `gorm:"column:action" json:"action,omitempty"`
+	DurationMS int64     `gorm:"column:duration_ms" json:"durationMs"`
+	CreatedAt  time.Time `gorm:"column:created_at" json:"createdAt"`
+}
+
+func (ProcessingResult) TableName() string {
+	return "processing_results"
+}
+
+// SaveProcessingResults replaces the results recorded for a path
+func SaveProcessingResults(p string, results []ProcessingResult) error {
+	err := GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("path = ?", p).Delete(&ProcessingResult{}).Error; err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return nil
+		}
+		return tx.Create(&results).Error
+	})
+	if err != nil {
+		logger.Error("failed to save processing results of %s: %v", p, err)
+	}
+	return err
+}
+
+// GetProcessingResults retrieves the results recorded for a path, in the
+// order the processors ran, leaving out binary data
+func GetProcessingResults(p string) ([]ProcessingResult, error) {
+	var results []ProcessingResult
+	err := GetDB().Omit("data").Where("path = ?", p).Order("id").Find(&results).Error
+	if err != nil {
+		logger.Error("failed to get processing results of %s: %v", p, err)
+	}
+	return results, err
+}
+
+// GetProcessingData retrieves the binary output of a processor for a path,
+// the first with any if processor is empty
+func GetProcessingData(p, processor string) (ProcessingResult, error) {
+	q := GetDB().Where("path = ? AND status = ? AND length(data) > 0", p, ProcessingDone)
+	if processor != "" {
+		q = q.Where("processor = ?", processor)
+	}
+	var r ProcessingResult
+	err := q.Order("id").First(&r).Error
+	return r, err
+}
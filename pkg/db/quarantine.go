@@ -0,0 +1,57 @@
+package db
+
+import (
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+)
+
+// QuarantinedFile records a file taken out of the share, as an audit trail
+// and to find it in the quarantine directory
+type QuarantinedFile struct {
+	ID string `gorm:"primaryKey" json:"id"`
+	// Path is where the file was, as the API names it
+	Path string `gorm:"column:path;index;not null" json:"path"`
+	Size int64  `gorm:"column:size" json:"size"`
+	// Source is what quarantined the file, e.g. "processor:scan"
+	Source string `gorm:"column:source" json:"source"`
+	Reason string `gorm:"column:reason" json:"reason"`
+	// Client is who uploaded the file, if known
+	Client    string    `gorm:"column:client" json:"client,omitempty"`
+	CreatedAt time.Time `gorm:"column:created_at;index" json:"createdAt"`
+}
+
+func (QuarantinedFile) TableName() string {
+	return "quarantined_files"
+}
+
+// AddQuarantined records a quarantined file
+func AddQuarantined(q *QuarantinedFile) error {
+	if err := GetDB().Create(q).Error; err != nil {
+		logger.Error("failed to record quarantined file %s: %v", q.Path, err)
+		return err
+	}
+	return nil
+}
+
+// GetQuarantined retrieves the quarantined files, newest first
+func GetQuarantined() ([]QuarantinedFile, error) {
+	var files []QuarantinedFile
+	if err := GetDB().Order("created_at DESC").Find(&files).Error; err != nil {
+		logger.Error("failed to get quarantined files: %v", err)
+		return nil, err
+	}
+	return files, nil
+}
+
+// GetQuarantinedFile retrieves a quarantined file by ID
+func GetQuarantinedFile(id string) (QuarantinedFile, error) {
+	var q QuarantinedFile
+	err := GetDB().Where("id = ?", id).First(&q).Error
+	return q, err
+}
+
+// DeleteQuarantined removes the record of a quarantined file
+func DeleteQuarantined(id string) error {
+	return GetDB().Where("id = ?", id).Delete(&QuarantinedFile{}).Error
+}
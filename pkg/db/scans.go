@@ -0,0 +1,66 @@
+package db
+
+import (
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"gorm.io/gorm/clause"
+)
+
+// Scan statuses of a file
+const (
+	ScanClean = "clean"
+	// ScanError marks a file stored although clamd couldn't scan it
+	ScanError = "error"
+	// ScanUnscanned is reported for files without a scan, from before
+	// scanning was on or put there outside beamdrop
+	ScanUnscanned = "unscanned"
+)
+
+// ScanResult is the antivirus verdict on an uploaded file. Infected files
+// are never stored; their record is a QuarantinedFile.
+type ScanResult struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	Path      string    `gorm:"column:path;uniqueIndex;not null" json:"path"`
+	Status    string    `gorm:"column:status;not null" json:"status"`
+	Error     string    `gorm:"column:error" json:"error,omitempty"`
+	Scanner   string    `gorm:"column:scanner" json:"scanner,omitempty"`
+	ScannedAt time.Time `gorm:"column:scanned_at" json:"scannedAt"`
+}
+
+func (ScanResult) TableName() string {
+	return "scan_results"
+}
+
+// SaveScanResult records the verdict on a path, replacing an earlier one
+func SaveScanResult(r ScanResult) error {
+	err := GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "error", "scanner", "scanned_at"}),
+	}).Create(&r).Error
+	if err != nil {
+		logger.Error("failed to save scan result of %s: %v", r.Path, err)
+	}
+	return err
+}
+
+// GetScanResult retrieves the verdict on a path
+func GetScanResult(p string) (ScanResult, error) {
+	var r ScanResult
+	err := GetDB().Where("path = ?", p).First(&r).Error
+	return r, err
+}
+
+// GetScanStatuses retrieves the scan status of each of paths that has one
+func GetScanStatuses(paths []string) (map[string]string, error) {
+	var rows []ScanResult
+	if err := GetDB().Select("path, status").Where("path IN ?", paths).Find(&rows).Error; err != nil {
+		logger.Error("failed to get scan statuses: %v", err)
+		return nil, err
+	}
+	statuses := make(map[string]string, len(rows))
+	for _, r := range rows {
+		statuses[r.Path] = r.Status
+	}
+	return statuses, nil
+}
@@ -0,0 +1,295 @@
+package db
+
+import (
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tag is a user-defined label files and directories can carry
+type Tag struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"column:name;uniqueIndex;not null" json:"name"`
+	Color       string    `gorm:"column:color" json:"color,omitempty"` // "#rrggbb"
+	Description string    `gorm:"column:description" json:"description,omitempty"`
+	CreatedAt   time.Time `gorm:"column:created_at" json:"createdAt"`
+}
+
+func (Tag) TableName() string {
+	return "tags"
+}
+
+// FileTag assigns a tag to a path
+type FileTag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TagID     uint      `gorm:"column:tag_id;uniqueIndex:idx_file_tag;not null" json:"tagId"`
+	FilePath  string    `gorm:"column:file_path;uniqueIndex:idx_file_tag;index;not null" json:"filePath"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"createdAt"`
+}
+
+func (FileTag) TableName() string {
+	return "file_tags"
+}
+
+// Collection is a named virtual folder referencing paths anywhere
+type Collection struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"column:name;uniqueIndex;not null" json:"name"`
+	Description string    `gorm:"column:description" json:"description,omitempty"`
+	CreatedAt   time.Time `gorm:"column:created_at" json:"createdAt"`
+}
+
+func (Collection) TableName() string {
+	return "collections"
+}
+
+// CollectionItem puts a path in a collection
+type CollectionItem struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	CollectionID uint      `gorm:"column:collection_id;uniqueIndex:idx_collection_item;not null" json:"collectionId"`
+	FilePath     string    `gorm:"column:file_path;uniqueIndex:idx_collection_item;index;not null" json:"filePath"`
+	CreatedAt    time.Time `gorm:"column:created_at" json:"createdAt"`
+}
+
+func (CollectionItem) TableName() string {
+	return "collection_items"
+}
+
+// GetTags retrieves every tag by name, with how many paths carry each
+func GetTags() ([]Tag, map[uint]int64, error) {
+	db := GetDB()
+	var tags []Tag
+	if err := db.Order("name").Find(&tags).Error; err != nil {
+		logger.Error("failed to get tags: %v", err)
+		return nil, nil, err
+	}
+	var counts []struct {
+		TagID uint
+		N     int64
+	}
+	if err := db.Model(&FileTag{}).Select("tag_id, COUNT(*) AS n").Group("tag_id").Scan(&counts).Error; err != nil {
+		logger.Error("failed to count tagged files: %v", err)
+		return nil, nil, err
+	}
+	usage := make(map[uint]int64, len(counts))
+	for _, c := range counts {
+		usage[c.TagID] = c.N
+	}
+	return tags, usage, nil
+}
+
+// GetTag retrieves a tag by ID
+func GetTag(id uint) (Tag, error) {
+	var tag Tag
+	err := GetDB().First(&tag, id).Error
+	return tag, err
+}
+
+// GetTagsByName retrieves the tags with the given names, ignoring case
+func GetTagsByName(names []string) ([]Tag, error) {
+	var tags []Tag
+	if len(names) == 0 {
+		return tags, nil
+	}
+	err := GetDB().Where("name COLLATE NOCASE IN ?", names).Find(&tags).Error
+	return tags, err
+}
+
+// SaveTag inserts or updates a tag
+func SaveTag(tag *Tag) error {
+	if err := GetDB().Save(tag).Error; err != nil {
+		logger.Error("failed to save tag %s: %v", tag.Name, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteTag removes a tag from everything that carries it, then the tag
+func DeleteTag(id uint) error {
+	return GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tag_id = ?", id).Delete(&FileTag{}).Error; err != nil {
+			return err
+		}
+		res := tx.Delete(&Tag{}, id)
+		if res.Error == nil && res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return res.Error
+	})
+}
+
+// TagFiles assigns and removes tags on paths in one transaction, returning
+// how many assignments were added and removed
+func TagFiles(paths []string, add, remove []uint) (added, removed int64, err error) {
+	err = GetDB().Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var rows []FileTag
+		for _, p := range paths {
+			for _, id := range add {
+				rows = append(rows, FileTag{TagID: id, FilePath: p, CreatedAt: now})
+			}
+		}
+		if len(rows) > 0 {
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rows, 500)
+			if res.Error != nil {
+				return res.Error
+			}
+			added = res.RowsAffected
+		}
+		if len(remove) > 0 && len(paths) > 0 {
+			res := tx.Where("tag_id IN ? AND file_path IN ?", remove, paths).Delete(&FileTag{})
+			if res.Error != nil {
+				return res.Error
+			}
+			removed = res.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("failed to tag files: %v", err)
+	}
+	return added, removed, err
+}
+
+// GetFileTags retrieves the names of the tags on each of the paths
+func GetFileTags(paths []string) (map[string][]string, error) {
+	var rows []struct {
+		FilePath string
+		Name     string
+	}
+	err := GetDB().Table("file_tags").
+		Select("file_tags.file_path, tags.name").
+		Joins("JOIN tags ON tags.id = file_tags.tag_id").
+		Where("file_tags.file_path IN ?", paths).
+		Order("tags.name").
+		Scan(&rows).Error
+	if err != nil {
+		logger.Error("failed to get file tags: %v", err)
+		return nil, err
+	}
+	tags := map[string][]string{}
+	for _, r := range rows {
+		tags[r.FilePath] = append(tags[r.FilePath], r.Name)
+	}
+	return tags, nil
+}
+
+// GetTaggedPaths retrieves the paths carrying every one of the tags
+func GetTaggedPaths(tagIDs []uint) ([]string, error) {
+	var paths []string
+	err := GetDB().Model(&FileTag{}).
+		Where("tag_id IN ?", tagIDs).
+		Group("file_path").
+		Having("COUNT(DISTINCT tag_id) = ?", len(tagIDs)).
+		Order("file_path").
+		Pluck("file_path", &paths).Error
+	if err != nil {
+		logger.Error("failed to get tagged files: %v", err)
+	}
+	return paths, err
+}
+
+// GetCollections retrieves every collection by name, with how many paths
+// each holds
+func GetCollections() ([]Collection, map[uint]int64, error) {
+	db := GetDB()
+	var collections []Collection
+	if err := db.Order("name").Find(&collections).Error; err != nil {
+		logger.Error("failed to get collections: %v", err)
+		return nil, nil, err
+	}
+	var counts []struct {
+		CollectionID uint
+		N            int64
+	}
+	if err := db.Model(&CollectionItem{}).Select("collection_id, COUNT(*) AS n").Group("collection_id").Scan(&counts).Error; err != nil {
+		logger.Error("failed to count collection items: %v", err)
+		return nil, nil, err
+	}
+	sizes := make(map[uint]int64, len(counts))
+	for _, c := range counts {
+		sizes[c.CollectionID] = c.N
+	}
+	return collections, sizes, nil
+}
+
+// GetCollection retrieves a collection by ID
+func GetCollection(id uint) (Collection, error) {
+	var c Collection
+	err := GetDB().First(&c, id).Error
+	return c, err
+}
+
+// GetCollectionByName retrieves a collection by name, ignoring case
+func GetCollectionByName(name string) (Collection, error) {
+	var c Collection
+	err := GetDB().Where("name = ? COLLATE NOCASE", name).First(&c).Error
+	return c, err
+}
+
+// SaveCollection inserts or updates a collection
+func SaveCollection(c *Collection) error {
+	if err := GetDB().Save(c).Error; err != nil {
+		logger.Error("failed to save collection %s: %v", c.Name, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteCollection removes a collection with its items; the files stay
+func DeleteCollection(id uint) error {
+	return GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("collection_id = ?", id).Delete(&CollectionItem{}).Error; err != nil {
+			return err
+		}
+		res := tx.Delete(&Collection{}, id)
+		if res.Error == nil && res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return res.Error
+	})
+}
+
+// GetCollectionItems retrieves the paths in a collection in the order they
+// were added
+func GetCollectionItems(id uint) ([]string, error) {
+	var paths []string
+	err := GetDB().Model(&CollectionItem{}).Where("collection_id = ?", id).Order("id").Pluck("file_path", &paths).Error
+	if err != nil {
+		logger.Error("failed to get collection items: %v", err)
+	}
+	return paths, err
+}
+
+// UpdateCollectionItems adds and removes paths in one transaction,
+// returning how many were added and removed
+func UpdateCollectionItems(id uint, add, remove []string) (added, removed int64, err error) {
+	err = GetDB().Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		rows := make([]CollectionItem, 0, len(add))
+		for _, p := range add {
+			rows = append(rows, CollectionItem{CollectionID: id, FilePath: p, CreatedAt: now})
+		}
+		if len(rows) > 0 {
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rows, 500)
+			if res.Error != nil {
+				return res.Error
+			}
+			added = res.RowsAffected
+		}
+		if len(remove) > 0 {
+			res := tx.Where("collection_id = ? AND file_path IN ?", id, remove).Delete(&CollectionItem{})
+			if res.Error != nil {
+				return res.Error
+			}
+			removed = res.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("failed to update collection %d: %v", id, err)
+	}
+	return added, removed, err
+}
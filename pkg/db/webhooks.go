@@ -0,0 +1,174 @@
+package db
+
+import (
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// Webhook is a subscription of a URL to file events
+type Webhook struct {
+	ID  uint   `gorm:"primaryKey" json:"id"`
+	URL string `gorm:"column:url;not null" json:"url"`
+	// Secret signs the payloads; only whoever set up the webhook knows it
+	Secret string `gorm:"column:secret;not null" json:"-"`
+	// Events are the event types sent, every one if empty
+	Events []string `gorm:"column:events;serializer:json" json:"events"`
+	// Paths are the patterns of the paths events are sent for, every path
+	// if empty
+	Paths     []string  `gorm:"column:paths;serializer:json" json:"paths"`
+	Active    bool      `gorm:"column:active" json:"active"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updatedAt"`
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// States of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is an event queued for a webhook, and the outcome of
+// sending it
+type WebhookDelivery struct {
+	ID        string `gorm:"primaryKey" json:"id"`
+	WebhookID uint   `gorm:"column:webhook_id;index;not null" json:"webhookId"`
+	Event     string `gorm:"column:event" json:"event"`
+	Path      string `gorm:"column:path" json:"path,omitempty"`
+	// Payload is the JSON body sent
+	Payload  string `gorm:"column:payload" json:"-"`
+	State    string `gorm:"column:state;index;not null" json:"state"`
+	Attempts int    `gorm:"column:attempts;default:0" json:"attempts"`
+	// NextAttempt is when a pending delivery is sent next
+	NextAttempt time.Time `gorm:"column:next_attempt;index" json:"nextAttempt"`
+	// StatusCode, Response and Error are about the last attempt
+	StatusCode  int        `gorm:"column:status_code" json:"statusCode,omitempty"`
+	Response    string     `gorm:"column:response" json:"response,omitempty"`
+	Error       string     `gorm:"column:error" json:"error,omitempty"`
+	CreatedAt   time.Time  `gorm:"column:created_at;index" json:"createdAt"`
+	AttemptedAt *time.Time `gorm:"column:attempted_at" json:"attemptedAt,omitempty"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// GetWebhooks retrieves every webhook, oldest first
+func GetWebhooks() ([]Webhook, error) {
+	var hooks []Webhook
+	if err := GetDB().Order("id").Find(&hooks).Error; err != nil {
+		logger.Error("failed to get webhooks: %v", err)
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// GetWebhook retrieves a webhook by ID
+func GetWebhook(id uint) (Webhook, error) {
+	var hook Webhook
+	err := GetDB().First(&hook, id).Error
+	return hook, err
+}
+
+// SaveWebhook inserts or updates a webhook
+func SaveWebhook(hook *Webhook) error {
+	if err := GetDB().Save(hook).Error; err != nil {
+		logger.Error("failed to save webhook %s: %v", hook.URL, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteWebhook removes a webhook with its deliveries
+func DeleteWebhook(id uint) error {
+	err := GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", id).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Webhook{}, id).Error
+	})
+	if err != nil {
+		logger.Error("failed to delete webhook %d: %v", id, err)
+	}
+	return err
+}
+
+// AddDeliveries queues deliveries
+func AddDeliveries(deliveries []WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := GetDB().Create(&deliveries).Error; err != nil {
+		logger.Error("failed to queue webhook deliveries: %v", err)
+		return err
+	}
+	return nil
+}
+
+// SaveDelivery updates a delivery
+func SaveDelivery(d *WebhookDelivery) error {
+	if err := GetDB().Save(d).Error; err != nil {
+		logger.Error("failed to save webhook delivery %s: %v", d.ID, err)
+		return err
+	}
+	return nil
+}
+
+// GetDueDeliveries retrieves up to limit pending deliveries due by now,
+// oldest first
+func GetDueDeliveries(now time.Time, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := GetDB().Where("state = ? AND next_attempt <= ?", DeliveryPending, now).
+		Order("next_attempt").Limit(limit).Find(&deliveries).Error
+	if err != nil {
+		logger.Error("failed to get due webhook deliveries: %v", err)
+	}
+	return deliveries, err
+}
+
+// NextDelivery returns when the next pending delivery is due, if any is
+func NextDelivery() (time.Time, bool) {
+	var d WebhookDelivery
+	err := GetDB().Where("state = ?", DeliveryPending).Order("next_attempt").First(&d).Error
+	if err != nil {
+		return time.Time{}, false
+	}
+	return d.NextAttempt, true
+}
+
+// GetDeliveries retrieves the deliveries of a webhook, newest first, only
+// those in state if it isn't empty
+func GetDeliveries(webhookID uint, state string, limit int) ([]WebhookDelivery, error) {
+	q := GetDB().Where("webhook_id = ?", webhookID)
+	if state != "" {
+		q = q.Where("state = ?", state)
+	}
+	var deliveries []WebhookDelivery
+	if err := q.Order("created_at DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		logger.Error("failed to get deliveries of webhook %d: %v", webhookID, err)
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// PruneDeliveries deletes all but the newest keep finished deliveries of a
+// webhook
+func PruneDeliveries(webhookID uint, keep int) error {
+	db := GetDB()
+	finished := []string{DeliveryDelivered, DeliveryFailed}
+	keepIDs := db.Model(&WebhookDelivery{}).Select("id").
+		Where("webhook_id = ? AND state IN ?", webhookID, finished).
+		Order("created_at DESC").Limit(keep)
+	err := db.Where("webhook_id = ? AND state IN ? AND id NOT IN (?)", webhookID, finished, keepIDs).
+		Delete(&WebhookDelivery{}).Error
+	if err != nil {
+		logger.Error("failed to prune deliveries of webhook %d: %v", webhookID, err)
+	}
+	return err
+}
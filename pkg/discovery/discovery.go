@@ -0,0 +1,200 @@
+// Package discovery advertises beamdrop servers on the local network as
+// _beamdrop._tcp DNS-SD services over mDNS and finds them again.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/mdns"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+)
+
+const (
+	// ServiceType is the DNS-SD service type beamdrop registers under
+	ServiceType = "_beamdrop._tcp"
+	Domain      = "local."
+
+	// DefaultTimeout is how long Browse listens for answers by default
+	DefaultTimeout = 2 * time.Second
+)
+
+// silent swallows the chatty logging of the mdns library
+var silent = log.New(io.Discard, "", 0)
+
+// Info is what a server advertises about itself
+type Info struct {
+	Name    string
+	Version string
+	Port    int
+	IPs     []net.IP
+	TLS     bool
+	Auth    bool
+}
+
+// Instance is a beamdrop server found on the network
+type Instance struct {
+	Name    string `json:"name"`
+	Host    string `json:"host"`
+	Addr    string `json:"addr"`
+	Port    int    `json:"port"`
+	Version string `json:"version"`
+	TLS     bool   `json:"tls"`
+	Auth    bool   `json:"auth"`
+}
+
+// URL returns the base URL of the instance
+func (i Instance) URL() string {
+	scheme := "http"
+	if i.TLS {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(i.Addr, fmt.Sprint(i.Port)))
+}
+
+// DefaultName is the instance name used when none is configured
+func DefaultName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "beamdrop"
+	}
+	return "beamdrop on " + strings.Split(host, ".")[0]
+}
+
+// Advertise registers the server on the local network. The returned
+// function withdraws the advertisement.
+func Advertise(info Info) (func(), error) {
+	if info.Name == "" {
+		info.Name = DefaultName()
+	}
+
+	txt := []string{
+		"name=" + info.Name,
+		"version=" + info.Version,
+		"tls=" + boolTXT(info.TLS),
+		"auth=" + boolTXT(info.Auth),
+	}
+
+	host, _ := os.Hostname()
+	host = strings.Split(host, ".")[0]
+	if host == "" {
+		host = "beamdrop"
+	}
+
+	service, err := mdns.NewMDNSService(info.Name, ServiceType, Domain, host+"."+Domain, info.Port, info.IPs, txt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mDNS service: %w", err)
+	}
+	srv, err := mdns.NewServer(&mdns.Config{Zone: service, Logger: silent})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start mDNS responder: %w", err)
+	}
+
+	logger.Info("Advertising %q as %s on the local network", info.Name, ServiceType)
+	return func() {
+		if err := srv.Shutdown(); err != nil {
+			logger.Warn("Failed to stop mDNS responder: %v", err)
+		}
+	}, nil
+}
+
+// Browse listens for beamdrop instances for the given time
+func Browse(ctx context.Context, timeout time.Duration) ([]Instance, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	entries := make(chan *mdns.ServiceEntry, 32)
+	found := make(map[string]Instance)
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		for e := range entries {
+			if inst, ok := fromEntry(e); ok {
+				found[inst.Name+"|"+inst.Addr] = inst
+			}
+		}
+	}()
+
+	params := mdns.DefaultParams(ServiceType)
+	params.Domain = strings.TrimSuffix(Domain, ".")
+	params.Timeout = timeout
+	params.Entries = entries
+	params.DisableIPv6 = true
+	params.Logger = silent
+	err := mdns.QueryContext(ctx, params)
+	close(entries)
+	<-collected
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]Instance, 0, len(found))
+	for _, inst := range found {
+		instances = append(instances, inst)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Name < instances[j].Name
+	})
+	return instances, nil
+}
+
+// ErrNotFound is returned by Lookup when no instance has the requested name
+var ErrNotFound = errors.New("no beamdrop instance with that name found")
+
+// Lookup browses the network for an instance with the given name
+// (case-insensitive)
+func Lookup(ctx context.Context, name string, timeout time.Duration) (Instance, error) {
+	instances, err := Browse(ctx, timeout)
+	if err != nil {
+		return Instance{}, err
+	}
+	for _, inst := range instances {
+		if strings.EqualFold(inst.Name, name) {
+			return inst, nil
+		}
+	}
+	return Instance{}, fmt.Errorf("%q: %w", name, ErrNotFound)
+}
+
+func fromEntry(e *mdns.ServiceEntry) (Instance, bool) {
+	if !strings.Contains(e.Name, ServiceType) || e.AddrV4 == nil {
+		return Instance{}, false
+	}
+
+	inst := Instance{
+		Name: strings.TrimSuffix(e.Name, "."+ServiceType+"."+Domain),
+		Host: strings.TrimSuffix(e.Host, "."),
+		Addr: e.AddrV4.String(),
+		Port: e.Port,
+	}
+	for _, field := range e.InfoFields {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "name":
+			inst.Name = value
+		case "version":
+			inst.Version = value
+		case "tls":
+			inst.TLS = value == "1"
+		case "auth":
+			inst.Auth = value == "1"
+		}
+	}
+	return inst, true
+}
+
+func boolTXT(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
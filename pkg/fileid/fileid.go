@@ -0,0 +1,40 @@
+// Package fileid recognizes files that were moved or renamed, by device and
+// inode number where the platform has them and by content hash
+package fileid
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+)
+
+// MaxHashSize is the largest file that is hashed; larger ones are only
+// recognized by inode
+const MaxHashSize = 1 << 30
+
+// Inode returns the device and inode number of a file, ok is false on
+// platforms without them
+func Inode(info fs.FileInfo) (dev, ino uint64, ok bool) {
+	return inode(info)
+}
+
+// Hash returns the SHA-256 of a regular file as hex, "" for anything else
+// and files over MaxHashSize
+func Hash(fsys *sandbox.FS, name string, info fs.FileInfo) (string, error) {
+	if !info.Mode().IsRegular() || info.Size() > MaxHashSize {
+		return "", nil
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package fileid
+
+import "io/fs"
+
+func inode(info fs.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,348 @@
+// Package fileops copies and moves whole trees between sandboxed file
+// systems, keeping modes, modification times and symbolic links.
+package fileops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+)
+
+// Policy decides what happens when a copy or move meets an existing target
+type Policy string
+
+const (
+	// Merge merges directories and replaces files
+	Merge Policy = "merge"
+	// Overwrite removes an existing target first, so the result is an exact
+	// copy of the source
+	Overwrite Policy = "overwrite"
+	// Skip merges directories and keeps existing files
+	Skip Policy = "skip"
+)
+
+var (
+	// ErrIntoItself is returned for a copy or move of a directory into itself
+	ErrIntoItself = errors.New("can't copy a directory into itself")
+	// ErrConflict is returned when a file meets a directory or the other way
+	// round, which only Overwrite replaces
+	ErrConflict = fmt.Errorf("a file and a directory can't replace each other: %w", fs.ErrExist)
+)
+
+// rename is the sandbox's rename, replaced in tests to cross devices
+var rename = (*sandbox.FS).Rename
+
+// ParsePolicy validates a policy name; "" is Merge
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case "":
+		return Merge, nil
+	case Merge, Overwrite, Skip:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown policy %q (want %s, %s or %s)", s, Merge, Overwrite, Skip)
+}
+
+// Progress counts the work an operation has done, and has to do once Count
+// was called
+type Progress struct {
+	Files      int64  `json:"files"`
+	Bytes      int64  `json:"bytes"`
+	Skipped    int64  `json:"skipped"`
+	TotalFiles int64  `json:"totalFiles"`
+	TotalBytes int64  `json:"totalBytes"`
+	Current    string `json:"current,omitempty"`
+}
+
+// Op copies or moves one entry, file or tree, between two file systems that
+// may be the same
+type Op struct {
+	Src     *sandbox.FS
+	SrcName string
+	Dst     *sandbox.FS
+	DstName string
+	Policy  Policy
+
+	// OnProgress, if set, is called as files are done and data is copied
+	OnProgress func(Progress)
+	// OnMoved, if set, is called as a move takes an entry from src to dst,
+	// standing for everything below it. Entries that stay, because they were
+	// skipped or a directory was merged into, aren't reported.
+	OnMoved func(src, dst string)
+
+	progress Progress
+}
+
+// Progress returns the work done so far
+func (op *Op) Progress() Progress {
+	return op.progress
+}
+
+// Check rejects copying or moving a directory into itself
+func (op *Op) Check() error {
+	if op.Src != op.Dst {
+		return nil
+	}
+	if op.SrcName == "." || op.DstName == op.SrcName || strings.HasPrefix(op.DstName, op.SrcName+"/") {
+		return ErrIntoItself
+	}
+	return nil
+}
+
+// Count walks the source to fill in the totals of the progress
+func (op *Op) Count() error {
+	return fs.WalkDir(op.Src.FS(), op.SrcName, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || sandbox.IsTemp(d.Name()) {
+			return nil
+		}
+		op.progress.TotalFiles++
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				op.progress.TotalBytes += info.Size()
+			}
+		}
+		return nil
+	})
+}
+
+// Copy copies the source to the target
+func (op *Op) Copy(ctx context.Context) error {
+	if err := op.Check(); err != nil {
+		return err
+	}
+	return op.copyEntry(ctx, op.SrcName, op.DstName)
+}
+
+// Move moves the source to the target. Entries are renamed where possible
+// and copied then removed where not, between two file systems or across
+// mount points. Entries skipped by the policy stay at the source.
+func (op *Op) Move(ctx context.Context) error {
+	if err := op.Check(); err != nil {
+		return err
+	}
+	return op.moveEntry(ctx, op.SrcName, op.DstName)
+}
+
+// prepare applies the policy to an existing target. It reports whether the
+// entry should be skipped and whether the target is a directory to merge
+// into.
+func (op *Op) prepare(src fs.FileInfo, dst string) (skip, merge bool, err error) {
+	target, err := op.Dst.Lstat(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	switch {
+	case op.Policy == Overwrite:
+	case src.IsDir() != target.IsDir():
+		return false, false, fmt.Errorf("%s: %w", dst, ErrConflict)
+	case src.IsDir() && target.IsDir():
+		return false, true, nil
+	case op.Policy == Skip:
+		return true, false, nil
+	case src.Mode().IsRegular() && target.Mode().IsRegular():
+		// Replaced atomically by the copy or rename
+		return false, false, nil
+	}
+	return false, false, op.Dst.RemoveAll(dst)
+}
+
+func (op *Op) moveEntry(ctx context.Context, src, dst string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	info, err := op.Src.Lstat(src)
+	if err != nil {
+		return err
+	}
+	skip, merge, err := op.prepare(info, dst)
+	switch {
+	case err != nil:
+		return err
+	case skip:
+		op.skip(src)
+		return nil
+	case merge:
+		entries, err := op.Src.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := op.moveEntry(ctx, path.Join(src, e.Name()), path.Join(dst, e.Name())); err != nil {
+				return err
+			}
+		}
+		// Whatever was skipped keeps the source directory alive
+		if err := op.Src.Remove(src); err != nil && op.Policy != Skip {
+			return err
+		}
+		return nil
+	}
+
+	if op.Src == op.Dst {
+		err := rename(op.Src, src, dst)
+		if !errors.Is(err, syscall.EXDEV) {
+			if err == nil {
+				op.done(src)
+				op.moved(src, dst)
+			}
+			return err
+		}
+	}
+	if err := op.copyEntry(ctx, src, dst); err != nil {
+		return err
+	}
+	if err := op.Src.RemoveAll(src); err != nil {
+		return err
+	}
+	op.moved(src, dst)
+	return nil
+}
+
+func (op *Op) moved(src, dst string) {
+	if op.OnMoved != nil {
+		op.OnMoved(src, dst)
+	}
+}
+
+func (op *Op) copyEntry(ctx context.Context, src, dst string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	info, err := op.Src.Lstat(src)
+	if err != nil {
+		return err
+	}
+	skip, merge, err := op.prepare(info, dst)
+	switch {
+	case err != nil:
+		return err
+	case skip:
+		op.skip(src)
+		return nil
+	}
+
+	switch mode := info.Mode(); {
+	case mode&fs.ModeSymlink != 0:
+		target, err := op.Src.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err := op.Dst.Symlink(target, dst); err != nil {
+			return err
+		}
+		op.done(src)
+		return nil
+
+	case mode.IsDir():
+		if !merge {
+			if err := op.Dst.Mkdir(dst, sandbox.DirMode); err != nil {
+				return err
+			}
+		}
+		entries, err := op.Src.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if sandbox.IsTemp(e.Name()) {
+				continue
+			}
+			if err := op.copyEntry(ctx, path.Join(src, e.Name()), path.Join(dst, e.Name())); err != nil {
+				return err
+			}
+		}
+		// Set last, copying the entries changed the time
+		if err := op.Dst.Chmod(dst, mode.Perm()); err != nil {
+			return err
+		}
+		return op.Dst.Chtimes(dst, info.ModTime(), info.ModTime())
+
+	case mode.IsRegular():
+		return op.copyFile(ctx, src, dst, info)
+	}
+
+	// Devices, sockets and pipes have no content to copy
+	op.skip(src)
+	return nil
+}
+
+func (op *Op) copyFile(ctx context.Context, src, dst string, info fs.FileInfo) error {
+	in, err := op.Src.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := op.Dst.CreateAtomic(dst, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	op.progress.Current = src
+	if _, err := io.Copy(out, &reader{ctx: ctx, r: in, op: op}); err != nil {
+		out.Abort()
+		return err
+	}
+	if err := out.Commit(); err != nil {
+		return err
+	}
+	// Commit keeps the mode of a file it replaces; the copy gets the source's
+	if err := op.Dst.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := op.Dst.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	op.done(src)
+	return nil
+}
+
+func (op *Op) done(name string) {
+	op.progress.Files++
+	op.progress.Current = name
+	op.report()
+}
+
+func (op *Op) skip(name string) {
+	op.progress.Skipped++
+	op.progress.Current = name
+	op.report()
+}
+
+func (op *Op) report() {
+	if op.OnProgress != nil {
+		op.OnProgress(op.progress)
+	}
+}
+
+// reader stops a copy once the context is done and counts what was read
+type reader struct {
+	ctx context.Context
+	r   io.Reader
+	op  *Op
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.op.progress.Bytes += int64(n)
+		r.op.report()
+	}
+	return n, err
+}
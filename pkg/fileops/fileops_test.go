@@ -0,0 +1,249 @@
+package fileops
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+)
+
+func newFS(t *testing.T) *sandbox.FS {
+	t.Helper()
+	fsys, err := sandbox.New(t.TempDir(), sandbox.SymlinksDeny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fsys.Close() })
+	return fsys
+}
+
+func writeFile(t *testing.T, fsys *sandbox.FS, name, content string) {
+	t.Helper()
+	if err := fsys.WriteFile(name, []byte(content), sandbox.FileMode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, fsys *sandbox.FS, name string) string {
+	t.Helper()
+	data, err := fsys.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestMismatchedKinds(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string // "file" or "dir"
+		policy Policy
+		move   bool
+		err    error
+	}{
+		{"copy file onto dir, merge", "file", Merge, false, ErrConflict},
+		{"move file onto dir, merge", "file", Merge, true, ErrConflict},
+		{"copy dir onto file, merge", "dir", Merge, false, ErrConflict},
+		{"move dir onto file, merge", "dir", Merge, true, ErrConflict},
+		{"copy file onto dir, skip", "file", Skip, false, ErrConflict},
+		{"move dir onto file, skip", "dir", Skip, true, ErrConflict},
+		{"copy file onto dir, overwrite", "file", Overwrite, false, nil},
+		{"move file onto dir, overwrite", "file", Overwrite, true, nil},
+		{"copy dir onto file, overwrite", "dir", Overwrite, false, nil},
+		{"move dir onto file, overwrite", "dir", Overwrite, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := newFS(t)
+			// The source is src; the target, of the other kind, is dst
+			if tt.src == "file" {
+				writeFile(t, fsys, "src", "new")
+				fsys.Mkdir("dst", sandbox.DirMode)
+				writeFile(t, fsys, "dst/important.txt", "keep")
+			} else {
+				fsys.Mkdir("src", sandbox.DirMode)
+				writeFile(t, fsys, "src/new.txt", "new")
+				writeFile(t, fsys, "dst", "keep")
+			}
+
+			op := &Op{Src: fsys, SrcName: "src", Dst: fsys, DstName: "dst", Policy: tt.policy}
+			run := op.Copy
+			if tt.move {
+				run = op.Move
+			}
+			err := run(context.Background())
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+
+			info, lerr := fsys.Lstat("dst")
+			if lerr != nil {
+				t.Fatal(lerr)
+			}
+			if tt.err != nil {
+				// Nothing changed on either side
+				kept := "dst"
+				if tt.src == "file" {
+					kept = "dst/important.txt"
+				}
+				if info.IsDir() == (tt.src == "dir") || readFile(t, fsys, kept) != "keep" {
+					t.Error("the target was replaced")
+				}
+				if _, err := fsys.Lstat("src"); err != nil {
+					t.Errorf("the source is gone: %v", err)
+				}
+				return
+			}
+
+			// The target is an exact copy of the source
+			if info.IsDir() != (tt.src == "dir") {
+				t.Fatalf("the target wasn't replaced")
+			}
+			want, got := "new", ""
+			if tt.src == "file" {
+				got = readFile(t, fsys, "dst")
+			} else {
+				got = readFile(t, fsys, "dst/new.txt")
+				if _, err := fsys.Lstat("dst/important.txt"); err == nil {
+					t.Error("the old content was merged in")
+				}
+			}
+			if got != want {
+				t.Errorf("target holds %q, want %q", got, want)
+			}
+			if _, err := fsys.Lstat("src"); tt.move != errors.Is(err, os.ErrNotExist) {
+				t.Errorf("source after the %s: %v", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestSameKinds(t *testing.T) {
+	tests := []struct {
+		policy Policy
+		file   string // content of dst/a.txt afterwards
+		kept   bool   // whether dst/b.txt is still there
+	}{
+		{Merge, "new", true},
+		{Skip, "old", true},
+		{Overwrite, "new", false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			fsys := newFS(t)
+			fsys.MkdirAll("src", sandbox.DirMode)
+			fsys.MkdirAll("dst", sandbox.DirMode)
+			writeFile(t, fsys, "src/a.txt", "new")
+			writeFile(t, fsys, "dst/a.txt", "old")
+			writeFile(t, fsys, "dst/b.txt", "b")
+
+			op := &Op{Src: fsys, SrcName: "src", Dst: fsys, DstName: "dst", Policy: tt.policy}
+			if err := op.Copy(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if got := readFile(t, fsys, "dst/a.txt"); got != tt.file {
+				t.Errorf("dst/a.txt holds %q, want %q", got, tt.file)
+			}
+			if _, err := fsys.Lstat("dst/b.txt"); (err == nil) != tt.kept {
+				t.Errorf("dst/b.txt: %v, want kept %v", err, tt.kept)
+			}
+		})
+	}
+}
+
+func TestMoveAcrossDevices(t *testing.T) {
+	rename = func(*sandbox.FS, string, string) error {
+		return &os.LinkError{Op: "rename", Err: syscall.EXDEV}
+	}
+	defer func() { rename = (*sandbox.FS).Rename }()
+
+	fsys := newFS(t)
+	fsys.MkdirAll("src/sub", sandbox.DirMode)
+	writeFile(t, fsys, "src/sub/a.txt", "a")
+	if err := fsys.Chmod("src/sub/a.txt", 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := fsys.Chtimes("src/sub/a.txt", mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	var moved [][2]string
+	op := &Op{Src: fsys, SrcName: "src", Dst: fsys, DstName: "dst", Policy: Merge,
+		OnMoved: func(src, dst string) { moved = append(moved, [2]string{src, dst}) }}
+	if err := op.Move(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, fsys, "dst/sub/a.txt"); got != "a" {
+		t.Errorf("the copy holds %q", got)
+	}
+	info, err := fsys.Lstat("dst/sub/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 || !info.ModTime().Equal(mtime) {
+		t.Errorf("the copy has mode %v and time %v", info.Mode(), info.ModTime())
+	}
+	if _, err := fsys.Lstat("src"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the source is still there: %v", err)
+	}
+	if len(moved) != 1 || moved[0] != [2]string{"src", "dst"} {
+		t.Errorf("reported moves %v, want src to dst", moved)
+	}
+	if p := op.Progress(); p.Files != 1 {
+		t.Errorf("counted %d files, want 1", p.Files)
+	}
+}
+
+func TestIntoItself(t *testing.T) {
+	fsys := newFS(t)
+	other := newFS(t)
+	fsys.MkdirAll("dir/sub", sandbox.DirMode)
+	writeFile(t, fsys, "dir/a.txt", "a")
+
+	tests := []struct {
+		src, dst string
+		dstFS    *sandbox.FS
+		err      error
+	}{
+		{"dir", "dir", fsys, ErrIntoItself},
+		{"dir", "dir/sub/copy", fsys, ErrIntoItself},
+		{".", "dir/copy", fsys, ErrIntoItself},
+		{"dir", "dir2", fsys, nil},
+		{"dir", "dir/sub/copy", other, nil},
+	}
+	for _, tt := range tests {
+		op := &Op{Src: fsys, SrcName: tt.src, Dst: tt.dstFS, DstName: tt.dst, Policy: Merge}
+		if err := op.Check(); err != tt.err {
+			t.Errorf("Check(%s, %s): got %v, want %v", tt.src, tt.dst, err, tt.err)
+		}
+		if tt.err == nil {
+			continue
+		}
+		if err := op.Copy(context.Background()); err != tt.err {
+			t.Errorf("Copy(%s, %s): got %v", tt.src, tt.dst, err)
+		}
+		if err := op.Move(context.Background()); err != tt.err {
+			t.Errorf("Move(%s, %s): got %v", tt.src, tt.dst, err)
+		}
+	}
+	if _, err := fsys.Lstat("dir/sub/copy"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a refused copy left %v", err)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	for in, want := range map[string]Policy{"": Merge, "merge": Merge, "overwrite": Overwrite, "skip": Skip} {
+		if got, err := ParsePolicy(in); err != nil || got != want {
+			t.Errorf("ParsePolicy(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParsePolicy("replace"); err == nil {
+		t.Error("ParsePolicy accepted an unknown policy")
+	}
+}
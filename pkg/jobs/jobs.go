@@ -0,0 +1,484 @@
+// Package jobs runs long file operations in the background on a pool of
+// workers. Jobs are kept in the database so they can be watched, cancelled
+// and picked up again after a restart.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/fileops"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// State is where a job is in its life
+type State string
+
+const (
+	Queued    State = "queued"
+	Running   State = "running"
+	Done      State = "done"
+	Failed    State = "failed"
+	Cancelled State = "cancelled"
+)
+
+// Finished reports whether the job can't change anymore
+func (s State) Finished() bool {
+	return s == Done || s == Failed || s == Cancelled
+}
+
+var (
+	// ErrNotFound is returned for an unknown job ID
+	ErrNotFound = errors.New("job not found")
+	// ErrFinished is returned when cancelling a job that already ended
+	ErrFinished = errors.New("job already finished")
+	// ErrUnknownKind is returned when submitting a job nobody can run
+	ErrUnknownKind = errors.New("unknown job kind")
+)
+
+const (
+	// keepFinished is how many finished jobs are remembered
+	keepFinished = 100
+	// maxAttempts bounds how often a job interrupted by restarts is resumed,
+	// so a job that crashes the server doesn't do so forever
+	maxAttempts = 3
+	// saveInterval is how often the progress of a running job is stored
+	saveInterval = 2 * time.Second
+)
+
+// Job is a snapshot of one piece of background work
+type Job struct {
+	ID       string           `json:"id"`
+	Kind     string           `json:"kind"`
+	Source   string           `json:"source"`
+	Target   string           `json:"target"`
+	Params   json.RawMessage  `json:"params,omitempty"`
+	State    State            `json:"state"`
+	Progress fileops.Progress `json:"progress"`
+	Error    string           `json:"error,omitempty"`
+	// Result is what the runner returned, for kinds that return something
+	Result json.RawMessage `json:"result,omitempty"`
+	// Attempts counts the runs; more than one means the job was resumed
+	// after a restart
+	Attempts int        `json:"attempts"`
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// Resumed reports whether the job runs again after a restart interrupted it
+func (j Job) Resumed() bool {
+	return j.Attempts > 1
+}
+
+// Runner does the work of one kind of job, reporting progress as it goes.
+// It should return once ctx is done. A non-nil result is stored with the
+// job as JSON, also when the job fails.
+type Runner func(ctx context.Context, job Job, progress func(fileops.Progress)) (result any, err error)
+
+type kind struct {
+	run Runner
+	// resumable kinds are run again after a restart; others fail
+	resumable bool
+}
+
+type entry struct {
+	job    Job
+	ctx    context.Context // set while running
+	cancel context.CancelFunc
+	saved  time.Time // when the progress was last stored
+}
+
+// Manager queues jobs, runs them on its workers and keeps them in the
+// database
+type Manager struct {
+	workers int
+
+	mu     sync.Mutex
+	kinds  map[string]kind
+	active map[string]*entry // queued and running jobs
+	queue  []string          // IDs of queued jobs, oldest first
+	subs   map[chan struct{}]struct{}
+	wake   chan struct{}
+}
+
+// NewManager returns a manager that runs up to workers jobs at once. Kinds
+// are registered before Start.
+func NewManager(workers int) *Manager {
+	return &Manager{
+		workers: max(workers, 1),
+		kinds:   make(map[string]kind),
+		active:  make(map[string]*entry),
+		subs:    make(map[chan struct{}]struct{}),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Register sets the runner of a kind of job. Resumable kinds are started
+// again after a restart interrupted them; the others are marked failed.
+func (m *Manager) Register(name string, run Runner, resumable bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kinds[name] = kind{run: run, resumable: resumable}
+}
+
+// Start recovers the jobs left queued or running by the previous run and
+// starts the workers. The database must be open.
+func (m *Manager) Start() error {
+	stored, err := db.GetJobs(string(Queued), string(Running))
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	// Oldest first, so the queue keeps its order
+	for _, rec := range slices.Backward(stored) {
+		if _, ok := m.active[rec.ID]; ok {
+			// Submitted before Start, already queued
+			continue
+		}
+		job := fromRecord(rec)
+		k, known := m.kinds[job.Kind]
+		switch {
+		case !known:
+			m.fail(&job, "unknown job kind "+job.Kind)
+		case job.State == Running && !k.resumable:
+			m.fail(&job, "interrupted by a restart")
+		case job.State == Running && job.Attempts >= maxAttempts:
+			m.fail(&job, fmt.Sprintf("interrupted by a restart %d times", job.Attempts))
+		default:
+			if job.State == Running {
+				logger.Info("Resuming %s job %s interrupted by a restart", job.Kind, job.ID)
+			}
+			job.State = Queued
+			m.active[job.ID] = &entry{job: job}
+			m.queue = append(m.queue, job.ID)
+			db.SaveJob(toRecord(job))
+		}
+	}
+	m.mu.Unlock()
+
+	for range m.workers {
+		go m.work()
+	}
+	m.signal()
+	return nil
+}
+
+// fail stores a job that can't run anymore
+func (m *Manager) fail(job *Job, reason string) {
+	logger.Warn("Job %s (%s) failed: %s", job.ID, job.Kind, reason)
+	now := time.Now()
+	job.State = Failed
+	job.Error = reason
+	job.Finished = &now
+	db.SaveJob(toRecord(*job))
+}
+
+// Submit queues a job of a registered kind. Params are stored as JSON and
+// handed back to the runner.
+func (m *Manager) Submit(kindName, source, target string, params any) (Job, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return Job{}, err
+	}
+	job := Job{
+		ID:      newID(),
+		Kind:    kindName,
+		Source:  source,
+		Target:  target,
+		Params:  raw,
+		State:   Queued,
+		Created: time.Now(),
+	}
+
+	m.mu.Lock()
+	if _, ok := m.kinds[kindName]; !ok {
+		m.mu.Unlock()
+		return Job{}, fmt.Errorf("%w: %s", ErrUnknownKind, kindName)
+	}
+	if err := db.SaveJob(toRecord(job)); err != nil {
+		m.mu.Unlock()
+		return Job{}, err
+	}
+	m.active[job.ID] = &entry{job: job}
+	m.queue = append(m.queue, job.ID)
+	m.mu.Unlock()
+
+	m.signal()
+	m.notify()
+	return job, nil
+}
+
+// Get returns the job with the ID
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	e, ok := m.active[id]
+	if ok {
+		job := e.job
+		m.mu.Unlock()
+		return job, nil
+	}
+	m.mu.Unlock()
+
+	rec, err := db.GetJob(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Job{}, ErrNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	return fromRecord(rec), nil
+}
+
+// List returns every job, newest first, with the live progress of the
+// active ones
+func (m *Manager) List() ([]Job, error) {
+	stored, err := db.GetJobs()
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]Job, 0, len(stored))
+	for _, rec := range stored {
+		if e, ok := m.active[rec.ID]; ok {
+			list = append(list, e.job)
+		} else {
+			list = append(list, fromRecord(rec))
+		}
+	}
+	return list, nil
+}
+
+// Active returns the queued and running jobs, oldest first
+func (m *Manager) Active() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]Job, 0, len(m.active))
+	for _, e := range m.active {
+		list = append(list, e.job)
+	}
+	slices.SortFunc(list, func(a, b Job) int { return a.Created.Compare(b.Created) })
+	return list
+}
+
+// Cancel stops a job. A queued job is cancelled right away; a running one
+// reports Cancelled once its runner has returned.
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	e, ok := m.active[id]
+	if !ok {
+		m.mu.Unlock()
+		job, err := m.Get(id)
+		if err != nil {
+			return Job{}, err
+		}
+		return job, ErrFinished
+	}
+
+	if e.job.State == Queued {
+		now := time.Now()
+		e.job.State = Cancelled
+		e.job.Finished = &now
+		m.queue = slices.DeleteFunc(m.queue, func(q string) bool { return q == id })
+		delete(m.active, id)
+		db.SaveJob(toRecord(e.job))
+	} else {
+		e.cancel()
+	}
+	job := e.job
+	m.mu.Unlock()
+
+	m.notify()
+	return job, nil
+}
+
+// Subscribe returns a channel that receives a value whenever a job changes,
+// and a function to stop the subscription. Changes that come in faster than
+// they're read are coalesced.
+func (m *Manager) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	m.mu.Lock()
+	m.subs[ch] = struct{}{}
+	m.mu.Unlock()
+	return ch, func() {
+		m.mu.Lock()
+		delete(m.subs, ch)
+		m.mu.Unlock()
+	}
+}
+
+func (m *Manager) notify() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ch := range m.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// signal wakes a worker if there's work queued
+func (m *Manager) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Manager) work() {
+	for range m.wake {
+		for {
+			e, k := m.next()
+			if e == nil {
+				break
+			}
+			m.run(e, k.run)
+		}
+	}
+}
+
+// next takes the oldest queued job and marks it running
+func (m *Manager) next() (*entry, kind) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.queue) == 0 {
+		return nil, kind{}
+	}
+	e := m.active[m.queue[0]]
+	m.queue = m.queue[1:]
+	// Let another worker pick up the rest
+	if len(m.queue) > 0 {
+		m.signal()
+	}
+
+	now := time.Now()
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+	e.job.State = Running
+	e.job.Started = &now
+	e.job.Attempts++
+	e.saved = now
+	db.SaveJob(toRecord(e.job))
+	return e, m.kinds[e.job.Kind]
+}
+
+func (m *Manager) run(e *entry, run Runner) {
+	m.mu.Lock()
+	job := e.job
+	m.mu.Unlock()
+	m.notify()
+	logger.Info("Running %s job %s", job.Kind, job.ID)
+
+	result, err := run(e.ctx, job, func(p fileops.Progress) {
+		m.mu.Lock()
+		e.job.Progress = p
+		save := time.Since(e.saved) >= saveInterval
+		if save {
+			e.saved = time.Now()
+			db.SaveJob(toRecord(e.job))
+		}
+		m.mu.Unlock()
+		m.notify()
+	})
+
+	cancelled := e.ctx.Err() != nil
+	e.cancel()
+
+	m.mu.Lock()
+	now := time.Now()
+	e.job.Finished = &now
+	if result != nil {
+		if raw, merr := json.Marshal(result); merr == nil {
+			e.job.Result = raw
+		}
+	}
+	switch {
+	case err != nil && cancelled:
+		e.job.State = Cancelled
+	case err != nil:
+		e.job.State = Failed
+		e.job.Error = err.Error()
+	default:
+		e.job.State = Done
+	}
+	delete(m.active, e.job.ID)
+	db.SaveJob(toRecord(e.job))
+	job = e.job
+	m.mu.Unlock()
+
+	db.PruneJobs(keepFinished, string(Done), string(Failed), string(Cancelled))
+	m.notify()
+	if err != nil && job.State == Failed {
+		logger.Error("%s job %s failed: %v", job.Kind, job.ID, err)
+	} else {
+		logger.Info("%s job %s %s", job.Kind, job.ID, job.State)
+	}
+}
+
+func toRecord(j Job) *db.Job {
+	return &db.Job{
+		ID:         j.ID,
+		Kind:       j.Kind,
+		Source:     j.Source,
+		Target:     j.Target,
+		Params:     string(j.Params),
+		Result:     string(j.Result),
+		State:      string(j.State),
+		Attempts:   j.Attempts,
+		Error:      j.Error,
+		Files:      j.Progress.Files,
+		Bytes:      j.Progress.Bytes,
+		Skipped:    j.Progress.Skipped,
+		TotalFiles: j.Progress.TotalFiles,
+		TotalBytes: j.Progress.TotalBytes,
+		CreatedAt:  j.Created,
+		StartedAt:  j.Started,
+		FinishedAt: j.Finished,
+	}
+}
+
+func fromRecord(r db.Job) Job {
+	j := Job{
+		ID:       r.ID,
+		Kind:     r.Kind,
+		Source:   r.Source,
+		Target:   r.Target,
+		State:    State(r.State),
+		Attempts: r.Attempts,
+		Error:    r.Error,
+		Progress: fileops.Progress{
+			Files:      r.Files,
+			Bytes:      r.Bytes,
+			Skipped:    r.Skipped,
+			TotalFiles: r.TotalFiles,
+			TotalBytes: r.TotalBytes,
+		},
+		Created:  r.CreatedAt,
+		Started:  r.StartedAt,
+		Finished: r.FinishedAt,
+	}
+	if r.Params != "" {
+		j.Params = json.RawMessage(r.Params)
+	}
+	if r.Result != "" {
+		j.Result = json.RawMessage(r.Result)
+	}
+	return j
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,281 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/fileops"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+)
+
+// TestMain gives the tests a database of their own in a temporary data
+// directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "beamdrop-jobs-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	config.SetDataDir(dir)
+	logger.SetOutput(io.Discard)
+	if err := db.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	db.AutoMigrate()
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// wait polls the job until it's in state, failing the test if it ends in
+// another one
+func wait(t *testing.T, m *Manager, id string, state State) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.State == state {
+			return job
+		}
+		if job.State.Finished() || time.Now().After(deadline) {
+			t.Fatalf("job %s is %s (%s), want %s", id, job.State, job.Error, state)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// blocker is a runner that holds its jobs until they're released or
+// cancelled, counting how many run at once
+type blocker struct {
+	mu      sync.Mutex
+	running int
+	most    int
+	release chan struct{}
+}
+
+func newBlocker() *blocker {
+	return &blocker{release: make(chan struct{})}
+}
+
+func (b *blocker) run(ctx context.Context, job Job, progress func(fileops.Progress)) (any, error) {
+	b.mu.Lock()
+	b.running++
+	b.most = max(b.most, b.running)
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.running--
+		b.mu.Unlock()
+	}()
+
+	select {
+	case <-b.release:
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// states counts the active jobs of m by state
+func states(m *Manager) map[State]int {
+	counts := make(map[State]int)
+	for _, job := range m.Active() {
+		counts[job.State]++
+	}
+	return counts
+}
+
+func TestQueueOrder(t *testing.T) {
+	var mu sync.Mutex
+	var ran []string
+	m := NewManager(1)
+	m.Register("order", func(ctx context.Context, job Job, progress func(fileops.Progress)) (any, error) {
+		mu.Lock()
+		ran = append(ran, job.Source)
+		mu.Unlock()
+		return nil, nil
+	}, true)
+
+	// Queued before the worker starts, so the order can't come from timing
+	var ids []string
+	for _, source := range []string{"a", "b", "c", "d", "e"} {
+		job, err := m.Submit("order", source, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, job.ID)
+	}
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		wait(t, m, id, Done)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(ran, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("ran %v, want the order of submission", ran)
+	}
+
+	if _, err := m.Submit("missing", "", "", nil); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("submitting an unknown kind: got %v", err)
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	b := newBlocker()
+	m := NewManager(2)
+	m.Register("block", b.run, true)
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for range 4 {
+		job, err := m.Submit("block", "", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, job.ID)
+	}
+	wait(t, m, ids[0], Running)
+	wait(t, m, ids[1], Running)
+	// Give a third worker, if there were one, the time to start
+	time.Sleep(50 * time.Millisecond)
+	if got := states(m); got[Running] != 2 || got[Queued] != 2 {
+		t.Errorf("got %v, want 2 running and 2 queued", got)
+	}
+
+	close(b.release)
+	for _, id := range ids {
+		wait(t, m, id, Done)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.most != 2 {
+		t.Errorf("%d jobs ran at once, want 2", b.most)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	b := newBlocker()
+	m := NewManager(1)
+	m.Register("block", b.run, true)
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	running, err := m.Submit("block", "running", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, m, running.ID, Running)
+	queued, err := m.Submit("block", "queued", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A queued job is cancelled at once and never runs
+	job, err := m.Cancel(queued.ID)
+	if err != nil || job.State != Cancelled || job.Finished == nil {
+		t.Fatalf("cancelling the queued job: got %s, %v", job.State, err)
+	}
+	if rec, err := db.GetJob(queued.ID); err != nil || rec.State != string(Cancelled) {
+		t.Errorf("stored queued job: got %q, %v", rec.State, err)
+	}
+
+	// A running one once its runner returns
+	job, err = m.Cancel(running.ID)
+	if err != nil || job.State != Running {
+		t.Fatalf("cancelling the running job: got %s, %v", job.State, err)
+	}
+	job = wait(t, m, running.ID, Cancelled)
+	if job.Error != "" {
+		t.Errorf("a cancelled job has the error %q", job.Error)
+	}
+	if job, _ := m.Get(queued.ID); job.Attempts != 0 {
+		t.Errorf("the cancelled queued job ran %d times", job.Attempts)
+	}
+
+	if _, err := m.Cancel(running.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("cancelling a finished job: got %v", err)
+	}
+	if _, err := m.Cancel("nonexistent"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("cancelling an unknown job: got %v", err)
+	}
+}
+
+// stored saves a job as a previous run of the server left it
+func stored(t *testing.T, kind string, state State, attempts int, created time.Time) string {
+	t.Helper()
+	job := Job{ID: newID(), Kind: kind, Source: kind, State: state, Attempts: attempts, Created: created}
+	if err := db.SaveJob(toRecord(job)); err != nil {
+		t.Fatal(err)
+	}
+	return job.ID
+}
+
+func TestStartAfterRestart(t *testing.T) {
+	created := time.Now().Add(-time.Hour)
+	var (
+		resumed     = stored(t, "resumable", Running, 1, created)
+		exhausted   = stored(t, "resumable", Running, maxAttempts, created.Add(time.Second))
+		interrupted = stored(t, "once", Running, 1, created.Add(2*time.Second))
+		first       = stored(t, "once", Queued, 0, created.Add(3*time.Second))
+		second      = stored(t, "resumable", Queued, 0, created.Add(4*time.Second))
+		unknown     = stored(t, "gone", Queued, 0, created.Add(5*time.Second))
+	)
+
+	var mu sync.Mutex
+	var ran []string
+	run := func(ctx context.Context, job Job, progress func(fileops.Progress)) (any, error) {
+		mu.Lock()
+		ran = append(ran, job.ID)
+		mu.Unlock()
+		return nil, nil
+	}
+	m := NewManager(1)
+	m.Register("resumable", run, true)
+	m.Register("once", run, false)
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	job := wait(t, m, resumed, Done)
+	if job.Attempts != 2 || !job.Resumed() {
+		t.Errorf("resumed job: %d attempts, resumed %v", job.Attempts, job.Resumed())
+	}
+	if job := wait(t, m, exhausted, Failed); job.Attempts != maxAttempts || job.Error != "interrupted by a restart 3 times" {
+		t.Errorf("job out of attempts: %d attempts, error %q", job.Attempts, job.Error)
+	}
+	if job := wait(t, m, interrupted, Failed); job.Error != "interrupted by a restart" {
+		t.Errorf("interrupted job that can't resume: error %q", job.Error)
+	}
+	if job := wait(t, m, unknown, Failed); job.Error != "unknown job kind gone" {
+		t.Errorf("job of an unknown kind: error %q", job.Error)
+	}
+	// Queued jobs run whatever their kind, since none of their work was done
+	wait(t, m, first, Done)
+	wait(t, m, second, Done)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(ran, []string{resumed, first, second}) {
+		t.Errorf("ran %v, want %v", ran, []string{resumed, first, second})
+	}
+}
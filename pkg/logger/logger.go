@@ -23,6 +23,23 @@ const (
 	FATAL
 )
 
+// ParseLevel converts a level name such as "debug" or "warn" into a LogLevel
+func ParseLevel(name string) (LogLevel, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return DEBUG, nil
+	case "info", "":
+		return INFO, nil
+	case "warn", "warning":
+		return WARN, nil
+	case "error":
+		return ERROR, nil
+	case "fatal":
+		return FATAL, nil
+	}
+	return INFO, fmt.Errorf("unknown log level %q", name)
+}
+
 // Logger represents a colorful terminal logger
 type Logger struct {
 	mu         sync.Mutex
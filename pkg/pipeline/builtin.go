@@ -0,0 +1,156 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // decoders for thumbnails
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"strconv"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/sniff"
+)
+
+const (
+	// ThumbnailSize is the longest side of a thumbnail in pixels
+	ThumbnailSize = 256
+	// maxPixels bounds the images that are thumbnailed, as decoding takes
+	// 4 to 8 bytes of memory per pixel
+	maxPixels = 50_000_000
+)
+
+// ctxReader stops reading once the context is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// hashProcessor records the SHA-256 of the content
+type hashProcessor struct{}
+
+func (hashProcessor) Process(ctx context.Context, f *File) (map[string]string, []byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, ctxReader{ctx, r}); err != nil {
+		return nil, nil, err
+	}
+	return map[string]string{"sha256": hex.EncodeToString(h.Sum(nil))}, nil, nil
+}
+
+// mimeProcessor records the type of the content, sniffed from its first
+// bytes, and the type its extension claims
+type mimeProcessor struct{}
+
+func (mimeProcessor) Process(ctx context.Context, f *File) (map[string]string, []byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	head := make([]byte, sniff.Size)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, nil, err
+	}
+	out := map[string]string{"mimeType": sniff.Type(head[:n])}
+	if byExt := sniff.ByExtension(f.Name); byExt != "" {
+		out["extensionType"] = byExt
+	}
+	return out, nil, nil
+}
+
+// thumbnailProcessor makes a JPEG thumbnail of GIF, JPEG and PNG images
+type thumbnailProcessor struct{}
+
+func (thumbnailProcessor) Process(ctx context.Context, f *File) (map[string]string, []byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, nil, ErrSkip
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, nil, fmt.Errorf("image of %dx%d pixels is too large", cfg.Width, cfg.Height)
+	}
+
+	r.Close()
+	if r, err = f.Open(); err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	img, _, err := image.Decode(ctxReader{ctx, r})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w, h := cfg.Width, cfg.Height
+	if w > ThumbnailSize || h > ThumbnailSize {
+		if w >= h {
+			w, h = ThumbnailSize, max(h*ThumbnailSize/w, 1)
+		} else {
+			w, h = max(w*ThumbnailSize/h, 1), ThumbnailSize
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scale(img, w, h), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, nil, err
+	}
+	return map[string]string{
+		"width":     strconv.Itoa(cfg.Width),
+		"height":    strconv.Itoa(cfg.Height),
+		"thumbnail": "image/jpeg",
+	}, buf.Bytes(), nil
+}
+
+// scale shrinks src to w by h pixels, averaging the pixels that make up
+// each new one, over a white background
+func scale(src image.Image, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	b := src.Bounds()
+	for y := range h {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(b.Min.Y+(y+1)*b.Dy()/h, y0+1)
+		for x := range w {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(b.Min.X+(x+1)*b.Dx()/w, x0+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			// Colors are premultiplied, so white shows through by 1 - alpha
+			white := 0xffff - a/n
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r/n + white),
+				G: uint16(g/n + white),
+				B: uint16(bl/n + white),
+				A: 0xffff,
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,117 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxCommandOutput bounds what's kept of a command's stdout and stderr
+const maxCommandOutput = 64 << 10
+
+// commandProcessor runs an external program on the file. The program finds
+// the file and what's known about it in the environment:
+//
+//	BEAMDROP_FILE    path of the file on the host
+//	BEAMDROP_PATH    path of the file in the API
+//	BEAMDROP_NAME    base name of the file
+//	BEAMDROP_SIZE    size in bytes
+//	BEAMDROP_CLIENT  who uploaded it
+//
+// and the outputs of earlier processors, like BEAMDROP_SHA256 or
+// BEAMDROP_MIME_TYPE. A JSON object printed to stdout becomes the output,
+// other text is kept as "stdout". Exiting non-zero is a failure.
+type commandProcessor struct {
+	command []string
+}
+
+func (c commandProcessor) Process(ctx context.Context, f *File) (map[string]string, []byte, error) {
+	host, err := f.Root.Resolve(f.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	env := os.Environ()
+	for k, v := range f.Outputs {
+		env = append(env, "BEAMDROP_"+envName(k)+"="+v)
+	}
+	env = append(env,
+		"BEAMDROP_FILE="+host,
+		"BEAMDROP_PATH="+f.Path,
+		"BEAMDROP_NAME="+path.Base(f.Name),
+		"BEAMDROP_SIZE="+strconv.FormatInt(f.Size, 10),
+		"BEAMDROP_CLIENT="+f.Client,
+	)
+
+	var stdout, stderr limitedBuffer
+	cmd := exec.CommandContext(ctx, c.command[0], c.command[1:]...)
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = 5 * time.Second
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, nil, err
+	}
+
+	out := strings.TrimSpace(stdout.String())
+	if out == "" {
+		return nil, nil, nil
+	}
+	var fields map[string]any
+	if json.Unmarshal([]byte(out), &fields) == nil {
+		output := make(map[string]string, len(fields))
+		for k, v := range fields {
+			if s, ok := v.(string); ok {
+				output[k] = s
+			} else {
+				b, _ := json.Marshal(v)
+				output[k] = string(b)
+			}
+		}
+		return output, nil, nil
+	}
+	return map[string]string{"stdout": out}, nil, nil
+}
+
+// envName turns an output key like "mimeType" into MIME_TYPE
+func envName(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		switch {
+		case unicode.IsUpper(r):
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToUpper(r))
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// limitedBuffer keeps the first maxCommandOutput bytes written to it and
+// discards the rest, so a chatty command can't exhaust memory
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxCommandOutput - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
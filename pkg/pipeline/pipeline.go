@@ -0,0 +1,209 @@
+// Package pipeline runs the configured processors on uploaded files, in
+// order: built-ins that hash, sniff and thumbnail files, and external
+// commands. Results are kept in the database, and a processor that fails
+// can have the file deleted or quarantined.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/quarantine"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+)
+
+// Actions a failure policy took
+const (
+	ActionDeleted     = "deleted"
+	ActionQuarantined = "quarantined"
+)
+
+// ErrSkip is returned by a processor that has nothing to do with a file,
+// like a thumbnailer given a PDF
+var ErrSkip = errors.New("not applicable")
+
+// File is a file going through the pipeline
+type File struct {
+	Root *sandbox.Root
+	// Name is the file's path inside Root, Path as the API names it
+	Name string
+	Path string
+	Size int64
+	// Client is who uploaded the file
+	Client string
+	// Outputs collects what the processors found so far
+	Outputs map[string]string
+}
+
+// Open opens the file for reading
+func (f *File) Open() (io.ReadCloser, error) {
+	return f.Root.Open(f.Name)
+}
+
+// Processor is one step of the pipeline. It returns what it found about
+// the file, and binary output like a thumbnail.
+type Processor interface {
+	Process(ctx context.Context, f *File) (output map[string]string, data []byte, err error)
+}
+
+type step struct {
+	config.Processor
+	proc Processor
+}
+
+// Pipeline is the configured chain of processors
+type Pipeline struct {
+	steps      []step
+	quarantine *quarantine.Store
+}
+
+// New builds the pipeline of the configured processors, which must be
+// valid. Failed files are quarantined into q.
+func New(processors []config.Processor, q *quarantine.Store) *Pipeline {
+	p := &Pipeline{quarantine: q}
+	for _, c := range processors {
+		if c.Timeout == 0 {
+			c.Timeout = config.DefaultProcessorTimeout
+		}
+		if c.OnFailure == "" {
+			c.OnFailure = config.OnFailureKeep
+		}
+		var proc Processor
+		switch c.Type {
+		case config.ProcessorHash:
+			proc = hashProcessor{}
+		case config.ProcessorMIME:
+			proc = mimeProcessor{}
+		case config.ProcessorThumbnail:
+			proc = thumbnailProcessor{}
+		case config.ProcessorCommand:
+			proc = commandProcessor{command: c.Command}
+		default:
+			continue
+		}
+		p.steps = append(p.steps, step{Processor: c, proc: proc})
+	}
+	return p
+}
+
+// Enabled reports whether any processors are configured
+func (p *Pipeline) Enabled() bool {
+	return len(p.steps) > 0
+}
+
+// Run runs the processors on the file in order and records their results,
+// replacing those of earlier runs. A failure whose policy deletes or
+// quarantines the file ends the run. Nothing is recorded when ctx is done
+// before the end.
+func (p *Pipeline) Run(ctx context.Context, f *File) ([]db.ProcessingResult, error) {
+	info, err := f.Root.Lstat(f.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil
+	}
+	f.Size = info.Size()
+	if f.Outputs == nil {
+		f.Outputs = make(map[string]string)
+	}
+
+	var results []db.ProcessingResult
+	for _, s := range p.steps {
+		if !s.matches(f.Name) {
+			continue
+		}
+		res := s.run(ctx, f)
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		if res.Status == db.ProcessingFailed {
+			logger.Warn("Processor %s failed on %s: %s", s.Name, f.Path, res.Error)
+			res.Action = p.fail(s, f, res.Error)
+		}
+		results = append(results, res)
+		if res.Action != "" {
+			break
+		}
+	}
+	return results, db.SaveProcessingResults(f.Path, results)
+}
+
+// run runs one processor within its timeout
+func (s step) run(ctx context.Context, f *File) db.ProcessingResult {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	started := time.Now()
+	output, data, err := s.proc.Process(ctx, f)
+	res := db.ProcessingResult{
+		Path:       f.Path,
+		Processor:  s.Name,
+		Status:     db.ProcessingDone,
+		Output:     output,
+		Data:       data,
+		DurationMS: time.Since(started).Milliseconds(),
+		CreatedAt:  started,
+	}
+	switch {
+	case errors.Is(err, ErrSkip):
+		res.Status = db.ProcessingSkipped
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		res.Status, res.Error = db.ProcessingFailed, fmt.Sprintf("timed out after %s", s.Timeout)
+	case err != nil:
+		res.Status, res.Error = db.ProcessingFailed, err.Error()
+	}
+	for k, v := range output {
+		f.Outputs[k] = v
+	}
+	return res
+}
+
+// matches reports whether the processor is for the file
+func (s step) matches(name string) bool {
+	if len(s.Match) == 0 {
+		return true
+	}
+	for _, pattern := range s.Match {
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fail applies the failure policy of the step to the file and returns the
+// action taken
+func (p *Pipeline) fail(s step, f *File, reason string) string {
+	switch s.OnFailure {
+	case config.OnFailureDelete:
+		if err := f.Root.RemoveAll(f.Name); err != nil {
+			logger.Error("Failed to delete %s after processor %s failed: %v", f.Path, s.Name, err)
+			return ""
+		}
+		db.ForgetPaths(f.Path)
+		logger.Warn("Deleted %s: processor %s failed", f.Path, s.Name)
+		return ActionDeleted
+
+	case config.OnFailureQuarantine:
+		_, err := p.quarantine.Put(f.Root, f.Name, db.QuarantinedFile{
+			Path:   f.Path,
+			Source: "processor:" + s.Name,
+			Reason: reason,
+			Client: f.Client,
+		})
+		if err != nil {
+			logger.Error("Failed to quarantine %s after processor %s failed: %v", f.Path, s.Name, err)
+			return ""
+		}
+		db.ForgetPaths(f.Path)
+		return ActionQuarantined
+	}
+	return ""
+}
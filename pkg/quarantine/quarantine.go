@@ -0,0 +1,98 @@
+// Package quarantine takes suspicious files out of the shared roots into a
+// directory of the data directory, where nobody can reach them through the
+// server, and keeps an audit record of each
+package quarantine
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/fileops"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+	"github.com/tachRoutine/beamdrop-go/pkg/sandbox"
+)
+
+// Store is the quarantine directory
+type Store struct {
+	fs *sandbox.FS
+}
+
+// Open opens the quarantine directory, creating it readable by the server's
+// user only
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	fs, err := sandbox.New(dir, sandbox.SymlinksDeny)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{fs: fs}, nil
+}
+
+// Dir returns the quarantine directory
+func (s *Store) Dir() string {
+	return s.fs.Dir()
+}
+
+// Put moves the file name out of the root into quarantine. rec describes it;
+// its ID and time are filled in and it's recorded.
+func (s *Store) Put(root *sandbox.Root, name string, rec db.QuarantinedFile) (db.QuarantinedFile, error) {
+	rec.ID = newID()
+	rec.CreatedAt = time.Now()
+	if info, err := root.Lstat(name); err == nil {
+		rec.Size = info.Size()
+	}
+	op := &fileops.Op{Src: root.FS, SrcName: name, Dst: s.fs, DstName: rec.ID, Policy: fileops.Overwrite}
+	if err := op.Move(context.Background()); err != nil {
+		return rec, err
+	}
+	return rec, s.record(&rec)
+}
+
+// Add stores content that never made it into a root, like an infected
+// upload, in quarantine. rec describes it as in Put.
+func (s *Store) Add(r io.Reader, rec db.QuarantinedFile) (db.QuarantinedFile, error) {
+	rec.ID = newID()
+	rec.CreatedAt = time.Now()
+	out, err := s.fs.CreateAtomic(rec.ID, 0600)
+	if err != nil {
+		return rec, err
+	}
+	if rec.Size, err = io.Copy(out, r); err != nil {
+		out.Abort()
+		return rec, err
+	}
+	if err := out.Commit(); err != nil {
+		return rec, err
+	}
+	return rec, s.record(&rec)
+}
+
+// record keeps the audit record of a file just quarantined
+func (s *Store) record(rec *db.QuarantinedFile) error {
+	if err := db.AddQuarantined(rec); err != nil {
+		return err
+	}
+	logger.Warn("Quarantined %s (%s): %s", rec.Path, rec.Source, rec.Reason)
+	return nil
+}
+
+// Delete removes a quarantined file for good
+func (s *Store) Delete(id string) error {
+	if err := s.fs.RemoveAll(id); err != nil {
+		return err
+	}
+	return db.DeleteQuarantined(id)
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,179 @@
+package sandbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Modes of the files and directories the server creates, before the umask
+const (
+	FileMode os.FileMode = 0644
+	DirMode  os.FileMode = 0755
+)
+
+// Temporary files are named TempPrefix + 16 hex digits + TempSuffix
+const (
+	TempPrefix = ".beamdrop-"
+	TempSuffix = ".tmp"
+)
+
+// IsTemp reports whether name is the base name of an AtomicFile still being
+// written, or left behind by a crash
+func IsTemp(name string) bool {
+	if !strings.HasPrefix(name, TempPrefix) || !strings.HasSuffix(name, TempSuffix) {
+		return false
+	}
+	id := name[len(TempPrefix) : len(name)-len(TempSuffix)]
+	if len(id) != 16 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// AtomicFile is written under a temporary name in the directory of its
+// target and only shows up at the target, complete and synced, once it's
+// committed. Abort discards it.
+type AtomicFile struct {
+	*os.File
+	fs     *FS
+	tmp    string
+	name   string
+	closed bool
+}
+
+// CreateAtomic starts writing the file name. New files get perm; a file
+// that is replaced keeps the permission bits it had.
+func (s *FS) CreateAtomic(name string, perm os.FileMode) (*AtomicFile, error) {
+	name, err := s.check(name, false)
+	if err != nil {
+		return nil, err
+	}
+	if name == "." {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+
+	for range 10 {
+		b := make([]byte, 8)
+		rand.Read(b)
+		tmp := path.Join(path.Dir(name), TempPrefix+hex.EncodeToString(b)+TempSuffix)
+		f, err := s.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &AtomicFile{File: f, fs: s, tmp: tmp, name: name}, nil
+	}
+	return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrExist}
+}
+
+// sync flushes and closes the temporary file once
+func (f *AtomicFile) sync() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	err := f.File.Sync()
+	if cerr := f.File.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Commit moves the file into place, replacing whatever is there
+func (f *AtomicFile) Commit() error {
+	if err := f.sync(); err != nil {
+		f.Abort()
+		return err
+	}
+	if info, err := f.fs.Lstat(f.name); err == nil && info.Mode().IsRegular() {
+		f.fs.Chmod(f.tmp, info.Mode().Perm())
+	}
+	if err := f.fs.Rename(f.tmp, f.name); err != nil {
+		f.Abort()
+		return err
+	}
+	f.fs.syncDir(path.Dir(f.name))
+	return nil
+}
+
+// CommitNew moves the file to name, which must be in the same directory,
+// unless that name is taken; then it fails with fs.ErrExist and the file
+// can still be committed elsewhere or aborted.
+func (f *AtomicFile) CommitNew(name string) error {
+	if err := f.sync(); err != nil {
+		f.Abort()
+		return err
+	}
+	err := f.fs.Link(f.tmp, name)
+	if errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	if err != nil {
+		// Not every file system has hard links; fall back to a check and a
+		// rename, which can race with another writer
+		if _, serr := f.fs.Lstat(name); serr == nil {
+			return &fs.PathError{Op: "create", Path: name, Err: fs.ErrExist}
+		}
+		if err := f.fs.Rename(f.tmp, name); err != nil {
+			f.Abort()
+			return err
+		}
+	} else {
+		f.fs.Remove(f.tmp)
+	}
+	f.fs.syncDir(path.Dir(name))
+	return nil
+}
+
+// Abort discards the file. It's a no-op after a successful commit.
+func (f *AtomicFile) Abort() error {
+	if !f.closed {
+		f.closed = true
+		f.File.Close()
+	}
+	err := f.fs.Remove(f.tmp)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// syncDir makes a rename in dir durable, where the platform supports it
+func (s *FS) syncDir(dir string) {
+	if d, err := s.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// SweepTemp removes temporary files last written before the given time,
+// left behind by writes that never finished, and returns how many it
+// removed. Passing the start time of the server spares writes in progress.
+func (s *FS) SweepTemp(before time.Time) (int, error) {
+	removed := 0
+	err := fs.WalkDir(s.FS(), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip what can't be read rather than give up on the tree
+			return nil
+		}
+		if !d.Type().IsRegular() || !IsTemp(d.Name()) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().Before(before) {
+			if err := s.Remove(p); err == nil {
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
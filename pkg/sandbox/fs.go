@@ -0,0 +1,41 @@
+package sandbox
+
+import (
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+)
+
+// policyFS exposes an FS as an io/fs file system that obeys its policy
+type policyFS struct {
+	s *FS
+}
+
+func (p policyFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	return p.s.Open(name)
+}
+
+func (p policyFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return p.s.ReadDir(name)
+}
+
+func (p policyFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	return p.s.Stat(name)
+}
+
+func sortEntries(entries []os.DirEntry) []os.DirEntry {
+	slices.SortFunc(entries, func(a, b os.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries
+}
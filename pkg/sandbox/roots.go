@@ -0,0 +1,197 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// Access is the kind of operation a request performs on a root
+type Access int
+
+const (
+	// Read covers listing, downloading, searching and starring
+	Read Access = iota
+	// Write covers anything that changes existing content
+	Write
+	// Upload covers adding new files through an upload
+	Upload
+)
+
+var (
+	// ErrReadOnly is returned for changes to a read-only root
+	ErrReadOnly = errors.New("root is read-only")
+	// ErrUploadOnly is returned for anything but uploads to an upload-only root
+	ErrUploadOnly = errors.New("root only accepts uploads")
+	// ErrTopLevel is returned for changes to the virtual directory that holds
+	// the named roots
+	ErrTopLevel = errors.New("the top level only holds the shared roots")
+)
+
+// Mode restricts what every root allows, on top of the root's own options
+type Mode string
+
+const (
+	// ModeNormal applies only the options of each root
+	ModeNormal Mode = "normal"
+	// ModeReadOnly refuses every change
+	ModeReadOnly Mode = "read-only"
+	// ModeDropBox accepts uploads and refuses everything else, listings
+	// included
+	ModeDropBox Mode = "drop-box"
+)
+
+// ParseMode validates a mode name; "" is ModeNormal
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case "":
+		return ModeNormal, nil
+	case ModeNormal, ModeReadOnly, ModeDropBox:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown mode %q (want %s, %s or %s)", s, ModeNormal, ModeReadOnly, ModeDropBox)
+}
+
+// Allow reports whether the mode permits the access
+func (m Mode) Allow(a Access) error {
+	switch {
+	case m == ModeReadOnly && a != Read:
+		return ErrReadOnly
+	case m == ModeDropBox && a != Upload:
+		return ErrUploadOnly
+	}
+	return nil
+}
+
+// Root is a tree shared under a name, with the options it was configured with
+type Root struct {
+	Name string
+	*FS
+
+	ReadOnly   bool
+	UploadOnly bool
+	// Hidden roots aren't listed at the top level but can still be reached
+	// by name
+	Hidden bool
+}
+
+// Allow reports whether the root permits the access
+func (r *Root) Allow(a Access) error {
+	switch {
+	case r.ReadOnly && a != Read:
+		return ErrReadOnly
+	case r.UploadOnly && a != Upload:
+		return ErrUploadOnly
+	}
+	return nil
+}
+
+// Roots maps request paths onto the shared roots. A single unnamed root is
+// the shared directory itself; named roots appear as top-level directories
+// of a virtual tree.
+type Roots struct {
+	list   []*Root
+	byName map[string]*Root
+	mode   Mode
+}
+
+// Single shares one tree at the top level
+func Single(fs *FS) *Roots {
+	return &Roots{list: []*Root{{FS: fs}}, mode: ModeNormal}
+}
+
+// Named shares several trees, each under its name
+func Named(roots []*Root) *Roots {
+	rs := &Roots{list: roots, byName: make(map[string]*Root, len(roots)), mode: ModeNormal}
+	for _, r := range roots {
+		rs.byName[r.Name] = r
+	}
+	return rs
+}
+
+// SetMode applies a server-wide mode to every root
+func (rs *Roots) SetMode(m Mode) {
+	rs.mode = m
+}
+
+// Mode returns the server-wide mode
+func (rs *Roots) Mode() Mode {
+	return rs.mode
+}
+
+// Virtual reports whether the top level is the virtual list of named roots
+func (rs *Roots) Virtual() bool {
+	return rs.byName != nil
+}
+
+// All returns every root, hidden ones included
+func (rs *Roots) All() []*Root {
+	return rs.list
+}
+
+// Visible returns the roots listed at the top level
+func (rs *Roots) Visible() []*Root {
+	var visible []*Root
+	for _, r := range rs.list {
+		if !r.Hidden {
+			visible = append(visible, r)
+		}
+	}
+	return visible
+}
+
+// Close releases every root
+func (rs *Roots) Close() error {
+	var errs []error
+	for _, r := range rs.list {
+		errs = append(errs, r.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Locate splits a request path into its root and the path inside it, and
+// checks that the mode and the root allow the access. For the virtual top
+// level the root is nil and only Read is allowed.
+func (rs *Roots) Locate(p string, a Access) (*Root, string, error) {
+	name, err := Clean(p)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := rs.mode.Allow(a); err != nil {
+		return nil, "", err
+	}
+	if !rs.Virtual() {
+		return rs.list[0], name, rs.list[0].Allow(a)
+	}
+
+	if name == "." {
+		if a != Read {
+			return nil, "", ErrTopLevel
+		}
+		return nil, ".", nil
+	}
+	first, rest, _ := strings.Cut(name, "/")
+	r, ok := rs.byName[first]
+	if !ok {
+		if a != Read {
+			return nil, "", ErrTopLevel
+		}
+		return nil, "", &fs.PathError{Op: "open", Path: p, Err: fs.ErrNotExist}
+	}
+	if rest == "" {
+		rest = "."
+	}
+	return r, rest, r.Allow(a)
+}
+
+// Join returns the request path of name inside the root
+func (r *Root) Join(name string) string {
+	if r.Name == "" {
+		return name
+	}
+	if name == "." || name == "" {
+		return r.Name
+	}
+	return r.Name + "/" + name
+}
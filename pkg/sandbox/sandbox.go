@@ -0,0 +1,466 @@
+// Package sandbox confines file access to one directory tree.
+//
+// Paths handed to an FS are request paths relative to its directory. They
+// are resolved with os.Root, so neither ".." components nor symbolic links
+// can reach outside the tree unless the symlink policy allows it.
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SymlinkPolicy decides which symbolic links inside the tree are followed
+type SymlinkPolicy string
+
+const (
+	// SymlinksDeny refuses any path that goes through a symbolic link
+	SymlinksDeny SymlinkPolicy = "deny"
+	// SymlinksWithinRoot follows links whose target stays inside the tree
+	SymlinksWithinRoot SymlinkPolicy = "within-root"
+	// SymlinksAllowAll follows every link, wherever it points
+	SymlinksAllowAll SymlinkPolicy = "allow-all"
+)
+
+// DefaultSymlinkPolicy is used when none is configured
+const DefaultSymlinkPolicy = SymlinksWithinRoot
+
+var (
+	// ErrEscape is returned for paths that leave the tree
+	ErrEscape = errors.New("path escapes the shared directory")
+	// ErrSymlink is returned for paths through a link the policy forbids
+	ErrSymlink = errors.New("path goes through a symbolic link")
+)
+
+// ParseSymlinkPolicy validates a policy name; "" is the default policy
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch p := SymlinkPolicy(s); p {
+	case "":
+		return DefaultSymlinkPolicy, nil
+	case SymlinksDeny, SymlinksWithinRoot, SymlinksAllowAll:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown symlink policy %q (want %s, %s or %s)", s, SymlinksDeny, SymlinksWithinRoot, SymlinksAllowAll)
+}
+
+// FS is a directory tree that file operations can't escape
+type FS struct {
+	dir    string
+	root   *os.Root
+	policy SymlinkPolicy
+}
+
+// New opens dir as a sandbox with the given symlink policy
+func New(dir string, policy SymlinkPolicy) (*FS, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if policy, err = ParseSymlinkPolicy(string(policy)); err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(abs)
+	if err != nil {
+		return nil, err
+	}
+	return &FS{dir: abs, root: root, policy: policy}, nil
+}
+
+// Close releases the directory handle
+func (s *FS) Close() error {
+	return s.root.Close()
+}
+
+// Dir returns the absolute host path of the tree
+func (s *FS) Dir() string {
+	return s.dir
+}
+
+// Policy returns the symlink policy in effect
+func (s *FS) Policy() SymlinkPolicy {
+	return s.policy
+}
+
+// Clean turns a request path into the slash-separated form relative to the
+// tree, "." being the tree itself. Absolute paths are taken relative to the
+// tree; ".." components and NUL bytes are rejected.
+func Clean(p string) (string, error) {
+	if strings.ContainsRune(p, 0) {
+		return "", ErrEscape
+	}
+	p = strings.ReplaceAll(p, "\\", "/")
+	for _, part := range strings.Split(p, "/") {
+		if part == ".." {
+			return "", ErrEscape
+		}
+	}
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return ".", nil
+	}
+	return p, nil
+}
+
+// check cleans name and applies the symlink policy. With followFinal unset
+// the last component may itself be a link, for operations on the link.
+func (s *FS) check(name string, followFinal bool) (string, error) {
+	name, err := Clean(name)
+	if err != nil {
+		return "", err
+	}
+	if s.policy != SymlinksDeny || name == "." {
+		return name, nil
+	}
+
+	parts := strings.Split(name, "/")
+	if !followFinal {
+		parts = parts[:len(parts)-1]
+	}
+	for i := range parts {
+		info, err := s.root.Lstat(strings.Join(parts[:i+1], "/"))
+		if errors.Is(err, fs.ErrNotExist) {
+			// Nothing below a missing component can be a link
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", ErrSymlink
+		}
+	}
+	return name, nil
+}
+
+// host is the host path of a cleaned name, only used under SymlinksAllowAll
+func (s *FS) host(name string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(name))
+}
+
+// translate maps os.Root's unexported escape error onto ErrEscape
+func translate(err error) error {
+	var pe *os.PathError
+	if errors.As(err, &pe) && pe.Err != nil && strings.Contains(pe.Err.Error(), "escapes") {
+		pe.Err = ErrEscape
+	}
+	var le *os.LinkError
+	if errors.As(err, &le) && le.Err != nil && strings.Contains(le.Err.Error(), "escapes") {
+		le.Err = ErrEscape
+	}
+	return err
+}
+
+// IsDenied reports whether err is a sandbox violation rather than an I/O error
+func IsDenied(err error) bool {
+	return errors.Is(err, ErrEscape) || errors.Is(err, ErrSymlink)
+}
+
+// Open opens a file for reading
+func (s *FS) Open(name string) (*os.File, error) {
+	return s.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// Create creates or truncates a file
+func (s *FS) Create(name string) (*os.File, error) {
+	return s.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, FileMode)
+}
+
+// OpenFile is the generalized open call
+func (s *FS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	name, err := s.check(name, true)
+	if err != nil {
+		return nil, err
+	}
+	if s.policy == SymlinksAllowAll {
+		return os.OpenFile(s.host(name), flag, perm)
+	}
+	f, err := s.root.OpenFile(name, flag, perm)
+	return f, translate(err)
+}
+
+// Stat describes a file, following links the policy allows
+func (s *FS) Stat(name string) (os.FileInfo, error) {
+	name, err := s.check(name, true)
+	if err != nil {
+		return nil, err
+	}
+	if s.policy == SymlinksAllowAll {
+		return os.Stat(s.host(name))
+	}
+	info, err := s.root.Stat(name)
+	return info, translate(err)
+}
+
+// Lstat describes a file without following a final link
+func (s *FS) Lstat(name string) (os.FileInfo, error) {
+	name, err := s.check(name, false)
+	if err != nil {
+		return nil, err
+	}
+	if s.policy == SymlinksAllowAll {
+		return os.Lstat(s.host(name))
+	}
+	info, err := s.root.Lstat(name)
+	return info, translate(err)
+}
+
+// Readlink returns the target of a link as stored, without resolving it
+func (s *FS) Readlink(name string) (string, error) {
+	name, err := s.check(name, false)
+	if err != nil {
+		return "", err
+	}
+	if s.policy == SymlinksAllowAll {
+		return os.Readlink(s.host(name))
+	}
+	target, err := s.root.Readlink(name)
+	return target, translate(err)
+}
+
+// ReadDir returns the entries of a directory sorted by name
+func (s *FS) ReadDir(name string) ([]os.DirEntry, error) {
+	d, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	entries, err := d.ReadDir(-1)
+	if err != nil {
+		return nil, err
+	}
+	return sortEntries(entries), nil
+}
+
+// Mkdir creates a single directory
+func (s *FS) Mkdir(name string, perm os.FileMode) error {
+	name, err := s.check(name, true)
+	if err != nil {
+		return err
+	}
+	if s.policy == SymlinksAllowAll {
+		return os.Mkdir(s.host(name), perm)
+	}
+	return translate(s.root.Mkdir(name, perm))
+}
+
+// MkdirAll creates a directory and any missing parents
+func (s *FS) MkdirAll(name string, perm os.FileMode) error {
+	name, err := s.check(name, true)
+	if err != nil {
+		return err
+	}
+	if s.policy == SymlinksAllowAll {
+		return os.MkdirAll(s.host(name), perm)
+	}
+	return translate(s.root.MkdirAll(name, perm))
+}
+
+// Remove deletes a file, a link or an empty directory
+func (s *FS) Remove(name string) error {
+	name, err := s.check(name, false)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return ErrEscape
+	}
+	if s.policy == SymlinksAllowAll {
+		return os.Remove(s.host(name))
+	}
+	return translate(s.root.Remove(name))
+}
+
+// RemoveAll deletes a path and everything below it. Links are removed,
+// never followed.
+func (s *FS) RemoveAll(name string) error {
+	name, err := s.check(name, false)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return ErrEscape
+	}
+	if s.policy == SymlinksAllowAll {
+		return os.RemoveAll(s.host(name))
+	}
+	return translate(s.root.RemoveAll(name))
+}
+
+// Rename moves oldname to newname, both inside the tree
+func (s *FS) Rename(oldname, newname string) error {
+	oldname, err := s.check(oldname, false)
+	if err != nil {
+		return err
+	}
+	newname, err = s.check(newname, false)
+	if err != nil {
+		return err
+	}
+	if oldname == "." || newname == "." {
+		return ErrEscape
+	}
+	if s.policy == SymlinksAllowAll {
+		return os.Rename(s.host(oldname), s.host(newname))
+	}
+	return translate(s.root.Rename(oldname, newname))
+}
+
+// WriteFile atomically replaces the content of a file with data, see
+// CreateAtomic
+func (s *FS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	f, err := s.CreateAtomic(name, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
+
+// ReadFile reads the whole content of a file
+func (s *FS) ReadFile(name string) ([]byte, error) {
+	f, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Chmod changes the permission bits of a file
+func (s *FS) Chmod(name string, mode os.FileMode) error {
+	name, err := s.check(name, true)
+	if err != nil {
+		return err
+	}
+	if s.policy == SymlinksAllowAll {
+		return os.Chmod(s.host(name), mode)
+	}
+	return translate(s.root.Chmod(name, mode))
+}
+
+// Link creates newname as a hard link to oldname. It fails with
+// fs.ErrExist if newname is taken.
+func (s *FS) Link(oldname, newname string) error {
+	oldname, err := s.check(oldname, false)
+	if err != nil {
+		return err
+	}
+	newname, err = s.check(newname, false)
+	if err != nil {
+		return err
+	}
+	if s.policy == SymlinksAllowAll {
+		return os.Link(s.host(oldname), s.host(newname))
+	}
+	return translate(s.root.Link(oldname, newname))
+}
+
+// Symlink creates newname as a symbolic link to target. The target is
+// stored as given; following it later is subject to the policy.
+func (s *FS) Symlink(target, newname string) error {
+	newname, err := s.check(newname, false)
+	if err != nil {
+		return err
+	}
+	if s.policy == SymlinksAllowAll {
+		return os.Symlink(target, s.host(newname))
+	}
+	return translate(s.root.Symlink(target, newname))
+}
+
+// Chtimes changes the access and modification times of a file
+func (s *FS) Chtimes(name string, atime, mtime time.Time) error {
+	name, err := s.check(name, true)
+	if err != nil {
+		return err
+	}
+	if s.policy == SymlinksAllowAll {
+		return os.Chtimes(s.host(name), atime, mtime)
+	}
+	return translate(s.root.Chtimes(name, atime, mtime))
+}
+
+// FS returns the tree as an io/fs file system, for fs.WalkDir and friends
+func (s *FS) FS() fs.FS {
+	if s.policy == SymlinksAllowAll {
+		return os.DirFS(s.dir)
+	}
+	return policyFS{s}
+}
+
+// Resolve returns the host path of name after applying the policy, for code
+// that must hand a path to another program. Prefer the FS methods, which
+// aren't subject to the link being swapped after the check.
+func (s *FS) Resolve(name string) (string, error) {
+	name, err := s.check(name, true)
+	if err != nil {
+		return "", err
+	}
+	host := s.host(name)
+	if s.policy == SymlinksAllowAll {
+		return host, nil
+	}
+	return within(s.dir, host)
+}
+
+// Resolve returns the host path of the request path p inside dir using the
+// default policy. It's the one-shot form of FS.Resolve.
+func Resolve(dir, p string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	name, err := Clean(p)
+	if err != nil {
+		return "", err
+	}
+	return within(abs, filepath.Join(abs, filepath.FromSlash(name)))
+}
+
+// within resolves the links in host and checks that the result is still
+// below dir. Missing trailing components are allowed so new files can be
+// created.
+func within(dir, host string) (string, error) {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+
+	existing, rest := host, ""
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	if !contains(realDir, real) {
+		return "", ErrEscape
+	}
+	return filepath.Join(real, rest), nil
+}
+
+// contains reports whether target is dir or below it. Unlike a plain
+// prefix check it doesn't mistake /srv/share-private for part of /srv/share.
+func contains(dir, target string) bool {
+	rel, err := filepath.Rel(dir, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
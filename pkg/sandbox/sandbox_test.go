@@ -0,0 +1,305 @@
+package sandbox
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{"", ".", nil},
+		{"/", ".", nil},
+		{".", ".", nil},
+		{"a/b", "a/b", nil},
+		{"./a/./b/", "a/b", nil},
+		{"a//b", "a/b", nil},
+		{"...", "...", nil},
+		{"a/..b", "a/..b", nil},
+		// Absolute paths are relative to the tree
+		{"/etc/passwd", "etc/passwd", nil},
+		{"//etc/passwd", "etc/passwd", nil},
+		// Backslashes separate like slashes
+		{`a\b`, "a/b", nil},
+		{`\etc\passwd`, "etc/passwd", nil},
+		{"..", "", ErrEscape},
+		{"../etc/passwd", "", ErrEscape},
+		{"a/../b", "", ErrEscape},
+		{"a/..", "", ErrEscape},
+		{"/../etc/passwd", "", ErrEscape},
+		{`..\etc\passwd`, "", ErrEscape},
+		{`a\..\..\etc`, "", ErrEscape},
+		{"a\x00b", "", ErrEscape},
+		{"file.txt\x00.jpg", "", ErrEscape},
+	}
+	for _, tt := range tests {
+		got, err := Clean(tt.in)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("Clean(%q) = %q, %v; want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+// layout builds
+//
+//	base/secret                    outside the tree
+//	base/share-private/secret      a sibling sharing the tree's prefix
+//	base/share/file.txt            the tree
+//	base/share/sub/inner.txt
+//	base/share/in -> file.txt
+//	base/share/indir -> sub
+//	base/share/out -> base/secret
+//	base/share/outrel -> ../secret
+//	base/share/private -> base/share-private
+//
+// and returns base
+func layout(t *testing.T) string {
+	t.Helper()
+	base := t.TempDir()
+	write := func(name, content string) {
+		p := filepath.Join(base, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(target, name string) {
+		if err := os.Symlink(target, filepath.Join(base, "share", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("secret", "outside")
+	write("share-private/secret", "sibling")
+	write("share/file.txt", "inside")
+	write("share/sub/inner.txt", "inner")
+	link("file.txt", "in")
+	link("sub", "indir")
+	link(filepath.Join(base, "secret"), "out")
+	link("../secret", "outrel")
+	link(filepath.Join(base, "share-private"), "private")
+	return base
+}
+
+func TestTraversal(t *testing.T) {
+	base := layout(t)
+	names := []string{
+		"..",
+		"../secret",
+		"sub/../../secret",
+		"/../secret",
+		`..\secret`,
+		`sub\..\..\secret`,
+		"../share-private/secret",
+		"file.txt\x00",
+	}
+	for _, policy := range []SymlinkPolicy{SymlinksDeny, SymlinksWithinRoot, SymlinksAllowAll} {
+		s, err := New(filepath.Join(base, "share"), policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		for _, name := range names {
+			if _, err := s.Open(name); !errors.Is(err, ErrEscape) {
+				t.Errorf("%s: Open(%q) = %v, want ErrEscape", policy, name, err)
+			}
+			if err := s.WriteFile(name, []byte("x"), FileMode); !errors.Is(err, ErrEscape) {
+				t.Errorf("%s: WriteFile(%q) = %v, want ErrEscape", policy, name, err)
+			}
+			if _, err := s.Resolve(name); !errors.Is(err, ErrEscape) {
+				t.Errorf("%s: Resolve(%q) = %v, want ErrEscape", policy, name, err)
+			}
+		}
+
+		// An absolute host path names a path inside the tree, which doesn't
+		// exist
+		if _, err := s.Open(filepath.Join(base, "secret")); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: Open of the absolute host path = %v, want ErrNotExist", policy, err)
+		}
+	}
+	if content, _ := os.ReadFile(filepath.Join(base, "secret")); string(content) != "outside" {
+		t.Errorf("the file outside the tree was changed to %q", content)
+	}
+}
+
+func TestSymlinks(t *testing.T) {
+	base := layout(t)
+	ok := error(nil)
+	tests := []struct {
+		name string
+		// Expected error of Open under deny, within-root and allow-all
+		deny, within, all error
+		// Content read when Open succeeds
+		content string
+	}{
+		{"file.txt", ok, ok, ok, "inside"},
+		{"sub/inner.txt", ok, ok, ok, "inner"},
+		{"in", ErrSymlink, ok, ok, "inside"},
+		{"indir/inner.txt", ErrSymlink, ok, ok, "inner"},
+		{"out", ErrSymlink, ErrEscape, ok, "outside"},
+		{"outrel", ErrSymlink, ErrEscape, ok, "outside"},
+		{"private/secret", ErrSymlink, ErrEscape, ok, "sibling"},
+	}
+	for _, policy := range []SymlinkPolicy{SymlinksDeny, SymlinksWithinRoot, SymlinksAllowAll} {
+		s, err := New(filepath.Join(base, "share"), policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		for _, tt := range tests {
+			want := map[SymlinkPolicy]error{SymlinksDeny: tt.deny, SymlinksWithinRoot: tt.within, SymlinksAllowAll: tt.all}[policy]
+			f, err := s.Open(tt.name)
+			if !errors.Is(err, want) {
+				t.Errorf("%s: Open(%q) = %v, want %v", policy, tt.name, err, want)
+			}
+			if err == nil {
+				content, _ := io.ReadAll(f)
+				f.Close()
+				if string(content) != tt.content {
+					t.Errorf("%s: Open(%q) read %q, want %q", policy, tt.name, content, tt.content)
+				}
+			}
+			if _, err := s.Resolve(tt.name); !errors.Is(err, want) {
+				t.Errorf("%s: Resolve(%q) = %v, want %v", policy, tt.name, err, want)
+			}
+			if IsDenied(err) != (want != nil) {
+				t.Errorf("%s: IsDenied(%v) = %v", policy, err, IsDenied(err))
+			}
+		}
+
+		// Operations on the link itself don't follow it
+		info, err := s.Lstat("out")
+		if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			t.Errorf("%s: Lstat of a link = %v, %v", policy, info, err)
+		}
+		// Nothing is created through a link the policy doesn't follow
+		if err := s.WriteFile("private/new", []byte("x"), FileMode); policy != SymlinksAllowAll && !IsDenied(err) {
+			t.Errorf("%s: WriteFile through a link out of the tree = %v", policy, err)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	tests := []struct {
+		dir, target string
+		want        bool
+	}{
+		{"/srv/share", "/srv/share", true},
+		{"/srv/share", "/srv/share/a", true},
+		{"/srv/share", "/srv/share/a/b", true},
+		{"/srv/share", "/srv/share/..a", true},
+		{"/srv/share", "/srv/share-private", false},
+		{"/srv/share", "/srv/share-private/a", false},
+		{"/srv/share", "/srv/shar", false},
+		{"/srv/share", "/srv", false},
+		{"/srv/share", "/etc/passwd", false},
+	}
+	for _, tt := range tests {
+		if got := contains(tt.dir, tt.target); got != tt.want {
+			t.Errorf("contains(%q, %q) = %v, want %v", tt.dir, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestResolveSibling(t *testing.T) {
+	base := layout(t)
+	share := filepath.Join(base, "share")
+	if _, err := Resolve(share, "private/secret"); !errors.Is(err, ErrEscape) {
+		t.Errorf("Resolve through a link to the sibling = %v, want ErrEscape", err)
+	}
+	got, err := Resolve(share, "sub/inner.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	real, _ := filepath.EvalSymlinks(filepath.Join(share, "sub", "inner.txt"))
+	if got != real {
+		t.Errorf("Resolve = %q, want %q", got, real)
+	}
+}
+
+func TestLocate(t *testing.T) {
+	open := func(name string) *FS {
+		dir := filepath.Join(t.TempDir(), name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		s, err := New(dir, SymlinksDeny)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	share := &Root{Name: "share", FS: open("share")}
+	docs := &Root{Name: "docs", FS: open("docs"), ReadOnly: true}
+	hidden := &Root{Name: "hidden", FS: open("hidden"), Hidden: true}
+	roots := Named([]*Root{share, docs, hidden})
+	defer roots.Close()
+
+	tests := []struct {
+		p      string
+		access Access
+		root   *Root
+		name   string
+		err    error
+	}{
+		// The virtual top level can be read, never changed
+		{"", Read, nil, ".", nil},
+		{"/", Read, nil, ".", nil},
+		{".", Read, nil, ".", nil},
+		{"", Write, nil, "", ErrTopLevel},
+		{"/", Upload, nil, "", ErrTopLevel},
+		{"nope", Read, nil, "", fs.ErrNotExist},
+		{"nope", Write, nil, "", ErrTopLevel},
+		{"share", Read, share, ".", nil},
+		{"/share/", Write, share, ".", nil},
+		{"share/a/b", Write, share, "a/b", nil},
+		{`share\a`, Read, share, "a", nil},
+		{"hidden/a", Read, hidden, "a", nil},
+		{"docs/a", Read, docs, "a", nil},
+		{"docs/a", Write, docs, "a", ErrReadOnly},
+		{"..", Read, nil, "", ErrEscape},
+		{"../share", Read, nil, "", ErrEscape},
+		{"share/../docs", Read, nil, "", ErrEscape},
+		{"share/a\x00", Read, nil, "", ErrEscape},
+	}
+	for _, tt := range tests {
+		root, name, err := roots.Locate(tt.p, tt.access)
+		if root != tt.root || name != tt.name || !errors.Is(err, tt.err) {
+			t.Errorf("Locate(%q, %d) = %v, %q, %v; want %v, %q, %v", tt.p, tt.access, root, name, err, tt.root, tt.name, tt.err)
+		}
+	}
+
+	if visible := roots.Visible(); len(visible) != 2 {
+		t.Errorf("Visible() has %d roots, want 2", len(visible))
+	}
+	roots.SetMode(ModeDropBox)
+	if _, _, err := roots.Locate("", Read); !errors.Is(err, ErrUploadOnly) {
+		t.Errorf("Locate of the top level in a drop box = %v, want ErrUploadOnly", err)
+	}
+}
+
+func TestLocateSingle(t *testing.T) {
+	s, err := New(t.TempDir(), SymlinksDeny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := Single(s)
+	defer roots.Close()
+	for _, p := range []string{"", "/", "."} {
+		root, name, err := roots.Locate(p, Write)
+		if root == nil || name != "." || err != nil {
+			t.Errorf("Locate(%q) = %v, %q, %v; want the root", p, root, name, err)
+		}
+	}
+	if _, _, err := roots.Locate("../x", Read); !errors.Is(err, ErrEscape) {
+		t.Errorf("Locate(../x) = %v, want ErrEscape", err)
+	}
+}
@@ -0,0 +1,124 @@
+// Package sniff tells the type of content from its first bytes. It knows
+// executables, scripts and archives on top of what http.DetectContentType
+// recognizes, so a program can't pass for a photo by its name.
+package sniff
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Size is how many bytes of the content Type looks at
+const Size = 512
+
+// Types of executable content
+const (
+	Windows = "application/x-msdownload"
+	ELF     = "application/x-executable"
+	MachO   = "application/x-mach-binary"
+	Script  = "text/x-shellscript"
+)
+
+// programExtensions are the extensions each kind of program goes by. Mime
+// tables disagree on their types, .exe is often just octet-stream.
+var programExtensions = map[string][]string{
+	Windows: {".exe", ".dll", ".com", ".scr", ".sys", ".cpl", ".efi"},
+	ELF:     {".so", ".bin", ".elf", ".run", ".appimage", ".o"},
+	MachO:   {".dylib", ".bundle", ".so", ".o"},
+	Script:  {".sh", ".bash", ".zsh", ".ksh", ".csh", ".command", ".py", ".pl", ".rb"},
+}
+
+// Generic types say too little about content to hold it against a name
+var generic = []string{"application/octet-stream", "text/plain", "application/zip", "text/xml", "application/xml"}
+
+type signature struct {
+	offset int
+	magic  string
+	mime   string
+}
+
+// signatures are checked before http.DetectContentType, in order
+var signatures = []signature{
+	{0, "\x7fELF", ELF},
+	{0, "\xfe\xed\xfa\xce", MachO},
+	{0, "\xfe\xed\xfa\xcf", MachO},
+	{0, "\xce\xfa\xed\xfe", MachO},
+	{0, "\xcf\xfa\xed\xfe", MachO},
+	{0, "#!", Script},
+	{0, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", "application/x-ole-storage"}, // old Office files, msi
+	{0, "BZh", "application/x-bzip2"},
+	{0, "\xfd7zXZ\x00", "application/x-xz"},
+	{0, "\x28\xb5\x2f\xfd", "application/zstd"},
+	{0, "SQLite format 3\x00", "application/vnd.sqlite3"},
+	{257, "ustar", "application/x-tar"},
+}
+
+// Type returns the MIME type of content starting with head, without
+// parameters, e.g. "image/png". Unknown binary content is
+// application/octet-stream.
+func Type(head []byte) string {
+	if len(head) > Size {
+		head = head[:Size]
+	}
+	if isWindowsExecutable(head) {
+		return Windows
+	}
+	for _, s := range signatures {
+		if len(head) >= s.offset+len(s.magic) && string(head[s.offset:s.offset+len(s.magic)]) == s.magic {
+			return s.mime
+		}
+	}
+	return bare(http.DetectContentType(head))
+}
+
+// ByExtension returns the type the extension of name stands for, without
+// parameters, or "" if it's unknown
+func ByExtension(name string) string {
+	return bare(mime.TypeByExtension(strings.ToLower(path.Ext(name))))
+}
+
+// Executable reports whether t is the type of a program or script
+func Executable(t string) bool {
+	return t == Windows || t == ELF || t == MachO || t == Script
+}
+
+// Mismatch reports whether content of type actual is clearly not what the
+// extension of name says it is, like a program named photo.jpg. Generic
+// types and types of the same family, an image/png named .jpg, pass; a
+// program only passes under an extension programs of its kind go by.
+func Mismatch(name, actual string) bool {
+	claimed := ByExtension(name)
+	if claimed == "" {
+		return false
+	}
+	if Executable(actual) {
+		return !slices.Contains(programExtensions[actual], strings.ToLower(path.Ext(name)))
+	}
+	if claimed == actual {
+		return false
+	}
+	for _, g := range generic {
+		if actual == g {
+			return false
+		}
+	}
+	major, _, _ := strings.Cut(actual, "/")
+	claimedMajor, _, _ := strings.Cut(claimed, "/")
+	return major != claimedMajor
+}
+
+// isWindowsExecutable recognizes the MZ header of DOS and PE programs,
+// which is binary unlike text that happens to start with MZ
+func isWindowsExecutable(head []byte) bool {
+	return len(head) >= 64 && head[0] == 'M' && head[1] == 'Z' && bytes.IndexByte(head[:64], 0) >= 0
+}
+
+// bare strips the parameters of a MIME type
+func bare(t string) string {
+	t, _, _ = strings.Cut(t, ";")
+	return strings.TrimSpace(t)
+}
@@ -0,0 +1,72 @@
+package sniff
+
+import (
+	"strings"
+	"testing"
+)
+
+// pe is the start of a Windows program: MZ, then binary header fields
+var pe = "MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff\x00\x00" + strings.Repeat("\x00", 48) + "This program cannot be run in DOS mode."
+
+func TestType(t *testing.T) {
+	tar := strings.Repeat("\x00", 257) + "ustar\x0000"
+	tests := []struct {
+		head string
+		want string
+	}{
+		{pe, Windows},
+		{"MZ is how this text starts, and it is only text", "text/plain"},
+		{"\x7fELF\x02\x01\x01\x00", ELF},
+		{"\xcf\xfa\xed\xfe\x07\x00\x00\x01", MachO},
+		{"#!/bin/sh\necho hi\n", Script},
+		{"\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", "image/png"},
+		{"\xff\xd8\xff\xe0\x00\x10JFIF", "image/jpeg"},
+		{"%PDF-1.7\n", "application/pdf"},
+		{"PK\x03\x04\x14\x00\x00\x00", "application/zip"},
+		{tar, "application/x-tar"},
+		{"SQLite format 3\x00", "application/vnd.sqlite3"},
+		{"hello, world\n", "text/plain"},
+		{"\x00\x01\x02\x03", "application/octet-stream"},
+		{"", "text/plain"},
+	}
+	for _, tt := range tests {
+		if got := Type([]byte(tt.head)); got != tt.want {
+			t.Errorf("Type(%.16q) = %s, want %s", tt.head, got, tt.want)
+		}
+	}
+}
+
+func TestTypeLooksAtSizeBytes(t *testing.T) {
+	// A tar header beyond Size isn't seen
+	long := strings.Repeat("a", Size) + "\x7fELF"
+	if got := Type([]byte(long)); got != "text/plain" {
+		t.Errorf("got %s for text followed by an ELF header past Size", got)
+	}
+}
+
+func TestMismatch(t *testing.T) {
+	tests := []struct {
+		name, actual string
+		want         bool
+	}{
+		{"photo.jpg", Windows, true},
+		{"photo.JPG", ELF, true},
+		{"notes.txt", Script, true},
+		{"report.pdf", "image/png", true},
+		{"photo.jpg", "image/jpeg", false},
+		{"photo.jpg", "image/png", false}, // same family
+		{"photo.jpg", "application/octet-stream", false},
+		{"data.csv", "text/plain", false},
+		{"archive.docx", "application/zip", false},
+		{"setup.exe", Windows, false},
+		{"install.sh", Script, false},
+		{"libz.so", ELF, false},
+		{"setup.msi", Windows, true},
+		{"README", ELF, false}, // no extension claims anything
+	}
+	for _, tt := range tests {
+		if got := Mismatch(tt.name, tt.actual); got != tt.want {
+			t.Errorf("Mismatch(%s, %s) = %v, want %v", tt.name, tt.actual, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package styles
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const progressWidth = 30
+
+// Progress renders a single-line terminal progress bar. It implements
+// io.Writer so it can be used with io.TeeReader or io.MultiWriter to count
+// transferred bytes.
+type Progress struct {
+	mu       sync.Mutex
+	out      io.Writer
+	label    string
+	total    int64
+	current  int64
+	lastDraw time.Time
+	done     bool
+}
+
+// NewProgress creates a progress bar writing to stderr. A total of zero or
+// less means the size is unknown and only the byte count is shown.
+func NewProgress(label string, total int64) *Progress {
+	return &Progress{out: os.Stderr, label: label, total: total}
+}
+
+// Write records len(p) transferred bytes
+func (p *Progress) Write(b []byte) (int, error) {
+	p.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// Add records n transferred bytes and redraws the bar at most every 100ms
+func (p *Progress) Add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current += n
+	if time.Since(p.lastDraw) >= 100*time.Millisecond {
+		p.draw()
+	}
+}
+
+// Set records the absolute number of transferred bytes
+func (p *Progress) Set(current int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = current
+	if time.Since(p.lastDraw) >= 100*time.Millisecond {
+		p.draw()
+	}
+}
+
+// Done draws the final state of the bar and moves to the next line
+func (p *Progress) Done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done {
+		return
+	}
+	p.done = true
+	p.draw()
+	fmt.Fprintln(p.out)
+}
+
+func (p *Progress) draw() {
+	p.lastDraw = time.Now()
+	if p.total <= 0 {
+		fmt.Fprintf(p.out, "\r%s %s", p.label, InfoStyle.Sprint(formatBytes(p.current)))
+		return
+	}
+
+	ratio := float64(p.current) / float64(p.total)
+	if ratio > 1 {
+		ratio = 1
+	}
+	filled := int(ratio * progressWidth)
+	bar := InfoStyle.Sprint(strings.Repeat("█", filled)) + DebugStyle.Sprint(strings.Repeat("░", progressWidth-filled))
+	fmt.Fprintf(p.out, "\r%s %s %3.0f%% %s/%s", p.label, bar, ratio*100, formatBytes(p.current), formatBytes(p.total))
+}
+
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -44,7 +44,7 @@ func GetSystemStats(sharedDir string) SystemStats {
 	stats.Memory = getMemoryStats()
 
 	// Get disk stats
-	stats.Disk = getDiskStats(sharedDir)
+	stats.Disk = GetDiskStats(sharedDir)
 
 	// Get CPU stats
 	stats.CPU = getCPUStats()
@@ -79,8 +79,8 @@ func getMemoryStats() MemoryStats {
 	}
 }
 
-// getDiskStats collects disk usage statistics for the shared directory
-func getDiskStats(sharedDir string) DiskStats {
+// GetDiskStats collects disk usage statistics for a shared directory
+func GetDiskStats(sharedDir string) DiskStats {
 	if sharedDir == "" {
 		logger.Warn("Shared directory not set, cannot get disk stats")
 		return DiskStats{}
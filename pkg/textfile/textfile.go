@@ -0,0 +1,235 @@
+// Package textfile reads and writes text files for the editor: it detects
+// their encoding and line endings, and gives each version a revision so
+// concurrent edits can be told apart.
+package textfile
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding is the character encoding of a text file
+type Encoding string
+
+const (
+	UTF8    Encoding = "utf-8"
+	UTF8BOM Encoding = "utf-8-bom"
+	UTF16LE Encoding = "utf-16le" // with a byte order mark
+	UTF16BE Encoding = "utf-16be" // with a byte order mark
+	Latin1  Encoding = "latin-1"
+)
+
+// Line endings
+const (
+	LF    = "lf"
+	CRLF  = "crlf"
+	CR    = "cr"
+	Mixed = "mixed"
+	None  = "none" // a single line
+)
+
+// ErrBinary is returned for content that isn't text
+var ErrBinary = errors.New("not a text file")
+
+// ErrTooLarge is returned by ReadLines for a range of lines over its limit
+var ErrTooLarge = errors.New("line range is too large")
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// ParseEncoding validates an encoding name; "" is UTF8
+func ParseEncoding(s string) (Encoding, error) {
+	switch e := Encoding(strings.ToLower(s)); e {
+	case "":
+		return UTF8, nil
+	case UTF8, UTF8BOM, UTF16LE, UTF16BE, Latin1:
+		return e, nil
+	}
+	return "", fmt.Errorf("unknown encoding %q (want %s, %s, %s, %s or %s)", s, UTF8, UTF8BOM, UTF16LE, UTF16BE, Latin1)
+}
+
+// Detect guesses the encoding from a byte order mark, or from the content or
+// its first bytes. Content with NUL bytes and no UTF-16 mark is binary.
+func Detect(head []byte) (Encoding, error) {
+	switch {
+	case bytes.HasPrefix(head, bomUTF8):
+		return UTF8BOM, nil
+	case bytes.HasPrefix(head, bomUTF16LE):
+		return UTF16LE, nil
+	case bytes.HasPrefix(head, bomUTF16BE):
+		return UTF16BE, nil
+	case bytes.IndexByte(head, 0) >= 0:
+		return "", ErrBinary
+	}
+	if utf8.Valid(head) {
+		return UTF8, nil
+	}
+	// The last character may be cut at the end of head
+	for i := len(head) - 1; i >= 0 && i >= len(head)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(head[i]) {
+			if !utf8.FullRune(head[i:]) && utf8.Valid(head[:i]) {
+				return UTF8, nil
+			}
+			break
+		}
+	}
+	return Latin1, nil
+}
+
+// Decode turns content in the encoding into a string, without the byte
+// order mark
+func Decode(data []byte, enc Encoding) (string, error) {
+	switch enc {
+	case UTF8BOM:
+		data = bytes.TrimPrefix(data, bomUTF8)
+		fallthrough
+	case UTF8:
+		if !utf8.Valid(data) {
+			return "", ErrBinary
+		}
+		return string(data), nil
+	case Latin1:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+	case UTF16LE, UTF16BE:
+		data = data[min(2, len(data)):]
+		if len(data)%2 != 0 {
+			return "", ErrBinary
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			if enc == UTF16LE {
+				units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+			} else {
+				units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+			}
+		}
+		return string(utf16.Decode(units)), nil
+	}
+	return "", fmt.Errorf("unknown encoding %q", enc)
+}
+
+// Encode turns a string into content in the encoding, with the byte order
+// mark the encoding calls for
+func Encode(s string, enc Encoding) ([]byte, error) {
+	switch enc {
+	case UTF8:
+		return []byte(s), nil
+	case UTF8BOM:
+		return append(bytes.Clone(bomUTF8), s...), nil
+	case Latin1:
+		out := make([]byte, 0, len(s))
+		for _, r := range s {
+			if r > 0xFF {
+				return nil, fmt.Errorf("%q can't be written as %s", r, Latin1)
+			}
+			out = append(out, byte(r))
+		}
+		return out, nil
+	case UTF16LE, UTF16BE:
+		units := utf16.Encode([]rune(s))
+		out := make([]byte, 0, 2+2*len(units))
+		if enc == UTF16LE {
+			out = append(out, bomUTF16LE...)
+			for _, u := range units {
+				out = append(out, byte(u), byte(u>>8))
+			}
+		} else {
+			out = append(out, bomUTF16BE...)
+			for _, u := range units {
+				out = append(out, byte(u>>8), byte(u))
+			}
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q", enc)
+}
+
+// LineEnding tells which line endings the text uses
+func LineEnding(s string) string {
+	crlf := strings.Count(s, "\r\n")
+	lf := strings.Count(s, "\n") - crlf
+	cr := strings.Count(s, "\r") - crlf
+	kinds := 0
+	ending := None
+	for _, k := range []struct {
+		n    int
+		name string
+	}{{lf, LF}, {crlf, CRLF}, {cr, CR}} {
+		if k.n > 0 {
+			kinds++
+			ending = k.name
+		}
+	}
+	if kinds > 1 {
+		return Mixed
+	}
+	return ending
+}
+
+// Revision identifies a version of a file's content
+func Revision(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// Lines is a range of lines read from a larger file
+type Lines struct {
+	// Data holds the raw lines, line endings included
+	Data []byte
+	// Total is how many lines the whole file has
+	Total int
+	// Revision is the revision of the whole file
+	Revision string
+}
+
+// ReadLines reads lines from through to (1-based, inclusive; to < 1 means
+// the last line) of r in one pass, computing the revision of all of it. It
+// works for encodings where '\n' is a single byte: UTF-8 and Latin-1. It
+// stops with ErrTooLarge once the range holds more than limit bytes, unless
+// limit is 0.
+func ReadLines(r io.Reader, from, to, limit int) (Lines, error) {
+	h := sha256.New()
+	br := bufio.NewReader(io.TeeReader(r, h))
+	var out Lines
+	for {
+		line, err := br.ReadSlice('\n')
+		if len(line) > 0 {
+			out.Total++
+			if out.Total >= from && (to < 1 || out.Total <= to) {
+				out.Data = append(out.Data, line...)
+				if limit > 0 && len(out.Data) > limit {
+					return out, ErrTooLarge
+				}
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			// A line longer than the buffer, continued by the next read
+			out.Total--
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return out, err
+		}
+	}
+	sum := h.Sum(nil)
+	out.Revision = hex.EncodeToString(sum[:16])
+	return out, nil
+}
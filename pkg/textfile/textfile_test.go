@@ -0,0 +1,76 @@
+package textfile
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadLines(t *testing.T) {
+	content := "one\ntwo\nthree\nfour"
+	tests := []struct {
+		from, to, limit int
+		want            string
+		err             error
+	}{
+		{1, 0, 0, content, nil},
+		{2, 3, 0, "two\nthree\n", nil},
+		{4, 0, 0, "four", nil},
+		{3, 100, 0, "three\nfour", nil},
+		{5, 0, 0, "", nil},
+		{1, 2, 8, "one\ntwo\n", nil},
+		{1, 3, 8, "", ErrTooLarge},
+		{2, 0, 8, "", ErrTooLarge},
+	}
+	for _, tt := range tests {
+		lines, err := ReadLines(strings.NewReader(content), tt.from, tt.to, tt.limit)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ReadLines(%d, %d, %d): error %v, want %v", tt.from, tt.to, tt.limit, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if string(lines.Data) != tt.want || lines.Total != 4 || lines.Revision != Revision([]byte(content)) {
+			t.Errorf("ReadLines(%d, %d, %d) = %q, %d lines, revision %s", tt.from, tt.to, tt.limit, lines.Data, lines.Total, lines.Revision)
+		}
+	}
+}
+
+// endless is a file of lines that never ends
+type endless struct{}
+
+func (endless) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'x'
+		if i%80 == 79 {
+			p[i] = '\n'
+		}
+	}
+	return len(p), nil
+}
+
+func TestReadLinesStopsAtLimit(t *testing.T) {
+	const limit = 1 << 20
+	counted := &countingReader{r: endless{}}
+	lines, err := ReadLines(counted, 1, 0, limit)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("got %v, want ErrTooLarge", err)
+	}
+	// Reading stops right after the limit, give or take a buffer
+	if len(lines.Data) > 2*limit || counted.n > 2*limit {
+		t.Errorf("held %d bytes after reading %d, limit %d", len(lines.Data), counted.n, limit)
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
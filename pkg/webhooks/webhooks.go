@@ -0,0 +1,339 @@
+// Package webhooks sends file events to subscribed URLs. Deliveries are
+// queued in the database, signed with the secret of their webhook and
+// retried with exponential backoff until the receiver answers with 2xx.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+)
+
+// Event types
+const (
+	Upload   = "upload"
+	Download = "download"
+	Write    = "write"
+	Move     = "move"
+	Copy     = "copy"
+	Rename   = "rename"
+	Mkdir    = "mkdir"
+	Delete   = "delete"
+	// Ping is sent on request to test a webhook, whatever its filters
+	Ping = "ping"
+)
+
+// Events are the event types a webhook can subscribe to
+var Events = []string{Upload, Download, Write, Move, Copy, Rename, Mkdir, Delete}
+
+// Headers of a delivery
+const (
+	EventHeader     = "X-Beamdrop-Event"
+	DeliveryHeader  = "X-Beamdrop-Delivery"
+	SignatureHeader = "X-Beamdrop-Signature"
+)
+
+const (
+	// MaxAttempts is how often a delivery is tried before it fails
+	MaxAttempts = 8
+	// RetryDelay is the wait after the first failed attempt, doubling after
+	// every further one up to MaxRetryDelay
+	RetryDelay    = 10 * time.Second
+	MaxRetryDelay = time.Hour
+	// Timeout bounds one attempt
+	Timeout = 10 * time.Second
+	// KeepDeliveries is how many finished deliveries are logged per webhook
+	KeepDeliveries = 200
+
+	// senders is how many deliveries are sent at once
+	senders = 4
+	// batchSize is how many due deliveries are picked up at a time
+	batchSize = 32
+	// maxResponse is how much of a response body is logged
+	maxResponse = 1024
+)
+
+// Event is something that happened to a file or directory
+type Event struct {
+	Type string `json:"event"`
+	// Path is the API path of the entry, after the event
+	Path string `json:"path,omitempty"`
+	// From is where a moved, copied or renamed entry was
+	From string `json:"from,omitempty"`
+	// Size is the size of an uploaded, downloaded or written file
+	Size int64 `json:"size,omitempty"`
+	// Client is who caused the event, if a request did
+	Client string    `json:"client,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	// ID is the delivery's, the same for every attempt
+	ID      string `json:"id"`
+	Webhook uint   `json:"webhook"`
+	Event
+}
+
+// Sign returns the signature of a body as sent in SignatureHeader:
+// "sha256=" and the hex HMAC-SHA256 of the body keyed with the secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidPattern reports whether a path filter is well formed
+func ValidPattern(pattern string) bool {
+	_, err := path.Match(pattern, "")
+	return err == nil && pattern != ""
+}
+
+// Matches reports whether the webhook subscribes to the event
+func Matches(hook db.Webhook, e Event) bool {
+	if len(hook.Events) > 0 && !slices.Contains(hook.Events, e.Type) {
+		return false
+	}
+	if len(hook.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range hook.Paths {
+		if matchPath(pattern, e.Path) || (e.From != "" && matchPath(pattern, e.From)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath reports whether p or a directory above it matches the pattern,
+// so a directory's pattern covers what's in it
+func matchPath(pattern, p string) bool {
+	for p != "" && p != "." && p != "/" {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+		p = path.Dir(p)
+	}
+	return false
+}
+
+// Dispatcher queues events for the webhooks subscribed to them and sends
+// them in the background
+type Dispatcher struct {
+	client *http.Client
+	wake   chan struct{}
+}
+
+// NewDispatcher returns a dispatcher. Events are queued as soon as the
+// database is open, and sent once Start was called.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		client: &http.Client{
+			Timeout: Timeout,
+			// A redirect answers a POST with a GET; better report it
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Start sends the deliveries left pending by the previous run, and then
+// the new ones as they come
+func (d *Dispatcher) Start() {
+	go d.run()
+}
+
+// Emit queues the event for every active webhook subscribed to it
+func (d *Dispatcher) Emit(e Event) {
+	hooks, err := db.GetWebhooks()
+	if err != nil {
+		return
+	}
+	var matched []db.Webhook
+	for _, hook := range hooks {
+		if hook.Active && Matches(hook, e) {
+			matched = append(matched, hook)
+		}
+	}
+	d.queue(matched, e)
+}
+
+// Ping queues a ping event for the webhook and returns its delivery
+func (d *Dispatcher) Ping(hook db.Webhook) (db.WebhookDelivery, error) {
+	deliveries, err := d.queue([]db.Webhook{hook}, Event{Type: Ping})
+	if err != nil {
+		return db.WebhookDelivery{}, err
+	}
+	return deliveries[0], nil
+}
+
+func (d *Dispatcher) queue(hooks []db.Webhook, e Event) ([]db.WebhookDelivery, error) {
+	if len(hooks) == 0 {
+		return nil, nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	now := time.Now()
+	deliveries := make([]db.WebhookDelivery, 0, len(hooks))
+	for _, hook := range hooks {
+		p := Payload{ID: newID(), Webhook: hook.ID, Event: e}
+		body, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, db.WebhookDelivery{
+			ID:          p.ID,
+			WebhookID:   hook.ID,
+			Event:       e.Type,
+			Path:        e.Path,
+			Payload:     string(body),
+			State:       db.DeliveryPending,
+			NextAttempt: now,
+			CreatedAt:   now,
+		})
+	}
+	if err := db.AddDeliveries(deliveries); err != nil {
+		return nil, err
+	}
+	d.signal()
+	return deliveries, nil
+}
+
+// signal wakes the sender if it's waiting
+func (d *Dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run sends due deliveries, then sleeps until the next one is due or an
+// event comes in
+func (d *Dispatcher) run() {
+	for {
+		due, err := db.GetDueDeliveries(time.Now(), batchSize)
+		if err == nil && len(due) > 0 {
+			d.sendAll(due)
+			if len(due) == batchSize {
+				continue
+			}
+		}
+
+		// At least a second, so a database failing to record attempts
+		// doesn't keep it busy
+		wait := time.Minute
+		if next, ok := db.NextDelivery(); ok {
+			wait = max(min(wait, time.Until(next)), time.Second)
+		}
+		select {
+		case <-d.wake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (d *Dispatcher) sendAll(deliveries []db.WebhookDelivery) {
+	sem := make(chan struct{}, senders)
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(dl *db.WebhookDelivery) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			d.send(dl)
+		}(&deliveries[i])
+	}
+	wg.Wait()
+}
+
+// send makes one attempt at a delivery and records how it went
+func (d *Dispatcher) send(dl *db.WebhookDelivery) {
+	hook, err := db.GetWebhook(dl.WebhookID)
+	if err != nil {
+		// Deleted along with its webhook
+		return
+	}
+	now := time.Now()
+	dl.AttemptedAt = &now
+	dl.Attempts++
+	dl.StatusCode, dl.Response, dl.Error = 0, "", ""
+
+	if !hook.Active && dl.Event != Ping {
+		dl.State, dl.Error = db.DeliveryFailed, "Webhook is disabled"
+	} else if err := d.post(hook, dl); err != nil {
+		dl.Error = err.Error()
+		if dl.Attempts >= MaxAttempts {
+			dl.State = db.DeliveryFailed
+			logger.Warn("Giving up on webhook delivery %s to %s: %v", dl.ID, hook.URL, err)
+		} else {
+			dl.NextAttempt = now.Add(Backoff(dl.Attempts))
+		}
+	} else {
+		dl.State = db.DeliveryDelivered
+	}
+	db.SaveDelivery(dl)
+	if dl.State != db.DeliveryPending {
+		db.PruneDeliveries(hook.ID, KeepDeliveries)
+	}
+}
+
+func (d *Dispatcher) post(hook db.Webhook, dl *db.WebhookDelivery) error {
+	body := []byte(dl.Payload)
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "beamdrop/"+config.VERSION)
+	req.Header.Set(EventHeader, dl.Event)
+	req.Header.Set(DeliveryHeader, dl.ID)
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	dl.StatusCode, dl.Response = resp.StatusCode, strings.ToValidUTF8(string(data), "")
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Backoff returns the wait after the given number of failed attempts
+func Backoff(attempts int) time.Duration {
+	delay := RetryDelay
+	for i := 1; i < attempts && delay < MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, MaxRetryDelay)
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
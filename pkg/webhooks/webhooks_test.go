@@ -0,0 +1,255 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tachRoutine/beamdrop-go/config"
+	"github.com/tachRoutine/beamdrop-go/pkg/db"
+	"github.com/tachRoutine/beamdrop-go/pkg/logger"
+)
+
+// TestMain gives the tests a database of their own in a temporary data
+// directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "beamdrop-webhooks-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	config.SetDataDir(dir)
+	logger.SetOutput(io.Discard)
+	if err := db.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	db.AutoMigrate()
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// received is a request that reached a test receiver
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is a local webhook receiver answering every request with status
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []received
+}
+
+func newReceiver(t *testing.T, status int) *receiver {
+	rcv := &receiver{}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rcv.mu.Lock()
+		rcv.requests = append(rcv.requests, received{header: r.Header, body: body})
+		rcv.mu.Unlock()
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "answered %d", status)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (rcv *receiver) received() []received {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return rcv.requests
+}
+
+// subscribe adds an active webhook of url
+func subscribe(t *testing.T, url, secret string) db.Webhook {
+	t.Helper()
+	hook := db.Webhook{URL: url, Secret: secret, Active: true}
+	if err := db.SaveWebhook(&hook); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DeleteWebhook(hook.ID) })
+	return hook
+}
+
+// ping queues a ping for the webhook and makes the first attempt at it
+func ping(t *testing.T, d *Dispatcher, hook db.Webhook) db.WebhookDelivery {
+	t.Helper()
+	dl, err := d.Ping(hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.send(&dl)
+	return dl
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"upload"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := Sign("s3cret", body); got != want {
+		t.Errorf("Sign = %q, want %q", got, want)
+	}
+	if Sign("other", body) == want {
+		t.Error("the signature doesn't depend on the secret")
+	}
+}
+
+func TestDelivery(t *testing.T) {
+	rcv := newReceiver(t, http.StatusNoContent)
+	hook := subscribe(t, rcv.URL, "s3cret")
+	d := NewDispatcher()
+
+	dl := ping(t, d, hook)
+	if dl.State != db.DeliveryDelivered || dl.Attempts != 1 || dl.StatusCode != http.StatusNoContent {
+		t.Errorf("got state %q after %d attempts with status %d", dl.State, dl.Attempts, dl.StatusCode)
+	}
+	reqs := rcv.received()
+	if len(reqs) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(reqs))
+	}
+	req := reqs[0]
+	if got, want := req.header.Get(SignatureHeader), Sign(hook.Secret, req.body); got != want {
+		t.Errorf("%s = %q, want %q", SignatureHeader, got, want)
+	}
+	if string(req.body) != dl.Payload {
+		t.Errorf("body = %s, want the payload %s", req.body, dl.Payload)
+	}
+	if req.header.Get(EventHeader) != Ping || req.header.Get(DeliveryHeader) != dl.ID {
+		t.Errorf("got event %q delivery %q", req.header.Get(EventHeader), req.header.Get(DeliveryHeader))
+	}
+	if ct := req.header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	rcv := newReceiver(t, http.StatusInternalServerError)
+	hook := subscribe(t, rcv.URL, "s3cret")
+	d := NewDispatcher()
+
+	dl := ping(t, d, hook)
+	for n := 1; n < MaxAttempts; n++ {
+		if dl.State != db.DeliveryPending || dl.Attempts != n || dl.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("attempt %d: got state %q, %d attempts, status %d", n, dl.State, dl.Attempts, dl.StatusCode)
+		}
+		if got := dl.NextAttempt.Sub(*dl.AttemptedAt); got != Backoff(n) {
+			t.Errorf("attempt %d: retried after %v, want %v", n, got, Backoff(n))
+		}
+		d.send(&dl)
+	}
+	if dl.State != db.DeliveryFailed || dl.Attempts != MaxAttempts {
+		t.Errorf("after %d attempts: got state %q", dl.Attempts, dl.State)
+	}
+	if n := len(rcv.received()); n != MaxAttempts {
+		t.Errorf("receiver got %d requests, want %d", n, MaxAttempts)
+	}
+
+	// The outcome is recorded, and a failed delivery isn't due anymore
+	saved, err := db.GetDeliveries(hook.ID, db.DeliveryFailed, 10)
+	if err != nil || len(saved) != 1 || saved[0].ID != dl.ID || saved[0].Attempts != MaxAttempts {
+		t.Errorf("recorded failed deliveries: %+v, %v", saved, err)
+	}
+	due, _ := db.GetDueDeliveries(time.Now().Add(24*time.Hour), batchSize)
+	for _, due := range due {
+		if due.ID == dl.ID {
+			t.Error("the failed delivery is still due")
+		}
+	}
+}
+
+func TestRedirectNotFollowed(t *testing.T) {
+	target := newReceiver(t, http.StatusOK)
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+	defer redirect.Close()
+	hook := subscribe(t, redirect.URL, "s3cret")
+
+	dl := ping(t, NewDispatcher(), hook)
+	if dl.State != db.DeliveryPending || dl.StatusCode != http.StatusFound {
+		t.Errorf("got state %q with status %d, want a retry after 302", dl.State, dl.StatusCode)
+	}
+	if n := len(target.received()); n != 0 {
+		t.Errorf("the redirect was followed %d times", n)
+	}
+}
+
+func TestDisabledWebhook(t *testing.T) {
+	rcv := newReceiver(t, http.StatusOK)
+	hook := subscribe(t, rcv.URL, "s3cret")
+	d := NewDispatcher()
+	dl, err := d.queue([]db.Webhook{hook}, Event{Type: Upload, Path: "a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook.Active = false
+	db.SaveWebhook(&hook)
+
+	d.send(&dl[0])
+	if dl[0].State != db.DeliveryFailed || len(rcv.received()) != 0 {
+		t.Errorf("delivery to a disabled webhook: got state %q, %d requests", dl[0].State, len(rcv.received()))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, RetryDelay},
+		{1, RetryDelay},
+		{2, 2 * RetryDelay},
+		{3, 4 * RetryDelay},
+		{6, 32 * RetryDelay},
+		{9, 256 * RetryDelay},
+		{10, MaxRetryDelay},
+		{100, MaxRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		paths  []string
+		e      Event
+		want   bool
+	}{
+		{"everything", nil, nil, Event{Type: Delete, Path: "a/b.txt"}, true},
+		{"subscribed event", []string{Upload, Delete}, nil, Event{Type: Upload, Path: "a.txt"}, true},
+		{"other event", []string{Upload}, nil, Event{Type: Delete, Path: "a.txt"}, false},
+		{"exact path", nil, []string{"docs/a.txt"}, Event{Type: Upload, Path: "docs/a.txt"}, true},
+		{"glob", nil, []string{"*.pdf"}, Event{Type: Upload, Path: "report.pdf"}, true},
+		{"glob doesn't cross directories", nil, []string{"*.pdf"}, Event{Type: Upload, Path: "docs/report.pdf"}, false},
+		{"below a directory", nil, []string{"docs"}, Event{Type: Upload, Path: "docs/sub/a.txt"}, true},
+		{"below a matched directory", nil, []string{"docs/*"}, Event{Type: Upload, Path: "docs/sub/a.txt"}, true},
+		{"sibling prefix", nil, []string{"docs"}, Event{Type: Upload, Path: "docs-old/a.txt"}, false},
+		{"other path", nil, []string{"docs"}, Event{Type: Upload, Path: "photos/a.jpg"}, false},
+		{"moved out", nil, []string{"docs"}, Event{Type: Move, Path: "archive/a.txt", From: "docs/a.txt"}, true},
+		{"moved in", nil, []string{"docs"}, Event{Type: Move, Path: "docs/a.txt", From: "inbox/a.txt"}, true},
+		{"event and path", []string{Upload}, []string{"docs"}, Event{Type: Delete, Path: "docs/a.txt"}, false},
+		{"several patterns", nil, []string{"photos", "*.txt"}, Event{Type: Write, Path: "notes.txt"}, true},
+	}
+	for _, tt := range tests {
+		hook := db.Webhook{Events: tt.events, Paths: tt.paths}
+		if got := Matches(hook, tt.e); got != tt.want {
+			t.Errorf("%s: Matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
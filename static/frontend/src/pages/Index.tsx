@@ -149,7 +149,8 @@ const Index = () => {
   const handleDrop = async (droppedFiles: File[]) => {
     const formData = new FormData();
     droppedFiles.forEach((file) => {
-      formData.append("files", file);
+      // Keep the folder layout of dropped directories
+      formData.append("files", file, file.webkitRelativePath || file.name);
     });
     formData.append("path", currentPath);
 
@@ -251,7 +252,7 @@ const Index = () => {
         await fetchFiles();
         
         // Show appropriate toast message
-        const isStarred = result.starred === "true";
+        const isStarred = result.starred === true;
         toast({
           title: isStarred ? "Starred" : "Unstarred",
           description: `${fileName} ${isStarred ? "added to" : "removed from"} starred files.`,